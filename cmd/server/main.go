@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	_ "time/tzdata" // Embed timezone data for user timezones in minimal images
 
 	"github.com/gabrielhirakawa/lifehub/internal/api"
 	"github.com/gabrielhirakawa/lifehub/internal/database"
@@ -23,6 +25,19 @@ func main() {
 	// Initialize JWT Secret
 	api.InitJWT()
 
+	// Initialize the key encrypting secrets at rest
+	api.InitEncryptionKey()
+	api.EncryptChannelSecrets()
+
+	// Background jobs
+	api.StartAttachmentGC()
+	api.StartReminderScheduler()
+	api.StartDeferredPushWorker()
+	api.StartDigestScheduler()
+	api.StartTodoRollover()
+	api.StartCalendarSync()
+	api.StartCollabCompaction()
+
 	port := ":8080"
 	fmt.Printf("Server starting on port %s...\n", port)
 
@@ -76,6 +91,51 @@ func main() {
 	})
 
 	// --- Widget Routes ---
+	http.HandleFunc("/api/sync", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleSync(w, r)
+	}))
+
+	http.HandleFunc("/api/collab/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		api.HandleCollab(w, r)
+	}))
+
+	http.HandleFunc("/api/events", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleEvents(w, r)
+	}))
+
+	http.HandleFunc("/api/search", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleSearch(w, r)
+	}))
+
+	http.HandleFunc("/api/tags", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleTags(w, r)
+	}))
+
+	// Handle /api/tags/{tag}/items
+	http.HandleFunc("/api/tags/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleTags(w, r)
+	}))
+
 	http.HandleFunc("/api/widgets", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		enableCors(&w, r)
 		if r.Method == http.MethodOptions {
@@ -90,6 +150,32 @@ func main() {
 		if r.Method == http.MethodOptions {
 			return
 		}
+		parts := strings.Split(r.URL.Path, "/")
+		// Handle /api/widgets/{id}/{todos|reminders}/{itemId}/skip
+		if len(parts) == 7 && parts[6] == "skip" {
+			api.HandleSkipOccurrence(w, r)
+			return
+		}
+		// Handle /api/widgets/{id}/import
+		if len(parts) == 5 && parts[4] == "import" {
+			api.HandleImportCalendar(w, r)
+			return
+		}
+		// Handle /api/widgets/{id}/kanban[/...]
+		if len(parts) > 4 && parts[4] == "kanban" {
+			api.HandleWidgetKanban(w, r)
+			return
+		}
+		// Handle /api/widgets/{id}/shares[/{userId}]
+		if len(parts) > 4 && parts[4] == "shares" {
+			api.HandleWidgetShares(w, r)
+			return
+		}
+		// Handle /api/widgets/{id}/todos[/{todoId}]
+		if len(parts) > 4 && parts[4] == "todos" {
+			api.HandleWidgetTodos(w, r)
+			return
+		}
 		// Only handle GET requests here (for fetching by ID)
 		// DELETE requests go to /api/widgets/delete/
 		if r.Method == http.MethodGet {
@@ -116,6 +202,58 @@ func main() {
 		api.HandleDeleteWidget(w, r)
 	}))
 
+	// --- Attachment Routes ---
+	http.HandleFunc("/api/attachments", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleUploadAttachment(w, r)
+	}))
+
+	// Handle /api/attachments/{id}
+	// Not wrapped in AuthMiddleware: attachments of public wiki pages are served anonymously
+	http.HandleFunc("/api/attachments/", func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleGetAttachment(w, r)
+	})
+
+	// --- Settings Routes ---
+	http.HandleFunc("/api/settings", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleSettings(w, r)
+	}))
+
+	http.HandleFunc("/api/settings/notifications", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleNotificationSettings(w, r)
+	}))
+
+	http.HandleFunc("/api/settings/digest", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleDigestSettings(w, r)
+	}))
+
+	http.HandleFunc("/api/digest/today", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleDigestToday(w, r)
+	}))
+
 	// --- Push Notification Routes ---
 	http.HandleFunc("/api/push/vapid-key", func(w http.ResponseWriter, r *http.Request) {
 		enableCors(&w, r)
@@ -141,6 +279,167 @@ func main() {
 		api.HandleSendNotification(w, r)
 	}))
 
+	http.HandleFunc("/api/push/subscriptions", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleListSubscriptions(w, r)
+	}))
+
+	// Handle /api/push/subscriptions/{id}
+	http.HandleFunc("/api/push/subscriptions/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleDeleteSubscription(w, r)
+	}))
+
+	// --- Notification Channel Routes ---
+	http.HandleFunc("/api/notifications/channels", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleNotificationChannels(w, r)
+	}))
+
+	// Handle /api/notifications/channels/{id} and /api/notifications/channels/{id}/test
+	http.HandleFunc("/api/notifications/channels/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleNotificationChannel(w, r)
+	}))
+
+	// --- AI Routes ---
+	http.HandleFunc("/api/ai/keys", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleListAIKeys(w, r)
+	}))
+
+	// Handle /api/ai/keys/{provider}
+	http.HandleFunc("/api/ai/keys/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIKey(w, r)
+	}))
+
+	http.HandleFunc("/api/ai/chat", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIChat(w, r)
+	}))
+
+	http.HandleFunc("/api/ai/models", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIModels(w, r)
+	}))
+
+	http.HandleFunc("/api/ai/conversations", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIConversations(w, r)
+	}))
+
+	// Handle /api/ai/conversations/{id} and /api/ai/conversations/{id}/messages
+	http.HandleFunc("/api/ai/conversations/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIConversation(w, r)
+	}))
+
+	// Handle /api/ai/actions/{id}/apply and /api/ai/actions/{id}/reject
+	http.HandleFunc("/api/ai/actions/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAIAction(w, r)
+	}))
+
+	http.HandleFunc("/api/context", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleDashboardContext(w, r)
+	}))
+
+	http.HandleFunc("/api/audit", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAuditLog(w, r)
+	}))
+
+	// --- Calendar Feed Routes ---
+	http.HandleFunc("/api/ical/token", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleCalendarFeedToken(w, r)
+	}))
+
+	// Handle /ical/{token}.ics (public, the token is the secret)
+	http.HandleFunc("/ical/", api.HandleCalendarFeed)
+
+	http.HandleFunc("/api/calendar/subscriptions", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleCalendarSubscriptions(w, r)
+	}))
+
+	http.HandleFunc("/api/calendar/subscriptions/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleCalendarSubscription(w, r)
+	}))
+
+	// --- API Token Routes ---
+	http.HandleFunc("/api/tokens", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleAPITokens(w, r)
+	}))
+
+	http.HandleFunc("/api/tokens/", api.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w, r)
+		if r.Method == http.MethodOptions {
+			return
+		}
+		api.HandleDeleteAPIToken(w, r)
+	}))
+
+	// --- CalDAV Routes ---
+	// DAV clients authenticate with Basic auth (password or API token)
+	http.HandleFunc("/dav/", api.BasicAuthMiddleware("LifeHub", api.HandleCalDAV))
+	http.HandleFunc("/.well-known/caldav", api.HandleCalDAVWellKnown)
+
 	// --- Static Files (Frontend) ---
 	// Serve static files from the "dist" directory
 	// This handles SPA routing by serving index.html for non-file requests
@@ -174,8 +473,8 @@ func enableCors(w *http.ResponseWriter, r *http.Request) {
 		(*w).Header().Set("Access-Control-Allow-Origin", origin)
 	}
 
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, Last-Event-ID")
 	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
 }
 
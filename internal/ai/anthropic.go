@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AnthropicBaseURL is the default endpoint of the Anthropic API.
+const AnthropicBaseURL = "https://api.anthropic.com/v1"
+
+// Anthropic streams completions from the Messages API.
+type Anthropic struct {
+	APIKey  string
+	BaseURL string
+}
+
+func (p *Anthropic) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Response, error) {
+	payload := map[string]any{
+		"model":      req.Model,
+		"system":     req.System,
+		"messages":   req.Messages,
+		"max_tokens": req.MaxTokens,
+		"stream":     true,
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]any{
+				"name":         t.Name,
+				"description":  t.Description,
+				"input_schema": t.Parameters,
+			})
+		}
+		payload["tools"] = tools
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.BaseURL, "/")+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.APIKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse("Anthropic", resp); err != nil {
+		return Response{}, err
+	}
+
+	var usage Usage
+	toolCalls := partialToolCalls{}
+	err = readSSE(resp.Body, func(event, data string) error {
+		var ev struct {
+			Type         string `json:"type"`
+			Index        int    `json:"index"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("Anthropic: invalid stream event: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				toolCalls.add(ev.Index, ev.ContentBlock.ID, ev.ContentBlock.Name, "")
+			}
+		case "content_block_delta":
+			if ev.Delta.Type == "input_json_delta" {
+				toolCalls.add(ev.Index, "", "", ev.Delta.PartialJSON)
+			} else if ev.Delta.Text != "" {
+				return onDelta(ev.Delta.Text)
+			}
+		case "message_delta":
+			usage.OutputTokens = ev.Usage.OutputTokens
+		case "error":
+			return &Error{Provider: "Anthropic", Message: ev.Error.Message}
+		}
+		return nil
+	})
+	return Response{Usage: usage, ToolCalls: toolCalls.calls()}, err
+}
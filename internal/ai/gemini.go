@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GeminiBaseURL is the default endpoint of the Gemini API.
+const GeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// Gemini streams completions from the Generative Language API.
+type Gemini struct {
+	APIKey  string
+	BaseURL string
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text         string `json:"text,omitempty"`
+	FunctionCall *struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall,omitempty"`
+}
+
+func (p *Gemini) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Response, error) {
+	contents := make([]geminiContent, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		role := "user"
+		if m.Role == RoleAssistant {
+			role = "model"
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: []geminiPart{{Text: m.Content}}})
+	}
+
+	payload := map[string]any{
+		"contents": contents,
+		"generationConfig": map[string]any{
+			"maxOutputTokens": req.MaxTokens,
+		},
+	}
+	if req.System != "" {
+		payload["systemInstruction"] = geminiContent{Parts: []geminiPart{{Text: req.System}}}
+	}
+	if len(req.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			declarations = append(declarations, map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			})
+		}
+		payload["tools"] = []map[string]any{{"functionDeclarations": declarations}}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", strings.TrimRight(p.BaseURL, "/"), url.PathEscape(req.Model))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.APIKey)
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse("Gemini", resp); err != nil {
+		return Response{}, err
+	}
+
+	var usage Usage
+	var toolCalls []ToolCall
+	err = readSSE(resp.Body, func(_, data string) error {
+		var chunk struct {
+			Candidates []struct {
+				Content geminiContent `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata *struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("Gemini: invalid stream chunk: %w", err)
+		}
+		if chunk.UsageMetadata != nil {
+			usage = Usage{InputTokens: chunk.UsageMetadata.PromptTokenCount, OutputTokens: chunk.UsageMetadata.CandidatesTokenCount}
+		}
+		for _, c := range chunk.Candidates {
+			for _, part := range c.Content.Parts {
+				// Gemini sends function calls whole, never split across chunks
+				if part.FunctionCall != nil {
+					args := part.FunctionCall.Args
+					if len(args) == 0 {
+						args = json.RawMessage(`{}`)
+					}
+					toolCalls = append(toolCalls, ToolCall{Name: part.FunctionCall.Name, Arguments: args})
+				}
+				if part.Text != "" {
+					if err := onDelta(part.Text); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return Response{Usage: usage, ToolCalls: toolCalls}, err
+}
@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenAIBaseURL is the default endpoint of the OpenAI API.
+const OpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI streams completions from the Chat Completions API. It also serves
+// OpenAI-compatible servers such as Ollama, llama.cpp or LM Studio.
+type OpenAI struct {
+	APIKey  string
+	BaseURL string
+	Name    string // Used in error messages, defaults to "OpenAI"
+}
+
+func (p *OpenAI) name() string {
+	if p.Name == "" {
+		return "OpenAI"
+	}
+	return p.Name
+}
+
+func (p *OpenAI) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(p.BaseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	return req, nil
+}
+
+func (p *OpenAI) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Response, error) {
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	messages = append(messages, req.Messages...)
+
+	payload := map[string]any{
+		"model":          req.Model,
+		"messages":       messages,
+		"max_tokens":     req.MaxTokens,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name":        t.Name,
+					"description": t.Description,
+					"parameters":  t.Parameters,
+				},
+			})
+		}
+		payload["tools"] = tools
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := p.newRequest(ctx, http.MethodPost, "/chat/completions", body)
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(p.name(), resp); err != nil {
+		return Response{}, err
+	}
+
+	var usage Usage
+	toolCalls := partialToolCalls{}
+	err = readSSE(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("%s: invalid stream chunk: %w", p.name(), err)
+		}
+		if chunk.Usage != nil {
+			usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		for _, c := range chunk.Choices {
+			for _, tc := range c.Delta.ToolCalls {
+				toolCalls.add(tc.Index, tc.ID, tc.Function.Name, tc.Function.Arguments)
+			}
+			if c.Delta.Content != "" {
+				if err := onDelta(c.Delta.Content); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return Response{Usage: usage, ToolCalls: toolCalls.calls()}, err
+}
+
+// ListModels returns the model IDs served by the /models endpoint.
+func (p *OpenAI) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := p.newRequest(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(p.name(), resp); err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("%s: invalid model list: %w", p.name(), err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	sort.Strings(models)
+	return models, nil
+}
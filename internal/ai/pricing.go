@@ -0,0 +1,42 @@
+package ai
+
+import "strings"
+
+// Price is the cost of a model in US dollars per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// prices lists the public list prices of the models offered in the AI Coach
+// settings, keyed by model name prefix. Models not listed (including local
+// ones) are considered free.
+var prices = map[string]Price{
+	"gpt-4o-mini":           {Input: 0.15, Output: 0.60},
+	"gpt-4o":                {Input: 2.50, Output: 10.00},
+	"gpt-3.5-turbo":         {Input: 0.50, Output: 1.50},
+	"claude-3-haiku":        {Input: 0.25, Output: 1.25},
+	"claude-3-5-sonnet":     {Input: 3.00, Output: 15.00},
+	"gemini-2.5-flash":      {Input: 0.30, Output: 2.50},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.30},
+	"gemini-2.0-flash":      {Input: 0.10, Output: 0.40},
+}
+
+// EstimateCost returns the approximate cost in US dollars of a request.
+// The provider matters because a local server may serve a model under the
+// name of a paid one.
+func EstimateCost(provider, model string, usage Usage) float64 {
+	if provider == ProviderOpenAICompatible {
+		return 0
+	}
+
+	// Longest matching prefix, so gpt-4o-mini isn't billed as gpt-4o
+	var price Price
+	matched := 0
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			price, matched = p, len(prefix)
+		}
+	}
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1e6
+}
@@ -0,0 +1,171 @@
+// Package ai talks to the LLM providers used by the AI Coach.
+// Calls are made server-side so API keys never reach the browser.
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/config"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// Provider names, matching AIProvider in web/types.ts.
+const (
+	ProviderGemini    = "gemini"
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	// ProviderOpenAICompatible is any server implementing the OpenAI Chat
+	// Completions API at a user-configured URL: Ollama, llama.cpp, LM Studio...
+	ProviderOpenAICompatible = "openai-compatible"
+)
+
+// Message roles.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is a provider independent chat completion request.
+type ChatRequest struct {
+	Model     string
+	System    string
+	Messages  []Message
+	MaxTokens int
+	Tools     []Tool // Functions the model may ask to call
+}
+
+// Usage reports the tokens consumed by a request, when the provider returns it.
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// Response is the outcome of a streamed request, once complete.
+type Response struct {
+	Usage     Usage
+	ToolCalls []ToolCall
+}
+
+// Provider streams chat completions from an LLM API.
+// onDelta is called with each text fragment as it arrives; returning an error
+// from it aborts the stream.
+type Provider interface {
+	Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Response, error)
+}
+
+// ModelLister is implemented by providers able to list their models.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// Config selects and configures a provider.
+type Config struct {
+	Provider string
+	APIKey   string
+	BaseURL  string // Required for ProviderOpenAICompatible, ignored otherwise
+}
+
+// DefaultMaxTokens mirrors the limit used by the frontend adapters.
+const DefaultMaxTokens = 300
+
+// httpClient is shared by the providers. No overall timeout since responses
+// are streamed; callers bound requests with their context. Local servers may
+// take a while to load a model before answering, hence the long header timeout,
+// but an unreachable host fails fast.
+var httpClient = newHTTPClient(config.AllowLocalAIServers())
+
+// newHTTPClient returns the client of the providers. Unless allowLocal is
+// set, it refuses the addresses of the local network like the other clients
+// reaching user supplied URLs.
+func newHTTPClient(allowLocal bool) *http.Client {
+	if allowLocal {
+		return &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 2 * time.Minute,
+			},
+		}
+	}
+	client := safehttp.NewClient(0)
+	transport := client.Transport.(*http.Transport)
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = 2 * time.Minute
+	return client
+}
+
+// DefaultModel returns the model used when the user didn't pick one.
+// There is no default for OpenAI-compatible servers, which serve whatever the
+// user installed.
+func DefaultModel(provider string) string {
+	switch provider {
+	case ProviderOpenAI:
+		return "gpt-4o-mini"
+	case ProviderAnthropic:
+		return "claude-3-haiku-20240307"
+	case ProviderOpenAICompatible:
+		return ""
+	default:
+		return "gemini-2.5-flash"
+	}
+}
+
+// IsKnownProvider reports whether the name is a supported provider.
+func IsKnownProvider(provider string) bool {
+	switch provider {
+	case ProviderGemini, ProviderOpenAI, ProviderAnthropic, ProviderOpenAICompatible:
+		return true
+	}
+	return false
+}
+
+// RequiresAPIKey reports whether the provider can't be used without a key.
+// Local servers usually don't check keys.
+func RequiresAPIKey(provider string) bool {
+	return provider != ProviderOpenAICompatible
+}
+
+// ValidateBaseURL checks the base URL of an OpenAI-compatible server, e.g.
+// http://localhost:11434/v1 for Ollama. Addresses of the local network are
+// refused unless LIFEHUB_AI_ALLOW_LOCAL is set.
+func ValidateBaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base URL %q", raw)
+	}
+	if config.AllowLocalAIServers() {
+		return nil
+	}
+	return safehttp.ValidateURL(raw)
+}
+
+// NewProvider returns the client of the configured provider.
+func NewProvider(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderGemini:
+		return &Gemini{APIKey: cfg.APIKey, BaseURL: GeminiBaseURL}, nil
+	case ProviderOpenAI:
+		return &OpenAI{APIKey: cfg.APIKey, BaseURL: OpenAIBaseURL}, nil
+	case ProviderAnthropic:
+		return &Anthropic{APIKey: cfg.APIKey, BaseURL: AnthropicBaseURL}, nil
+	case ProviderOpenAICompatible:
+		if err := ValidateBaseURL(cfg.BaseURL); err != nil {
+			return nil, err
+		}
+		return &OpenAI{APIKey: cfg.APIKey, BaseURL: cfg.BaseURL, Name: "OpenAI-compatible server"}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", cfg.Provider)
+	}
+}
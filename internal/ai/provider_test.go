@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// provider serves handler and makes the providers reach it with the client
+// of the test server, as theirs refuses local addresses.
+func provider(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = client })
+	return srv
+}
+
+func TestValidateBaseURL(t *testing.T) {
+	for _, raw := range []string{"", "localhost:11434", "ftp://example.com/v1", "http:///v1"} {
+		if err := ValidateBaseURL(raw); err == nil {
+			t.Errorf("ValidateBaseURL(%q) succeeded", raw)
+		}
+	}
+	if err := ValidateBaseURL("https://llm.example.com/v1"); err != nil {
+		t.Errorf("ValidateBaseURL() = %v", err)
+	}
+
+	local := []string{"http://127.0.0.1:11434/v1", "http://192.168.1.10:8080/v1", "http://169.254.169.254/latest", "http://[::1]:11434/v1"}
+	for _, raw := range local {
+		if err := ValidateBaseURL(raw); !errors.Is(err, safehttp.ErrForbiddenAddress) {
+			t.Errorf("ValidateBaseURL(%q) = %v, want %v", raw, err, safehttp.ErrForbiddenAddress)
+		}
+	}
+	t.Setenv("LIFEHUB_AI_ALLOW_LOCAL", "true")
+	for _, raw := range local {
+		if err := ValidateBaseURL(raw); err != nil {
+			t.Errorf("ValidateBaseURL(%q) = %v with local servers allowed", raw, err)
+		}
+	}
+}
+
+func TestHTTPClientLocalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"llama3"}]}`))
+	}))
+	defer srv.Close()
+	// Host names are checked once resolved
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/models", nil)
+	if _, err := newHTTPClient(false).Do(req); !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("Do() = %v, want %v", err, safehttp.ErrForbiddenAddress)
+	}
+
+	resp, err := newHTTPClient(true).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestProviderErrorsHideMessages(t *testing.T) {
+	const secret = "quota of project acme-internal-42 exceeded"
+	srv := provider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"` + secret + `"}}`))
+	})
+
+	p := &OpenAI{BaseURL: srv.URL, Name: "OpenAI-compatible server"}
+	_, err := p.ListModels(context.Background())
+	var providerErr *Error
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("ListModels() = %v, want an *Error", err)
+	}
+	if providerErr.StatusCode != http.StatusTooManyRequests || !strings.Contains(err.Error(), secret) {
+		t.Errorf("error = %+v, want the status and message of the provider", providerErr)
+	}
+	if got, want := providerErr.Public(), "OpenAI-compatible server error: 429 Too Many Requests"; got != want {
+		t.Errorf("Public() = %q, want %q", got, want)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	srv := provider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12}}}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n" +
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded on node 7\"}}\n\n"))
+	})
+
+	var text strings.Builder
+	p := &Anthropic{APIKey: "key", BaseURL: srv.URL}
+	resp, err := p.Stream(context.Background(), ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "Hi"}}}, func(s string) error {
+		text.WriteString(s)
+		return nil
+	})
+	var providerErr *Error
+	if !errors.As(err, &providerErr) || providerErr.Public() != "Anthropic error" {
+		t.Fatalf("Stream() = %v, want a provider error", err)
+	}
+	// What arrived before the error is kept
+	if text.String() != "Hel" || resp.Usage.InputTokens != 12 {
+		t.Errorf("text %q, usage %+v", text.String(), resp.Usage)
+	}
+}
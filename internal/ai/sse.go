@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// readSSE parses a text/event-stream body and calls fn for every event.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// Error is an error reported by a provider. Its message comes from the
+// provider and may repeat parts of the request, so it is meant for the logs:
+// users are shown Public.
+type Error struct {
+	Provider   string
+	StatusCode int // 0 for errors reported within a stream
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s error: %s", e.Provider, e.Message)
+}
+
+// Public describes the error without the provider's message.
+func (e *Error) Public() string {
+	if e.StatusCode == 0 {
+		return e.Provider + " error"
+	}
+	return fmt.Sprintf("%s error: %d %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// checkResponse turns a non-2xx provider response into an *Error,
+// extracting the provider's message when the body is JSON.
+func checkResponse(provider string, resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err := &Error{Provider: provider, StatusCode: resp.StatusCode, Message: resp.Status}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error.Message != "" {
+		err.Message = parsed.Error.Message
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Tool is a function offered to the model. Parameters is a JSON Schema
+// object; keep to the subset understood by every provider (no
+// additionalProperties, no $ref).
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+}
+
+// ToolCall is a function call requested by the model. Arguments is a JSON
+// object, not yet validated.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// partialToolCalls assembles tool calls streamed in fragments, keyed by the
+// index given by the provider.
+type partialToolCalls map[int]*struct {
+	id, name string
+	args     []byte
+}
+
+func (p partialToolCalls) add(index int, id, name, args string) {
+	call, ok := p[index]
+	if !ok {
+		call = &struct {
+			id, name string
+			args     []byte
+		}{}
+		p[index] = call
+	}
+	if id != "" {
+		call.id = id
+	}
+	if name != "" {
+		call.name = name
+	}
+	call.args = append(call.args, args...)
+}
+
+func (p partialToolCalls) calls() []ToolCall {
+	indexes := make([]int, 0, len(p))
+	for i := range p {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var calls []ToolCall
+	for _, i := range indexes {
+		c := p[i]
+		args := json.RawMessage(c.args)
+		if len(args) == 0 || !json.Valid(args) {
+			args = json.RawMessage(`{}`)
+		}
+		calls = append(calls, ToolCall{ID: c.id, Name: c.name, Arguments: args})
+	}
+	return calls
+}
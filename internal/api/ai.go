@@ -0,0 +1,556 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/ai"
+	"github.com/gabrielhirakawa/lifehub/internal/dashboard"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+const (
+	// aiChatTimeout bounds a whole streamed answer.
+	aiChatTimeout = 2 * time.Minute
+	// aiLocalChatTimeout is used for self-hosted servers, which may have to
+	// load the model and run on modest hardware.
+	aiLocalChatTimeout = 5 * time.Minute
+	// aiModelsTimeout bounds model listing.
+	aiModelsTimeout = 15 * time.Second
+	// aiHistoryLimit is the number of previous messages sent along a question.
+	aiHistoryLimit = 20
+)
+
+// aiDefaultQuestions is sent when the user just asks for an analysis.
+var aiDefaultQuestions = map[string]string{
+	"en-us": "Analyze my dashboard.",
+	"pt-br": "Analise meu painel.",
+}
+
+type AIKeyRequest struct {
+	APIKey  string `json:"apiKey"`
+	BaseURL string `json:"baseUrl,omitempty"` // OpenAI-compatible servers only
+}
+
+// AIChatRequest is a question to the AI Coach. Without a conversation ID a
+// new conversation is started, attached to WidgetID if given.
+type AIChatRequest struct {
+	Provider       string `json:"provider"`
+	Model          string `json:"model,omitempty"`
+	Language       string `json:"language,omitempty"`
+	Message        string `json:"message"`
+	ConversationID string `json:"conversationId,omitempty"`
+	WidgetID       string `json:"widgetId,omitempty"`
+	// Tools lets the model propose widget actions. Defaults to true, except
+	// for OpenAI-compatible servers: many local models don't support tools.
+	Tools *bool `json:"tools,omitempty"`
+}
+
+// HandleListAIKeys returns which providers have a stored key.
+// Route: GET /api/ai/keys
+func HandleListAIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := database.ListAIKeys(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch AI keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// HandleAIKey stores or removes the API key of a provider, and the base URL
+// of OpenAI-compatible servers. Keys are encrypted at rest and never returned.
+// Routes: PUT /api/ai/keys/{provider}, DELETE /api/ai/keys/{provider}
+func HandleAIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "ai", "keys", "{provider}"]
+	if len(parts) < 5 || !ai.IsKnownProvider(parts[4]) {
+		http.Error(w, "Unknown AI provider", http.StatusBadRequest)
+		return
+	}
+	provider := parts[4]
+
+	switch r.Method {
+	case http.MethodPut:
+		var req AIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.APIKey = strings.TrimSpace(req.APIKey)
+		req.BaseURL = strings.TrimSpace(req.BaseURL)
+
+		if provider == ai.ProviderOpenAICompatible {
+			if err := ai.ValidateBaseURL(req.BaseURL); err != nil {
+				if errors.Is(err, safehttp.ErrForbiddenAddress) {
+					http.Error(w, "Local addresses are not allowed, see LIFEHUB_AI_ALLOW_LOCAL", http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "Invalid base URL", http.StatusBadRequest)
+				return
+			}
+		} else {
+			req.BaseURL = ""
+			if req.APIKey == "" {
+				http.Error(w, "API key required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := storeAIKey(userID, provider, req.APIKey, req.BaseURL); err != nil {
+			log.Println("Error saving AI key:", err)
+			http.Error(w, "Failed to save AI key", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"saved"}`))
+
+	case http.MethodDelete:
+		if err := database.DeleteAIKey(userID, provider); err != nil {
+			http.Error(w, "Failed to delete AI key", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAIChat answers a question about the user's dashboard, streaming the
+// provider's response as Server-Sent Events:
+//
+//	event: start  data: {"conversationId": "...", "messageId": 1}
+//	event: delta  data: {"text": "..."}
+//	event: done   data: {"messageId": 2, "text": "...", "usage": {...}, "costUsd": 0.0001, "actions": [...]}
+//	event: error  data: {"error": "...", "messageId": 2}
+//
+// The question and the answer are stored in the conversation. An answer cut
+// short by an error is stored as far as it went, with the tokens it used,
+// and the error carries its messageId. Actions the model proposed through
+// tool calls wait for the user's confirmation, see HandleAIAction.
+//
+// Route: POST /api/ai/chat
+func HandleAIChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Provider == "" {
+		req.Provider = ai.ProviderGemini
+	}
+	if !ai.IsKnownProvider(req.Provider) {
+		http.Error(w, "Unknown AI provider", http.StatusBadRequest)
+		return
+	}
+	req.Language = dashboard.NormalizeLanguage(req.Language)
+	if req.Model == "" {
+		req.Model = ai.DefaultModel(req.Provider)
+	}
+	if req.Model == "" {
+		http.Error(w, "Model required", http.StatusBadRequest)
+		return
+	}
+
+	provider, ok := aiProviderForUser(w, userID, req.Provider)
+	if !ok {
+		return
+	}
+
+	question := strings.TrimSpace(req.Message)
+	if question == "" {
+		question = aiDefaultQuestions[req.Language]
+	}
+
+	var conv *models.AIConversation
+	if req.ConversationID != "" {
+		conv, err = database.GetAIConversation(userID, req.ConversationID)
+	} else {
+		if !aiConversationWidget(w, userID, req.WidgetID) {
+			return
+		}
+		conv, err = database.CreateAIConversation(userID, req.WidgetID, database.ConversationTitle(question))
+	}
+	if err != nil {
+		http.Error(w, "Failed to load conversation", http.StatusInternalServerError)
+		return
+	}
+	if conv == nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	history, _, err := database.GetAIMessages(conv.ID, 0, aiHistoryLimit)
+	if err != nil {
+		http.Error(w, "Failed to load conversation", http.StatusInternalServerError)
+		return
+	}
+
+	dashboardContext, err := buildDashboardContext(userID, req.Language, dashboard.DefaultTokenBudget)
+	if err != nil {
+		http.Error(w, "Failed to build context", http.StatusInternalServerError)
+		return
+	}
+
+	chatReq := ai.ChatRequest{
+		Model:     req.Model,
+		System:    dashboard.TermsFor(req.Language).SystemPrompt + "\n\n" + dashboardContext,
+		Messages:  aiChatMessages(history, question),
+		MaxTokens: ai.DefaultMaxTokens,
+	}
+	useTools := req.Provider != ai.ProviderOpenAICompatible
+	if req.Tools != nil {
+		useTools = *req.Tools
+	}
+	if useTools {
+		chatReq.Tools = aiToolDefinitions()
+		chatReq.System = dashboard.TermsFor(req.Language).SystemPrompt + " " + aiToolsPrompt[req.Language] + "\n\n" + dashboardContext
+	}
+
+	userMsg := models.AIMessage{ConversationID: conv.ID, Role: models.AIRoleUser, Text: question}
+	if err := database.AddAIMessage(&userMsg); err != nil {
+		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	timeout := aiChatTimeout
+	if req.Provider == ai.ProviderOpenAICompatible {
+		timeout = aiLocalChatTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	writeSSE(w, flusher, "", "start", map[string]any{"conversationId": conv.ID, "messageId": userMsg.ID})
+
+	var answer strings.Builder
+	resp, err := provider.Stream(ctx, chatReq, func(text string) error {
+		answer.WriteString(text)
+		return writeSSE(w, flusher, "", "delta", map[string]string{"text": text})
+	})
+	if err != nil {
+		log.Printf("AI chat (%s) failed: %v\n", req.Provider, err)
+		data := map[string]any{"error": aiErrorMessage(err)}
+		// Keep the partial answer and account for the tokens it cost
+		if answer.Len() > 0 || resp.Usage != (ai.Usage{}) {
+			partial := models.AIMessage{
+				ConversationID: conv.ID,
+				Role:           models.AIRoleModel,
+				Text:           answer.String(),
+				Provider:       req.Provider,
+				Model:          req.Model,
+				InputTokens:    resp.Usage.InputTokens,
+				OutputTokens:   resp.Usage.OutputTokens,
+				CostUSD:        ai.EstimateCost(req.Provider, req.Model, resp.Usage),
+			}
+			if err := database.AddAIMessage(&partial); err != nil {
+				log.Println("Error saving AI answer:", err)
+			} else {
+				data["messageId"] = partial.ID
+			}
+		}
+		writeSSE(w, flusher, "", "error", data)
+		return
+	}
+
+	var actions []models.AIAction
+	if useTools {
+		if actions, err = proposeAIActions(userID, resp.ToolCalls, req.Language); err != nil {
+			log.Println("Error proposing AI actions:", err)
+		}
+	}
+
+	text := answer.String()
+	if strings.TrimSpace(text) == "" && len(actions) > 0 {
+		// Models often call tools without a word; the proposals are the answer
+		var summaries []string
+		for _, a := range actions {
+			summaries = append(summaries, "- "+a.Summary)
+		}
+		text = strings.Join(summaries, "\n")
+	}
+
+	modelMsg := models.AIMessage{
+		ConversationID: conv.ID,
+		Role:           models.AIRoleModel,
+		Text:           text,
+		Provider:       req.Provider,
+		Model:          req.Model,
+		InputTokens:    resp.Usage.InputTokens,
+		OutputTokens:   resp.Usage.OutputTokens,
+		CostUSD:        ai.EstimateCost(req.Provider, req.Model, resp.Usage),
+	}
+	if err := database.AddAIMessage(&modelMsg); err != nil {
+		log.Println("Error saving AI answer:", err)
+	}
+	for _, action := range actions {
+		action.ConversationID = conv.ID
+		action.MessageID = modelMsg.ID
+		if err := database.CreateAIAction(userID, &action); err != nil {
+			log.Println("Error saving AI action:", err)
+			continue
+		}
+		modelMsg.Actions = append(modelMsg.Actions, action)
+	}
+
+	writeSSE(w, flusher, "", "done", map[string]any{
+		"messageId": modelMsg.ID,
+		"text":      modelMsg.Text,
+		"usage":     resp.Usage,
+		"costUsd":   modelMsg.CostUSD,
+		"actions":   modelMsg.Actions,
+	})
+}
+
+// HandleAIModels lists the models available from a configured provider,
+// e.g. the models pulled in a local Ollama.
+// Route: GET /api/ai/models?provider=openai-compatible
+func HandleAIModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name := r.URL.Query().Get("provider")
+	if !ai.IsKnownProvider(name) {
+		http.Error(w, "Unknown AI provider", http.StatusBadRequest)
+		return
+	}
+
+	provider, ok := aiProviderForUser(w, userID, name)
+	if !ok {
+		return
+	}
+	lister, ok := provider.(ai.ModelLister)
+	if !ok {
+		http.Error(w, "Model listing not supported for "+name, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), aiModelsTimeout)
+	defer cancel()
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		log.Printf("AI models (%s) failed: %v\n", name, err)
+		http.Error(w, "Failed to list models: "+aiErrorMessage(err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models)
+}
+
+// newAIProvider builds provider clients, replaced in tests.
+var newAIProvider = ai.NewProvider
+
+// aiProviderForUser builds the provider client from the user's stored
+// configuration, writing the HTTP error when it can't.
+func aiProviderForUser(w http.ResponseWriter, userID int, name string) (ai.Provider, bool) {
+	cfg, err := loadAIConfig(userID, name)
+	if err != nil {
+		log.Println("Error loading AI key:", err)
+		http.Error(w, "Failed to load AI key", http.StatusInternalServerError)
+		return nil, false
+	}
+	if cfg == nil || (cfg.APIKey == "" && ai.RequiresAPIKey(name)) {
+		http.Error(w, "No API key configured for "+name, http.StatusBadRequest)
+		return nil, false
+	}
+
+	provider, err := newAIProvider(*cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return provider, true
+}
+
+// aiErrorMessage describes a failed provider request to the user. Messages
+// of the provider and of the network are only logged: they may reveal the
+// request or the hosts of the server's network.
+func aiErrorMessage(err error) string {
+	var providerErr *ai.Error
+	switch {
+	case errors.As(err, &providerErr):
+		return providerErr.Public()
+	case errors.Is(err, safehttp.ErrForbiddenAddress):
+		return "AI server address not allowed"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "AI provider timed out"
+	default:
+		return "AI provider request failed"
+	}
+}
+
+// aiChatMessages converts the conversation history plus the new question
+// into provider messages.
+func aiChatMessages(history []models.AIMessage, question string) []ai.Message {
+	var messages []ai.Message
+	add := func(role, text string) {
+		// Providers require alternating roles; a question left unanswered
+		// by a failed request is merged with the next one.
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content += "\n\n" + text
+			return
+		}
+		messages = append(messages, ai.Message{Role: role, Content: text})
+	}
+
+	for _, m := range history {
+		role := ai.RoleUser
+		if m.Role == models.AIRoleModel {
+			role = ai.RoleAssistant
+		}
+		// Providers require the conversation to start with the user
+		if (len(messages) == 0 && role != ai.RoleUser) || strings.TrimSpace(m.Text) == "" {
+			continue
+		}
+		add(role, m.Text)
+	}
+	add(ai.RoleUser, question)
+	return messages
+}
+
+// storeAIKey encrypts and stores a provider key. An empty key or base URL
+// keeps the stored value.
+func storeAIKey(userID int, provider, apiKey, baseURL string) error {
+	existing, err := database.GetAIKey(userID, provider)
+	if err != nil {
+		return err
+	}
+
+	var key database.AIKey
+	if existing != nil {
+		key = *existing
+	}
+	if apiKey != "" {
+		if key.EncryptedKey, err = encryptSecret(apiKey); err != nil {
+			return err
+		}
+	}
+	if baseURL != "" {
+		key.BaseURL = baseURL
+	}
+	return database.SaveAIKey(userID, provider, key)
+}
+
+// loadAIConfig returns the decrypted provider configuration, or nil if the
+// user didn't configure the provider.
+func loadAIConfig(userID int, provider string) (*ai.Config, error) {
+	key, err := database.GetAIKey(userID, provider)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	cfg := &ai.Config{Provider: provider, BaseURL: key.BaseURL}
+	if key.EncryptedKey != "" {
+		if cfg.APIKey, err = decryptSecret(key.EncryptedKey); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// sanitizeAIWidgetContent prepares AI_ASSISTANT widget content for storage:
+// the chat history lives in ai_messages and the API key in the encrypted key
+// store, so neither is kept in the widget.
+func sanitizeAIWidgetContent(userID int, content json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return content, nil
+	}
+	if _, ok := fields["chatHistory"]; ok {
+		delete(fields, "chatHistory")
+		content, _ = json.Marshal(fields)
+	}
+	return extractAIKey(userID, content)
+}
+
+// extractAIKey moves aiConfig.apiKey out of AI_ASSISTANT widget content into
+// the encrypted key store, returning the content without the key.
+func extractAIKey(userID int, content json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil || fields["aiConfig"] == nil {
+		return content, nil
+	}
+
+	var aiConfig map[string]json.RawMessage
+	if err := json.Unmarshal(fields["aiConfig"], &aiConfig); err != nil {
+		return content, nil
+	}
+	if _, ok := aiConfig["apiKey"]; !ok {
+		return content, nil
+	}
+
+	var cfg models.AIConfig
+	json.Unmarshal(fields["aiConfig"], &cfg)
+	if cfg.APIKey != "" {
+		if cfg.Provider == "" {
+			cfg.Provider = ai.ProviderGemini
+		}
+		if !ai.IsKnownProvider(cfg.Provider) {
+			return nil, fmt.Errorf("unknown AI provider %q", cfg.Provider)
+		}
+		if err := storeAIKey(userID, cfg.Provider, cfg.APIKey, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	delete(aiConfig, "apiKey")
+	stripped, err := json.Marshal(aiConfig)
+	if err != nil {
+		return nil, err
+	}
+	fields["aiConfig"] = stripped
+	return json.Marshal(fields)
+}
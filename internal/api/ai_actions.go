@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// HandleAIAction confirms or rejects an action proposed by the AI Coach.
+// A confirmed action is applied to its widget and recorded in the audit log.
+// The updated action is returned; an action is resolved only once.
+// Routes: POST /api/ai/actions/{id}/apply, POST /api/ai/actions/{id}/reject
+func HandleAIAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "ai", "actions", "{id}", "apply"|"reject"]
+	if len(parts) < 6 || parts[4] == "" {
+		http.Error(w, "Action ID required", http.StatusBadRequest)
+		return
+	}
+	id, verb := parts[4], parts[5]
+
+	status := ""
+	switch verb {
+	case "apply":
+		status = models.AIActionApplying
+	case "reject":
+		status = models.AIActionRejected
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	action, err := database.GetAIAction(userID, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch action", http.StatusInternalServerError)
+		return
+	}
+	if action == nil {
+		http.Error(w, "Action not found", http.StatusNotFound)
+		return
+	}
+
+	claimed, err := database.ClaimAIAction(userID, id, status)
+	if err != nil {
+		http.Error(w, "Failed to update action", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		http.Error(w, "Action already "+action.Status, http.StatusConflict)
+		return
+	}
+
+	if verb == "apply" {
+		status = models.AIActionApplied
+		errMsg := ""
+		if err := applyAIAction(userID, action); err != nil {
+			log.Printf("AI action %s failed: %v\n", action.ID, err)
+			status, errMsg = models.AIActionFailed, err.Error()
+		} else if err := database.AddAuditEntry(userID, "ai."+action.Tool, action.WidgetID, map[string]any{
+			"actionId":       action.ID,
+			"conversationId": action.ConversationID,
+			"arguments":      action.Arguments,
+			"summary":        action.Summary,
+		}); err != nil {
+			log.Println("Error adding audit entry:", err)
+		}
+		if err := database.FinishAIAction(action.ID, status, errMsg); err != nil {
+			log.Println("Error updating AI action:", err)
+		}
+	}
+
+	action, err = database.GetAIAction(userID, id)
+	if err != nil || action == nil {
+		http.Error(w, "Failed to fetch action", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(action)
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	aiMessagesPageSize    = 50
+	aiMessagesMaxPageSize = 200
+)
+
+type AIConversationRequest struct {
+	Title    string `json:"title"`
+	WidgetID string `json:"widgetId,omitempty"`
+}
+
+type AIMessagesPage struct {
+	Messages []models.AIMessage `json:"messages"`
+	HasMore  bool               `json:"hasMore"`
+}
+
+// HandleAIConversations lists or creates the user's AI conversations.
+// Routes: GET /api/ai/conversations, POST /api/ai/conversations
+func HandleAIConversations(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		conversations, err := database.ListAIConversations(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversations)
+
+	case http.MethodPost:
+		var req AIConversationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !aiConversationWidget(w, userID, req.WidgetID) {
+			return
+		}
+		conv, err := database.CreateAIConversation(userID, req.WidgetID, database.ConversationTitle(req.Title))
+		if err != nil {
+			log.Println("Error creating conversation:", err)
+			http.Error(w, "Failed to create conversation", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conv)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAIConversation reads, renames or deletes a conversation, and pages
+// or clears its messages.
+// Routes: GET/PUT/DELETE /api/ai/conversations/{id},
+// GET /api/ai/conversations/{id}/messages?before={messageId}&limit=50,
+// DELETE /api/ai/conversations/{id}/messages
+func HandleAIConversation(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "ai", "conversations", "{id}", ("messages")]
+	if len(parts) < 5 || parts[4] == "" {
+		http.Error(w, "Conversation ID required", http.StatusBadRequest)
+		return
+	}
+	id := parts[4]
+
+	conv, err := database.GetAIConversation(userID, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch conversation", http.StatusInternalServerError)
+		return
+	}
+	if conv == nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) > 5 && parts[5] == "messages" {
+		handleAIMessages(w, r, conv)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conv)
+
+	case http.MethodPut:
+		var req AIConversationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+			http.Error(w, "Title required", http.StatusBadRequest)
+			return
+		}
+		if err := database.RenameAIConversation(userID, id, strings.TrimSpace(req.Title)); err != nil {
+			http.Error(w, "Failed to rename conversation", http.StatusInternalServerError)
+			return
+		}
+		conv.Title = strings.TrimSpace(req.Title)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conv)
+
+	case http.MethodDelete:
+		if err := database.DeleteAIConversation(userID, id); err != nil {
+			http.Error(w, "Failed to delete conversation", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// aiConversationWidget checks a new conversation may be attached to the
+// widget, writing the error otherwise: the user must be able to read it and
+// it must be an AI assistant. An empty ID attaches none.
+func aiConversationWidget(w http.ResponseWriter, userID int, widgetID string) bool {
+	if widgetID == "" {
+		return true
+	}
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return false
+	}
+	if widget == nil || !widget.IsActive {
+		http.Error(w, "Widget not found", http.StatusNotFound)
+		return false
+	}
+	if widget.Type != models.WidgetTypeAIAssistant {
+		http.Error(w, "Widget is not an AI assistant", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func handleAIMessages(w http.ResponseWriter, r *http.Request, conv *models.AIConversation) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		var before int64
+		if v := query.Get("before"); v != "" {
+			var err error
+			if before, err = strconv.ParseInt(v, 10, 64); err != nil || before < 0 {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+		}
+		limit := aiMessagesPageSize
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, aiMessagesMaxPageSize)
+		}
+
+		messages, hasMore, err := database.GetAIMessages(conv.ID, before, limit)
+		if err != nil {
+			http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+			return
+		}
+		if err := attachAIActions(messages); err != nil {
+			http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AIMessagesPage{Messages: messages, HasMore: hasMore})
+
+	case http.MethodDelete:
+		if err := database.ClearAIMessages(conv.ID); err != nil {
+			http.Error(w, "Failed to clear conversation", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"cleared"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// attachAIActions adds to the messages the actions they proposed.
+func attachAIActions(messages []models.AIMessage) error {
+	ids := make([]int64, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	actions, err := database.GetAIActionsByMessage(ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Actions = actions[messages[i].ID]
+	}
+	return nil
+}
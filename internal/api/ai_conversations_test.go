@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/ai"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// newTestConversation creates a conversation through the endpoint.
+func newTestConversation(t *testing.T, userID int, widgetID string) models.AIConversation {
+	t.Helper()
+	w := serveAs(t, userID, HandleAIConversations, http.MethodPost, "/api/ai/conversations", AIConversationRequest{Title: "Sleep", WidgetID: widgetID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var conv models.AIConversation
+	if err := json.Unmarshal(w.Body.Bytes(), &conv); err != nil {
+		t.Fatal(err)
+	}
+	return conv
+}
+
+func TestAIMessagesPaging(t *testing.T) {
+	userID := newTestUser(t)
+	conv := newTestConversation(t, userID, "")
+	for i := range 5 {
+		m := models.AIMessage{ConversationID: conv.ID, Role: models.AIRoleUser, Text: fmt.Sprint(i)}
+		if err := database.AddAIMessage(&m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page := func(query string) AIMessagesPage {
+		t.Helper()
+		w := serveAs(t, userID, HandleAIConversation, http.MethodGet, "/api/ai/conversations/"+conv.ID+"/messages"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("get %s: %d %s", query, w.Code, w.Body)
+		}
+		var p AIMessagesPage
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	texts := func(p AIMessagesPage) string {
+		s := ""
+		for _, m := range p.Messages {
+			s += m.Text
+		}
+		return s
+	}
+
+	// Latest first, pages in chronological order
+	p := page("?limit=2")
+	if texts(p) != "34" || !p.HasMore {
+		t.Errorf("first page = %q, hasMore %v", texts(p), p.HasMore)
+	}
+	p = page(fmt.Sprintf("?limit=2&before=%d", p.Messages[0].ID))
+	if texts(p) != "12" || !p.HasMore {
+		t.Errorf("second page = %q, hasMore %v", texts(p), p.HasMore)
+	}
+	p = page(fmt.Sprintf("?limit=2&before=%d", p.Messages[0].ID))
+	if texts(p) != "0" || p.HasMore {
+		t.Errorf("last page = %q, hasMore %v", texts(p), p.HasMore)
+	}
+	if p = page(""); texts(p) != "01234" || p.HasMore {
+		t.Errorf("default page = %q, hasMore %v", texts(p), p.HasMore)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=x", "?before=-1"} {
+		w := serveAs(t, userID, HandleAIConversation, http.MethodGet, "/api/ai/conversations/"+conv.ID+"/messages"+query, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("get %s: %d", query, w.Code)
+		}
+	}
+	other := newTestUser(t)
+	if w := serveAs(t, other, HandleAIConversation, http.MethodGet, "/api/ai/conversations/"+conv.ID+"/messages", nil); w.Code != http.StatusNotFound {
+		t.Errorf("other user: %d", w.Code)
+	}
+}
+
+func TestAIConversationWidgetAccess(t *testing.T) {
+	userID := newTestUser(t)
+	other := newTestUser(t)
+	foreign := newTestWidget(t, other, models.WidgetTypeAIAssistant, `{}`)
+	note := newTestWidget(t, userID, models.WidgetTypeNote, `{}`)
+	assistant := newTestWidget(t, userID, models.WidgetTypeAIAssistant, `{}`)
+
+	tests := []struct {
+		widgetID string
+		want     int
+	}{
+		{foreign, http.StatusNotFound},
+		{"missing", http.StatusNotFound},
+		{note, http.StatusBadRequest},
+		{assistant, http.StatusCreated},
+		{"", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		w := serveAs(t, userID, HandleAIConversations, http.MethodPost, "/api/ai/conversations", AIConversationRequest{Title: "Hi", WidgetID: tt.widgetID})
+		if w.Code != tt.want {
+			t.Errorf("create with widget %q: %d, want %d", tt.widgetID, w.Code, tt.want)
+		}
+	}
+
+	// The chat endpoint creates conversations too
+	if w := serveAs(t, userID, HandleAIKey, http.MethodPut, "/api/ai/keys/"+ai.ProviderAnthropic, AIKeyRequest{APIKey: "key"}); w.Code != http.StatusOK {
+		t.Fatalf("put key: %d", w.Code)
+	}
+	w := serveAs(t, userID, HandleAIChat, http.MethodPost, "/api/ai/chat", AIChatRequest{Provider: ai.ProviderAnthropic, Message: "Hi", WidgetID: foreign})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("chat with a foreign widget: %d", w.Code)
+	}
+}
+
+func TestAIConversationRemovesActions(t *testing.T) {
+	userID := newTestUser(t)
+	conv := newTestConversation(t, userID, "")
+	propose := func() string {
+		t.Helper()
+		m := models.AIMessage{ConversationID: conv.ID, Role: models.AIRoleModel, Text: "Add a todo?"}
+		if err := database.AddAIMessage(&m); err != nil {
+			t.Fatal(err)
+		}
+		a := models.AIAction{ConversationID: conv.ID, MessageID: m.ID, Tool: "add_todo", Arguments: json.RawMessage(`{}`), Summary: "Add a todo"}
+		if err := database.CreateAIAction(userID, &a); err != nil {
+			t.Fatal(err)
+		}
+		return a.ID
+	}
+	gone := func(id string) bool {
+		t.Helper()
+		a, err := database.GetAIAction(userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a == nil
+	}
+
+	id := propose()
+	if w := serveAs(t, userID, HandleAIConversation, http.MethodDelete, "/api/ai/conversations/"+conv.ID+"/messages", nil); w.Code != http.StatusOK {
+		t.Fatalf("clear: %d", w.Code)
+	}
+	if !gone(id) {
+		t.Error("clearing the messages kept their action")
+	}
+
+	id = propose()
+	if w := serveAs(t, userID, HandleAIConversation, http.MethodDelete, "/api/ai/conversations/"+conv.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if !gone(id) {
+		t.Error("deleting the conversation kept its action")
+	}
+}
+
+func TestMigrateWidgetChatHistory(t *testing.T) {
+	userID := newTestUser(t)
+	id := newTestWidget(t, userID, models.WidgetTypeAIAssistant,
+		`{"provider":"gemini","chatHistory":[{"role":"user","text":"How do I sleep better?"},{"role":"model","text":"Keep a schedule."}]}`)
+	before, err := database.GetWidgetByID(userID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.InitAIConversationTables(); err != nil {
+		t.Fatal(err)
+	}
+	widget, err := database.GetWidgetByID(userID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if widget.Version != before.Version+1 {
+		t.Errorf("version = %d, want %d", widget.Version, before.Version+1)
+	}
+	var content map[string]any
+	if err := json.Unmarshal(widget.Content, &content); err != nil {
+		t.Fatal(err)
+	}
+	conversationID, _ := content["conversationId"].(string)
+	if content["chatHistory"] != nil || content["provider"] != "gemini" || conversationID == "" {
+		t.Fatalf("content = %s", widget.Content)
+	}
+
+	conv, err := database.GetAIConversation(userID, conversationID)
+	if err != nil || conv == nil {
+		t.Fatalf("conversation = %v, %v", conv, err)
+	}
+	if conv.WidgetID != id || conv.Title != "How do I sleep better?" {
+		t.Errorf("conversation = %+v", conv)
+	}
+	messages, _, err := database.GetAIMessages(conversationID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Role != models.AIRoleUser || messages[1].Text != "Keep a schedule." {
+		t.Errorf("messages = %+v", messages)
+	}
+
+	// Migrated widgets are left alone
+	if err := database.InitAIConversationTables(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := database.GetWidgetByID(userID, id); again.Version != widget.Version {
+		t.Errorf("second run changed the widget: version %d", again.Version)
+	}
+}
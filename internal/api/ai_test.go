@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/ai"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// failingProvider streams text, then fails as a provider reporting an
+// error mid-stream.
+type failingProvider struct {
+	text  string
+	usage ai.Usage
+}
+
+func (p failingProvider) Stream(ctx context.Context, req ai.ChatRequest, onDelta func(string) error) (ai.Response, error) {
+	if err := onDelta(p.text); err != nil {
+		return ai.Response{}, err
+	}
+	return ai.Response{Usage: p.usage}, &ai.Error{Provider: "Anthropic", Message: "Overloaded"}
+}
+
+func TestAIKeys(t *testing.T) {
+	userID := newTestUser(t)
+	put := func(provider string, body AIKeyRequest) int {
+		return serveAs(t, userID, HandleAIKey, http.MethodPut, "/api/ai/keys/"+provider, body).Code
+	}
+
+	if code := put(ai.ProviderOpenAI, AIKeyRequest{APIKey: "sk-secret"}); code != http.StatusOK {
+		t.Fatalf("put: %d", code)
+	}
+	if code := put(ai.ProviderOpenAICompatible, AIKeyRequest{BaseURL: "https://llm.example.com/v1"}); code != http.StatusOK {
+		t.Fatalf("put: %d", code)
+	}
+	for _, url := range []string{"http://127.0.0.1:11434/v1", "http://169.254.169.254/latest", "not a url"} {
+		if code := put(ai.ProviderOpenAICompatible, AIKeyRequest{BaseURL: url}); code != http.StatusBadRequest {
+			t.Errorf("put %s: %d", url, code)
+		}
+	}
+
+	w := serveAs(t, userID, HandleListAIKeys, http.MethodGet, "/api/ai/keys", nil)
+	if strings.Contains(w.Body.String(), "sk-secret") {
+		t.Fatalf("list leaks the key: %s", w.Body)
+	}
+	var keys []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys) != 2 {
+		t.Fatalf("list = %s", w.Body)
+	}
+	// Sorted by provider
+	if keys[0]["provider"] != ai.ProviderOpenAI || keys[0]["hasKey"] != true || keys[0]["baseUrl"] != nil {
+		t.Errorf("openai = %v", keys[0])
+	}
+	if keys[1]["hasKey"] != false || keys[1]["baseUrl"] != "https://llm.example.com/v1" {
+		t.Errorf("openai-compatible = %v", keys[1])
+	}
+}
+
+func TestAIErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&ai.Error{Provider: "Gemini", StatusCode: http.StatusBadRequest, Message: "API key AIza-123 not valid"}, "Gemini error: 400 Bad Request"},
+		{fmt.Errorf("stream: %w", &ai.Error{Provider: "Anthropic", Message: "Overloaded"}), "Anthropic error"},
+		{fmt.Errorf("dial tcp 10.0.0.5:11434: %w", safehttp.ErrForbiddenAddress), "AI server address not allowed"},
+		{fmt.Errorf("read: %w", context.DeadlineExceeded), "AI provider timed out"},
+		{errors.New("dial tcp 10.0.0.5:11434: connect: connection refused"), "AI provider request failed"},
+	}
+	for _, tt := range tests {
+		if got := aiErrorMessage(tt.err); got != tt.want {
+			t.Errorf("aiErrorMessage(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAIChatKeepsPartialAnswer(t *testing.T) {
+	userID := newTestUser(t)
+	if w := serveAs(t, userID, HandleAIKey, http.MethodPut, "/api/ai/keys/"+ai.ProviderAnthropic, AIKeyRequest{APIKey: "key"}); w.Code != http.StatusOK {
+		t.Fatalf("put key: %d", w.Code)
+	}
+	newProvider := newAIProvider
+	newAIProvider = func(ai.Config) (ai.Provider, error) {
+		return failingProvider{text: "Drink more", usage: ai.Usage{InputTokens: 120, OutputTokens: 3}}, nil
+	}
+	t.Cleanup(func() { newAIProvider = newProvider })
+
+	w := serveAs(t, userID, HandleAIChat, http.MethodPost, "/api/ai/chat", AIChatRequest{Provider: ai.ProviderAnthropic, Message: "Hi"})
+	var conversationID string
+	var failure struct {
+		Error     string `json:"error"`
+		MessageID int64  `json:"messageId"`
+	}
+	for _, frame := range strings.Split(w.Body.String(), "\n\n") {
+		event, data, _ := strings.Cut(strings.TrimPrefix(frame, "event: "), "\ndata: ")
+		switch event {
+		case "start":
+			var start struct {
+				ConversationID string `json:"conversationId"`
+			}
+			json.Unmarshal([]byte(data), &start)
+			conversationID = start.ConversationID
+		case "error":
+			json.Unmarshal([]byte(data), &failure)
+		}
+	}
+	if failure.Error != "Anthropic error" || failure.MessageID == 0 {
+		t.Fatalf("error event = %+v in %s", failure, w.Body)
+	}
+
+	messages, _, err := database.GetAIMessages(conversationID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("messages = %+v", messages)
+	}
+	answer := messages[1]
+	if answer.ID != failure.MessageID || answer.Role != models.AIRoleModel || answer.Text != "Drink more" ||
+		answer.InputTokens != 120 || answer.OutputTokens != 3 {
+		t.Errorf("partial answer = %+v", answer)
+	}
+}
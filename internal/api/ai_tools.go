@@ -0,0 +1,604 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/ai"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// aiMaxWaterMl mirrors MAX_CAPACITY of the Wellness widget.
+const aiMaxWaterMl = 5000
+
+// aiToolArgs holds the arguments of every tool; each tool reads its own.
+type aiToolArgs struct {
+	Widget   string       `json:"widget,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Date     string       `json:"date,omitempty"`
+	AmountMl float64      `json:"amountMl,omitempty"`
+	Meal     string       `json:"meal,omitempty"`
+	Foods    []aiToolFood `json:"foods,omitempty"`
+	Card     string       `json:"card,omitempty"`
+	ToColumn string       `json:"toColumn,omitempty"`
+}
+
+type aiToolFood struct {
+	Name     string  `json:"name"`
+	Calories float64 `json:"calories"`
+	Protein  float64 `json:"protein,omitempty"`
+}
+
+// aiTool is an action the AI Coach can propose. Proposals are validated
+// against the widget when made, and applied once the user confirms them.
+type aiTool struct {
+	def        ai.Tool
+	widgetType models.WidgetType
+	// normalize checks and completes the arguments; today is the user's date.
+	normalize func(args *aiToolArgs, today string) error
+	// apply changes the widget content in place.
+	apply func(content map[string]json.RawMessage, args aiToolArgs) error
+	// applyKanban is apply for Kanban widgets: it changes the columns in
+	// place.
+	applyKanban func(columns []models.KanbanColumn, args aiToolArgs) error
+	// summary describes the action to the user.
+	summary func(args aiToolArgs, widget models.Widget, lang string) string
+}
+
+// widgetArg is the optional widget argument shared by every tool.
+var widgetArg = map[string]any{
+	"type":        "string",
+	"description": "Title or ID of the target widget. Omit to use the first widget of the right type.",
+}
+
+var dateArg = map[string]any{
+	"type":        "string",
+	"description": "Date in YYYY-MM-DD format. Defaults to today.",
+}
+
+var aiTools = map[string]aiTool{
+	"add_todo": {
+		def: ai.Tool{
+			Name:        "add_todo",
+			Description: "Add a task to a todo list widget.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"text":   map[string]any{"type": "string", "description": "The task."},
+					"widget": widgetArg,
+				},
+				"required": []string{"text"},
+			},
+		},
+		widgetType: models.WidgetTypeTodo,
+		normalize: func(args *aiToolArgs, today string) error {
+			return requireText(&args.Text, "text")
+		},
+		apply: func(content map[string]json.RawMessage, args aiToolArgs) error {
+			return appendContentItem(content, "todos", models.TodoItem{ID: uuid.NewString(), Text: args.Text})
+		},
+		summary: func(args aiToolArgs, widget models.Widget, lang string) string {
+			return fmt.Sprintf(aiToolSummaries[lang]["add_todo"], args.Text, widget.Title)
+		},
+	},
+
+	"create_reminder": {
+		def: ai.Tool{
+			Name:        "create_reminder",
+			Description: "Create a reminder for a date in a reminder widget.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"text":   map[string]any{"type": "string", "description": "What to remind."},
+					"date":   map[string]any{"type": "string", "description": "Date in YYYY-MM-DD format."},
+					"widget": widgetArg,
+				},
+				"required": []string{"text", "date"},
+			},
+		},
+		widgetType: models.WidgetTypeReminder,
+		normalize: func(args *aiToolArgs, today string) error {
+			if err := requireText(&args.Text, "text"); err != nil {
+				return err
+			}
+			if _, err := time.Parse("2006-01-02", args.Date); err != nil {
+				return errors.New("date must be YYYY-MM-DD")
+			}
+			return nil
+		},
+		apply: func(content map[string]json.RawMessage, args aiToolArgs) error {
+			return appendContentItem(content, "reminders", models.ReminderItem{ID: uuid.NewString(), Text: args.Text, Date: args.Date})
+		},
+		summary: func(args aiToolArgs, widget models.Widget, lang string) string {
+			return fmt.Sprintf(aiToolSummaries[lang]["create_reminder"], args.Text, args.Date, widget.Title)
+		},
+	},
+
+	"log_water": {
+		def: ai.Tool{
+			Name:        "log_water",
+			Description: "Add water intake to a wellness widget.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"amountMl": map[string]any{"type": "number", "description": "Amount of water drunk, in milliliters."},
+					"date":     dateArg,
+					"widget":   widgetArg,
+				},
+				"required": []string{"amountMl"},
+			},
+		},
+		widgetType: models.WidgetTypeWellness,
+		normalize: func(args *aiToolArgs, today string) error {
+			if args.AmountMl <= 0 || args.AmountMl > aiMaxWaterMl {
+				return fmt.Errorf("amountMl must be between 1 and %d", aiMaxWaterMl)
+			}
+			return normalizeDate(&args.Date, today)
+		},
+		apply: applyLogWater,
+		summary: func(args aiToolArgs, widget models.Widget, lang string) string {
+			return fmt.Sprintf(aiToolSummaries[lang]["log_water"], formatAmount(args.AmountMl), args.Date)
+		},
+	},
+
+	"log_meal": {
+		def: ai.Tool{
+			Name:        "log_meal",
+			Description: "Log foods eaten in a meal in a diet widget.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"meal": map[string]any{"type": "string", "description": "Meal name: Breakfast, Lunch, Dinner or Snacks."},
+					"foods": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"name":     map[string]any{"type": "string"},
+								"calories": map[string]any{"type": "number", "description": "Estimated kcal."},
+								"protein":  map[string]any{"type": "number", "description": "Estimated grams of protein."},
+							},
+							"required": []string{"name", "calories"},
+						},
+					},
+					"date":   dateArg,
+					"widget": widgetArg,
+				},
+				"required": []string{"meal", "foods"},
+			},
+		},
+		widgetType: models.WidgetTypeDiet,
+		normalize: func(args *aiToolArgs, today string) error {
+			if err := requireText(&args.Meal, "meal"); err != nil {
+				return err
+			}
+			if len(args.Foods) == 0 {
+				return errors.New("foods required")
+			}
+			for i := range args.Foods {
+				f := &args.Foods[i]
+				if err := requireText(&f.Name, "food name"); err != nil {
+					return err
+				}
+				if f.Calories < 0 || f.Protein < 0 {
+					return errors.New("calories and protein can't be negative")
+				}
+			}
+			return normalizeDate(&args.Date, today)
+		},
+		apply: applyLogMeal,
+		summary: func(args aiToolArgs, widget models.Widget, lang string) string {
+			var names []string
+			var calories float64
+			for _, f := range args.Foods {
+				names = append(names, f.Name)
+				calories += f.Calories
+			}
+			return fmt.Sprintf(aiToolSummaries[lang]["log_meal"], strings.Join(names, ", "), formatAmount(calories), args.Meal, args.Date)
+		},
+	},
+
+	"move_kanban_card": {
+		def: ai.Tool{
+			Name:        "move_kanban_card",
+			Description: "Move a card of a kanban board to another column.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"card":     map[string]any{"type": "string", "description": "Text or ID of the card."},
+					"toColumn": map[string]any{"type": "string", "description": "Title or ID of the destination column."},
+					"widget":   widgetArg,
+				},
+				"required": []string{"card", "toColumn"},
+			},
+		},
+		widgetType: models.WidgetTypeKanban,
+		normalize: func(args *aiToolArgs, today string) error {
+			if err := requireText(&args.Card, "card"); err != nil {
+				return err
+			}
+			return requireText(&args.ToColumn, "toColumn")
+		},
+		applyKanban: applyMoveKanbanCard,
+		summary: func(args aiToolArgs, widget models.Widget, lang string) string {
+			return fmt.Sprintf(aiToolSummaries[lang]["move_kanban_card"], args.Card, args.ToColumn, widget.Title)
+		},
+	},
+}
+
+var aiToolSummaries = map[string]map[string]string{
+	"en-us": {
+		"add_todo":         "Add task %q to %q",
+		"create_reminder":  "Remind %q on %s in %q",
+		"log_water":        "Log %sml of water on %s",
+		"log_meal":         "Log %s (%s kcal) in %s on %s",
+		"move_kanban_card": "Move card %q to %q in %q",
+	},
+	"pt-br": {
+		"add_todo":         "Adicionar tarefa %q em %q",
+		"create_reminder":  "Lembrar %q em %s no %q",
+		"log_water":        "Registrar %sml de água em %s",
+		"log_meal":         "Registrar %s (%s kcal) no %s de %s",
+		"move_kanban_card": "Mover cartão %q para %q em %q",
+	},
+}
+
+// aiToolsPrompt is appended to the system prompt when tools are offered.
+var aiToolsPrompt = map[string]string{
+	"en-us": "You can propose changes to the dashboard with the available tools when the user asks for them. The user confirms each change before it is applied, so briefly say what you proposed.",
+	"pt-br": "Você pode propor alterações no painel com as ferramentas disponíveis quando o usuário pedir. O usuário confirma cada alteração antes de ser aplicada, então diga brevemente o que você propôs.",
+}
+
+// aiToolDefinitions returns the tools offered to the model.
+func aiToolDefinitions() []ai.Tool {
+	names := []string{"add_todo", "create_reminder", "log_water", "log_meal", "move_kanban_card"}
+	tools := make([]ai.Tool, len(names))
+	for i, name := range names {
+		tools[i] = aiTools[name].def
+	}
+	return tools
+}
+
+// proposeAIActions turns the model's tool calls into actions awaiting
+// confirmation. Calls that can't be applied to the current widgets are
+// dropped, so the user is never asked to confirm an action bound to fail.
+func proposeAIActions(userID int, calls []ai.ToolCall, lang string) ([]models.AIAction, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	widgets, err := database.GetAllWidgets(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now().In(userLocation(settings)).Format("2006-01-02")
+
+	var actions []models.AIAction
+	for _, call := range calls {
+		action, err := proposeAIAction(widgets, call, lang, today)
+		if err != nil {
+			log.Printf("AI tool call %s dropped: %v\n", call.Name, err)
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func proposeAIAction(widgets []models.Widget, call ai.ToolCall, lang, today string) (models.AIAction, error) {
+	tool, ok := aiTools[call.Name]
+	if !ok {
+		return models.AIAction{}, fmt.Errorf("unknown tool")
+	}
+	var args aiToolArgs
+	if err := json.Unmarshal(call.Arguments, &args); err != nil {
+		return models.AIAction{}, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := tool.normalize(&args, today); err != nil {
+		return models.AIAction{}, err
+	}
+
+	widget, err := findToolWidget(widgets, tool.widgetType, args.Widget)
+	if err != nil {
+		return models.AIAction{}, err
+	}
+	args.Widget = widget.ID
+
+	// Dry run, e.g. to check that the kanban card exists
+	if tool.applyKanban != nil {
+		var content models.WidgetContentWrapper
+		if len(widget.Content) > 0 {
+			if err := json.Unmarshal(widget.Content, &content); err != nil {
+				return models.AIAction{}, fmt.Errorf("invalid widget content: %w", err)
+			}
+		}
+		if err := tool.applyKanban(content.Kanban, args); err != nil {
+			return models.AIAction{}, err
+		}
+	} else {
+		content, err := widgetContentFields(widget)
+		if err != nil {
+			return models.AIAction{}, err
+		}
+		if err := tool.apply(content, args); err != nil {
+			return models.AIAction{}, err
+		}
+	}
+
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		return models.AIAction{}, err
+	}
+	return models.AIAction{
+		WidgetID:  widget.ID,
+		Tool:      call.Name,
+		Arguments: arguments,
+		Summary:   tool.summary(args, widget, lang),
+	}, nil
+}
+
+// applyAIAction applies a confirmed action through the widget write path,
+// to the widget as it is now: it may have changed since the proposal.
+func applyAIAction(userID int, action *models.AIAction) error {
+	tool, ok := aiTools[action.Tool]
+	if !ok {
+		return fmt.Errorf("unknown tool %q", action.Tool)
+	}
+	var args aiToolArgs
+	if err := json.Unmarshal(action.Arguments, &args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	var err error
+	if tool.applyKanban != nil {
+		_, err = mutateKanban(userID, action.WidgetID, 0, func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			return columns, tool.applyKanban(columns, args)
+		})
+	} else {
+		err = mutateWidgetContent(userID, action.WidgetID, tool.widgetType, func(content map[string]json.RawMessage) error {
+			return tool.apply(content, args)
+		})
+	}
+	if errors.Is(err, errWidgetNotFound) {
+		return errors.New("the widget no longer exists")
+	}
+	return err
+}
+
+// findToolWidget resolves the widget a tool call targets: by ID, then by
+// title, defaulting to the first widget of the type.
+func findToolWidget(widgets []models.Widget, widgetType models.WidgetType, ref string) (models.Widget, error) {
+	var candidates []models.Widget
+	for _, w := range widgets {
+		if w.Type == widgetType {
+			candidates = append(candidates, w)
+		}
+	}
+	if len(candidates) == 0 {
+		return models.Widget{}, fmt.Errorf("no %s widget", widgetType)
+	}
+
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return candidates[0], nil
+	}
+	i := matchIndex(len(candidates), ref, func(i int) (string, string) {
+		return candidates[i].ID, candidates[i].Title
+	})
+	if i < 0 {
+		return models.Widget{}, fmt.Errorf("no %s widget named %q", widgetType, ref)
+	}
+	return candidates[i], nil
+}
+
+// widgetContentFields decodes widget content keeping the fields it doesn't
+// know about, so that tools only touch their own field.
+func widgetContentFields(w models.Widget) (map[string]json.RawMessage, error) {
+	var content map[string]json.RawMessage
+	if len(w.Content) > 0 {
+		if err := json.Unmarshal(w.Content, &content); err != nil {
+			return nil, fmt.Errorf("invalid widget content: %w", err)
+		}
+	}
+	if content == nil {
+		content = map[string]json.RawMessage{}
+	}
+	return content, nil
+}
+
+// appendContentItem appends an item to the array field of widget content.
+func appendContentItem(content map[string]json.RawMessage, field string, item any) error {
+	var items []json.RawMessage
+	if content[field] != nil {
+		if err := json.Unmarshal(content[field], &items); err != nil {
+			return fmt.Errorf("invalid %s: %w", field, err)
+		}
+	}
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	content[field], err = json.Marshal(append(items, raw))
+	return err
+}
+
+func applyLogWater(content map[string]json.RawMessage, args aiToolArgs) error {
+	var wellness map[string]json.RawMessage
+	if content["wellness"] != nil {
+		if err := json.Unmarshal(content["wellness"], &wellness); err != nil {
+			return fmt.Errorf("invalid wellness: %w", err)
+		}
+	}
+	if wellness == nil {
+		wellness = map[string]json.RawMessage{}
+	}
+	var history []models.WellnessRecord
+	if wellness["history"] != nil {
+		if err := json.Unmarshal(wellness["history"], &history); err != nil {
+			return fmt.Errorf("invalid wellness history: %w", err)
+		}
+	}
+
+	found := false
+	for i := range history {
+		if history[i].Date == args.Date {
+			history[i].Amount = min(history[i].Amount+args.AmountMl, aiMaxWaterMl)
+			found = true
+			break
+		}
+	}
+	if !found {
+		history = append(history, models.WellnessRecord{Date: args.Date, Amount: args.AmountMl})
+	}
+
+	var err error
+	if wellness["history"], err = json.Marshal(history); err != nil {
+		return err
+	}
+	content["wellness"], err = json.Marshal(wellness)
+	return err
+}
+
+// aiDefaultMeals mirrors DEFAULT_MEALS of the Diet widget.
+var aiDefaultMeals = []string{"Breakfast", "Lunch", "Dinner", "Snacks"}
+
+func applyLogMeal(content map[string]json.RawMessage, args aiToolArgs) error {
+	var diet map[string]json.RawMessage
+	if content["diet"] != nil {
+		if err := json.Unmarshal(content["diet"], &diet); err != nil {
+			return fmt.Errorf("invalid diet: %w", err)
+		}
+	}
+	if diet == nil {
+		diet = map[string]json.RawMessage{"calorieGoal": json.RawMessage("2000")}
+	}
+	var history []models.DietDayLog
+	if diet["history"] != nil {
+		if err := json.Unmarshal(diet["history"], &history); err != nil {
+			return fmt.Errorf("invalid diet history: %w", err)
+		}
+	}
+
+	day := -1
+	for i := range history {
+		if history[i].Date == args.Date {
+			day = i
+			break
+		}
+	}
+	if day < 0 {
+		dayLog := models.DietDayLog{Date: args.Date}
+		for _, name := range aiDefaultMeals {
+			dayLog.Meals = append(dayLog.Meals, models.DietMeal{ID: strings.ToLower(name), Name: name, Items: []models.DietFood{}})
+		}
+		history = append(history, dayLog)
+		day = len(history) - 1
+	}
+
+	meals := history[day].Meals
+	meal := -1
+	for i := range meals {
+		if strings.EqualFold(meals[i].Name, args.Meal) || strings.EqualFold(meals[i].ID, args.Meal) {
+			meal = i
+			break
+		}
+	}
+	if meal < 0 {
+		meals = append(meals, models.DietMeal{ID: uuid.NewString(), Name: args.Meal})
+		meal = len(meals) - 1
+	}
+	for _, f := range args.Foods {
+		meals[meal].Items = append(meals[meal].Items, models.DietFood{
+			ID:       uuid.NewString(),
+			Name:     f.Name,
+			Calories: f.Calories,
+			Protein:  f.Protein,
+		})
+	}
+	history[day].Meals = meals
+
+	var err error
+	if diet["history"], err = json.Marshal(history); err != nil {
+		return err
+	}
+	content["diet"], err = json.Marshal(diet)
+	return err
+}
+
+func applyMoveKanbanCard(columns []models.KanbanColumn, args aiToolArgs) error {
+	to := matchIndex(len(columns), args.ToColumn, func(i int) (string, string) {
+		return columns[i].ID, columns[i].Title
+	})
+	if to < 0 {
+		return fmt.Errorf("column %q not found", args.ToColumn)
+	}
+
+	type cardRef struct{ column, index int }
+	var cards []cardRef
+	for i, col := range columns {
+		for j := range col.Items {
+			cards = append(cards, cardRef{i, j})
+		}
+	}
+	c := matchIndex(len(cards), args.Card, func(i int) (string, string) {
+		item := columns[cards[i].column].Items[cards[i].index]
+		return item.ID, item.Content
+	})
+	if c < 0 {
+		return fmt.Errorf("card %q not found", args.Card)
+	}
+	if cards[c].column == to {
+		return fmt.Errorf("card %q is already in column %q", args.Card, args.ToColumn)
+	}
+
+	_, err := moveKanbanCard(columns, cards[c].column, cards[c].index, to, nil)
+	return err
+}
+
+// matchIndex finds the element matching ref by ID, then by its text
+// ignoring case. Returns -1 if none does.
+func matchIndex(n int, ref string, key func(i int) (id, text string)) int {
+	for i := 0; i < n; i++ {
+		if id, _ := key(i); id == ref {
+			return i
+		}
+	}
+	for i := 0; i < n; i++ {
+		if _, text := key(i); strings.EqualFold(strings.TrimSpace(text), ref) {
+			return i
+		}
+	}
+	return -1
+}
+
+func requireText(s *string, name string) error {
+	*s = strings.TrimSpace(*s)
+	if *s == "" {
+		return fmt.Errorf("%s required", name)
+	}
+	return nil
+}
+
+func normalizeDate(date *string, today string) error {
+	if *date == "" {
+		*date = today
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", *date); err != nil {
+		return errors.New("date must be YYYY-MM-DD")
+	}
+	return nil
+}
+
+func formatAmount(f float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", f), "0"), ".")
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const testKanban = `{"kanban":[
+	{"id":"todo","title":"To do","items":[{"id":"a","content":"Write report"},{"id":"b","content":"Call Ana"}]},
+	{"id":"doing","title":"Doing","wipLimit":1,"wipStrict":true,"items":[{"id":"c","content":"Taxes"}]},
+	{"id":"done","title":"Done","items":[]}
+]}`
+
+func aiAction(t *testing.T, widgetID, tool string, args aiToolArgs) *models.AIAction {
+	t.Helper()
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.AIAction{WidgetID: widgetID, Tool: tool, Arguments: arguments}
+}
+
+func TestApplyAIActionKeepsConcurrentChanges(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[]}`)
+	action := aiAction(t, widgetID, "add_todo", aiToolArgs{Text: "Buy milk"})
+
+	// Saved between the proposal and its confirmation
+	saveTestWidget(t, userID, widgetID, models.WidgetTypeTodo, `{"todos":[{"id":"x","text":"Pay rent"}]}`)
+	if err := applyAIAction(userID, action); err != nil {
+		t.Fatal(err)
+	}
+
+	widget, _ := database.GetWidgetByID(userID, widgetID)
+	var content models.WidgetContentWrapper
+	json.Unmarshal(widget.Content, &content)
+	if len(content.Todos) != 2 || content.Todos[0].Text != "Pay rent" || content.Todos[1].Text != "Buy milk" {
+		t.Errorf("todos = %+v", content.Todos)
+	}
+
+	if err := database.DeleteWidget(userID, widgetID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyAIAction(userID, action); err == nil || err.Error() != "the widget no longer exists" {
+		t.Errorf("applyAIAction() on a deleted widget = %v", err)
+	}
+}
+
+func TestApplyAIActionMovesKanbanCards(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeKanban, testKanban)
+
+	if err := applyAIAction(userID, aiAction(t, widgetID, "move_kanban_card", aiToolArgs{Card: "write report", ToColumn: "Done"})); err != nil {
+		t.Fatal(err)
+	}
+	columns, version, err := loadKanban(userID, widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns[0].Items) != 1 || len(columns[2].Items) != 1 || columns[2].Items[0].ID != "a" || version != 2 {
+		t.Errorf("board at version %d = %+v", version, columns)
+	}
+	events, err := database.GetKanbanEvents(widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].CardID != "a" || events[0].FromColumn != "todo" || events[0].ToColumn != "done" {
+		t.Errorf("events = %+v", events)
+	}
+
+	// Strict WIP limits apply as in the move endpoint
+	err = applyAIAction(userID, aiAction(t, widgetID, "move_kanban_card", aiToolArgs{Card: "b", ToColumn: "doing"}))
+	if !errors.Is(err, errWIPLimitReached) {
+		t.Errorf("applyAIAction() = %v, want %v", err, errWIPLimitReached)
+	}
+	if _, v, _ := loadKanban(userID, widgetID); v != version {
+		t.Errorf("rejected move changed the widget to version %d", v)
+	}
+}
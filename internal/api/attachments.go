@@ -0,0 +1,340 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/config"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxAttachmentSize is the largest file accepted by the upload endpoint.
+	MaxAttachmentSize = 10 << 20 // 10 MB
+	// AttachmentQuota is the total storage available to each user.
+	AttachmentQuota = 200 << 20 // 200 MB
+	// attachmentGracePeriod keeps fresh uploads alive until the widget
+	// referencing them has been saved.
+	attachmentGracePeriod = 24 * time.Hour
+	attachmentGCInterval  = 6 * time.Hour
+)
+
+// allowedAttachmentTypes lists the sniffed MIME types we accept.
+// SVG and HTML are intentionally excluded since they can carry scripts.
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+type AttachmentResponse struct {
+	models.Attachment
+	URL string `json:"url"`
+}
+
+// attachmentsDir returns the directory holding the attachment blobs.
+func attachmentsDir() string {
+	return filepath.Join(config.GetDataDir(), "attachments")
+}
+
+// attachmentBlobPath returns the content-addressed path of a blob.
+// Blobs are sharded by the first two hex chars of their hash.
+func attachmentBlobPath(hash string) string {
+	return filepath.Join(attachmentsDir(), hash[:2], hash)
+}
+
+// HandleUploadAttachment stores an uploaded file for the authenticated user.
+// Route: POST /api/attachments (multipart/form-data, field "file")
+func HandleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Leave some room for the multipart envelope
+	r.Body = http.MaxBytesReader(w, r.Body, MaxAttachmentSize+(1<<20))
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "File too large or missing", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > MaxAttachmentSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Detect the real type from the content instead of trusting the client
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	mimeType := http.DetectContentType(sniff[:n])
+	if !allowedAttachmentTypes[mimeType] {
+		http.Error(w, "Unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	tmp, hash, size, err := writeAttachmentUpload(file)
+	if err != nil {
+		log.Println("Error storing attachment:", err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp) // No-op once moved in place
+
+	attachment := models.Attachment{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Hash:      hash,
+		Filename:  sanitizeFilename(header.Filename),
+		MimeType:  mimeType,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	err = database.CreateAttachment(attachment, AttachmentQuota)
+	if errors.Is(err, database.ErrQuotaExceeded) {
+		http.Error(w, "Storage quota exceeded", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Println("Error saving attachment:", err)
+		http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+		return
+	}
+	// Only once recorded, so the garbage collector sees the blob in use
+	if err := placeAttachmentBlob(tmp, hash); err != nil {
+		log.Println("Error storing attachment:", err)
+		if err := database.DeleteAttachment(attachment.ID); err != nil {
+			log.Println("Error deleting attachment:", err)
+		}
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(AttachmentResponse{
+		Attachment: attachment,
+		URL:        "/api/attachments/" + attachment.ID,
+	})
+}
+
+// HandleGetAttachment serves an attachment to its owner, or to anyone when it
+// is referenced by a public wiki page.
+// Route: GET /api/attachments/{id}
+func HandleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "attachments", "{id}"]
+	if len(parts) < 4 || parts[3] == "" {
+		http.Error(w, "Attachment ID required", http.StatusBadRequest)
+		return
+	}
+	id := parts[3]
+
+	attachment, err := database.GetAttachment(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+		return
+	}
+	if attachment == nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	cacheControl := "private, max-age=31536000, immutable"
+	allowed := false
+	if userID, ok := GetOptionalUserID(r); ok {
+		allowed = userID == attachment.UserID
+		if !allowed {
+			if allowed, err = database.IsAttachmentShared(attachment, userID); err != nil {
+				http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if !allowed {
+		public, err := database.IsAttachmentPublic(attachment)
+		if err != nil {
+			http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+			return
+		}
+		if !public {
+			// Don't reveal that the attachment exists
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		// Public pages can be unpublished, so don't let proxies keep it forever
+		cacheControl = "public, max-age=300"
+	}
+
+	f, err := os.Open(attachmentBlobPath(attachment.Hash))
+	if err != nil {
+		log.Println("Error opening attachment blob:", err)
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Disposition", `inline; filename="`+attachment.Filename+`"`)
+	http.ServeContent(w, r, "", attachment.CreatedAt, f)
+}
+
+// writeAttachmentUpload writes the content to a temporary file and returns
+// its path, SHA-256 hash and size. See placeAttachmentBlob.
+func writeAttachmentUpload(src io.Reader) (string, string, int64, error) {
+	if err := os.MkdirAll(attachmentsDir(), 0755); err != nil {
+		return "", "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(attachmentsDir(), "upload-*")
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+	return tmp.Name(), hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// placeAttachmentBlob moves an upload to its content-addressed location,
+// unless the blob already exists. Called once the attachment is recorded,
+// see removeAttachmentBlob.
+func placeAttachmentBlob(tmp, hash string) error {
+	dest := attachmentBlobPath(hash)
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// removeAttachmentBlob deletes a blob no attachment points to anymore.
+// An upload of the same content may be recorded meanwhile: the blob is first
+// moved aside and put back if the upload was recorded before it could see
+// the blob missing. Blobs have the same content whoever stores them, so
+// either copy will do.
+func removeAttachmentBlob(hash string) error {
+	if used, err := database.IsAttachmentHashUsed(hash); err != nil || used {
+		return err
+	}
+	path := attachmentBlobPath(hash)
+	trash := path + ".removed"
+	if err := os.Rename(path, trash); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove blob %s: %w", hash, err)
+	}
+	used, err := database.IsAttachmentHashUsed(hash)
+	if err != nil || used {
+		if restoreErr := os.Rename(trash, path); restoreErr != nil {
+			return fmt.Errorf("failed to restore blob %s: %w", hash, restoreErr)
+		}
+		return err
+	}
+	if err := os.Remove(trash); err != nil {
+		return fmt.Errorf("failed to remove blob %s: %w", hash, err)
+	}
+	return nil
+}
+
+// sanitizeFilename keeps only the base name and strips characters that
+// would break the Content-Disposition header.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+// StartAttachmentGC periodically removes attachments that are no longer
+// referenced by any widget content.
+func StartAttachmentGC() {
+	go func() {
+		for {
+			collectOrphanAttachments()
+			time.Sleep(attachmentGCInterval)
+		}
+	}()
+}
+
+func collectOrphanAttachments() {
+	orphans, err := database.GetOrphanAttachments(time.Now().Add(-attachmentGracePeriod))
+	if err != nil {
+		log.Println("Attachment GC failed:", err)
+		return
+	}
+
+	removed := 0
+	for _, a := range orphans {
+		// Referenced again since the query: kept
+		deleted, err := database.DeleteOrphanAttachment(a.ID)
+		if err != nil {
+			log.Println("Attachment GC failed to delete", a.ID, err)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+		removed++
+		if err := removeAttachmentBlob(a.Hash); err != nil {
+			log.Println("Attachment GC:", err)
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("Attachment GC removed %d orphan attachments\n", removed)
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// newTestAttachment records an attachment of the user and returns its ID.
+func newTestAttachment(t *testing.T, userID int, hash string) string {
+	t.Helper()
+	a := models.Attachment{ID: uuid.NewString(), UserID: userID, Hash: hash, Filename: "a.png", MimeType: "image/png", Size: 1}
+	if err := database.CreateAttachment(a, AttachmentQuota); err != nil {
+		t.Fatal(err)
+	}
+	return a.ID
+}
+
+// uploadTestAttachment uploads a file through the endpoint, as nobody when
+// userID is 0.
+func uploadTestAttachment(t *testing.T, userID int, filename string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/attachments", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if userID != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	}
+	w := httptest.NewRecorder()
+	HandleUploadAttachment(w, r)
+	return w
+}
+
+// fetchTestAttachment fetches an attachment with the cookie of the user, or
+// anonymously when userID is 0.
+func fetchTestAttachment(t *testing.T, userID int, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/attachments/"+id, nil)
+	if userID != 0 {
+		token, err := GenerateToken(userID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	}
+	w := httptest.NewRecorder()
+	HandleGetAttachment(w, r)
+	return w
+}
+
+// testPNG returns the content of a file sniffed as a PNG image, unique to
+// the test.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	return append([]byte("\x89PNG\r\n\x1a\n"), t.Name()...)
+}
+
+// hashOf returns the hash a blob of the content is stored under.
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadAttachment(t *testing.T) {
+	userID, other := newTestUser(t), newTestUser(t)
+	content := testPNG(t)
+
+	upload := func(userID int, filename string, content []byte) AttachmentResponse {
+		t.Helper()
+		w := uploadTestAttachment(t, userID, filename, content)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("upload: %d %s", w.Code, w.Body)
+		}
+		var resp AttachmentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	first := upload(userID, `../"photo".png`, content)
+	if first.MimeType != "image/png" || first.Filename != "photo.png" || first.Size != int64(len(content)) ||
+		first.URL != "/api/attachments/"+first.ID {
+		t.Errorf("attachment = %+v", first)
+	}
+
+	// The same content is stored once
+	second := upload(other, "copy.png", content)
+	if second.ID == first.ID {
+		t.Errorf("duplicate upload: %+v", second)
+	}
+	for _, id := range []string{first.ID, second.ID} {
+		if a, _ := database.GetAttachment(id); a == nil || a.Hash != hashOf(content) {
+			t.Errorf("attachment %s = %+v", id, a)
+		}
+	}
+	stored, err := os.ReadFile(attachmentBlobPath(hashOf(content)))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("blob = %q, %v", stored, err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(attachmentsDir(), "upload-*")); len(tmp) != 0 {
+		t.Errorf("uploads left behind: %v", tmp)
+	}
+
+	// Scripts are only ever served as plain text
+	if svg := upload(userID, "image.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)); svg.MimeType != "text/plain; charset=utf-8" {
+		t.Errorf("svg upload stored as %q", svg.MimeType)
+	}
+	if w := uploadTestAttachment(t, userID, "a.zip", []byte("PK\x03\x04archive")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("zip upload: %d", w.Code)
+	}
+	if w := uploadTestAttachment(t, userID, "page.html", []byte(`<html><script>alert(1)</script></html>`)); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("html upload: %d", w.Code)
+	}
+	if w := uploadTestAttachment(t, 0, "a.png", content); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous upload: %d", w.Code)
+	}
+}
+
+func TestAttachmentQuota(t *testing.T) {
+	userID := newTestUser(t)
+	big := models.Attachment{ID: uuid.NewString(), UserID: userID, Hash: uuid.NewString(), Filename: "big.pdf",
+		MimeType: "application/pdf", Size: AttachmentQuota - 10}
+	if err := database.CreateAttachment(big, AttachmentQuota); err != nil {
+		t.Fatal(err)
+	}
+
+	content := testPNG(t)
+	if w := uploadTestAttachment(t, userID, "a.png", content); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload over quota: %d", w.Code)
+	}
+	if _, err := os.Stat(attachmentBlobPath(hashOf(content))); !os.IsNotExist(err) {
+		t.Errorf("blob of a rejected upload: %v", err)
+	}
+	if w := uploadTestAttachment(t, userID, "a.txt", []byte("fits")); w.Code != http.StatusCreated {
+		t.Errorf("upload within quota: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestGetAttachment(t *testing.T) {
+	owner := newTestUser(t)
+	recipient, recipientName := newNamedTestUser(t)
+	stranger := newTestUser(t)
+	w := uploadTestAttachment(t, owner, "a.png", testPNG(t))
+	var a AttachmentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	w = fetchTestAttachment(t, owner, a.ID)
+	if w.Code != http.StatusOK || w.Body.String() != string(testPNG(t)) ||
+		w.Header().Get("Content-Type") != "image/png" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("owner fetch: %d %v", w.Code, w.Header())
+	}
+	for name, userID := range map[string]int{"stranger": stranger, "recipient": recipient, "anonymous": 0} {
+		if w := fetchTestAttachment(t, userID, a.ID); w.Code != http.StatusNotFound {
+			t.Errorf("%s fetch: %d", name, w.Code)
+		}
+	}
+	if w := fetchTestAttachment(t, owner, uuid.NewString()); w.Code != http.StatusNotFound {
+		t.Errorf("unknown attachment: %d", w.Code)
+	}
+
+	// Recipients of a widget showing it
+	page := models.WikiPage{ID: "p1", Title: "Page", Content: "![](" + a.URL + ")"}
+	wiki := func(public bool) string {
+		page.IsPublic = public
+		data, _ := json.Marshal(models.WidgetContentWrapper{Wiki: &models.WikiData{Pages: []models.WikiPage{page}}})
+		return string(data)
+	}
+	id := newTestWidget(t, owner, models.WidgetTypeWiki, wiki(false))
+	shareTestWidget(t, owner, id, recipientName, models.ShareRoleViewer)
+	if w := fetchTestAttachment(t, recipient, a.ID); w.Code != http.StatusOK {
+		t.Errorf("recipient fetch: %d", w.Code)
+	}
+	if w := fetchTestAttachment(t, 0, a.ID); w.Code != http.StatusNotFound {
+		t.Errorf("anonymous fetch of a private page: %d", w.Code)
+	}
+
+	// Anyone, on a public page
+	saveTestWidget(t, owner, id, models.WidgetTypeWiki, wiki(true))
+	w = fetchTestAttachment(t, 0, a.ID)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("public fetch: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestDeleteOrphanAttachment(t *testing.T) {
+	userID := newTestUser(t)
+	hash := uuid.NewString()
+	first, second := newTestAttachment(t, userID, hash), newTestAttachment(t, userID, hash)
+
+	// Referenced since the orphans were listed
+	newTestWidget(t, userID, "NOTE", `{"text":"![](/api/attachments/`+first+`)"}`)
+	if deleted, err := database.DeleteOrphanAttachment(first); err != nil || deleted {
+		t.Errorf("DeleteOrphanAttachment(referenced) = %v, %v", deleted, err)
+	}
+	if deleted, err := database.DeleteOrphanAttachment(second); err != nil || !deleted {
+		t.Errorf("DeleteOrphanAttachment() = %v, %v", deleted, err)
+	}
+	if a, _ := database.GetAttachment(second); a != nil {
+		t.Error("orphan attachment kept")
+	}
+}
+
+func TestRemoveAttachmentBlob(t *testing.T) {
+	userID := newTestUser(t)
+	content := testPNG(t)
+	hash := hashOf(content)
+	path := attachmentBlobPath(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still in use by another attachment
+	id := newTestAttachment(t, userID, hash)
+	if err := removeAttachmentBlob(hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("blob in use removed: %v", err)
+	}
+
+	if err := database.DeleteAttachment(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeAttachmentBlob(hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unused blob kept: %v", err)
+	}
+	if err := removeAttachmentBlob(hash); err != nil {
+		t.Errorf("removing a missing blob: %v", err)
+	}
+}
+
+func TestOrphanAttachments(t *testing.T) {
+	userID, other := newTestUser(t), newTestUser(t)
+	hash := uuid.NewString()
+	unused := newTestAttachment(t, userID, hash)
+	own := newTestAttachment(t, userID, hash)
+	copied := newTestAttachment(t, userID, hash)
+	deleted := newTestAttachment(t, userID, hash)
+
+	newTestWidget(t, userID, "NOTE", `{"text":"![](/api/attachments/`+own+`)"}`)
+	// Pasted by another user the widget isn't shared with
+	newTestWidget(t, other, "NOTE", `{"text":"![](/api/attachments/`+copied+`)"}`)
+	// Soft deleted widgets can be restored
+	id := newTestWidget(t, other, "NOTE", `{"text":"![](/api/attachments/`+deleted+`)"}`)
+	if err := database.DeleteWidget(other, id, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := database.GetOrphanAttachments(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, a := range orphans {
+		found[a.ID] = true
+	}
+	if !found[unused] {
+		t.Error("unreferenced attachment isn't an orphan")
+	}
+	for name, id := range map[string]string{"own": own, "copied": copied, "deleted": deleted} {
+		if found[id] {
+			t.Errorf("%s attachment is an orphan", name)
+		}
+	}
+}
@@ -0,0 +1,871 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/ical"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/recurrence"
+)
+
+// CalDAV (RFC 4791) exposes each Todo and Reminder widget as a calendar of
+// VTODO resources, one per item, so that reminder apps can sync them:
+//
+//	/dav/                          service root
+//	/dav/principal/                the authenticated user
+//	/dav/calendars/                calendar home, one collection per widget
+//	/dav/calendars/{widgetId}/     a Todo or Reminder widget
+//	/dav/calendars/{widgetId}/{itemId}.ics
+//
+// The CTag of a calendar is the version of its widget; the ETag of an item
+// is that version with the item ID, see davETag.
+const (
+	davRootPath      = "/dav/"
+	davPrincipalPath = "/dav/principal/"
+	davCalendarsPath = "/dav/calendars/"
+	maxDAVBodySize   = 1 << 20 // 1 MB
+)
+
+// XML namespaces
+const (
+	nsDAV       = "DAV:"
+	nsCalDAV    = "urn:ietf:params:xml:ns:caldav"
+	nsCalServer = "http://calendarserver.org/ns/"
+)
+
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCalServer: "cs"}
+
+var davCalendarDataProp = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+
+// davTargetKind is the kind of resource a DAV path points to.
+type davTargetKind int
+
+const (
+	davRoot davTargetKind = iota
+	davPrincipal
+	davCalendarHome
+	davCalendar
+	davItem
+)
+
+type davTarget struct {
+	Kind     davTargetKind
+	WidgetID string
+	ItemID   string
+}
+
+// davTodo is a todo or reminder, as exposed over CalDAV.
+type davTodo struct {
+	ID          string
+	Text        string
+	Date        string // YYYY-MM-DD, empty for undated todos
+	Completed   bool
+	CompletedAt string // RFC3339
+	Priority    string
+	Recurrence  models.Recurrence
+}
+
+// davETag returns the entity tag of an item of a widget at version. Any
+// change to the widget changes the tags of its items, as writes made
+// against a tag are only applied to that version of the widget. The ID is
+// escaped: clients choose it, and tags are sent in comma-separated lists.
+func davETag(version int, itemID string) string {
+	return `"` + strconv.Itoa(version) + "-" + url.QueryEscape(itemID) + `"`
+}
+
+// davPreconditionVersion returns the version of the widget conditional
+// writes must apply to, 0 for unconditional ones.
+func davPreconditionVersion(r *http.Request, widget *models.Widget) int {
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-None-Match") == "" {
+		return 0
+	}
+	return widget.Version
+}
+
+// HandleCalDAV serves the CalDAV tree of the authenticated user.
+// Routes: OPTIONS, PROPFIND, REPORT, GET, PUT, DELETE /dav/...
+func HandleCalDAV(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	target, ok := parseDAVPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxDAVBodySize)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		handleDAVPropfind(w, r, userID, target)
+	case "REPORT":
+		handleDAVReport(w, r, userID, target)
+	case http.MethodGet, http.MethodHead:
+		handleDAVGet(w, r, userID, target)
+	case http.MethodPut:
+		handleDAVPut(w, r, userID, target)
+	case http.MethodDelete:
+		handleDAVDelete(w, r, userID, target)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCalDAVWellKnown points clients discovering the service to its root.
+// Route: /.well-known/caldav
+func HandleCalDAVWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, davRootPath, http.StatusMovedPermanently)
+}
+
+// parseDAVPath returns the resource a path under /dav/ points to.
+func parseDAVPath(path string) (davTarget, bool) {
+	rest, ok := strings.CutPrefix(path, davRootPath)
+	if !ok {
+		return davTarget{}, false
+	}
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	switch {
+	case rest == "":
+		return davTarget{Kind: davRoot}, true
+	case len(parts) == 1 && parts[0] == "principal":
+		return davTarget{Kind: davPrincipal}, true
+	case parts[0] != "calendars":
+		return davTarget{}, false
+	case len(parts) == 1:
+		return davTarget{Kind: davCalendarHome}, true
+	case len(parts) == 2 && parts[1] != "":
+		return davTarget{Kind: davCalendar, WidgetID: parts[1]}, true
+	case len(parts) == 3 && parts[1] != "" && strings.HasSuffix(parts[2], ".ics") && !strings.HasSuffix(rest, "/"):
+		id := strings.TrimSuffix(parts[2], ".ics")
+		if id == "" {
+			return davTarget{}, false
+		}
+		return davTarget{Kind: davItem, WidgetID: parts[1], ItemID: id}, true
+	}
+	return davTarget{}, false
+}
+
+func davCalendarHref(widgetID string) string {
+	return davCalendarsPath + url.PathEscape(widgetID) + "/"
+}
+
+func davItemHref(widgetID, itemID string) string {
+	return davCalendarHref(widgetID) + url.PathEscape(itemID) + ".ics"
+}
+
+// loadDAVCalendar returns a Todo or Reminder widget of the user and its
+// items. Returns nil if there is no such widget. Archived todos are left
+// out: they are gone from the widget too.
+func loadDAVCalendar(userID int, widgetID string) (*models.Widget, []davTodo, error) {
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil || widget == nil || !widget.IsActive {
+		return nil, nil, err
+	}
+	var content models.WidgetContentWrapper
+	if len(widget.Content) > 0 {
+		if err := json.Unmarshal(widget.Content, &content); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var items []davTodo
+	switch widget.Type {
+	case models.WidgetTypeTodo:
+		for _, t := range content.Todos {
+			if !t.Archived {
+				items = append(items, davTodoFromTodo(t))
+			}
+		}
+	case models.WidgetTypeReminder:
+		for _, rem := range content.Reminders {
+			items = append(items, davTodoFromReminder(rem))
+		}
+	default:
+		return nil, nil, nil
+	}
+	return widget, items, nil
+}
+
+func davTodoFromTodo(t models.TodoItem) davTodo {
+	return davTodo{
+		ID:          t.ID,
+		Text:        t.Text,
+		Date:        t.DueDate,
+		Completed:   t.Completed,
+		CompletedAt: t.CompletedAt,
+		Priority:    t.Priority,
+		Recurrence:  t.Recurrence,
+	}
+}
+
+func davTodoFromReminder(rem models.ReminderItem) davTodo {
+	return davTodo{
+		ID:         rem.ID,
+		Text:       rem.Text,
+		Date:       rem.Date,
+		Completed:  rem.Completed,
+		Recurrence: rem.Recurrence,
+	}
+}
+
+func findDAVTodo(items []davTodo, id string) (davTodo, bool) {
+	for _, item := range items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return davTodo{}, false
+}
+
+// davPropRequest is the body of a PROPFIND, or the prop element of a
+// REPORT. No prop element means all properties.
+type davPropRequest struct {
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     *struct {
+		Names []struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+// names returns the requested properties, nil for all of them.
+func (p davPropRequest) names() []xml.Name {
+	if p.Prop == nil || p.AllProp != nil || p.PropName != nil {
+		return nil
+	}
+	names := []xml.Name{}
+	for _, n := range p.Prop.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+// davReportRequest is the body of a calendar-query or calendar-multiget
+// REPORT.
+type davReportRequest struct {
+	XMLName xml.Name
+	davPropRequest
+	Hrefs  []string `xml:"DAV: href"`
+	Filter struct {
+		CompFilter struct {
+			Name       string `xml:"name,attr"`
+			CompFilter []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// davResponse is a response element of a multistatus: the properties of a
+// resource, or a status for resources that don't exist.
+type davResponse struct {
+	Href    string
+	Props   map[xml.Name]string // Inner XML of each property
+	Missing []xml.Name
+	Status  int
+}
+
+// davPropResponse answers a request for names (nil for all) with the
+// properties of a resource. calendar-data is only returned on request.
+func davPropResponse(href string, props map[xml.Name]string, names []xml.Name) davResponse {
+	resp := davResponse{Href: href, Props: map[xml.Name]string{}}
+	if names == nil {
+		for name, value := range props {
+			if name != davCalendarDataProp {
+				resp.Props[name] = value
+			}
+		}
+		return resp
+	}
+	for _, name := range names {
+		if value, ok := props[name]; ok {
+			resp.Props[name] = value
+		} else {
+			resp.Missing = append(resp.Missing, name)
+		}
+	}
+	return resp
+}
+
+func handleDAVPropfind(w http.ResponseWriter, r *http.Request, userID int, target davTarget) {
+	var req davPropRequest
+	if err := decodeDAVBody(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	names := req.names()
+	depth := r.Header.Get("Depth")
+
+	var responses []davResponse
+	switch target.Kind {
+	case davRoot, davPrincipal:
+		href := davRootPath
+		if target.Kind == davPrincipal {
+			href = davPrincipalPath
+		}
+		responses = append(responses, davPropResponse(href, davPrincipalProps(target.Kind == davPrincipal), names))
+
+	case davCalendarHome:
+		responses = append(responses, davPropResponse(davCalendarsPath, davHomeProps(), names))
+		if depth == "0" {
+			break
+		}
+		widgets, err := database.GetAllWidgets(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch widgets", http.StatusInternalServerError)
+			return
+		}
+		for _, widget := range widgets {
+			if widget.Type == models.WidgetTypeTodo || widget.Type == models.WidgetTypeReminder {
+				responses = append(responses, davPropResponse(davCalendarHref(widget.ID), davCalendarProps(widget), names))
+			}
+		}
+
+	case davCalendar, davItem:
+		widget, items, err := loadDAVCalendar(userID, target.WidgetID)
+		if err != nil {
+			http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+			return
+		}
+		if widget == nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if target.Kind == davItem {
+			item, ok := findDAVTodo(items, target.ItemID)
+			if !ok {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			responses = append(responses, davPropResponse(davItemHref(widget.ID, item.ID), davItemProps(*widget, item), names))
+			break
+		}
+		responses = append(responses, davPropResponse(davCalendarHref(widget.ID), davCalendarProps(*widget), names))
+		if depth != "0" {
+			for _, item := range items {
+				responses = append(responses, davPropResponse(davItemHref(widget.ID, item.ID), davItemProps(*widget, item), names))
+			}
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+func handleDAVReport(w http.ResponseWriter, r *http.Request, userID int, target davTarget) {
+	var req davReportRequest
+	if err := decodeDAVBody(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if target.Kind != davCalendar && target.Kind != davItem {
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return
+	}
+	widget, items, err := loadDAVCalendar(userID, target.WidgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	names := req.names()
+
+	var responses []davResponse
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		// Only component filters are applied: time ranges and property
+		// filters match everything, which clients filter again anyway
+		filter := req.Filter.CompFilter
+		for _, c := range filter.CompFilter {
+			if c.Name != "VTODO" {
+				items = nil
+			}
+		}
+		if filter.Name != "" && filter.Name != "VCALENDAR" {
+			items = nil
+		}
+		for _, item := range items {
+			if target.Kind == davItem && item.ID != target.ItemID {
+				continue
+			}
+			responses = append(responses, davPropResponse(davItemHref(widget.ID, item.ID), davItemProps(*widget, item), names))
+		}
+
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			u, err := url.Parse(strings.TrimSpace(href))
+			var t davTarget
+			if err == nil {
+				t, _ = parseDAVPath(u.Path)
+			}
+			item, ok := findDAVTodo(items, t.ItemID)
+			if t.Kind != davItem || t.WidgetID != widget.ID || !ok {
+				responses = append(responses, davResponse{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			responses = append(responses, davPropResponse(href, davItemProps(*widget, item), names))
+		}
+
+	default:
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return
+	}
+	writeMultistatus(w, responses)
+}
+
+func handleDAVGet(w http.ResponseWriter, r *http.Request, userID int, target davTarget) {
+	if target.Kind != davItem {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	widget, items, err := loadDAVCalendar(userID, target.WidgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	item, ok := findDAVTodo(items, target.ItemID)
+	if widget == nil || !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("ETag", davETag(widget.Version, item.ID))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write([]byte(davCalendarData(*widget, item)))
+}
+
+func handleDAVPut(w http.ResponseWriter, r *http.Request, userID int, target davTarget) {
+	if target.Kind != davItem {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cal, err := ical.Parse(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid calendar: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	todos := cal.Components("VTODO")
+	if len(todos) == 0 {
+		http.Error(w, "Only VTODO resources are supported", http.StatusForbidden)
+		return
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().In(userLocation(settings))
+	put := davTodoFromICal(todos[0], now)
+	put.ID = target.ItemID
+
+	widget, err := database.GetWidgetByID(userID, target.WidgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil || !widget.IsActive {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	version := davPreconditionVersion(r, widget)
+	etag := davETag(widget.Version, put.ID)
+	created := false
+	switch widget.Type {
+	case models.WidgetTypeTodo:
+		err = mutateTodos(userID, widget.ID, version, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			created = true
+			for i := range todos {
+				if todos[i].ID == put.ID {
+					created = false
+					if err := checkDAVPreconditions(r, etag); err != nil {
+						return nil, err
+					}
+					applyDAVTodo(&todos[i], put, now)
+					return todos, nil
+				}
+			}
+			if err := checkDAVPreconditions(r, ""); err != nil {
+				return nil, err
+			}
+			todo := models.TodoItem{ID: put.ID}
+			applyDAVTodo(&todo, put, now)
+			return append(todos, todo), nil
+		})
+
+	case models.WidgetTypeReminder:
+		if put.Date == "" {
+			// Reminders are always dated
+			put.Date = now.Format("2006-01-02")
+		}
+		err = mutateReminders(userID, widget.ID, version, func(reminders []models.ReminderItem) ([]models.ReminderItem, error) {
+			created = true
+			for i := range reminders {
+				if reminders[i].ID == put.ID {
+					created = false
+					if err := checkDAVPreconditions(r, etag); err != nil {
+						return nil, err
+					}
+					applyDAVReminder(&reminders[i], put)
+					return reminders, nil
+				}
+			}
+			if err := checkDAVPreconditions(r, ""); err != nil {
+				return nil, err
+			}
+			rem := models.ReminderItem{ID: put.ID}
+			applyDAVReminder(&rem, put)
+			return append(reminders, rem), nil
+		})
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	// No ETag: the stored item is not byte for byte what was sent
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleDAVDelete(w http.ResponseWriter, r *http.Request, userID int, target davTarget) {
+	if target.Kind != davItem {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	widget, err := database.GetWidgetByID(userID, target.WidgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil || !widget.IsActive {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	version := davPreconditionVersion(r, widget)
+	etag := davETag(widget.Version, target.ItemID)
+	switch widget.Type {
+	case models.WidgetTypeTodo:
+		err = mutateTodos(userID, widget.ID, version, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			for i := range todos {
+				if todos[i].ID == target.ItemID && !todos[i].Archived {
+					if err := checkDAVPreconditions(r, etag); err != nil {
+						return nil, err
+					}
+					return append(todos[:i], todos[i+1:]...), nil
+				}
+			}
+			return nil, errItemNotFound
+		})
+	case models.WidgetTypeReminder:
+		err = mutateReminders(userID, widget.ID, version, func(reminders []models.ReminderItem) ([]models.ReminderItem, error) {
+			for i := range reminders {
+				if reminders[i].ID == target.ItemID {
+					if err := checkDAVPreconditions(r, etag); err != nil {
+						return nil, err
+					}
+					return append(reminders[:i], reminders[i+1:]...), nil
+				}
+			}
+			return nil, errItemNotFound
+		})
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDAVPreconditions checks the If-Match and If-None-Match headers
+// against the ETag of the current resource, empty if it doesn't exist.
+func checkDAVPreconditions(r *http.Request, etag string) error {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if etag == "" || (match != "*" && !etagListContains(match, etag)) {
+			return errPreconditionFailed
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && etag != "" {
+		if noneMatch == "*" || etagListContains(noneMatch, etag) {
+			return errPreconditionFailed
+		}
+	}
+	return nil
+}
+
+func etagListContains(list, etag string) bool {
+	for _, e := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(e), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// davTodoFromICal reads the fields of a VTODO. Dates are taken in the
+// timezone of now.
+func davTodoFromICal(c *ical.Component, now time.Time) davTodo {
+	loc := now.Location()
+	t := davTodo{Text: strings.TrimSpace(c.Text("SUMMARY"))}
+
+	prop := c.Get("DUE")
+	if prop == nil {
+		prop = c.Get("DTSTART")
+	}
+	if prop != nil {
+		t.Date, _ = calendarDate(prop, loc, loc)
+	}
+
+	t.Completed = strings.EqualFold(c.Text("STATUS"), "COMPLETED") || c.Get("COMPLETED") != nil
+	if p := c.Get("COMPLETED"); p != nil && t.Completed {
+		if completedAt, _, err := p.DateTime(loc); err == nil {
+			t.CompletedAt = completedAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	// RFC 5545: 1-4 high, 5 medium, 6-9 low, 0 undefined
+	if p, err := strconv.Atoi(c.Text("PRIORITY")); err == nil {
+		switch {
+		case p >= 1 && p <= 4:
+			t.Priority = models.TodoPriorityHigh
+		case p == 5:
+			t.Priority = models.TodoPriorityMedium
+		case p >= 6 && p <= 9:
+			t.Priority = models.TodoPriorityLow
+		}
+	}
+
+	// Unsupported rules are dropped rather than rejected, so that clients
+	// don't retry the upload forever
+	if p := c.Get("RRULE"); p != nil && t.Date != "" {
+		if _, err := recurrence.Parse(p.Value); err == nil {
+			t.Recurrence.RRule = strings.ToUpper(p.Value)
+		}
+	}
+	return t
+}
+
+// davRecurrence returns the recurrence of an item updated with rrule: the
+// series is kept as long as the rule doesn't change.
+func davRecurrence(rec models.Recurrence, rrule string) models.Recurrence {
+	if rrule == rec.RRule {
+		return rec
+	}
+	return models.Recurrence{RRule: rrule}
+}
+
+// applyDAVTodo applies an uploaded VTODO to a todo, keeping the fields
+// CalDAV doesn't carry.
+func applyDAVTodo(todo *models.TodoItem, t davTodo, now time.Time) {
+	todo.Text = t.Text
+	todo.DueDate = t.Date
+	todo.Priority = t.Priority
+	todo.Recurrence = davRecurrence(todo.Recurrence, t.Recurrence.RRule)
+	switch {
+	case !t.Completed:
+		todo.Completed, todo.CompletedAt = false, ""
+	case !todo.Completed:
+		todo.Completed, todo.CompletedAt = true, t.CompletedAt
+		if todo.CompletedAt == "" {
+			todo.CompletedAt = now.UTC().Format(time.RFC3339)
+		}
+	}
+}
+
+// applyDAVReminder applies an uploaded VTODO to a reminder.
+func applyDAVReminder(rem *models.ReminderItem, t davTodo) {
+	rem.Text = t.Text
+	rem.Date = t.Date
+	rem.Completed = t.Completed
+	rem.Recurrence = davRecurrence(rem.Recurrence, t.Recurrence.RRule)
+}
+
+// davCalendarData renders an item as a calendar with a single VTODO.
+// Pending recurring items carry their rule from their own date, the
+// previous occurrences being separate resources.
+func davCalendarData(widget models.Widget, t davTodo) string {
+	var cal ical.Writer
+	cal.Begin("VCALENDAR")
+	cal.Raw("VERSION", "2.0")
+	cal.Raw("PRODID", "-//LifeHub//LifeHub//EN")
+	cal.Begin("VTODO")
+	cal.Text("UID", t.ID)
+	cal.Raw("DTSTAMP", ical.UTC(widget.UpdatedAt))
+	cal.Raw("LAST-MODIFIED", ical.UTC(widget.UpdatedAt))
+	cal.Text("SUMMARY", t.Text)
+	if date := ical.Date(t.Date); date != "" {
+		cal.Raw("DTSTART;VALUE=DATE", date)
+		cal.Raw("DUE;VALUE=DATE", date)
+	}
+	cal.Raw("PRIORITY", todoPriorities[t.Priority])
+	if t.Completed {
+		cal.Raw("STATUS", "COMPLETED")
+		cal.Raw("PERCENT-COMPLETE", "100")
+		if completedAt, err := time.Parse(time.RFC3339, t.CompletedAt); err == nil {
+			cal.Raw("COMPLETED", ical.UTC(completedAt))
+		}
+	} else {
+		cal.Raw("STATUS", "NEEDS-ACTION")
+		if t.Date != "" {
+			writeRecurrence(&cal, t.Recurrence, nil)
+		}
+	}
+	cal.End("VTODO")
+	cal.End("VCALENDAR")
+	return cal.String()
+}
+
+func davHref(path string) string {
+	return "<d:href>" + xmlEscape(path) + "</d:href>"
+}
+
+// davPrincipalProps returns the properties of the service root and of the
+// principal, which point clients to the calendar home.
+func davPrincipalProps(principal bool) map[xml.Name]string {
+	resourceType := "<d:collection/>"
+	if principal {
+		resourceType += "<d:principal/>"
+	}
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:           resourceType,
+		{Space: nsDAV, Local: "current-user-principal"}: davHref(davPrincipalPath),
+		{Space: nsDAV, Local: "principal-URL"}:          davHref(davPrincipalPath),
+		{Space: nsCalDAV, Local: "calendar-home-set"}:   davHref(davCalendarsPath),
+	}
+}
+
+func davHomeProps() map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:           "<d:collection/>",
+		{Space: nsDAV, Local: "current-user-principal"}: davHref(davPrincipalPath),
+	}
+}
+
+func davCalendarProps(widget models.Widget) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         xmlEscape(widget.Title),
+		{Space: nsDAV, Local: "current-user-principal"}:              davHref(davPrincipalPath),
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege><d:privilege><d:write-content/></d:privilege><d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>",
+		{Space: nsDAV, Local: "supported-report-set"}:                "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report><d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		{Space: nsCalServer, Local: "getctag"}:                       xmlEscape(strconv.Itoa(widget.Version)),
+	}
+}
+
+func davItemProps(widget models.Widget, t davTodo) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:   "",
+		{Space: nsDAV, Local: "getetag"}:        xmlEscape(davETag(widget.Version, t.ID)),
+		{Space: nsDAV, Local: "getcontenttype"}: "text/calendar; charset=utf-8; component=VTODO",
+		davCalendarDataProp:                     xmlEscape(davCalendarData(widget, t)),
+	}
+}
+
+// decodeDAVBody decodes an XML request body. An empty body leaves v as is.
+func decodeDAVBody(r *http.Request, v any) error {
+	err := xml.NewDecoder(r.Body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// writeMultistatus writes a 207 Multi-Status response.
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + nsCalDAV + `" xmlns:cs="` + nsCalServer + `">`)
+	for _, resp := range responses {
+		b.WriteString("<d:response>" + davHref(resp.Href))
+		if resp.Status != 0 {
+			b.WriteString(davStatus(resp.Status))
+		}
+		if len(resp.Props) > 0 {
+			names := make([]xml.Name, 0, len(resp.Props))
+			for name := range resp.Props {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				return names[i].Space+names[i].Local < names[j].Space+names[j].Local
+			})
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range names {
+				b.WriteString(davElement(name, resp.Props[name]))
+			}
+			b.WriteString("</d:prop>" + davStatus(http.StatusOK) + "</d:propstat>")
+		}
+		if len(resp.Missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range resp.Missing {
+				b.WriteString(davElement(name, ""))
+			}
+			b.WriteString("</d:prop>" + davStatus(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>\n")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(b.String()))
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// davElement renders an element with its inner XML, declaring its
+// namespace unless it is a well-known one.
+func davElement(name xml.Name, inner string) string {
+	tag, attrs := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else {
+		tag = "x:" + name.Local
+		attrs = ` xmlns:x="` + xmlEscape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + attrs + "/>"
+	}
+	return "<" + tag + attrs + ">" + inner + "</" + tag + ">"
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
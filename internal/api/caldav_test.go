@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// serveDAV calls the CalDAV handler as a user, with the given precondition
+// header, e.g. "If-Match: \"1-a\"".
+func serveDAV(t *testing.T, userID int, method, target, header, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if name, value, ok := strings.Cut(header, ": "); ok {
+		r.Header.Set(name, value)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	HandleCalDAV(w, r)
+	return w
+}
+
+func TestCalDAVETags(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"a","text":"Pay rent"}]}`)
+	item := davCalendarsPath + widgetID + "/a.ics"
+	vtodo := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:a\r\nSUMMARY:Pay the rent\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+	if w := serveDAV(t, userID, http.MethodGet, item, "", ""); w.Header().Get("ETag") != `"1-a"` {
+		t.Fatalf("GET: %d with ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	// Changes to other items change the tag as well
+	err := mutateTodos(userID, widgetID, 0, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+		return append(todos, models.TodoItem{ID: "b", Text: "Buy milk"}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serveDAV(t, userID, http.MethodGet, item, "", ""); w.Header().Get("ETag") != `"2-a"` {
+		t.Fatalf("GET after a change: ETag %s", w.Header().Get("ETag"))
+	}
+
+	if w := serveDAV(t, userID, http.MethodPut, item, `If-Match: "1-a"`, vtodo); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale tag: %d", w.Code)
+	}
+	if w := serveDAV(t, userID, http.MethodPut, item, `If-Match: "2-a"`, vtodo); w.Code != http.StatusNoContent {
+		t.Errorf("PUT: %d %s", w.Code, w.Body)
+	}
+	if w := serveDAV(t, userID, http.MethodPut, davCalendarsPath+widgetID+"/c.ics", `If-None-Match: *`, vtodo); w.Code != http.StatusCreated {
+		t.Errorf("PUT of a new item: %d %s", w.Code, w.Body)
+	}
+
+	if w := serveDAV(t, userID, http.MethodDelete, item, `If-Match: "3-a"`, ""); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale tag: %d", w.Code)
+	}
+	if w := serveDAV(t, userID, http.MethodDelete, item, `If-Match: "4-a"`, ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d %s", w.Code, w.Body)
+	}
+
+	if got := davETag(1, `a",b`); got != `"1-a%22%2Cb"` {
+		t.Errorf("davETag() = %s", got)
+	}
+}
@@ -0,0 +1,563 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/ical"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/recurrence"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxCalendarSize is the largest .ics document imported, uploaded or
+	// fetched.
+	maxCalendarSize = 5 << 20 // 5 MB
+	// calendarSyncInterval is how often subscribed calendars are fetched.
+	calendarSyncInterval = time.Hour
+	calendarSyncTick     = 5 * time.Minute
+)
+
+// calendarHTTPClient fetches subscribed calendars; it refuses local
+// addresses.
+var calendarHTTPClient = safehttp.NewClient(30 * time.Second)
+
+// ImportResult counts the reminders changed by an import. Skipped counts
+// the events that could not be imported, e.g. without a date.
+type ImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+	Skipped int `json:"skipped"`
+}
+
+// CalendarSubscriptionRequest is the payload to subscribe to a calendar.
+type CalendarSubscriptionRequest struct {
+	WidgetID string `json:"widgetId"`
+	URL      string `json:"url"`
+}
+
+// CalendarSyncResponse is a subscription with the result of its sync.
+type CalendarSyncResponse struct {
+	models.CalendarSubscription
+	Result ImportResult `json:"result"`
+}
+
+// HandleImportCalendar imports the events and tasks of an iCalendar file
+// into a Reminder widget. Events imported before are updated rather than
+// duplicated.
+// Route: POST /api/widgets/{id}/import (text/calendar body, or
+// multipart/form-data with field "file")
+func HandleImportCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "widgets", "{id}", "import"]
+	if len(parts) != 5 || parts[3] == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID := parts[3]
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCalendarSize+1<<20)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	cal, err := readCalendar(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := importCalendar(userID, widgetID, 0, cal)
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleCalendarSubscriptions lists the calendar subscriptions of the
+// authenticated user, or subscribes a Reminder widget to a calendar URL and
+// runs its first sync.
+// Routes: GET, POST /api/calendar/subscriptions
+func HandleCalendarSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := database.GetCalendarSubscriptions(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch calendar subscriptions", http.StatusInternalServerError)
+			return
+		}
+		if subs == nil {
+			subs = []models.CalendarSubscription{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subs)
+
+	case http.MethodPost:
+		var req CalendarSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.URL = calendarURL(req.URL)
+		if err := validateHTTPURL(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		widget, err := database.GetWidgetByID(userID, req.WidgetID)
+		if err != nil {
+			http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+			return
+		}
+		if widget == nil || !widget.IsActive || widget.Type != models.WidgetTypeReminder {
+			http.Error(w, "Widget not found", http.StatusNotFound)
+			return
+		}
+		if widget.Role == models.ShareRoleViewer {
+			http.Error(w, "Widget is read-only", http.StatusForbidden)
+			return
+		}
+
+		id, err := database.CreateCalendarSubscription(userID, req.WidgetID, req.URL)
+		if err != nil {
+			log.Println("Error creating calendar subscription:", err)
+			http.Error(w, "Failed to create calendar subscription", http.StatusInternalServerError)
+			return
+		}
+		writeCalendarSync(w, r.Context(), userID, id, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCalendarSubscription unsubscribes from a calendar, or syncs it now.
+// Unsubscribing keeps the imported reminders.
+// Routes: DELETE /api/calendar/subscriptions/{id}
+// POST /api/calendar/subscriptions/{id}/sync
+func HandleCalendarSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "calendar", "subscriptions", "{id}"(, "sync")]
+	if len(parts) < 5 || len(parts) > 6 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.Atoi(parts[4])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 6 && parts[5] == "sync" && r.Method == http.MethodPost:
+		writeCalendarSync(w, r.Context(), userID, id, http.StatusOK)
+
+	case len(parts) == 5 && r.Method == http.MethodDelete:
+		if err := database.DeleteCalendarSubscription(userID, id); err != nil {
+			http.Error(w, "Calendar subscription not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeCalendarSync syncs a subscription of the user and writes it with the
+// result. Fetch and parse errors are recorded on the subscription rather
+// than failing the request.
+func writeCalendarSync(w http.ResponseWriter, ctx context.Context, userID, id int, status int) {
+	sub, err := database.GetCalendarSubscription(userID, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch calendar subscription", http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		http.Error(w, "Calendar subscription not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := syncCalendarSubscription(ctx, userID, *sub)
+	if errors.Is(err, errWidgetConflict) {
+		writeItemError(w, err)
+		return
+	}
+	if sub, err = database.GetCalendarSubscription(userID, id); err != nil || sub == nil {
+		http.Error(w, "Failed to fetch calendar subscription", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(CalendarSyncResponse{CalendarSubscription: *sub, Result: result})
+}
+
+// StartCalendarSync periodically imports the subscribed calendars into
+// their widgets.
+func StartCalendarSync() {
+	go func() {
+		ticker := time.NewTicker(calendarSyncTick)
+		defer ticker.Stop()
+		for range ticker.C {
+			syncDueCalendars(time.Now())
+		}
+	}()
+}
+
+// syncDueCalendars syncs the subscriptions not synced for an interval.
+func syncDueCalendars(now time.Time) {
+	subs, err := database.GetDueCalendarSubscriptions(now.Add(-calendarSyncInterval))
+	if err != nil {
+		log.Println("Calendar sync failed to load subscriptions:", err)
+		return
+	}
+	for _, sub := range subs {
+		if _, err := syncCalendarSubscription(context.Background(), sub.UserID, sub.CalendarSubscription); err != nil {
+			log.Printf("Calendar sync of subscription %d: %v", sub.ID, err)
+		}
+	}
+}
+
+// syncCalendarSubscription fetches a subscribed calendar and imports it,
+// removing the pending reminders whose event left the calendar. The outcome
+// is recorded on the subscription.
+func syncCalendarSubscription(ctx context.Context, userID int, sub models.CalendarSubscription) (ImportResult, error) {
+	var result ImportResult
+	cal, err := fetchCalendar(ctx, sub.URL)
+	if err == nil {
+		result, err = importCalendar(userID, sub.WidgetID, sub.ID, cal)
+		if errors.Is(err, errWidgetNotFound) {
+			err = errors.New("widget not found")
+		}
+	}
+
+	syncErr := ""
+	if err != nil {
+		syncErr = err.Error()
+	}
+	if err := database.SetCalendarSubscriptionSynced(sub.ID, time.Now(), syncErr); err != nil {
+		log.Println("Error updating calendar subscription:", err)
+	}
+	return result, err
+}
+
+// calendarURL turns webcal:// URLs, as published by most calendar apps,
+// into https:// ones.
+func calendarURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if rest, ok := strings.CutPrefix(raw, "webcal://"); ok {
+		return "https://" + rest
+	}
+	return raw
+}
+
+// fetchCalendar downloads and parses an iCalendar document.
+func fetchCalendar(ctx context.Context, rawURL string) (*ical.Component, error) {
+	if err := validateHTTPURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := calendarHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return readCalendar(resp.Body)
+}
+
+// readCalendar parses an iCalendar document of at most maxCalendarSize.
+func readCalendar(r io.Reader) (*ical.Component, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxCalendarSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	if len(data) > maxCalendarSize {
+		return nil, errors.New("calendar too large")
+	}
+	cal, err := ical.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar: %w", err)
+	}
+	return cal, nil
+}
+
+// importCalendar imports a calendar into a Reminder widget of the user.
+// subscriptionID is 0 for uploaded files.
+func importCalendar(userID int, widgetID string, subscriptionID int, cal *ical.Component) (ImportResult, error) {
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	loc := userLocation(settings)
+
+	var result ImportResult
+	err = mutateWidgetContent(userID, widgetID, models.WidgetTypeReminder, func(content map[string]json.RawMessage) error {
+		var reminders []models.ReminderItem
+		if content["reminders"] != nil {
+			if err := json.Unmarshal(content["reminders"], &reminders); err != nil {
+				return err
+			}
+		}
+		reminders, result = mergeCalendar(reminders, cal, subscriptionID, time.Now().In(loc))
+		var err error
+		content["reminders"], err = json.Marshal(reminders)
+		return err
+	})
+	return result, err
+}
+
+// mergeCalendar imports the events and tasks of a calendar into reminders.
+// Reminders are matched to events by UID within their source, so that
+// importing the same calendar again updates them. When syncing a
+// subscription, its pending reminders missing from the calendar are removed.
+// now is in the user's timezone.
+func mergeCalendar(reminders []models.ReminderItem, cal *ical.Component, subscriptionID int, now time.Time) ([]models.ReminderItem, ImportResult) {
+	var result ImportResult
+	today := now.Format("2006-01-02")
+	calLoc := now.Location()
+	if name := cal.Text("X-WR-TIMEZONE"); name != "" {
+		if tz, err := time.LoadLocation(name); err == nil {
+			calLoc = tz
+		}
+	}
+
+	// The pending reminder of each source ID, else its latest occurrence
+	existing := make(map[string]int)
+	for i, rem := range reminders {
+		if rem.SourceID == "" || rem.SubscriptionID != subscriptionID {
+			continue
+		}
+		if j, ok := existing[rem.SourceID]; !ok || !rem.Completed || reminders[j].Completed {
+			existing[rem.SourceID] = i
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range cal.Children {
+		if c.Name != "VEVENT" && c.Name != "VTODO" {
+			continue
+		}
+		// Moved occurrences of a series are not supported: the series
+		// keeps its own date for them
+		if c.Get("RECURRENCE-ID") != nil {
+			result.Skipped++
+			continue
+		}
+		item, ok := calendarReminder(c, calLoc, now.Location(), today)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+		if seen[item.SourceID] {
+			continue
+		}
+		seen[item.SourceID] = true
+		item.SubscriptionID = subscriptionID
+
+		i, ok := existing[item.SourceID]
+		if !ok {
+			item.ID = uuid.NewString()
+			if item.RRule != "" {
+				item.SeriesID = item.ID
+			}
+			reminders = append(reminders, item)
+			result.Created++
+			continue
+		}
+		if updateImportedReminder(&reminders[i], item) {
+			result.Updated++
+		}
+	}
+
+	if subscriptionID != 0 {
+		kept := reminders[:0]
+		for _, rem := range reminders {
+			if rem.SubscriptionID == subscriptionID && rem.SourceID != "" && !rem.Completed && !seen[rem.SourceID] {
+				result.Removed++
+				continue
+			}
+			kept = append(kept, rem)
+		}
+		reminders = kept
+	}
+	if reminders == nil {
+		reminders = []models.ReminderItem{}
+	}
+	return reminders, result
+}
+
+// calendarReminder maps a VEVENT or VTODO to a reminder, without ID. Times
+// without a timezone are read in calLoc and dates are taken in the user's
+// timezone loc. Recurring events are imported at their next occurrence from
+// today; their rule is dropped if it isn't supported, so that only their
+// first occurrence is imported. Returns false for components that can't be
+// imported: without a date, cancelled, or whose series has ended.
+func calendarReminder(c *ical.Component, calLoc, loc *time.Location, today string) (models.ReminderItem, bool) {
+	var item models.ReminderItem
+	if strings.EqualFold(c.Text("STATUS"), "CANCELLED") {
+		return item, false
+	}
+	prop := c.Get("DTSTART")
+	if c.Name == "VTODO" && c.Get("DUE") != nil {
+		prop = c.Get("DUE")
+	}
+	if prop == nil {
+		return item, false
+	}
+	date, ok := calendarDate(prop, calLoc, loc)
+	if !ok {
+		return item, false
+	}
+
+	item.Date = date
+	item.Text = strings.TrimSpace(c.Text("SUMMARY"))
+	if item.Text == "" {
+		item.Text = "(No title)"
+	}
+	item.Completed = c.Name == "VTODO" && strings.EqualFold(c.Text("STATUS"), "COMPLETED")
+	item.SourceID = c.Text("UID")
+	if item.SourceID == "" {
+		// Without UID, the event is identified by its content
+		sum := sha256.Sum256([]byte(c.Name + "\n" + prop.Value + "\n" + item.Text))
+		item.SourceID = hex.EncodeToString(sum[:16])
+	}
+
+	rrule := c.Get("RRULE")
+	if rrule == nil || item.Completed {
+		return item, true
+	}
+	rule, err := recurrence.Parse(rrule.Value)
+	if err != nil {
+		return item, true
+	}
+	item.RRule = strings.ToUpper(rrule.Value)
+	item.SeriesStart = date
+	for _, exdate := range c.All("EXDATE") {
+		for _, t := range exdate.Dates(calLoc) {
+			if exdate.Params["VALUE"] != "DATE" && len(strings.TrimSpace(exdate.Value)) != 8 {
+				t = t.In(loc)
+			}
+			item.ExDates = append(item.ExDates, t.Format("2006-01-02"))
+		}
+	}
+	if date < today {
+		day, _ := time.Parse("2006-01-02", today)
+		yesterday := day.AddDate(0, 0, -1).Format("2006-01-02")
+		next, ok := rule.Next(item.SeriesStart, yesterday, item.ExDates)
+		if !ok {
+			return item, false
+		}
+		item.Date = next
+	}
+	return item, true
+}
+
+// calendarDate returns the date of a DATE or DATE-TIME property in loc.
+func calendarDate(prop *ical.Property, calLoc, loc *time.Location) (string, bool) {
+	t, allDay, err := prop.DateTime(calLoc)
+	if err != nil {
+		return "", false
+	}
+	if !allDay {
+		t = t.In(loc)
+	}
+	return t.Format("2006-01-02"), true
+}
+
+// updateImportedReminder applies an imported event to the reminder imported
+// from it before. The date of a series the user is working through is kept
+// unless the series changed, and the dates skipped by the user are kept.
+// Returns whether the reminder changed.
+func updateImportedReminder(rem *models.ReminderItem, item models.ReminderItem) bool {
+	before, _ := json.Marshal(rem)
+
+	rem.Text = item.Text
+	switch {
+	case item.RRule == "":
+		if rem.Date != item.Date {
+			rem.Date = item.Date
+			rem.Completed = false
+		}
+		if item.Completed {
+			rem.Completed = true
+		}
+		rem.Recurrence = models.Recurrence{}
+	case rem.RRule != item.RRule || rem.SeriesStart != item.SeriesStart:
+		// A new series, starting from this reminder
+		if !rem.Completed || rem.Date != item.Date {
+			rem.Date = item.Date
+			rem.Completed = false
+		}
+		rem.Recurrence = item.Recurrence
+		rem.SeriesID = rem.ID
+	default:
+		skipped := make(map[string]bool)
+		for _, d := range item.ExDates {
+			skipped[d] = true
+		}
+		for _, d := range rem.ExDates {
+			if !skipped[d] {
+				item.ExDates = append(item.ExDates, d)
+			}
+		}
+		rem.ExDates = item.ExDates
+	}
+
+	after, _ := json.Marshal(rem)
+	return string(before) != string(after)
+}
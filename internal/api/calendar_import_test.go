@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/ical"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testdata, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func parseCalendar(t *testing.T, doc string) *ical.Component {
+	t.Helper()
+	cal, err := readCalendar(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func bySource(reminders []models.ReminderItem) map[string]models.ReminderItem {
+	m := make(map[string]models.ReminderItem)
+	for _, rem := range reminders {
+		m[rem.SourceID] = rem
+	}
+	return m
+}
+
+func TestMergeCalendar(t *testing.T) {
+	cal := parseCalendar(t, readFixture(t, "feed.ics"))
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	reminders, result := mergeCalendar(nil, cal, 0, now)
+	if result != (ImportResult{Created: 5, Skipped: 3}) {
+		t.Errorf("result = %+v", result)
+	}
+
+	got := bySource(reminders)
+	tests := []struct {
+		uid, text, date string
+		completed       bool
+	}{
+		// 23:00 in New York is the next day in UTC
+		{"dentist@example.com", "Dentist, downtown", "2030-03-11", false},
+		// Floating time in the calendar's timezone
+		{"standup@example.com", "Standup", "2030-01-07", false},
+		{"holiday@example.com", "Bastille Day", "2030-07-14", false},
+		// Tasks are due on DUE rather than DTSTART
+		{"taxes@example.com", "File taxes", "2030-04-15", false},
+		{"done@example.com", "Done task", "2030-01-05", true},
+	}
+	for _, tt := range tests {
+		rem, ok := got[tt.uid]
+		if !ok {
+			t.Errorf("%s not imported", tt.uid)
+			continue
+		}
+		if rem.Text != tt.text || rem.Date != tt.date || rem.Completed != tt.completed || rem.ID == "" {
+			t.Errorf("%s = %+v", tt.uid, rem)
+		}
+	}
+	standup := got["standup@example.com"]
+	if standup.RRule != "FREQ=WEEKLY;BYDAY=MO,WE" || standup.SeriesStart != "2030-01-07" || standup.SeriesID != standup.ID ||
+		len(standup.ExDates) != 1 || standup.ExDates[0] != "2030-01-09" {
+		t.Errorf("standup = %+v", standup)
+	}
+
+	// Importing again updates rather than duplicates
+	again, result := mergeCalendar(reminders, cal, 0, now)
+	if result != (ImportResult{Skipped: 3}) || len(again) != len(reminders) {
+		t.Errorf("second import = %+v, %d reminders", result, len(again))
+	}
+}
+
+func TestMergeCalendarRecurringFromToday(t *testing.T) {
+	cal := parseCalendar(t, readFixture(t, "feed.ics"))
+	// Wednesday the 9th is excluded
+	now := time.Date(2030, 1, 8, 12, 0, 0, 0, time.UTC)
+	reminders, _ := mergeCalendar(nil, cal, 0, now)
+	if rem := bySource(reminders)["standup@example.com"]; rem.Date != "2030-01-14" || rem.SeriesStart != "2030-01-07" {
+		t.Errorf("standup = %+v", rem)
+	}
+}
+
+func TestCalendarURL(t *testing.T) {
+	if got := calendarURL(" webcal://example.com/cal.ics "); got != "https://example.com/cal.ics" {
+		t.Errorf("calendarURL() = %q", got)
+	}
+	if got := calendarURL("http://example.com/cal.ics"); got != "http://example.com/cal.ics" {
+		t.Errorf("calendarURL() = %q", got)
+	}
+}
+
+// feedServer serves a calendar that tests can change. Subscriptions reach
+// it with the client of the test server, as theirs refuses local
+// addresses.
+type feedServer struct {
+	mu  sync.Mutex
+	doc string
+	url string
+}
+
+func newFeedServer(t *testing.T, doc string) *feedServer {
+	t.Helper()
+	feed := &feedServer{doc: doc}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		if r.URL.Path != "/team.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(feed.doc))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := calendarHTTPClient
+	calendarHTTPClient = srv.Client()
+	t.Cleanup(func() { calendarHTTPClient = client })
+	feed.url = strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/team.ics"
+	return feed
+}
+
+func (f *feedServer) set(doc string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.doc = doc
+}
+
+func TestCalendarSubscription(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeReminder, `{"reminders":[{"id":"own","text":"Mine","date":"2030-01-01","completed":false}]}`)
+	doc := readFixture(t, "feed.ics")
+	feed := newFeedServer(t, doc)
+
+	w := serveAs(t, userID, HandleCalendarSubscriptions, http.MethodPost, "/api/calendar/subscriptions",
+		CalendarSubscriptionRequest{WidgetID: widgetID, URL: feed.url})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribe: %d %s", w.Code, w.Body)
+	}
+	var res CalendarSyncResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Result.Created != 5 || res.LastError != "" {
+		t.Fatalf("first sync = %s", w.Body)
+	}
+
+	// The holiday left the calendar, the dentist moved
+	doc = strings.Replace(doc, "BEGIN:VEVENT\nUID:holiday@example.com\nDTSTART;VALUE=DATE:20300714\nSUMMARY:Bastille Day\nEND:VEVENT\n", "", 1)
+	doc = strings.Replace(doc, "20300310T230000", "20300312T100000", 1)
+	feed.set(doc)
+	path := "/api/calendar/subscriptions/" + strconv.Itoa(res.ID) + "/sync"
+	w = serveAs(t, userID, HandleCalendarSubscription, http.MethodPost, path, nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Result != (ImportResult{Updated: 1, Removed: 1, Skipped: 3}) {
+		t.Fatalf("second sync: %d %s", w.Code, w.Body)
+	}
+
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content models.WidgetContentWrapper
+	json.Unmarshal(widget.Content, &content)
+	got := bySource(content.Reminders)
+	if _, ok := got["holiday@example.com"]; ok {
+		t.Error("removed event still imported")
+	}
+	if rem := got["dentist@example.com"]; rem.Date != "2030-03-12" {
+		t.Errorf("dentist = %+v", rem)
+	}
+	if rem := got[""]; rem.ID != "own" {
+		t.Errorf("reminder of the user = %+v", rem)
+	}
+
+	// Fetch errors are recorded on the subscription
+	feed.set("not a calendar")
+	w = serveAs(t, userID, HandleCalendarSubscription, http.MethodPost, path, nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.LastError == "" {
+		t.Errorf("failed sync: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestCalendarSubscriptionLocalAddresses(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeReminder, `{"reminders":[]}`)
+	for _, url := range []string{"http://127.0.0.1/cal.ics", "webcal://169.254.169.254/cal.ics", "file:///etc/passwd"} {
+		w := serveAs(t, userID, HandleCalendarSubscriptions, http.MethodPost, "/api/calendar/subscriptions",
+			CalendarSubscriptionRequest{WidgetID: widgetID, URL: url})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("subscribe to %s: %d", url, w.Code)
+		}
+	}
+
+	// Host names resolving to local addresses are refused when fetching
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	target := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	if _, err := fetchCalendar(t.Context(), target); !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("fetchCalendar() = %v, want %v", err, safehttp.ErrForbiddenAddress)
+	}
+}
@@ -0,0 +1,754 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/crdt"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	// Sessions are checked every collabCompactInterval: changes saved with
+	// the widget are merged then. Edits are only written to the widget once
+	// the document was idle for collabIdleDelay, its last client left, or
+	// they waited for collabMaxDelay, as every write bumps the version of
+	// the widget, which conflicts with the clients editing it otherwise.
+	collabCompactInterval = 15 * time.Second
+	collabIdleDelay       = time.Minute
+	collabMaxDelay        = 10 * time.Minute
+	collabPingInterval    = 30 * time.Second
+	collabMaxMessage      = 2 * 1024 * 1024
+	collabSendQueue       = 256 // Messages queued per client
+	// collabServerSite inserts the text a document starts from
+	collabServerSite = "server"
+)
+
+// Types of collabMessage
+const (
+	collabInit   = "init"
+	collabUpdate = "update"
+	collabError  = "error"
+)
+
+// collabMessage is a message of the collaboration protocol. The server
+// sends init on connection, with the site ID the client inserts with and
+// the document state; clients send updates, which the server relays to the
+// other clients of the document.
+type collabMessage struct {
+	Type     string    `json:"type"`
+	Site     string    `json:"site,omitempty"`
+	Clock    int       `json:"clock,omitempty"` // Highest counter of the document
+	State    *crdt.Doc `json:"state,omitempty"`
+	ReadOnly bool      `json:"readOnly,omitempty"`
+	Ops      []crdt.Op `json:"ops,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// collabSession is a document loaded for editing. Updates are stored before
+// they are applied, and compacted into the document state and the widget
+// content once the document is idle. Sessions without clients are unloaded
+// once compacted.
+type collabSession struct {
+	id         string // {widgetId}/{itemId}
+	widgetID   string
+	itemID     string
+	widgetType models.WidgetType
+	ownerID    int
+
+	compacting sync.Mutex // Held during compactions
+
+	mu         sync.Mutex
+	doc        *crdt.Doc // Nil until loaded
+	text       string    // Text of the item at the last compaction
+	base       []crdt.ID // IDs of the characters of text
+	clients    map[*collabClient]bool
+	lastUpdate int64 // ID of the last stored update
+	dirty      bool
+	dirtySince time.Time // Of the oldest update not compacted
+	lastEdit   time.Time // Of the last update of a client
+	unloaded   bool
+}
+
+// collabClient is a connection to a session. Messages are queued and
+// written by the goroutine of write, so that a slow client doesn't hold
+// the session; a client whose queue is full is disconnected.
+type collabClient struct {
+	conn     *websocket.Conn
+	site     string
+	readOnly bool
+
+	out      chan []byte
+	done     chan struct{} // Closed once the client left
+	slow     chan struct{} // Closed once the queue is full
+	slowOnce sync.Once
+}
+
+var collabSessions = struct {
+	sync.Mutex
+	m map[string]*collabSession
+}{m: make(map[string]*collabSession)}
+
+// HandleCollab opens a collaborative editing session of a wiki page or a
+// note tab over WebSocket. Viewers of a shared widget receive the updates
+// but can't send any. The plain text of the document is written back to
+// the widget content once the document is idle or left, and changes of the
+// item saved with the widget are merged into the document.
+// Route: GET /api/collab/{widgetId}/{pageId or tabId}
+func HandleCollab(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "collab", "{widgetId}", "{itemId}"]
+	if len(parts) != 5 || parts[3] == "" || parts[4] == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID, itemID := parts[3], parts[4]
+
+	// Browsers send the cookie with cross-site WebSocket requests. Ports
+	// are ignored, the dev server proxies from another one.
+	if origin := r.Header.Get("Origin"); origin != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if u, err := url.Parse(origin); err != nil || u.Hostname() != host {
+			http.Error(w, "Cross-origin request denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil || !widget.IsActive || (widget.Type != models.WidgetTypeWiki && widget.Type != models.WidgetTypeNote) {
+		http.Error(w, "Widget not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := collabItemText(*widget, itemID); !ok {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	ownerID := userID
+	if widget.Role != "" {
+		ownerID = widget.UserID
+	}
+
+	conn, err := websocket.Upgrade(w, r, collabMaxMessage)
+	if err != nil {
+		return
+	}
+	client := &collabClient{
+		conn:     conn,
+		site:     uuid.NewString(),
+		readOnly: widget.Role == models.ShareRoleViewer,
+		out:      make(chan []byte, collabSendQueue),
+		done:     make(chan struct{}),
+		slow:     make(chan struct{}),
+	}
+
+	session, err := joinCollabSession(ownerID, *widget, itemID, client)
+	if err != nil {
+		log.Println("Error opening collab document:", err)
+		conn.Close(websocket.CloseGoingAway, "failed to open document")
+		return
+	}
+	defer close(client.done)
+	defer session.leave(client)
+	go client.write()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg collabMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != collabUpdate {
+			client.send(collabMessage{Type: collabError, Error: "expected an update"})
+			continue
+		}
+		session.update(client, msg.Ops)
+	}
+}
+
+// joinCollabSession adds a client to the session of a document, loading it
+// if needed, and sends it the document. Changes of the item saved with the
+// widget are merged first, so that the client starts from them.
+func joinCollabSession(ownerID int, widget models.Widget, itemID string, client *collabClient) (*collabSession, error) {
+	for {
+		s, err := lockCollabSession(ownerID, widget, itemID)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Unlock()
+
+		s.compacting.Lock()
+		_, _, err = s.merge()
+		s.mu.Lock()
+		if err != nil || s.unloaded {
+			s.mu.Unlock()
+			s.compacting.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		s.clients[client] = true
+		client.send(collabMessage{Type: collabInit, Site: client.site, Clock: s.doc.Clock(), State: s.doc, ReadOnly: client.readOnly})
+		s.mu.Unlock()
+		s.compacting.Unlock()
+		return s, nil
+	}
+}
+
+// lockCollabSession returns the session of a document, loaded and locked.
+// The global lock is only held to find the session: documents are loaded
+// under the lock of their session.
+func lockCollabSession(ownerID int, widget models.Widget, itemID string) (*collabSession, error) {
+	id := widget.ID + "/" + itemID
+	for {
+		collabSessions.Lock()
+		s := collabSessions.m[id]
+		if s == nil {
+			s = &collabSession{
+				id:         id,
+				widgetID:   widget.ID,
+				itemID:     itemID,
+				widgetType: widget.Type,
+				ownerID:    ownerID,
+				clients:    make(map[*collabClient]bool),
+			}
+			collabSessions.m[id] = s
+		}
+		collabSessions.Unlock()
+
+		s.mu.Lock()
+		if s.unloaded {
+			// Unloaded meanwhile, a new session replaces it
+			s.mu.Unlock()
+			continue
+		}
+		if s.doc == nil {
+			if err := s.load(widget); err != nil {
+				s.mu.Unlock()
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+}
+
+// load loads a document: its compacted state and the updates received
+// since. Documents are created from the text of the item, and changes of
+// the text made through the widget since the last compaction are merged.
+func (s *collabSession) load(widget models.Widget) error {
+	text, ok := collabItemText(widget, s.itemID)
+	if !ok {
+		return errItemNotFound
+	}
+
+	record, err := database.GetCollabDocument(s.id)
+	if err != nil {
+		return err
+	}
+	updates, err := database.GetCollabUpdates(s.id)
+	if err != nil {
+		return err
+	}
+
+	doc := crdt.New()
+	if record == nil {
+		doc = crdt.FromText(collabServerSite, text)
+		state, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		record := models.CollabDocument{ID: s.id, WidgetID: s.widgetID, State: state, Text: text}
+		if err := database.SaveCollabDocument(record, 0); err != nil {
+			return err
+		}
+		s.doc, s.text, s.base = doc, text, doc.VisibleIDs()
+		return nil
+	}
+
+	if err := json.Unmarshal(record.State, doc); err != nil {
+		return fmt.Errorf("invalid state of %s: %w", s.id, err)
+	}
+	s.text, s.base = record.Text, doc.VisibleIDs()
+	for _, u := range updates {
+		var ops []crdt.Op
+		if err := json.Unmarshal(u.Ops, &ops); err != nil {
+			return fmt.Errorf("invalid update %d: %w", u.ID, err)
+		}
+		if u.Text != nil {
+			// A merge of the saved text, which the next ones start from
+			_, ids, err := crdt.Diff(collabServerSite, doc.Clock(), s.base, s.text, *u.Text)
+			if err != nil {
+				return fmt.Errorf("invalid merge %d: %w", u.ID, err)
+			}
+			s.text, s.base = *u.Text, ids
+		}
+		for _, op := range ops {
+			if err := doc.Apply(op); err != nil {
+				log.Printf("Skipping collab operation of %s: %v", s.id, err)
+			}
+		}
+		s.lastUpdate = u.ID
+	}
+	s.doc = doc
+	if len(updates) > 0 {
+		s.dirty, s.dirtySince = true, time.Now()
+	}
+	if text != s.text {
+		return s.rebase(text)
+	}
+	return nil
+}
+
+// leave removes a client from the session. The edits are compacted once
+// the last client left.
+func (s *collabSession) leave(client *collabClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, client)
+	if len(s.clients) == 0 && s.dirty {
+		go func() {
+			if err := s.compact(time.Now()); err != nil {
+				log.Printf("Collab compaction of %s failed: %v", s.id, err)
+			}
+		}()
+	}
+}
+
+// update applies the operations of a client, once stored, and relays them.
+// If any doesn't apply, none is, and the client is sent an error; it should
+// then reconnect to start over from the server's state.
+func (s *collabSession) update(client *collabClient, ops []crdt.Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client.readOnly {
+		client.send(collabMessage{Type: collabError, Error: "document is read-only"})
+		return
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	for _, op := range ops {
+		if op.Op == crdt.OpInsert {
+			// Clients insert with their own site only, so IDs stay unique
+			if id, err := crdt.ParseID(op.ID); err != nil || id.Site != client.site {
+				err := fmt.Errorf("%w: insert IDs must use site %s", crdt.ErrInvalidOp, client.site)
+				client.send(collabMessage{Type: collabError, Error: err.Error()})
+				return
+			}
+		}
+	}
+	if err := s.doc.Check(ops); err != nil {
+		client.send(collabMessage{Type: collabError, Error: err.Error()})
+		return
+	}
+	if err := s.store(ops, nil); err != nil {
+		log.Println("Error storing collab update:", err)
+		client.send(collabMessage{Type: collabError, Error: "failed to store update"})
+		return
+	}
+	s.apply(ops)
+	s.lastEdit = time.Now()
+	s.broadcast(client, collabMessage{Type: collabUpdate, Site: client.site, Ops: ops})
+}
+
+// rebase merges a change of the item text made outside of the session,
+// e.g. by saving the whole widget, as operations of the server: the range
+// changed since the last compaction is replaced, keeping the edits made
+// concurrently in the session.
+func (s *collabSession) rebase(text string) error {
+	ops, ids, err := crdt.Diff(collabServerSite, s.doc.Clock(), s.base, s.text, text)
+	if err != nil {
+		return err
+	}
+	if err := s.doc.Check(ops); err != nil {
+		return err
+	}
+	if err := s.store(ops, &text); err != nil {
+		return err
+	}
+	s.apply(ops)
+	s.text, s.base = text, ids
+	s.broadcast(nil, collabMessage{Type: collabUpdate, Site: collabServerSite, Ops: ops})
+	return nil
+}
+
+// store stores operations before they are applied, so that the document
+// can be rebuilt from its state and updates, with the text they merge for
+// the operations of rebase.
+func (s *collabSession) store(ops []crdt.Op, text *string) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	id, err := database.AddCollabUpdate(s.id, data, text)
+	if err != nil {
+		return err
+	}
+	s.lastUpdate = id
+	if !s.dirty {
+		s.dirty, s.dirtySince = true, time.Now()
+	}
+	return nil
+}
+
+// apply applies checked operations.
+func (s *collabSession) apply(ops []crdt.Op) {
+	for _, op := range ops {
+		if err := s.doc.Apply(op); err != nil {
+			log.Printf("Collab operation of %s failed after its check: %v", s.id, err)
+		}
+	}
+}
+
+// broadcast sends a message to the clients of the session but one.
+func (s *collabSession) broadcast(except *collabClient, msg collabMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Error encoding collab message:", err)
+		return
+	}
+	for client := range s.clients {
+		if client != except {
+			client.queue(data)
+		}
+	}
+}
+
+func (c *collabClient) send(msg collabMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Error encoding collab message:", err)
+		return
+	}
+	c.queue(data)
+}
+
+func (c *collabClient) queue(data []byte) {
+	select {
+	case c.out <- data:
+	default:
+		c.slowOnce.Do(func() { close(c.slow) })
+	}
+}
+
+// write writes the queued messages, and pings the client, until it leaves.
+func (c *collabClient) write() {
+	ticker := time.NewTicker(collabPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.slow:
+			c.conn.Close(websocket.ClosePolicyViolation, "client too slow")
+			return
+		case data := <-c.out:
+			if err := c.conn.WriteMessage(data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// errCollabTextChanged stops a compaction when the item text was saved
+// since it was read. The next compaction merges it.
+var errCollabTextChanged = errors.New("collab item text changed")
+
+// idle reports whether the edits of the session can be written to the
+// widget, see collabIdleDelay.
+func (s *collabSession) idle(now time.Time) bool {
+	return len(s.clients) == 0 || now.Sub(s.lastEdit) >= collabIdleDelay || now.Sub(s.dirtySince) >= collabMaxDelay
+}
+
+// compact merges the changes of the item text saved with the widget and,
+// once the document is idle, writes its text to the widget and stores its
+// state, dropping the updates it includes. Tombstones are dropped from the
+// stored state when no client could refer to them anymore.
+func (s *collabSession) compact(now time.Time) error {
+	s.compacting.Lock()
+	defer s.compacting.Unlock()
+
+	s.mu.Lock()
+	loaded := s.doc != nil && !s.unloaded
+	s.mu.Unlock()
+	if !loaded {
+		return nil
+	}
+
+	stored, ok, err := s.merge()
+	if err != nil || !ok {
+		return err
+	}
+
+	s.mu.Lock()
+	if !s.dirty || !s.idle(now) {
+		s.mu.Unlock()
+		return nil
+	}
+	text := s.doc.Text()
+	ids := s.doc.VisibleIDs()
+	state, err := json.Marshal(s.doc)
+	if err == nil && len(s.clients) == 0 {
+		state, err = compactCollabState(state)
+	}
+	upTo := s.lastUpdate
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if text != stored {
+		err := mutateWidgetContent(s.ownerID, s.widgetID, s.widgetType, func(content map[string]json.RawMessage) error {
+			return setCollabItemText(content, s.widgetType, s.itemID, stored, text)
+		})
+		if errors.Is(err, errCollabTextChanged) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	doc := models.CollabDocument{ID: s.id, WidgetID: s.widgetID, State: state, Text: text}
+	if err := database.SaveCollabDocument(doc, upTo); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.text, s.base = text, ids
+	if s.dirty = s.lastUpdate > upTo; s.dirty {
+		s.dirtySince = now
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// merge merges the changes of the item text saved with the widget since the
+// last compaction, and returns the saved text; ok is false if the item is
+// gone. Called with the compaction lock held, so that the text a compaction
+// is writing isn't merged as a change.
+func (s *collabSession) merge() (stored string, ok bool, err error) {
+	widget, err := database.GetWidgetByID(s.ownerID, s.widgetID)
+	if err != nil {
+		return "", false, err
+	}
+	if widget == nil || !widget.IsActive {
+		return "", false, nil
+	}
+	if stored, ok = collabItemText(*widget, s.itemID); !ok {
+		return "", false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored != s.text {
+		if err := s.rebase(stored); err != nil {
+			return "", false, err
+		}
+	}
+	return stored, true, nil
+}
+
+// compactCollabState drops the tombstones of a document state.
+func compactCollabState(state []byte) ([]byte, error) {
+	doc := crdt.New()
+	if err := json.Unmarshal(state, doc); err != nil {
+		return nil, err
+	}
+	doc.Compact()
+	return json.Marshal(doc)
+}
+
+// StartCollabCompaction periodically compacts the documents being edited
+// once idle, and those left with updates, e.g. by a restart.
+func StartCollabCompaction() {
+	go func() {
+		ticker := time.NewTicker(collabCompactInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			compactCollabSessions()
+		}
+	}()
+}
+
+func compactCollabSessions() {
+	if err := loadPendingCollabSessions(); err != nil {
+		log.Println("Collab compaction failed to load documents:", err)
+	}
+
+	collabSessions.Lock()
+	sessions := make([]*collabSession, 0, len(collabSessions.m))
+	for _, s := range collabSessions.m {
+		sessions = append(sessions, s)
+	}
+	collabSessions.Unlock()
+
+	now := time.Now()
+	for _, s := range sessions {
+		if err := s.compact(now); err != nil {
+			log.Printf("Collab compaction of %s failed: %v", s.id, err)
+		}
+	}
+
+	// Unload the sessions left without clients. A failed compaction keeps
+	// its updates, which are loaded again on the next run. Sessions being
+	// loaded are left for the next run.
+	collabSessions.Lock()
+	defer collabSessions.Unlock()
+	for id, s := range collabSessions.m {
+		if !s.mu.TryLock() {
+			continue
+		}
+		if len(s.clients) == 0 {
+			s.unloaded = true
+			delete(collabSessions.m, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// loadPendingCollabSessions loads the documents that have updates but no
+// session.
+func loadPendingCollabSessions() error {
+	ids, err := database.GetPendingCollabDocuments()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		collabSessions.Lock()
+		loaded := collabSessions.m[id] != nil
+		collabSessions.Unlock()
+		if loaded {
+			continue
+		}
+		widgetID, itemID, ok := strings.Cut(id, "/")
+		if !ok {
+			continue
+		}
+		users, _, _, err := database.GetWidgetAudience(widgetID)
+		if err != nil || len(users) == 0 {
+			continue
+		}
+		widget, err := database.GetWidgetByID(users[0], widgetID)
+		if err != nil || widget == nil {
+			continue
+		}
+		s, err := lockCollabSession(users[0], *widget, itemID)
+		if err != nil {
+			if !errors.Is(err, errItemNotFound) {
+				log.Printf("Collab compaction failed to load %s: %v", id, err)
+			}
+			continue
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// collabItemText returns the text of the wiki page or note tab of a widget.
+func collabItemText(widget models.Widget, itemID string) (string, bool) {
+	var content models.WidgetContentWrapper
+	if len(widget.Content) > 0 {
+		if err := json.Unmarshal(widget.Content, &content); err != nil {
+			return "", false
+		}
+	}
+	switch widget.Type {
+	case models.WidgetTypeWiki:
+		if content.Wiki != nil {
+			for _, page := range content.Wiki.Pages {
+				if page.ID == itemID {
+					return page.Content, true
+				}
+			}
+		}
+	case models.WidgetTypeNote:
+		for _, tab := range content.Notes {
+			if tab.ID == itemID {
+				return tab.Content, true
+			}
+		}
+	}
+	return "", false
+}
+
+// setCollabItemText replaces the text of a wiki page or note tab in the
+// content of a widget, keeping the fields of the item the models don't
+// know. Returns errCollabTextChanged if the item text isn't previous.
+func setCollabItemText(content map[string]json.RawMessage, widgetType models.WidgetType, itemID, previous, text string) error {
+	container, key := content, "notes"
+	var wiki map[string]json.RawMessage
+	if widgetType == models.WidgetTypeWiki {
+		if err := json.Unmarshal(content["wiki"], &wiki); err != nil || wiki == nil {
+			return errItemNotFound
+		}
+		container, key = wiki, "pages"
+	}
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(container[key], &items); err != nil {
+		return errItemNotFound
+	}
+	found := false
+	for _, item := range items {
+		var id string
+		if json.Unmarshal(item["id"], &id) == nil && id == itemID {
+			var current string
+			if len(item["content"]) > 0 {
+				if err := json.Unmarshal(item["content"], &current); err != nil {
+					return err
+				}
+			}
+			if current != previous {
+				return errCollabTextChanged
+			}
+			item["content"], _ = json.Marshal(text)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errItemNotFound
+	}
+
+	var err error
+	if container[key], err = json.Marshal(items); err != nil {
+		return err
+	}
+	if wiki != nil {
+		content["wiki"], err = json.Marshal(wiki)
+	}
+	return err
+}
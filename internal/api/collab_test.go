@@ -0,0 +1,349 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/crdt"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// collabServer serves the collab endpoint to the user of the X-User header.
+func collabServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(r.Header.Get("X-User"))
+		HandleCollab(w, r.WithContext(context.WithValue(r.Context(), "userID", userID)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// collabConn is the client side of a collab connection.
+type collabConn struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialCollab opens the document of an item as a user and returns the
+// connection with its init message.
+func dialCollab(t *testing.T, srv *httptest.Server, userID int, widgetID, itemID string) (*collabConn, collabMessage) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /api/collab/%s/%s HTTP/1.1\r\nHost: test\r\nX-User: %d\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		widgetID, itemID, userID)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	c := &collabConn{t: t, conn: conn, br: br}
+	init := c.read()
+	if init.Type != collabInit {
+		t.Fatalf("first message = %+v, want init", init)
+	}
+	return c, init
+}
+
+// send writes a message in a masked text frame, as browsers do. The mask is
+// zero, which leaves the payload as is.
+func (c *collabConn) send(msg collabMessage) {
+	c.t.Helper()
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	header := []byte{0x81}
+	if n := len(payload); n < 126 {
+		header = append(header, 0x80|byte(n))
+	} else {
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	}
+	header = append(header, 0, 0, 0, 0)
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads the next message, skipping pings.
+func (c *collabConn) read() collabMessage {
+	c.t.Helper()
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			c.t.Fatal(err)
+		}
+		n := uint64(header[1] & 0x7f)
+		switch n {
+		case 126:
+			var ext [2]byte
+			io.ReadFull(c.br, ext[:])
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			io.ReadFull(c.br, ext[:])
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			c.t.Fatal(err)
+		}
+		if header[0]&0x0f != 0x1 {
+			continue
+		}
+		var msg collabMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			c.t.Fatal(err)
+		}
+		return msg
+	}
+}
+
+// insert sends the insertion of text after the character after.
+func (c *collabConn) insert(init collabMessage, counter int, after, text string) {
+	c.t.Helper()
+	id := crdt.ID{Site: init.Site, Counter: counter}
+	c.send(collabMessage{Type: collabUpdate, Ops: []crdt.Op{{Op: crdt.OpInsert, ID: id.String(), After: after, Text: text}}})
+}
+
+func collabSessionOf(t *testing.T, id string) *collabSession {
+	t.Helper()
+	collabSessions.Lock()
+	defer collabSessions.Unlock()
+	s := collabSessions.m[id]
+	if s == nil {
+		t.Fatalf("no session of %s", id)
+	}
+	return s
+}
+
+// sessionText returns the text of the document of a session.
+func sessionText(s *collabSession) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doc.Text()
+}
+
+// noteText returns the text and version of the tab of a note widget.
+func noteText(t *testing.T, userID int, widgetID, tabID string) (string, int) {
+	t.Helper()
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil || widget == nil {
+		t.Fatal(widget, err)
+	}
+	text, ok := collabItemText(*widget, tabID)
+	if !ok {
+		t.Fatalf("no tab %s in %s", tabID, widget.Content)
+	}
+	return text, widget.Version
+}
+
+const testNote = `{"notes":[{"id":"t1","title":"Tab","content":"hello"}]}`
+
+func TestCollabEditing(t *testing.T) {
+	srv := collabServer(t)
+	owner, editor, viewer := newTestUser(t), newTestUser(t), newTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, testNote)
+	database.SaveWidgetShare(widgetID, editor, models.ShareRoleEditor)
+	database.SaveWidgetShare(widgetID, viewer, models.ShareRoleViewer)
+
+	a, initA := dialCollab(t, srv, owner, widgetID, "t1")
+	b, initB := dialCollab(t, srv, editor, widgetID, "t1")
+	v, initV := dialCollab(t, srv, viewer, widgetID, "t1")
+	if initA.State.Text() != "hello" || initA.ReadOnly || initB.ReadOnly || !initV.ReadOnly {
+		t.Fatalf("init = %+v, %+v, %+v", initA, initB, initV)
+	}
+	if initA.Site == initB.Site {
+		t.Error("clients share a site")
+	}
+
+	// Updates are relayed to the other clients
+	a.insert(initA, initA.Clock+1, "server:5", " world")
+	for _, c := range []*collabConn{b, v} {
+		if msg := c.read(); msg.Type != collabUpdate || msg.Site != initA.Site || len(msg.Ops) != 1 {
+			t.Errorf("relayed update = %+v", msg)
+		}
+	}
+
+	// Viewers can't edit, and clients insert with their own site only
+	v.insert(initV, initV.Clock+7, "", "x")
+	if msg := v.read(); msg.Type != collabError || msg.Error != "document is read-only" {
+		t.Errorf("update of a viewer: %+v", msg)
+	}
+	b.insert(initA, initA.Clock+7, "", "x")
+	if msg := b.read(); msg.Type != collabError || !strings.Contains(msg.Error, "must use site") {
+		t.Errorf("update with another site: %+v", msg)
+	}
+
+	s := collabSessionOf(t, widgetID+"/t1")
+	if got := sessionText(s); got != "hello world" {
+		t.Fatalf("document = %q", got)
+	}
+
+	// Nothing is written while the document is edited
+	text, version := noteText(t, owner, widgetID, "t1")
+	compactCollabSessions()
+	if text2, version2 := noteText(t, owner, widgetID, "t1"); text2 != text || version2 != version {
+		t.Errorf("compaction of a busy document wrote %q at version %d", text2, version2)
+	}
+
+	// Once idle, the text is written to the widget
+	if err := s.compact(time.Now().Add(collabIdleDelay)); err != nil {
+		t.Fatal(err)
+	}
+	if text, v2 := noteText(t, owner, widgetID, "t1"); text != "hello world" || v2 != version+1 {
+		t.Errorf("widget = %q at version %d", text, v2)
+	}
+	if updates, _ := database.GetCollabUpdates(widgetID + "/t1"); len(updates) != 0 {
+		t.Errorf("%d updates left after compaction", len(updates))
+	}
+}
+
+func TestCollabCompactsWhenLeft(t *testing.T) {
+	srv := collabServer(t)
+	owner := newTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, testNote)
+
+	a, init := dialCollab(t, srv, owner, widgetID, "t1")
+	a.insert(init, init.Clock+1, "", "Oh, ")
+	s := collabSessionOf(t, widgetID+"/t1")
+	for deadline := time.Now().Add(5 * time.Second); sessionText(s) != "Oh, hello"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("update not applied")
+		}
+	}
+
+	a.conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if text, _ := noteText(t, owner, widgetID, "t1"); text == "Oh, hello" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("text not written once the client left")
+		}
+	}
+}
+
+func TestCollabMergesWidgetSaves(t *testing.T) {
+	srv := collabServer(t)
+	owner := newTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, testNote)
+
+	a, init := dialCollab(t, srv, owner, widgetID, "t1")
+	a.insert(init, init.Clock+1, "", "X")
+	s := collabSessionOf(t, widgetID+"/t1")
+	for deadline := time.Now().Add(5 * time.Second); sessionText(s) != "Xhello"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("update not applied")
+		}
+	}
+
+	// A save of the whole widget is merged, keeping the edits of the session
+	saveTestWidget(t, owner, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"t1","title":"Tab","content":"hello there"}]}`)
+	compactCollabSessions()
+	if msg := a.read(); msg.Type != collabUpdate || msg.Site != collabServerSite {
+		t.Errorf("merge = %+v", msg)
+	}
+	if got := sessionText(s); got != "Xhello there" {
+		t.Errorf("document after the merge = %q", got)
+	}
+
+	// Clients joining start from the saved text
+	saveTestWidget(t, owner, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"t1","title":"Tab","content":"hello there!"}]}`)
+	_, joined := dialCollab(t, srv, owner, widgetID, "t1")
+	if got := joined.State.Text(); got != "Xhello there!" {
+		t.Errorf("init after a save = %q", got)
+	}
+
+	if err := s.compact(time.Now().Add(collabIdleDelay)); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := noteText(t, owner, widgetID, "t1"); text != "Xhello there!" {
+		t.Errorf("widget = %q", text)
+	}
+}
+
+func TestCollabReloadsPendingUpdates(t *testing.T) {
+	srv := collabServer(t)
+	owner := newTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, testNote)
+	id := widgetID + "/t1"
+
+	a, init := dialCollab(t, srv, owner, widgetID, "t1")
+	a.insert(init, init.Clock+1, "", "X")
+	s := collabSessionOf(t, id)
+	for deadline := time.Now().Add(5 * time.Second); sessionText(s) != "Xhello"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("update not applied")
+		}
+	}
+	saveTestWidget(t, owner, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"t1","title":"Tab","content":"hello there"}]}`)
+	compactCollabSessions()
+
+	// The server stops before compacting
+	collabSessions.Lock()
+	s.mu.Lock()
+	s.unloaded = true
+	delete(collabSessions.m, id)
+	s.mu.Unlock()
+	collabSessions.Unlock()
+	a.conn.Close()
+
+	if err := loadPendingCollabSessions(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := collabSessionOf(t, id)
+	if got := sessionText(reloaded); got != "Xhello there" {
+		t.Errorf("reloaded document = %q", got)
+	}
+	if err := reloaded.compact(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := noteText(t, owner, widgetID, "t1"); text != "Xhello there" {
+		t.Errorf("widget = %q", text)
+	}
+}
+
+func TestSetCollabItemText(t *testing.T) {
+	content := map[string]json.RawMessage{
+		"wiki": json.RawMessage(`{"activePageId":"p1","pages":[{"id":"p1","title":"Home","content":"a","isPublic":true}]}`),
+	}
+	if err := setCollabItemText(content, models.WidgetTypeWiki, "p1", "b", "c"); !errors.Is(err, errCollabTextChanged) {
+		t.Errorf("with another previous text: %v, want %v", err, errCollabTextChanged)
+	}
+	if err := setCollabItemText(content, models.WidgetTypeWiki, "p2", "a", "c"); !errors.Is(err, errItemNotFound) {
+		t.Errorf("unknown page: %v, want %v", err, errItemNotFound)
+	}
+	if err := setCollabItemText(content, models.WidgetTypeWiki, "p1", "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"activePageId":"p1","pages":[{"content":"c","id":"p1","isPublic":true,"title":"Home"}]}`
+	if string(content["wiki"]) != want {
+		t.Errorf("content = %s, want %s", content["wiki"], want)
+	}
+}
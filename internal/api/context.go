@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/dashboard"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+)
+
+type DashboardContextResponse struct {
+	Language        string    `json:"language"`
+	GeneratedAt     time.Time `json:"generatedAt"`
+	EstimatedTokens int       `json:"estimatedTokens"`
+	Context         string    `json:"context"`
+}
+
+// HandleDashboardContext returns the plain text summary of the dashboard, as
+// given to the AI coach.
+// Route: GET /api/context?lang=pt-br&maxTokens=2000
+func HandleDashboardContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	maxTokens := dashboard.DefaultTokenBudget
+	if v := r.URL.Query().Get("maxTokens"); v != "" {
+		maxTokens, err = strconv.Atoi(v)
+		if err != nil || maxTokens < 0 {
+			http.Error(w, "Invalid maxTokens", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lang := dashboard.NormalizeLanguage(r.URL.Query().Get("lang"))
+	text, err := buildDashboardContext(userID, lang, maxTokens)
+	if err != nil {
+		http.Error(w, "Failed to build context", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DashboardContextResponse{
+		Language:        lang,
+		GeneratedAt:     time.Now().UTC(),
+		EstimatedTokens: dashboard.EstimateTokens(text),
+		Context:         text,
+	})
+}
+
+// buildDashboardContext summarises the user's widgets, with "today" in the
+// user's timezone. maxTokens 0 means no limit.
+func buildDashboardContext(userID int, lang string, maxTokens int) (string, error) {
+	widgets, err := database.GetAllWidgets(userID)
+	if err != nil {
+		return "", err
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		return "", err
+	}
+
+	return dashboard.BuildContext(widgets, dashboard.Options{
+		Language:  lang,
+		Now:       time.Now().In(userLocation(settings)),
+		MaxTokens: maxTokens,
+	}), nil
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/ai"
+	"github.com/gabrielhirakawa/lifehub/internal/dashboard"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	digestCheckInterval = time.Minute
+	// digestCatchUpWindow bounds how late a digest may still be delivered,
+	// e.g. after the server was down. A morning summary is useless at night.
+	digestCatchUpWindow = 3 * time.Hour
+	// digestTTL is how long push services keep the digest for offline devices.
+	digestTTL = 12 * time.Hour
+	// digestAITimeout bounds the optional AI rewrite.
+	digestAITimeout = 2 * time.Minute
+)
+
+// weekdays maps the weeklyDay setting to time weekdays.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// DigestResponse is a digest with its text, rewritten by the configured AI
+// provider when enabled.
+type DigestResponse struct {
+	dashboard.Digest
+	Text      string `json:"text"`
+	Rewritten bool   `json:"rewritten"`
+}
+
+// HandleDigestToday previews the digest of today. Without kind, it is the
+// digest the user receives today: weekly on the weekly day, daily otherwise.
+// ai=false skips the AI rewrite.
+// Route: GET /api/digest/today?kind=daily&lang=pt-br&ai=false
+func HandleDigestToday(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	digestSettings, err := database.GetDigestSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch digest settings", http.StatusInternalServerError)
+		return
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	switch kind {
+	case "":
+		kind = models.DigestDaily
+		if k, ok := digestKindFor(digestSettings, time.Now().In(userLocation(settings))); ok {
+			kind = k
+		}
+	case models.DigestDaily, models.DigestWeekly:
+	default:
+		http.Error(w, "Invalid kind, expected daily or weekly", http.StatusBadRequest)
+		return
+	}
+	if lang := query.Get("lang"); lang != "" {
+		digestSettings.Language = lang
+	}
+	rewrite := query.Get("ai") != "false"
+
+	digest, err := composeDigest(userID, digestSettings, kind, rewrite)
+	if err != nil {
+		log.Println("Error composing digest:", err)
+		http.Error(w, "Failed to compose digest", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(digest)
+}
+
+// HandleDigestSettings returns or updates the digest settings of the
+// authenticated user.
+// Routes: GET /api/settings/digest, PUT /api/settings/digest
+func HandleDigestSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := database.GetDigestSettings(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch digest settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	case http.MethodPut:
+		settings := models.DefaultDigestSettings()
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := time.Parse("15:04", settings.Time); err != nil {
+			http.Error(w, "Invalid digest time, expected HH:MM", http.StatusBadRequest)
+			return
+		}
+		settings.WeeklyDay = strings.ToLower(settings.WeeklyDay)
+		if _, ok := weekdays[settings.WeeklyDay]; !ok {
+			http.Error(w, "Invalid weekly day, expected monday to sunday", http.StatusBadRequest)
+			return
+		}
+		settings.Language = dashboard.NormalizeLanguage(settings.Language)
+		if settings.AIProvider != "" {
+			if !ai.IsKnownProvider(settings.AIProvider) {
+				http.Error(w, "Unknown AI provider", http.StatusBadRequest)
+				return
+			}
+			if settings.AIModel == "" && ai.DefaultModel(settings.AIProvider) == "" {
+				http.Error(w, "Model required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := database.SaveDigestSettings(userID, settings); err != nil {
+			log.Println("Error saving digest settings:", err)
+			http.Error(w, "Failed to save digest settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// StartDigestScheduler periodically sends the daily and weekly digests at
+// the time chosen by each user. Deliveries are tracked in notification_log,
+// so a digest is sent at most once a day.
+func StartDigestScheduler() {
+	go func() {
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+		for {
+			checkDueDigests(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// checkDueDigests sends the digests due at the given time.
+func checkDueDigests(now time.Time) {
+	subscribers, err := database.GetDigestSubscribers()
+	if err != nil {
+		log.Println("Digest scheduler:", err)
+		return
+	}
+
+	for userID, digestSettings := range subscribers {
+		settings, err := database.GetUserSettings(userID)
+		if err != nil {
+			log.Println("Digest scheduler failed to load settings:", err)
+			continue
+		}
+		local := now.In(userLocation(settings))
+
+		kind, ok := digestKindFor(digestSettings, local)
+		if !ok {
+			continue
+		}
+		clock, err := time.Parse("15:04", digestSettings.Time)
+		if err != nil {
+			continue
+		}
+		dueAt := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, local.Location())
+		if dueAt.After(local) || local.Sub(dueAt) > digestCatchUpWindow {
+			continue
+		}
+
+		// One digest per local day, even if the user changes the time
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		logID, claimed, err := database.ClaimNotification(userID, "digest", kind+":"+strconv.Itoa(userID), day.UTC().Format(time.RFC3339), now)
+		if err != nil {
+			log.Println("Digest scheduler:", err)
+			continue
+		}
+		if !claimed {
+			continue // Already sent, or waiting for a retry
+		}
+		// The AI rewrite may take a while; don't hold back the other users
+		go sendDigest(userID, digestSettings, kind, logID)
+	}
+}
+
+// digestKindFor returns the digest due on the day of now: the weekly digest
+// replaces the daily one on its day.
+func digestKindFor(s models.DigestSettings, now time.Time) (string, bool) {
+	if day, ok := weekdays[s.WeeklyDay]; s.Weekly && ok && now.Weekday() == day {
+		return models.DigestWeekly, true
+	}
+	if s.Daily {
+		return models.DigestDaily, true
+	}
+	return "", false
+}
+
+func sendDigest(userID int, digestSettings models.DigestSettings, kind string, logID int64) {
+	digest, err := composeDigest(userID, digestSettings, kind, true)
+	if err != nil {
+		log.Println("Digest scheduler:", err)
+		database.MarkNotification(logID, database.NotificationFailed)
+		return
+	}
+
+	tag := "digest-" + kind
+	payload := PushPayload{
+		Title: digest.Title,
+		Body:  strings.TrimPrefix(digest.Text, digest.Title+"\n\n"),
+		Tag:   tag,
+	}
+	// Normal urgency: a digest scheduled during quiet hours waits for their end
+	opts := PushOptions{
+		TTL:      int(digestTTL.Seconds()),
+		Urgency:  webpush.UrgencyNormal,
+		Topic:    PushTopic(tag),
+		Category: models.NotificationDigest,
+	}
+	delivered, err := NotifyUser(userID, payload, opts)
+	if err := database.MarkNotification(logID, notificationStatus(delivered, err)); err != nil {
+		log.Println("Digest scheduler:", err)
+	}
+}
+
+// composeDigest builds the digest of the user's dashboard, in the user's
+// timezone, rewriting it with the configured AI provider when asked to.
+// A failed rewrite falls back to the plain digest.
+func composeDigest(userID int, digestSettings models.DigestSettings, kind string, rewrite bool) (DigestResponse, error) {
+	widgets, err := database.GetAllWidgets(userID)
+	if err != nil {
+		return DigestResponse{}, err
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		return DigestResponse{}, err
+	}
+
+	lang := dashboard.NormalizeLanguage(digestSettings.Language)
+	digest := dashboard.BuildDigest(widgets, kind, dashboard.Options{
+		Language: lang,
+		Now:      time.Now().In(userLocation(settings)),
+	})
+	resp := DigestResponse{Digest: digest, Text: digest.Text()}
+
+	if rewrite && digestSettings.AIProvider != "" {
+		text, err := rewriteDigest(userID, digestSettings, lang, resp.Text)
+		if err != nil {
+			log.Printf("Digest AI rewrite (%s) failed: %v\n", digestSettings.AIProvider, err)
+		} else {
+			resp.Text = digest.Title + "\n\n" + text
+			resp.Rewritten = true
+		}
+	}
+	return resp, nil
+}
+
+// rewriteDigest asks the user's AI provider to turn the digest into a
+// friendlier message.
+func rewriteDigest(userID int, digestSettings models.DigestSettings, lang, text string) (string, error) {
+	cfg, err := loadAIConfig(userID, digestSettings.AIProvider)
+	if err != nil {
+		return "", err
+	}
+	if cfg == nil || (cfg.APIKey == "" && ai.RequiresAPIKey(digestSettings.AIProvider)) {
+		return "", fmt.Errorf("no API key configured for %s", digestSettings.AIProvider)
+	}
+	provider, err := ai.NewProvider(*cfg)
+	if err != nil {
+		return "", err
+	}
+
+	model := digestSettings.AIModel
+	if model == "" {
+		model = ai.DefaultModel(digestSettings.AIProvider)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), digestAITimeout)
+	defer cancel()
+
+	var answer strings.Builder
+	_, err = provider.Stream(ctx, ai.ChatRequest{
+		Model:     model,
+		System:    dashboard.TermsFor(lang).DigestRewritePrompt,
+		Messages:  []ai.Message{{Role: ai.RoleUser, Content: text}},
+		MaxTokens: ai.DefaultMaxTokens,
+	}, func(delta string) error {
+		answer.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	rewritten := strings.TrimSpace(answer.String())
+	if rewritten == "" {
+		return "", fmt.Errorf("empty answer")
+	}
+	return rewritten, nil
+}
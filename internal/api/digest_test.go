@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestDigestKindFor(t *testing.T) {
+	monday := time.Date(2026, 3, 9, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		settings models.DigestSettings
+		now      time.Time
+		want     string
+	}{
+		{"daily", models.DigestSettings{Daily: true, Weekly: true, WeeklyDay: "monday"}, monday.AddDate(0, 0, 1), models.DigestDaily},
+		{"weekly replaces daily", models.DigestSettings{Daily: true, Weekly: true, WeeklyDay: "monday"}, monday, models.DigestWeekly},
+		{"weekly only", models.DigestSettings{Weekly: true, WeeklyDay: "monday"}, monday, models.DigestWeekly},
+		{"not the weekly day", models.DigestSettings{Weekly: true, WeeklyDay: "monday"}, monday.AddDate(0, 0, 1), ""},
+		{"off", models.DigestSettings{WeeklyDay: "monday"}, monday, ""},
+	}
+	for _, tt := range tests {
+		if kind, ok := digestKindFor(tt.settings, tt.now); kind != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: digestKindFor() = %q, %v, want %q", tt.name, kind, ok, tt.want)
+		}
+	}
+}
+
+func TestDigestScheduler(t *testing.T) {
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusOK)
+	createChannel(t, userID, map[string]any{"type": "webhook", "enabled": true, "config": map[string]any{"url": url}})
+	settings := models.DefaultUserSettings()
+	settings.Timezone = "America/Sao_Paulo" // UTC-3
+	if err := database.SaveUserSettings(userID, settings); err != nil {
+		t.Fatal(err)
+	}
+	digestSettings := models.DefaultDigestSettings()
+	digestSettings.Daily = true
+	digestSettings.Time = "07:00"
+	if err := database.SaveDigestSettings(userID, digestSettings); err != nil {
+		t.Fatal(err)
+	}
+	newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"1","text":"Water the plants","completed":false}]}`)
+
+	// Digests are sent from a goroutine
+	sent := func(wait time.Duration) int {
+		t.Helper()
+		n := 0
+		for {
+			select {
+			case r := <-received:
+				if !strings.Contains(string(r.body), "Water the plants") {
+					t.Errorf("digest = %s", r.body)
+				}
+				n++
+				wait = 100 * time.Millisecond
+			case <-time.After(wait):
+				return n
+			}
+		}
+	}
+
+	// 07:00 in São Paulo is 10:00 UTC
+	checkDueDigests(time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC))
+	if n := sent(200 * time.Millisecond); n != 0 {
+		t.Errorf("sent %d digests before time", n)
+	}
+	checkDueDigests(time.Date(2026, 3, 10, 10, 5, 0, 0, time.UTC))
+	if n := sent(5 * time.Second); n != 1 {
+		t.Fatalf("sent %d digests, want 1", n)
+	}
+
+	// Once a day, even if the time changes
+	checkDueDigests(time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC))
+	digestSettings.Time = "08:30"
+	if err := database.SaveDigestSettings(userID, digestSettings); err != nil {
+		t.Fatal(err)
+	}
+	checkDueDigests(time.Date(2026, 3, 10, 11, 45, 0, 0, time.UTC))
+	if n := sent(200 * time.Millisecond); n != 0 {
+		t.Errorf("sent %d more digests the same day", n)
+	}
+
+	// Too late to catch up on a missed morning
+	checkDueDigests(time.Date(2026, 3, 11, 15, 0, 0, 0, time.UTC))
+	if n := sent(200 * time.Millisecond); n != 0 {
+		t.Errorf("sent %d digests in the afternoon", n)
+	}
+	checkDueDigests(time.Date(2026, 3, 12, 11, 40, 0, 0, time.UTC))
+	if n := sent(5 * time.Second); n != 1 {
+		t.Errorf("sent %d digests the next day, want 1", n)
+	}
+}
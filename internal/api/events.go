@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+)
+
+const (
+	widgetEventLogSize = 1000
+	// eventsHeartbeat is below the idle timeout of common reverse proxies
+	// (60s for nginx)
+	eventsHeartbeat = 25 * time.Second
+	eventsRetry     = 5 * time.Second
+)
+
+// Types of WidgetEvent, used as SSE event names. A reset tells the client
+// that events were missed and it should reload its widgets.
+const (
+	widgetEventChanged = "widget-changed"
+	widgetEventDeleted = "widget-deleted"
+	widgetEventReset   = "reset"
+)
+
+// WidgetEvent tells the clients of a user that a widget changed. Clients
+// fetch the widget again unless they already have that version.
+type WidgetEvent struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	WidgetID string `json:"widgetId,omitempty"`
+	Version  int    `json:"version,omitempty"`
+	userID   int
+}
+
+// widgetEventLog keeps the last events of all users for Last-Event-ID
+// resumption, and wakes the streams of the users they concern.
+type widgetEventLog struct {
+	mu      sync.Mutex
+	events  []WidgetEvent
+	nextID  int64
+	dropped int64 // Highest ID no longer in the log
+	waiters map[int]map[chan struct{}]struct{}
+}
+
+// IDs start at the startup time so that they keep increasing across
+// restarts: clients resuming from a previous run get a reset.
+var widgetEvents = newWidgetEventLog(time.Now().UnixMicro())
+
+func newWidgetEventLog(firstID int64) *widgetEventLog {
+	return &widgetEventLog{
+		nextID:  firstID,
+		dropped: firstID - 1,
+		waiters: make(map[int]map[chan struct{}]struct{}),
+	}
+}
+
+// publish records an event for each user and wakes their streams.
+func (l *widgetEventLog) publish(userIDs []int, eventType, widgetID string, version int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, userID := range userIDs {
+		l.events = append(l.events, WidgetEvent{ID: l.nextID, Type: eventType, WidgetID: widgetID, Version: version, userID: userID})
+		l.nextID++
+		for wake := range l.waiters[userID] {
+			select {
+			case wake <- struct{}{}:
+			default: // Already pending
+			}
+		}
+	}
+	if over := len(l.events) - widgetEventLogSize; over > 0 {
+		l.dropped = l.events[over-1].ID
+		l.events = append([]WidgetEvent(nil), l.events[over:]...)
+	}
+}
+
+// subscribe returns a channel signalled when an event for the user is
+// published, and the function to unsubscribe.
+func (l *widgetEventLog) subscribe(userID int) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.waiters[userID] == nil {
+		l.waiters[userID] = make(map[chan struct{}]struct{})
+	}
+	l.waiters[userID][wake] = struct{}{}
+	return wake, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.waiters[userID], wake)
+		if len(l.waiters[userID]) == 0 {
+			delete(l.waiters, userID)
+		}
+	}
+}
+
+// current returns the ID of the last event published.
+func (l *widgetEventLog) current() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextID - 1
+}
+
+// since returns the events of the user after lastID, and the ID to resume
+// from. ok is false if events after lastID are no longer available, or
+// lastID was never issued.
+func (l *widgetEventLog) since(userID int, lastID int64) (events []WidgetEvent, last int64, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last = l.nextID - 1
+	if lastID < l.dropped || lastID > last {
+		return nil, last, false
+	}
+	for _, e := range l.events {
+		if e.ID > lastID && e.userID == userID {
+			events = append(events, e)
+		}
+	}
+	return events, last, true
+}
+
+// notifyWidgetChanged publishes the change of a widget to its owner and the
+// users it is shared with. Called once a write committed.
+func notifyWidgetChanged(widgetID string) {
+	users, version, active, err := database.GetWidgetAudience(widgetID)
+	if err != nil {
+		log.Println("Error publishing widget event:", err)
+		return
+	}
+	eventType := widgetEventChanged
+	if !active {
+		eventType = widgetEventDeleted
+	}
+	publishWidgetChange(users, eventType, widgetID, version)
+}
+
+// publishWidgetChange pushes a change of a widget to the event streams of
+// the given users. The change is recorded for delta sync by the write
+// itself (see database.InitWidgetChangesTable).
+func publishWidgetChange(userIDs []int, eventType, widgetID string, version int) {
+	widgetEvents.publish(userIDs, eventType, widgetID, version)
+}
+
+// HandleEvents streams the widget changes of the user, including those of
+// the widgets shared with them, as Server-Sent Events. Reconnecting clients
+// send Last-Event-ID (or ?lastEventId=) to get the events they missed; if
+// those are gone they get a reset event instead. A comment is sent every
+// 25s to keep proxies from closing the connection.
+// Route: GET /api/events
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("lastEventId")
+	}
+	var lastID int64
+	if resume != "" {
+		if lastID, err = strconv.ParseInt(resume, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before reading the log so that no event falls in between
+	wake, unsubscribe := widgetEvents.subscribe(userID)
+	defer unsubscribe()
+	if resume == "" {
+		lastID = widgetEvents.current()
+	}
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, last, ok := widgetEvents.since(userID, lastID)
+		if !ok {
+			events = []WidgetEvent{{ID: last, Type: widgetEventReset}}
+		}
+		for _, e := range events {
+			if err := writeSSE(w, flusher, strconv.FormatInt(e.ID, 10), e.Type, e); err != nil {
+				return
+			}
+			lastID = e.ID
+		}
+		lastID = max(lastID, last)
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
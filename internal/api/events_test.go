@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// eventsServer serves HandleEvents to the user in the X-User-ID header.
+func eventsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(r.Header.Get("X-User-ID"))
+		HandleEvents(w, r.WithContext(context.WithValue(r.Context(), "userID", userID)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type eventStream struct {
+	t      *testing.T
+	events chan sseEvent
+	cancel context.CancelFunc
+}
+
+type sseEvent struct {
+	id, event string
+	data      WidgetEvent
+}
+
+// openEventStream connects to the events of a user, from lastEventID unless
+// empty, and returns once the server is streaming.
+func openEventStream(t *testing.T, srv *httptest.Server, userID int, lastEventID string) *eventStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events", nil)
+	req.Header.Set("X-User-ID", strconv.Itoa(userID))
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s := &eventStream{t: t, events: make(chan sseEvent, 10), cancel: cancel}
+	br := bufio.NewReader(resp.Body)
+	// The retry field comes once the user is subscribed
+	if line, err := br.ReadString('\n'); err != nil || !strings.HasPrefix(line, "retry: ") {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	go func() {
+		defer resp.Body.Close()
+		var e sseEvent
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				close(s.events)
+				return
+			}
+			switch line = strings.TrimSuffix(line, "\n"); {
+			case line == "":
+				if e.event != "" {
+					s.events <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data)
+			}
+		}
+	}()
+	return s
+}
+
+// next returns the next event of the stream.
+func (s *eventStream) next() sseEvent {
+	s.t.Helper()
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			s.t.Fatal("stream closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	srv := eventsServer(t)
+	owner, recipient, other := newTestUser(t), newTestUser(t), newTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, `{"notes":[]}`)
+	if err := database.SaveWidgetShare(widgetID, recipient, models.ShareRoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	otherWidget := newTestWidget(t, other, models.WidgetTypeNote, `{"notes":[]}`)
+
+	ownerStream := openEventStream(t, srv, owner, "")
+	recipientStream := openEventStream(t, srv, recipient, "")
+	otherStream := openEventStream(t, srv, other, "")
+
+	saveTestWidget(t, owner, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"a","title":"A","content":"x"}]}`)
+	var first sseEvent
+	for name, s := range map[string]*eventStream{"owner": ownerStream, "recipient": recipientStream} {
+		e := s.next()
+		if e.event != widgetEventChanged || e.data.WidgetID != widgetID || e.data.Version != 2 || e.id != strconv.FormatInt(e.data.ID, 10) {
+			t.Errorf("%s got %+v", name, e)
+		}
+		if s == recipientStream {
+			// Every user has their own event IDs
+			first = e
+		}
+	}
+
+	// Users the widget isn't shared with only get their own changes
+	saveTestWidget(t, other, otherWidget, models.WidgetTypeNote, `{"notes":[{"id":"b","title":"B","content":"y"}]}`)
+	if e := otherStream.next(); e.data.WidgetID != otherWidget {
+		t.Errorf("other user got %+v", e)
+	}
+
+	// Deleting the widget reaches the recipient too
+	if w := serveAs(t, owner, HandleDeleteWidget, http.MethodDelete, "/api/widgets/delete/"+widgetID, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if e := recipientStream.next(); e.event != widgetEventDeleted || e.data.WidgetID != widgetID {
+		t.Errorf("recipient got %+v", e)
+	}
+
+	// Reconnecting replays the missed events, unless they are unknown
+	firstID, _ := strconv.ParseInt(first.id, 10, 64)
+	resumed := openEventStream(t, srv, recipient, strconv.FormatInt(firstID-1, 10))
+	if e := resumed.next(); e.id != first.id {
+		t.Errorf("resumed with %+v, want event %s", e, first.id)
+	}
+	if e := resumed.next(); e.event != widgetEventDeleted {
+		t.Errorf("resumed with %+v, want the deletion", e)
+	}
+	if e := openEventStream(t, srv, recipient, "1").next(); e.event != widgetEventReset {
+		t.Errorf("resumed from an unknown event with %+v, want a reset", e)
+	}
+}
+
+func TestEventsUnsubscribeOnDisconnect(t *testing.T) {
+	srv := eventsServer(t)
+	userID := newTestUser(t)
+	subscribed := func() int {
+		widgetEvents.mu.Lock()
+		defer widgetEvents.mu.Unlock()
+		return len(widgetEvents.waiters[userID])
+	}
+
+	s1 := openEventStream(t, srv, userID, "")
+	s2 := openEventStream(t, srv, userID, "")
+	if n := subscribed(); n != 2 {
+		t.Fatalf("%d streams subscribed, want 2", n)
+	}
+
+	s1.cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribed() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d streams subscribed after a disconnect, want 1", subscribed())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The remaining stream still gets events
+	widgetID := newTestWidget(t, userID, models.WidgetTypeNote, `{"notes":[]}`)
+	saveTestWidget(t, userID, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"a","title":"A","content":"x"}]}`)
+	if e := s2.next(); e.data.WidgetID != widgetID {
+		t.Errorf("got %+v", e)
+	}
+
+	s2.cancel()
+	for subscribed() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream still subscribed after a disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/ical"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/recurrence"
+)
+
+// CalendarFeedResponse tells whether the calendar feed is enabled. The
+// secret URL, relative to the server, is only returned when generated: the
+// server keeps a hash of the token.
+type CalendarFeedResponse struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// HandleCalendarFeedToken tells whether the calendar feed of the
+// authenticated user is enabled, generates a new URL (invalidating the
+// previous one) or disables the feed.
+// Routes: GET, POST, DELETE /api/ical/token
+func HandleCalendarFeedToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var resp CalendarFeedResponse
+	switch r.Method {
+	case http.MethodGet:
+		resp.Enabled, err = database.HasCalendarFeed(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost:
+		bytes := make([]byte, 24)
+		if _, err := rand.Read(bytes); err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		token := hex.EncodeToString(bytes)
+		if err := database.SetCalendarFeedToken(userID, token); err != nil {
+			log.Println("Error saving calendar feed token:", err)
+			http.Error(w, "Failed to save calendar feed", http.StatusInternalServerError)
+			return
+		}
+		resp = CalendarFeedResponse{Enabled: true, Token: token, URL: "/ical/" + token + ".ics"}
+
+	case http.MethodDelete:
+		if err := database.DeleteCalendarFeedToken(userID); err != nil {
+			http.Error(w, "Failed to disable calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleCalendarFeed renders the reminders and dated todos of the owner of
+// the token as an iCalendar feed, for calendar apps to subscribe to.
+// No authentication: the token is the secret.
+// Route: GET /ical/{token}.ics
+func HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "ical", "{token}.ics"]
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".ics") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	token := strings.TrimSuffix(parts[2], ".ics")
+	if token == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	userID, err := database.GetCalendarFeedUser(token)
+	if err != nil {
+		http.Error(w, "Failed to fetch calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if userID == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	widgets, err := database.GetAllWidgets(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widgets", http.StatusInternalServerError)
+		return
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+		return
+	}
+
+	var cal ical.Writer
+	cal.Begin("VCALENDAR")
+	writeCalendarHeader(&cal, "LifeHub", settings)
+	for _, widget := range widgets {
+		var content models.WidgetContentWrapper
+		if err := json.Unmarshal(widget.Content, &content); err != nil {
+			continue
+		}
+		switch widget.Type {
+		case models.WidgetTypeReminder:
+			done := make(map[string][]string)
+			for _, item := range content.Reminders {
+				if item.RRule != "" && item.Completed {
+					id := seriesOf(item.Recurrence, item.ID, item.Date).SeriesID
+					done[id] = append(done[id], item.Date)
+				}
+			}
+			for _, item := range content.Reminders {
+				writeReminderEvent(&cal, widget, item, done)
+			}
+		case models.WidgetTypeTodo:
+			done := make(map[string][]string)
+			for _, todo := range content.Todos {
+				if todo.RRule != "" && todo.Completed {
+					id := seriesOf(todo.Recurrence, todo.ID, todo.DueDate).SeriesID
+					done[id] = append(done[id], todo.DueDate)
+				}
+			}
+			for _, todo := range content.Todos {
+				if todo.DueDate != "" {
+					writeTodo(&cal, widget, todo, done)
+				}
+			}
+		}
+	}
+	cal.End("VCALENDAR")
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="lifehub.ics"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write([]byte(cal.String()))
+}
+
+// writeCalendarHeader writes the properties of a VCALENDAR.
+func writeCalendarHeader(cal *ical.Writer, name string, settings models.UserSettings) {
+	cal.Raw("VERSION", "2.0")
+	cal.Raw("PRODID", "-//LifeHub//LifeHub//EN")
+	cal.Raw("CALSCALE", "GREGORIAN")
+	cal.Raw("METHOD", "PUBLISH")
+	cal.Text("X-WR-CALNAME", name)
+	cal.Text("X-WR-TIMEZONE", settings.Timezone)
+	// Hints for subscribers on how often to refresh
+	cal.Raw("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	cal.Raw("X-PUBLISHED-TTL", "PT1H")
+}
+
+// itemUID is the iCalendar UID of a todo or reminder. It only depends on
+// the widget and item IDs, so that it is stable across exports.
+func itemUID(widgetID, itemID string) string {
+	return widgetID + "-" + itemID + "@lifehub"
+}
+
+// exportedItem returns the UID and date to export an item with: pending
+// occurrences of recurring items stand for their whole series, from which
+// the completed occurrences are excluded to be exported on their own.
+func exportedItem(widgetID, id, date string, rec models.Recurrence, completed bool) (string, string) {
+	if rec.RRule == "" {
+		return itemUID(widgetID, id), date
+	}
+	rec = seriesOf(rec, id, date)
+	if completed {
+		// Not the ID: the first occurrence has the ID of the series
+		return itemUID(widgetID, occurrenceID(rec, date)), date
+	}
+	return itemUID(widgetID, rec.SeriesID), rec.SeriesStart
+}
+
+// writeReminderEvent writes a reminder as an all-day VEVENT. Events can't
+// be completed in iCalendar: completed reminders are marked in the summary.
+// done holds the dates of the completed occurrences of each series.
+func writeReminderEvent(cal *ical.Writer, widget models.Widget, item models.ReminderItem, done map[string][]string) {
+	uid, start := exportedItem(widget.ID, item.ID, item.Date, item.Recurrence, item.Completed)
+	date, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return
+	}
+	summary := item.Text
+	if item.Completed {
+		summary = "✓ " + summary
+	}
+
+	cal.Begin("VEVENT")
+	cal.Text("UID", uid)
+	cal.Raw("DTSTAMP", ical.UTC(widget.UpdatedAt))
+	cal.Raw("LAST-MODIFIED", ical.UTC(widget.UpdatedAt))
+	cal.Raw("DTSTART;VALUE=DATE", date.Format("20060102"))
+	cal.Raw("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format("20060102"))
+	cal.Text("SUMMARY", summary)
+	cal.Text("CATEGORIES", widget.Title)
+	cal.Raw("TRANSP", "TRANSPARENT")
+	if item.Completed {
+		cal.Raw("X-LIFEHUB-COMPLETED", "TRUE")
+	} else {
+		writeRecurrence(cal, item.Recurrence, done[seriesOf(item.Recurrence, item.ID, item.Date).SeriesID])
+	}
+	cal.End("VEVENT")
+}
+
+// todoPriorities maps todo priorities to iCalendar priorities (1 is the
+// highest).
+var todoPriorities = map[string]string{
+	models.TodoPriorityHigh:   "1",
+	models.TodoPriorityMedium: "5",
+	models.TodoPriorityLow:    "9",
+}
+
+// writeTodo writes a dated todo as a VTODO, due on its date. done holds the
+// dates of the completed occurrences of each series.
+func writeTodo(cal *ical.Writer, widget models.Widget, todo models.TodoItem, done map[string][]string) {
+	uid, start := exportedItem(widget.ID, todo.ID, todo.DueDate, todo.Recurrence, todo.Completed)
+	due := ical.Date(start)
+	if due == "" {
+		return
+	}
+
+	cal.Begin("VTODO")
+	cal.Text("UID", uid)
+	cal.Raw("DTSTAMP", ical.UTC(widget.UpdatedAt))
+	cal.Raw("LAST-MODIFIED", ical.UTC(widget.UpdatedAt))
+	cal.Raw("DTSTART;VALUE=DATE", due)
+	cal.Raw("DUE;VALUE=DATE", due)
+	cal.Text("SUMMARY", todo.Text)
+	cal.Text("CATEGORIES", widget.Title)
+	cal.Raw("PRIORITY", todoPriorities[todo.Priority])
+	if todo.Completed {
+		cal.Raw("STATUS", "COMPLETED")
+		cal.Raw("PERCENT-COMPLETE", "100")
+		if completedAt, err := time.Parse(time.RFC3339, todo.CompletedAt); err == nil {
+			cal.Raw("COMPLETED", ical.UTC(completedAt))
+		}
+	} else {
+		cal.Raw("STATUS", "NEEDS-ACTION")
+		writeRecurrence(cal, todo.Recurrence, done[seriesOf(todo.Recurrence, todo.ID, todo.DueDate).SeriesID])
+	}
+	cal.End("VTODO")
+}
+
+// writeRecurrence writes the recurrence of a series, exported from the
+// date of its first occurrence, excluding the skipped dates and the dates
+// in done.
+func writeRecurrence(cal *ical.Writer, rec models.Recurrence, done []string) {
+	rule := strings.ToUpper(strings.TrimPrefix(rec.RRule, "RRULE:"))
+	if _, err := recurrence.Parse(rule); err != nil {
+		return
+	}
+	cal.Raw("RRULE", rule)
+	for _, d := range append(append([]string(nil), rec.ExDates...), done...) {
+		cal.Raw("EXDATE;VALUE=DATE", ical.Date(d))
+	}
+}
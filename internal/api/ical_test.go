@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/ical"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// fetchCalendarFeed fetches a feed anonymously, as calendar apps do.
+func fetchCalendarFeed(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	HandleCalendarFeed(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func calendarFeedToken(t *testing.T, userID int, method string) CalendarFeedResponse {
+	t.Helper()
+	w := serveAs(t, userID, HandleCalendarFeedToken, method, "/api/ical/token", nil)
+	var resp CalendarFeedResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("%s token: %d %s", method, w.Code, w.Body)
+	}
+	return resp
+}
+
+func TestCalendarFeedToken(t *testing.T) {
+	userID := newTestUser(t)
+	if resp := calendarFeedToken(t, userID, http.MethodGet); resp.Enabled || resp.URL != "" {
+		t.Errorf("disabled feed = %+v", resp)
+	}
+
+	first := calendarFeedToken(t, userID, http.MethodPost)
+	if !first.Enabled || len(first.Token) != 48 || first.URL != "/ical/"+first.Token+".ics" {
+		t.Fatalf("generated feed = %+v", first)
+	}
+	if w := fetchCalendarFeed(first.URL); w.Code != http.StatusOK || w.Header().Get("Content-Type") != ical.ContentType {
+		t.Errorf("feed: %d %v", w.Code, w.Header())
+	}
+	// The URL can't be read back
+	if resp := calendarFeedToken(t, userID, http.MethodGet); !resp.Enabled || resp.Token != "" || resp.URL != "" {
+		t.Errorf("enabled feed = %+v", resp)
+	}
+
+	// Regenerating invalidates the previous URL
+	second := calendarFeedToken(t, userID, http.MethodPost)
+	if second.Token == first.Token {
+		t.Fatal("token wasn't regenerated")
+	}
+	if w := fetchCalendarFeed(first.URL); w.Code != http.StatusNotFound {
+		t.Errorf("previous feed: %d", w.Code)
+	}
+	if w := fetchCalendarFeed(second.URL); w.Code != http.StatusOK {
+		t.Errorf("new feed: %d", w.Code)
+	}
+
+	if resp := calendarFeedToken(t, userID, http.MethodDelete); resp.Enabled {
+		t.Errorf("deleted feed = %+v", resp)
+	}
+	for _, path := range []string{second.URL, "/ical/unknown.ics", "/ical/.ics", "/ical/" + second.Token, "/ical/a/b.ics"} {
+		if w := fetchCalendarFeed(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: %d", path, w.Code)
+		}
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	userID := newTestUser(t)
+	reminders := newTestWidget(t, userID, models.WidgetTypeReminder, `{"reminders":[
+		{"id":"r1","text":"Dentist, 10:00","date":"2026-03-12","completed":false},
+		{"id":"r2","text":"Call Ana","date":"2026-03-01","completed":true},
+		{"id":"r3","text":"Gym","date":"2026-03-02","completed":true,"rrule":"FREQ=WEEKLY"},
+		{"id":"r3-20260309","text":"Gym","date":"2026-03-09","completed":false,"rrule":"FREQ=WEEKLY","seriesId":"r3","seriesStart":"2026-03-02","exdates":["2026-03-16"]}
+	]}`)
+	todos := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[
+		{"id":"t1","text":"Taxes","completed":false,"dueDate":"2026-03-15","priority":"high"},
+		{"id":"t2","text":"Report","completed":true,"dueDate":"2026-03-05","completedAt":"2026-03-04T18:30:00Z"},
+		{"id":"t3","text":"Someday","completed":false}
+	]}`)
+	feed := calendarFeedToken(t, userID, http.MethodPost)
+
+	parse := func() map[string]*ical.Component {
+		t.Helper()
+		w := fetchCalendarFeed(feed.URL)
+		cal, err := ical.Parse(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := make(map[string]*ical.Component)
+		for _, c := range cal.Children {
+			items[c.Name+" "+c.Text("UID")] = c
+		}
+		return items
+	}
+	items := parse()
+	if len(items) != 6 {
+		t.Errorf("items = %v", items)
+	}
+	get := func(kind, widgetID, itemID string) *ical.Component {
+		t.Helper()
+		c := items[kind+" "+widgetID+"-"+itemID+"@lifehub"]
+		if c == nil {
+			t.Fatalf("%s %s not exported", kind, itemID)
+		}
+		return c
+	}
+
+	event := get("VEVENT", reminders, "r1")
+	if event.Text("SUMMARY") != "Dentist, 10:00" || event.Get("DTSTART").Value != "20260312" || event.Get("DTEND").Value != "20260313" ||
+		event.Get("X-LIFEHUB-COMPLETED") != nil {
+		t.Errorf("reminder = %+v", event.Properties)
+	}
+	if event := get("VEVENT", reminders, "r2"); event.Text("SUMMARY") != "✓ Call Ana" || event.Get("X-LIFEHUB-COMPLETED") == nil {
+		t.Errorf("completed reminder = %+v", event.Properties)
+	}
+
+	// Series start at their first occurrence, without the completed ones
+	series := get("VEVENT", reminders, "r3")
+	var exdates []string
+	for _, p := range series.All("EXDATE") {
+		exdates = append(exdates, p.Value)
+	}
+	if series.Get("RRULE").Value != "FREQ=WEEKLY" || series.Get("DTSTART").Value != "20260302" || strings.Join(exdates, ",") != "20260316,20260302" {
+		t.Errorf("series = %+v", series.Properties)
+	}
+	if done := get("VEVENT", reminders, "r3-20260302"); done.Get("RRULE") != nil || done.Get("DTSTART").Value != "20260302" {
+		t.Errorf("completed occurrence = %+v", done.Properties)
+	}
+
+	todo := get("VTODO", todos, "t1")
+	if todo.Text("STATUS") != "NEEDS-ACTION" || todo.Get("DUE").Value != "20260315" || todo.Text("PRIORITY") != "1" || todo.Get("COMPLETED") != nil {
+		t.Errorf("todo = %+v", todo.Properties)
+	}
+	done := get("VTODO", todos, "t2")
+	if done.Text("STATUS") != "COMPLETED" || done.Text("PERCENT-COMPLETE") != "100" || done.Get("COMPLETED").Value != "20260304T183000Z" {
+		t.Errorf("completed todo = %+v", done.Properties)
+	}
+
+	// UIDs don't change with the content
+	saveTestWidget(t, userID, todos, models.WidgetTypeTodo, `{"todos":[
+		{"id":"t1","text":"Pay taxes","completed":true,"dueDate":"2026-03-15"},
+		{"id":"t2","text":"Report","completed":true,"dueDate":"2026-03-05"}
+	]}`)
+	items = parse()
+	if todo := get("VTODO", todos, "t1"); todo.Text("SUMMARY") != "Pay taxes" || todo.Text("STATUS") != "COMPLETED" {
+		t.Errorf("updated todo = %+v", todo.Properties)
+	}
+	get("VEVENT", reminders, "r1")
+}
@@ -0,0 +1,565 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// KanbanColumnInput is the body of the column endpoints. On update,
+// omitted fields are left unchanged.
+type KanbanColumnInput struct {
+	Title     *string `json:"title"`
+	Position  *int    `json:"position"` // Index among the columns, default last
+	WIPLimit  *int    `json:"wipLimit"` // 0 removes the limit
+	WIPStrict *bool   `json:"wipStrict"`
+}
+
+var errWIPLimitReached = errors.New("WIP limit reached")
+
+// KanbanCardInput is the body of the card endpoints. On update, omitted
+// fields are left unchanged and empty values clear them.
+type KanbanCardInput struct {
+	Content     *string                       `json:"content"`
+	Description *string                       `json:"description"`
+	Labels      *[]string                     `json:"labels"`
+	DueDate     *string                       `json:"dueDate"`
+	Checklist   *[]models.KanbanChecklistItem `json:"checklist"`
+	Assignee    *string                       `json:"assignee"`
+	Position    *int                          `json:"position"` // Index in the column on creation, default last
+}
+
+// KanbanMoveInput moves a card to a column, at an index of the column
+// (default last).
+type KanbanMoveInput struct {
+	ColumnID string `json:"columnId"`
+	Position *int   `json:"position"`
+}
+
+// HandleWidgetKanban manages the columns and cards of a Kanban widget. Every
+// change is applied atomically to the stored board. Responses carry the
+// version of the widget as ETag; changes sent with If-Match fail with 412
+// if the board changed since that version.
+//
+// Cards entering a column at its WIP limit are rejected with 409 if the
+// limit is strict, else accepted with an X-WIP-Warning header. Card
+// transitions are recorded for the metrics with the change, as for boards
+// saved whole.
+// Routes: GET /api/widgets/{id}/kanban
+// GET /api/widgets/{id}/kanban/metrics
+// POST /api/widgets/{id}/kanban/columns
+// PUT, DELETE /api/widgets/{id}/kanban/columns/{columnId}
+// POST /api/widgets/{id}/kanban/columns/{columnId}/cards
+// PUT, DELETE /api/widgets/{id}/kanban/cards/{cardId}
+// POST /api/widgets/{id}/kanban/cards/{cardId}/move
+func HandleWidgetKanban(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "widgets", "{id}", "kanban", "columns|cards", "{itemId}", "cards|move"]
+	if len(parts) < 5 || parts[3] == "" || parts[4] != "kanban" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID := parts[3]
+	route := strings.Join(parts[5:], "/")
+	var itemID string
+	if len(parts) > 6 {
+		itemID = parts[6]
+		route = strings.Join(append([]string{parts[5], "{id}"}, parts[7:]...), "/")
+		if itemID == "" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if route == "" && r.Method == http.MethodGet {
+		getKanban(w, userID, widgetID)
+		return
+	}
+	if route == "metrics" && r.Method == http.MethodGet {
+		HandleKanbanMetrics(w, r, userID, widgetID)
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result any
+	var warning string
+	var fn func([]models.KanbanColumn) ([]models.KanbanColumn, error)
+	status := http.StatusOK
+	switch {
+	case route == "columns" && r.Method == http.MethodPost:
+		var input KanbanColumnInput
+		if !decodeKanbanInput(w, r, &input) {
+			return
+		}
+		if input.Title == nil || strings.TrimSpace(*input.Title) == "" {
+			http.Error(w, "Title is required", http.StatusBadRequest)
+			return
+		}
+		if input.WIPLimit != nil && *input.WIPLimit < 0 {
+			http.Error(w, "Invalid wipLimit", http.StatusBadRequest)
+			return
+		}
+		status = http.StatusCreated
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			col := models.KanbanColumn{ID: uuid.NewString(), Items: []models.KanbanItem{}}
+			applyKanbanColumnInput(&col, input)
+			result = col
+			return insertAt(columns, input.Position, col), nil
+		}
+
+	case route == "columns/{id}" && r.Method == http.MethodPut:
+		var input KanbanColumnInput
+		if !decodeKanbanInput(w, r, &input) {
+			return
+		}
+		if input.Title != nil && strings.TrimSpace(*input.Title) == "" {
+			http.Error(w, "Title is required", http.StatusBadRequest)
+			return
+		}
+		if input.WIPLimit != nil && *input.WIPLimit < 0 {
+			http.Error(w, "Invalid wipLimit", http.StatusBadRequest)
+			return
+		}
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i := kanbanColumnIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			col := columns[i]
+			applyKanbanColumnInput(&col, input)
+			result = col
+			if input.Position == nil {
+				columns[i] = col
+				return columns, nil
+			}
+			return insertAt(slices.Delete(columns, i, i+1), input.Position, col), nil
+		}
+
+	case route == "columns/{id}" && r.Method == http.MethodDelete:
+		// Deleting a column deletes its cards
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i := kanbanColumnIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			return slices.Delete(columns, i, i+1), nil
+		}
+
+	case route == "columns/{id}/cards" && r.Method == http.MethodPost:
+		var input KanbanCardInput
+		if !decodeKanbanInput(w, r, &input) {
+			return
+		}
+		if input.Content == nil || strings.TrimSpace(*input.Content) == "" {
+			http.Error(w, "Content is required", http.StatusBadRequest)
+			return
+		}
+		if msg := validateKanbanCardInput(input); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		status = http.StatusCreated
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i := kanbanColumnIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			if err := checkKanbanAssignee(widgetID, input); err != nil {
+				return nil, err
+			}
+			var err error
+			if warning, err = checkWIPLimit(columns[i]); err != nil {
+				return nil, err
+			}
+			card := models.KanbanItem{ID: uuid.NewString()}
+			applyKanbanCardInput(&card, input)
+			result = card
+			columns[i].Items = insertAt(columns[i].Items, input.Position, card)
+			return columns, nil
+		}
+
+	case route == "cards/{id}" && r.Method == http.MethodPut:
+		var input KanbanCardInput
+		if !decodeKanbanInput(w, r, &input) {
+			return
+		}
+		if input.Content != nil && strings.TrimSpace(*input.Content) == "" {
+			http.Error(w, "Content is required", http.StatusBadRequest)
+			return
+		}
+		if msg := validateKanbanCardInput(input); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i, j := kanbanCardIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			if err := checkKanbanAssignee(widgetID, input); err != nil {
+				return nil, err
+			}
+			card := &columns[i].Items[j]
+			applyKanbanCardInput(card, input)
+			result = *card
+			return columns, nil
+		}
+
+	case route == "cards/{id}" && r.Method == http.MethodDelete:
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i, j := kanbanCardIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			columns[i].Items = slices.Delete(columns[i].Items, j, j+1)
+			return columns, nil
+		}
+
+	case route == "cards/{id}/move" && r.Method == http.MethodPost:
+		var input KanbanMoveInput
+		if !decodeKanbanInput(w, r, &input) {
+			return
+		}
+		if input.ColumnID == "" {
+			http.Error(w, "columnId is required", http.StatusBadRequest)
+			return
+		}
+		fn = func(columns []models.KanbanColumn) ([]models.KanbanColumn, error) {
+			i, j := kanbanCardIndex(columns, itemID)
+			if i < 0 {
+				return nil, errItemNotFound
+			}
+			to := kanbanColumnIndex(columns, input.ColumnID)
+			if to < 0 {
+				return nil, fmt.Errorf("%w: column not found", errInvalidWidget)
+			}
+			result = columns[i].Items[j]
+			var err error
+			if warning, err = moveKanbanCard(columns, i, j, to, input.Position); err != nil {
+				return nil, err
+			}
+			return columns, nil
+		}
+
+	case route == "" || route == "metrics" || route == "columns" || route == "columns/{id}" || route == "columns/{id}/cards" ||
+		route == "cards/{id}" || route == "cards/{id}/move":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	newVersion, err := mutateKanban(userID, widgetID, version, fn)
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(newVersion))
+	if warning != "" {
+		w.Header().Set("X-WIP-Warning", warning)
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// getKanban writes the columns of a Kanban widget.
+func getKanban(w http.ResponseWriter, userID int, widgetID string) {
+	columns, version, err := loadKanban(userID, widgetID)
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(version))
+	json.NewEncoder(w).Encode(columns)
+}
+
+func decodeKanbanInput(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateKanbanCardInput returns why a card input is invalid, empty if it
+// is valid.
+func validateKanbanCardInput(input KanbanCardInput) string {
+	if input.DueDate != nil && *input.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", *input.DueDate); err != nil {
+			return "Invalid dueDate, expected YYYY-MM-DD"
+		}
+	}
+	if input.Checklist != nil {
+		for _, item := range *input.Checklist {
+			if strings.TrimSpace(item.Text) == "" {
+				return "Checklist items require a text"
+			}
+		}
+	}
+	return ""
+}
+
+// checkKanbanAssignee checks that the assignee of a card input, if any, is
+// the owner of the board or one of its recipients.
+func checkKanbanAssignee(widgetID string, input KanbanCardInput) error {
+	if input.Assignee == nil || strings.TrimSpace(*input.Assignee) == "" {
+		return nil
+	}
+	member, err := database.IsWidgetMember(widgetID, strings.TrimSpace(*input.Assignee))
+	if err != nil {
+		return err
+	}
+	if !member {
+		return fmt.Errorf("%w: assignee must be the owner of the board or a user it is shared with", errInvalidWidget)
+	}
+	return nil
+}
+
+func applyKanbanColumnInput(col *models.KanbanColumn, input KanbanColumnInput) {
+	if input.Title != nil {
+		col.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.WIPLimit != nil {
+		col.WIPLimit = *input.WIPLimit
+	}
+	if input.WIPStrict != nil {
+		col.WIPStrict = *input.WIPStrict
+	}
+}
+
+// checkWIPLimit checks that a card may enter col. Returns a warning when
+// the card takes the column over a soft limit.
+func checkWIPLimit(col models.KanbanColumn) (string, error) {
+	if col.WIPLimit <= 0 || len(col.Items) < col.WIPLimit {
+		return "", nil
+	}
+	if col.WIPStrict {
+		return "", fmt.Errorf("%w: column %q has a WIP limit of %d", errWIPLimitReached, col.Title, col.WIPLimit)
+	}
+	return fmt.Sprintf("column %q is over its WIP limit of %d", col.Title, col.WIPLimit), nil
+}
+
+// moveKanbanCard moves the card at index j of column i to column to, at
+// position (default last). Moves to another column are checked against its
+// WIP limit.
+func moveKanbanCard(columns []models.KanbanColumn, i, j, to int, position *int) (string, error) {
+	card := columns[i].Items[j]
+	var warning string
+	if to != i {
+		var err error
+		if warning, err = checkWIPLimit(columns[to]); err != nil {
+			return "", err
+		}
+	}
+	columns[i].Items = slices.Delete(columns[i].Items, j, j+1)
+	columns[to].Items = insertAt(columns[to].Items, position, card)
+	return warning, nil
+}
+
+// kanbanEvents returns the card transitions between two versions of the
+// content of a Kanban widget: cards added, moved to another column or
+// deleted. Cards may not enter a column over its strict WIP limit, so that
+// boards saved whole follow the limits of the card endpoints.
+func kanbanEvents(before, after json.RawMessage) ([]models.KanbanEvent, error) {
+	var old, board models.WidgetContentWrapper
+	if len(before) > 0 {
+		json.Unmarshal(before, &old) // An invalid board counts as empty
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &board); err != nil {
+			return nil, fmt.Errorf("%w: invalid board", errInvalidWidget)
+		}
+	}
+
+	columnOf := make(map[string]string)
+	for _, col := range old.Kanban {
+		for _, card := range col.Items {
+			columnOf[card.ID] = col.ID
+		}
+	}
+
+	var events []models.KanbanEvent
+	for _, col := range board.Kanban {
+		for _, card := range col.Items {
+			from, ok := columnOf[card.ID]
+			delete(columnOf, card.ID)
+			if card.ID == "" || (ok && from == col.ID) {
+				continue
+			}
+			if col.WIPStrict && col.WIPLimit > 0 && len(col.Items) > col.WIPLimit {
+				return nil, fmt.Errorf("%w: column %q has a WIP limit of %d", errWIPLimitReached, col.Title, col.WIPLimit)
+			}
+			events = append(events, models.KanbanEvent{CardID: card.ID, FromColumn: from, ToColumn: col.ID})
+		}
+	}
+	for _, col := range old.Kanban {
+		for _, card := range col.Items {
+			if _, ok := columnOf[card.ID]; ok && card.ID != "" {
+				events = append(events, models.KanbanEvent{CardID: card.ID, FromColumn: col.ID})
+			}
+		}
+	}
+	return events, nil
+}
+
+func applyKanbanCardInput(card *models.KanbanItem, input KanbanCardInput) {
+	if input.Content != nil {
+		card.Content = strings.TrimSpace(*input.Content)
+	}
+	if input.Description != nil {
+		card.Description = *input.Description
+	}
+	if input.Labels != nil {
+		card.Labels = nil
+		for _, label := range *input.Labels {
+			label = strings.TrimSpace(label)
+			if label != "" && !slices.Contains(card.Labels, label) {
+				card.Labels = append(card.Labels, label)
+			}
+		}
+	}
+	if input.DueDate != nil {
+		card.DueDate = *input.DueDate
+	}
+	if input.Checklist != nil {
+		card.Checklist = nil
+		for _, item := range *input.Checklist {
+			if item.ID == "" {
+				item.ID = uuid.NewString()
+			}
+			item.Text = strings.TrimSpace(item.Text)
+			card.Checklist = append(card.Checklist, item)
+		}
+	}
+	if input.Assignee != nil {
+		card.Assignee = strings.TrimSpace(*input.Assignee)
+	}
+}
+
+func kanbanColumnIndex(columns []models.KanbanColumn, id string) int {
+	for i, col := range columns {
+		if col.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// kanbanCardIndex returns the column and index of a card, -1 if not found.
+func kanbanCardIndex(columns []models.KanbanColumn, id string) (int, int) {
+	for i, col := range columns {
+		for j, card := range col.Items {
+			if card.ID == id {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// insertAt inserts v at position in s, or appends it if position is nil or
+// past the end.
+func insertAt[T any](s []T, position *int, v T) []T {
+	i := len(s)
+	if position != nil && *position >= 0 && *position < len(s) {
+		i = *position
+	}
+	return slices.Insert(s, i, v)
+}
+
+// ifMatchVersion returns the widget version of the If-Match header, 0 if
+// there is none.
+func ifMatchVersion(r *http.Request) (int, error) {
+	match := r.Header.Get("If-Match")
+	if match == "" || match == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(match, "W/"), `"`))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match %q, expected a widget version", match)
+	}
+	return version, nil
+}
+
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// loadKanban returns the columns of a Kanban widget of the user and the
+// version of the widget.
+func loadKanban(userID int, widgetID string) ([]models.KanbanColumn, int, error) {
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if widget == nil || !widget.IsActive || widget.Type != models.WidgetTypeKanban {
+		return nil, 0, errWidgetNotFound
+	}
+	var content models.WidgetContentWrapper
+	if len(widget.Content) > 0 {
+		if err := json.Unmarshal(widget.Content, &content); err != nil {
+			return nil, 0, err
+		}
+	}
+	if content.Kanban == nil {
+		content.Kanban = []models.KanbanColumn{}
+	}
+	return content.Kanban, widget.Version, nil
+}
+
+// mutateKanban applies fn to the columns of a Kanban widget of the user,
+// at version unless 0, and returns the new version of the widget.
+func mutateKanban(userID int, widgetID string, version int, fn func([]models.KanbanColumn) ([]models.KanbanColumn, error)) (int, error) {
+	return mutateWidgetVersion(userID, widgetID, models.WidgetTypeKanban, version, func(content map[string]json.RawMessage) error {
+		var columns []models.KanbanColumn
+		if content["kanban"] != nil {
+			if err := json.Unmarshal(content["kanban"], &columns); err != nil {
+				return err
+			}
+		}
+		columns, err := fn(columns)
+		if err != nil {
+			return err
+		}
+		for i := range columns {
+			if columns[i].Items == nil {
+				columns[i].Items = []models.KanbanItem{}
+			}
+		}
+		if columns == nil {
+			columns = []models.KanbanColumn{}
+		}
+		content["kanban"], err = json.Marshal(columns)
+		return err
+	})
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	kanbanMetricsDays    = 30
+	kanbanMetricsMaxDays = 365
+)
+
+// KanbanMetrics is the flow of a Kanban board over the last days, computed
+// from the recorded card transitions. The last column counts as done; a
+// card is started when it first enters a column other than the first.
+type KanbanMetrics struct {
+	From           string              `json:"from"` // First day, YYYY-MM-DD in the user's timezone
+	To             string              `json:"to"`
+	DoneColumn     string              `json:"doneColumn"`
+	CycleTime      KanbanDurationStats `json:"cycleTime"` // Days from started to done
+	LeadTime       KanbanDurationStats `json:"leadTime"`  // Days from created to done
+	Throughput     []KanbanDayCount    `json:"throughput"`
+	CumulativeFlow []KanbanFlowDay     `json:"cumulativeFlow"`
+	WIP            []KanbanColumnWIP   `json:"wip"`
+}
+
+// KanbanDurationStats summarises the durations, in days, of the cards
+// finished in the period.
+type KanbanDurationStats struct {
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	Median  float64 `json:"median"`
+	P85     float64 `json:"p85"`
+}
+
+// KanbanDayCount is the number of cards finished on a day.
+type KanbanDayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// KanbanFlowDay is the number of cards in each column, by column ID, at
+// the end of a day.
+type KanbanFlowDay struct {
+	Date    string         `json:"date"`
+	Columns map[string]int `json:"columns"`
+}
+
+// KanbanColumnWIP is the current number of cards of a column.
+type KanbanColumnWIP struct {
+	ColumnID string `json:"columnId"`
+	Title    string `json:"title"`
+	Count    int    `json:"count"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// HandleKanbanMetrics writes the cycle time, lead time, throughput and
+// cumulative flow of a Kanban widget over ?days= (default 30).
+// Route: GET /api/widgets/{id}/kanban/metrics
+func HandleKanbanMetrics(w http.ResponseWriter, r *http.Request, userID int, widgetID string) {
+	days := kanbanMetricsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = min(n, kanbanMetricsMaxDays)
+	}
+
+	columns, _, err := loadKanban(userID, widgetID)
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+	events, err := database.GetKanbanEvents(widgetID)
+	if err != nil {
+		log.Println("Error fetching kanban events:", err)
+		http.Error(w, "Failed to fetch metrics", http.StatusInternalServerError)
+		return
+	}
+	settings, err := database.GetUserSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+		return
+	}
+
+	metrics := kanbanMetrics(columns, events, time.Now().In(userLocation(settings)), days)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
+// kanbanMetrics computes the metrics of the days up to the day of now.
+func kanbanMetrics(columns []models.KanbanColumn, events []models.KanbanEvent, now time.Time, days int) KanbanMetrics {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from := today.AddDate(0, 0, -(days - 1))
+	metrics := KanbanMetrics{
+		From:           from.Format("2006-01-02"),
+		To:             today.Format("2006-01-02"),
+		Throughput:     make([]KanbanDayCount, days),
+		CumulativeFlow: make([]KanbanFlowDay, days),
+		WIP:            []KanbanColumnWIP{},
+	}
+	for i := range days {
+		metrics.Throughput[i].Date = from.AddDate(0, 0, i).Format("2006-01-02")
+	}
+
+	counts := make(map[string]int)
+	for _, col := range columns {
+		counts[col.ID] = len(col.Items)
+		metrics.WIP = append(metrics.WIP, KanbanColumnWIP{ColumnID: col.ID, Title: col.Title, Count: len(col.Items), Limit: col.WIPLimit})
+	}
+
+	var first, done string
+	if len(columns) > 0 {
+		first, done = columns[0].ID, columns[len(columns)-1].ID
+		metrics.DoneColumn = done
+	}
+
+	// Replay the transitions. Cards moved out of done are reopened; deleting
+	// a finished card keeps it finished.
+	created := make(map[string]time.Time)
+	started := make(map[string]time.Time)
+	finished := make(map[string]time.Time)
+	for _, e := range events {
+		if e.FromColumn == "" {
+			created[e.CardID] = e.CreatedAt
+		}
+		if e.ToColumn == "" {
+			continue
+		}
+		if _, ok := started[e.CardID]; !ok && e.ToColumn != first {
+			started[e.CardID] = e.CreatedAt
+		}
+		if e.ToColumn == done {
+			finished[e.CardID] = e.CreatedAt
+			if day := dayIndex(from, e.CreatedAt.In(loc)); day >= 0 && day < days {
+				metrics.Throughput[day].Count++
+			}
+		} else {
+			delete(finished, e.CardID)
+		}
+	}
+
+	var cycle, lead []float64
+	for card, at := range finished {
+		if at.Before(from) {
+			continue
+		}
+		if start, ok := started[card]; ok {
+			cycle = append(cycle, at.Sub(start).Hours()/24)
+		}
+		if start, ok := created[card]; ok {
+			lead = append(lead, at.Sub(start).Hours()/24)
+		}
+	}
+	metrics.CycleTime = durationStats(cycle)
+	metrics.LeadTime = durationStats(lead)
+
+	// Rebuild the end of each day from the current board by undoing the
+	// later transitions. Cards that predate the recording have no events,
+	// hence the clamp at zero.
+	next := len(events) - 1
+	for i := days - 1; i >= 0; i-- {
+		end := from.AddDate(0, 0, i+1)
+		for ; next >= 0 && !events[next].CreatedAt.Before(end); next-- {
+			e := events[next]
+			if e.ToColumn != "" {
+				counts[e.ToColumn]--
+			}
+			if e.FromColumn != "" {
+				counts[e.FromColumn]++
+			}
+		}
+		day := KanbanFlowDay{Date: from.AddDate(0, 0, i).Format("2006-01-02"), Columns: make(map[string]int)}
+		for _, col := range columns {
+			day.Columns[col.ID] = max(counts[col.ID], 0)
+		}
+		metrics.CumulativeFlow[i] = day
+	}
+	return metrics
+}
+
+// dayIndex returns the number of calendar days from from to t, in the
+// location of from.
+func dayIndex(from, t time.Time) int {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, from.Location())
+	return int(math.Round(day.Sub(from).Hours() / 24))
+}
+
+func durationStats(days []float64) KanbanDurationStats {
+	if len(days) == 0 {
+		return KanbanDurationStats{}
+	}
+	slices.Sort(days)
+	var sum float64
+	for _, d := range days {
+		sum += d
+	}
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(days)))) - 1
+		return roundDays(days[max(i, 0)])
+	}
+	return KanbanDurationStats{
+		Count:   len(days),
+		Average: roundDays(sum / float64(len(days))),
+		Median:  percentile(0.5),
+		P85:     percentile(0.85),
+	}
+}
+
+func roundDays(d float64) float64 {
+	return math.Round(d*100) / 100
+}
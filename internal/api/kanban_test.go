@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestSaveKanbanRecordsEvents(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeKanban, testKanban)
+
+	// Dragging a card saves the whole board
+	saveTestWidget(t, userID, widgetID, models.WidgetTypeKanban, `{"kanban":[
+		{"id":"todo","title":"To do","items":[{"id":"b","content":"Call Ana"},{"id":"d","content":"New"}]},
+		{"id":"doing","title":"Doing","wipLimit":1,"wipStrict":true,"items":[{"id":"c","content":"Taxes"}]},
+		{"id":"done","title":"Done","items":[{"id":"a","content":"Write report"}]}
+	]}`)
+	// Reordering a column records nothing
+	saveTestWidget(t, userID, widgetID, models.WidgetTypeKanban, `{"kanban":[
+		{"id":"todo","title":"To do","items":[{"id":"d","content":"New"},{"id":"b","content":"Call Ana"}]},
+		{"id":"doing","title":"Doing","wipLimit":1,"wipStrict":true,"items":[]},
+		{"id":"done","title":"Done","items":[{"id":"a","content":"Write report"}]}
+	]}`)
+
+	events, err := database.GetKanbanEvents(widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.KanbanEvent{
+		{CardID: "d", ToColumn: "todo"},
+		{CardID: "a", FromColumn: "todo", ToColumn: "done"},
+		{CardID: "c", FromColumn: "doing"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want %+v", events, want)
+	}
+	for i, e := range events {
+		if e.CardID != want[i].CardID || e.FromColumn != want[i].FromColumn || e.ToColumn != want[i].ToColumn {
+			t.Errorf("event %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestSaveKanbanEnforcesWIPLimit(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeKanban, testKanban)
+	over := json.RawMessage(`{"kanban":[
+		{"id":"todo","title":"To do","items":[{"id":"b","content":"Call Ana"}]},
+		{"id":"doing","title":"Doing","wipLimit":1,"wipStrict":true,"items":[{"id":"c","content":"Taxes"},{"id":"a","content":"Write report"}]},
+		{"id":"done","title":"Done","items":[]}
+	]}`)
+
+	widget := models.Widget{ID: widgetID, Type: models.WidgetTypeKanban, Title: "Board", IsActive: true, Content: over}
+	if w := serveAs(t, userID, HandleSaveWidget, http.MethodPost, "/api/widgets", widget); w.Code != http.StatusConflict {
+		t.Errorf("save over the WIP limit: %d %s", w.Code, w.Body)
+	}
+
+	w := serveAs(t, userID, HandleSync, http.MethodPost, "/api/sync", SyncRequest{Mutations: []SyncMutation{{
+		ID: widgetID, Op: syncOpSave, BaseVersion: 1, Widget: &widget,
+	}}})
+	var resp struct {
+		Results []SyncResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+		t.Fatalf("sync: %d %s", w.Code, w.Body)
+	}
+	if resp.Results[0].Status != syncRejected {
+		t.Errorf("sync result = %+v, want rejected", resp.Results[0])
+	}
+
+	if _, version, _ := loadKanban(userID, widgetID); version != 1 {
+		t.Errorf("rejected saves changed the widget to version %d", version)
+	}
+	if events, _ := database.GetKanbanEvents(widgetID); len(events) != 0 {
+		t.Errorf("rejected saves recorded %+v", events)
+	}
+}
+
+// kanbanRequest calls the Kanban endpoints of a widget as a user, with the
+// given If-Match header unless empty.
+func kanbanRequest(t *testing.T, userID int, method, target, ifMatch string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, target, bytes.NewReader(data))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	HandleWidgetKanban(w, r)
+	return w
+}
+
+// kanbanCardIDs returns the IDs of the cards of each column of a board.
+func kanbanCardIDs(t *testing.T, userID int, widgetID string) map[string][]string {
+	t.Helper()
+	columns, _, err := loadKanban(userID, widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string][]string)
+	for _, col := range columns {
+		ids[col.ID] = []string{}
+		for _, card := range col.Items {
+			ids[col.ID] = append(ids[col.ID], card.ID)
+		}
+	}
+	return ids
+}
+
+func TestKanbanEndpoints(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID := newTestWidget(t, userID, models.WidgetTypeKanban, testKanban)
+	base := "/api/widgets/" + widgetID + "/kanban"
+	position := func(i int) *int { return &i }
+	content := func(s string) *string { return &s }
+
+	// Cards are inserted at their index, the others shift
+	w := kanbanRequest(t, userID, http.MethodPost, base+"/columns/todo/cards", "", KanbanCardInput{Content: content("First"), Position: position(0)})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create card: %d %s", w.Code, w.Body)
+	}
+	var card models.KanbanItem
+	json.Unmarshal(w.Body.Bytes(), &card)
+	if ids := kanbanCardIDs(t, userID, widgetID)["todo"]; !slices.Equal(ids, []string{card.ID, "a", "b"}) {
+		t.Errorf("todo = %v", ids)
+	}
+
+	// Moves within and across columns
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/cards/"+card.ID+"/move", "", KanbanMoveInput{ColumnID: "todo", Position: position(1)}); w.Code != http.StatusOK {
+		t.Fatalf("move in column: %d %s", w.Code, w.Body)
+	}
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/cards/a/move", "", KanbanMoveInput{ColumnID: "done"}); w.Code != http.StatusOK {
+		t.Fatalf("move across columns: %d %s", w.Code, w.Body)
+	}
+	ids := kanbanCardIDs(t, userID, widgetID)
+	if !slices.Equal(ids["todo"], []string{card.ID, "b"}) || !slices.Equal(ids["done"], []string{"a"}) {
+		t.Errorf("board = %v", ids)
+	}
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/cards/a/move", "", KanbanMoveInput{ColumnID: "nowhere"}); w.Code != http.StatusBadRequest {
+		t.Errorf("move to an unknown column: %d", w.Code)
+	}
+	if w := kanbanRequest(t, userID, http.MethodDelete, base+"/cards/unknown", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("delete an unknown card: %d", w.Code)
+	}
+
+	// Strict WIP limits reject cards, soft ones warn
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/cards/b/move", "", KanbanMoveInput{ColumnID: "doing"}); w.Code != http.StatusConflict {
+		t.Errorf("move over a strict limit: %d", w.Code)
+	}
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/columns/doing/cards", "", KanbanCardInput{Content: content("More")}); w.Code != http.StatusConflict {
+		t.Errorf("create over a strict limit: %d", w.Code)
+	}
+	if w := kanbanRequest(t, userID, http.MethodPost, base+"/cards/c/move", "", KanbanMoveInput{ColumnID: "doing", Position: position(0)}); w.Code != http.StatusOK {
+		t.Errorf("reorder in a full column: %d", w.Code)
+	}
+	strict := false
+	if w := kanbanRequest(t, userID, http.MethodPut, base+"/columns/doing", "", KanbanColumnInput{WIPStrict: &strict}); w.Code != http.StatusOK {
+		t.Fatalf("update column: %d %s", w.Code, w.Body)
+	}
+	w = kanbanRequest(t, userID, http.MethodPost, base+"/cards/b/move", "", KanbanMoveInput{ColumnID: "doing"})
+	if w.Code != http.StatusOK || w.Header().Get("X-WIP-Warning") == "" {
+		t.Errorf("move over a soft limit: %d, warning %q", w.Code, w.Header().Get("X-WIP-Warning"))
+	}
+
+	// Columns are renumbered too
+	w = kanbanRequest(t, userID, http.MethodPut, base+"/columns/done", "", KanbanColumnInput{Position: position(0)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("move column: %d %s", w.Code, w.Body)
+	}
+	columns, version, _ := loadKanban(userID, widgetID)
+	if len(columns) != 3 || columns[0].ID != "done" || columns[1].ID != "todo" || columns[2].ID != "doing" {
+		t.Errorf("columns = %+v", columns)
+	}
+	if w.Header().Get("ETag") != versionETag(version) {
+		t.Errorf("ETag = %q, want version %d", w.Header().Get("ETag"), version)
+	}
+
+	// Changes based on an older version fail
+	stale := versionETag(version - 1)
+	if w := kanbanRequest(t, userID, http.MethodDelete, base+"/cards/a", stale, nil); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: %d", w.Code)
+	}
+	if w := kanbanRequest(t, userID, http.MethodDelete, base+"/cards/a", "version", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid If-Match: %d", w.Code)
+	}
+	if w := kanbanRequest(t, userID, http.MethodDelete, base+"/cards/a", versionETag(version), nil); w.Code != http.StatusOK {
+		t.Errorf("current If-Match: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestKanbanSharedBoard(t *testing.T) {
+	owner, ownerName := newNamedTestUser(t)
+	editor, editorName := newNamedTestUser(t)
+	viewer, viewerName := newNamedTestUser(t)
+	_, strangerName := newNamedTestUser(t)
+	widgetID := newTestWidget(t, owner, models.WidgetTypeKanban, testKanban)
+	shareTestWidget(t, owner, widgetID, editorName, models.ShareRoleEditor)
+	shareTestWidget(t, owner, widgetID, viewerName, models.ShareRoleViewer)
+	base := "/api/widgets/" + widgetID + "/kanban"
+	assign := func(userID int, assignee string) int {
+		t.Helper()
+		return kanbanRequest(t, userID, http.MethodPut, base+"/cards/a", "", KanbanCardInput{Assignee: &assignee}).Code
+	}
+
+	if w := kanbanRequest(t, viewer, http.MethodGet, base, "", nil); w.Code != http.StatusOK {
+		t.Errorf("viewer reads: %d", w.Code)
+	}
+	if code := assign(viewer, viewerName); code != http.StatusForbidden {
+		t.Errorf("viewer edits: %d", code)
+	}
+	if w := kanbanRequest(t, viewer, http.MethodPost, base+"/cards/a/move", "", KanbanMoveInput{ColumnID: "done"}); w.Code != http.StatusForbidden {
+		t.Errorf("viewer moves: %d", w.Code)
+	}
+
+	// Cards are assigned to the members of the board
+	for _, name := range []string{ownerName, editorName, viewerName, ""} {
+		if code := assign(editor, name); code != http.StatusOK {
+			t.Errorf("assign to %q: %d", name, code)
+		}
+	}
+	if code := assign(owner, strangerName); code != http.StatusBadRequest {
+		t.Errorf("assign to a stranger: %d", code)
+	}
+	assignee := strangerName
+	if w := kanbanRequest(t, owner, http.MethodPost, base+"/columns/todo/cards", "", KanbanCardInput{Content: &assignee, Assignee: &assignee}); w.Code != http.StatusBadRequest {
+		t.Errorf("create for a stranger: %d", w.Code)
+	}
+	columns, _, _ := loadKanban(owner, widgetID)
+	if card := columns[0].Items[0]; card.ID != "a" || card.Assignee != "" || len(columns[0].Items) != 2 {
+		t.Errorf("todo = %+v", columns[0].Items)
+	}
+}
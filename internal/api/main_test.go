@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// testdata is the directory of the fixtures, tests run in another one.
+var testdata string
+
+// TestMain runs the tests against a database in a temporary data
+// directory.
+func TestMain(m *testing.M) {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	testdata = filepath.Join(wd, "testdata")
+	dir, err := os.MkdirTemp("", "lifehub-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.InitDB(); err != nil {
+		log.Fatal(err)
+	}
+	InitEncryptionKey()
+	jwtSecret = []byte("test-secret")
+
+	code := m.Run()
+	database.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var testUsers atomic.Int64
+
+// newTestUser creates a user with a unique name and returns its ID.
+func newTestUser(t *testing.T) int {
+	t.Helper()
+	id, _ := newNamedTestUser(t)
+	return id
+}
+
+// newNamedTestUser is newTestUser also returning the user's name.
+func newNamedTestUser(t *testing.T) (int, string) {
+	t.Helper()
+	username := fmt.Sprintf("user%d", testUsers.Add(1))
+	if err := database.CreateUser(username, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := database.GetUserIDByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, username
+}
+
+// serveAs calls a handler as a user, with body encoded as JSON unless nil.
+func serveAs(t *testing.T, userID int, handler http.HandlerFunc, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, target, bytes.NewReader(data))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// newTestWidget creates a widget of the user and returns its ID.
+func newTestWidget(t *testing.T, userID int, widgetType models.WidgetType, content string) string {
+	t.Helper()
+	id := uuid.NewString()
+	widget := models.Widget{ID: id, Type: widgetType, Title: string(widgetType), IsActive: true, Content: json.RawMessage(content)}
+	if err := database.SaveWidget(userID, widget, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// saveTestWidget saves a widget through the save endpoint.
+func saveTestWidget(t *testing.T, userID int, id string, widgetType models.WidgetType, content string) {
+	t.Helper()
+	widget := models.Widget{ID: id, Type: widgetType, Title: string(widgetType), IsActive: true, Content: json.RawMessage(content)}
+	if w := serveAs(t, userID, HandleSaveWidget, http.MethodPost, "/api/widgets", widget); w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body)
+	}
+}
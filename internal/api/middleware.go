@@ -132,3 +132,21 @@ func GetUserIDFromContext(r *http.Request) (int, error) {
 	}
 	return userID, nil
 }
+
+// GetOptionalUserID returns the user ID from the token cookie when present and valid.
+// Used by routes that also serve anonymous visitors (e.g. public attachments).
+func GetOptionalUserID(r *http.Request) (int, bool) {
+	c, err := r.Cookie("token")
+	if err != nil {
+		return 0, false
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(c.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+	return claims.UserID, true
+}
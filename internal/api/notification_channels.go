@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// channelSecretKeys are config fields never sent back to the browser, and
+// stored encrypted. On update, leaving them empty keeps the stored value.
+var channelSecretKeys = []string{"password", "token", "headers"}
+
+// channelSecretsKey is the field of a stored config holding its secrets,
+// encrypted together as a JSON object.
+const channelSecretsKey = "encryptedSecrets"
+
+// HandleNotificationChannels lists or creates the user's notification channels.
+// Routes: GET /api/notifications/channels, POST /api/notifications/channels
+func HandleNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		channels, err := database.GetNotificationChannels(userID, false)
+		if err != nil {
+			http.Error(w, "Failed to fetch notification channels", http.StatusInternalServerError)
+			return
+		}
+		for i := range channels {
+			channels[i].Config = redactChannelConfig(channels[i].Config)
+		}
+		if channels == nil {
+			channels = []models.NotificationChannel{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channels)
+
+	case http.MethodPost:
+		var ch models.NotificationChannel
+		if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if ch.Name == "" {
+			ch.Name = string(ch.Type)
+		}
+		if _, err := NotifierForChannel(ch); err != nil {
+			http.Error(w, "Invalid channel configuration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stored := ch
+		if stored.Config, err = sealChannelConfig(ch.Config); err != nil {
+			log.Println("Error encrypting notification channel:", err)
+			http.Error(w, "Failed to create notification channel", http.StatusInternalServerError)
+			return
+		}
+		id, err := database.CreateNotificationChannel(userID, stored)
+		if err != nil {
+			log.Println("Error creating notification channel:", err)
+			http.Error(w, "Failed to create notification channel", http.StatusInternalServerError)
+			return
+		}
+		ch.ID = id
+		ch.CreatedAt = time.Now()
+		ch.Config = redactChannelConfig(ch.Config)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ch)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleNotificationChannel updates, deletes or tests a single channel.
+// Routes: PUT/DELETE /api/notifications/channels/{id},
+// POST /api/notifications/channels/{id}/test
+func HandleNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "notifications", "channels", "{id}", ("test")]
+	if len(parts) < 5 || parts[4] == "" {
+		http.Error(w, "Channel ID required", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[4])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := database.GetNotificationChannel(userID, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch notification channel", http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if existing.Config, err = openChannelConfig(existing.Config); err != nil {
+		log.Println("Error decrypting notification channel:", err)
+		http.Error(w, "Failed to fetch notification channel", http.StatusInternalServerError)
+		return
+	}
+
+	if len(parts) > 5 && parts[5] == "test" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		testNotificationChannel(w, *existing)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var ch models.NotificationChannel
+		if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		ch.ID = id
+		ch.Type = existing.Type // The type can't change
+		if ch.Name == "" {
+			ch.Name = existing.Name
+		}
+		if len(ch.Config) == 0 {
+			ch.Config = existing.Config
+		} else {
+			ch.Config = mergeChannelSecrets(ch.Config, existing.Config)
+		}
+		if _, err := NotifierForChannel(ch); err != nil {
+			http.Error(w, "Invalid channel configuration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stored := ch
+		if stored.Config, err = sealChannelConfig(ch.Config); err != nil {
+			log.Println("Error encrypting notification channel:", err)
+			http.Error(w, "Failed to update notification channel", http.StatusInternalServerError)
+			return
+		}
+		if err := database.UpdateNotificationChannel(userID, stored); err != nil {
+			log.Println("Error updating notification channel:", err)
+			http.Error(w, "Failed to update notification channel", http.StatusInternalServerError)
+			return
+		}
+		ch.CreatedAt = existing.CreatedAt
+		ch.Config = redactChannelConfig(ch.Config)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ch)
+
+	case http.MethodDelete:
+		if err := database.DeleteNotificationChannel(userID, id); err != nil {
+			http.Error(w, "Failed to delete notification channel", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// testNotificationChannel sends a test message through one channel only.
+// Delivery errors are logged but not reported, they would tell which hosts
+// and ports of the server's network answer.
+func testNotificationChannel(w http.ResponseWriter, ch models.NotificationChannel) {
+	n, err := NotifierForChannel(ch)
+	if err != nil {
+		http.Error(w, "Invalid channel configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	payload := PushPayload{
+		Title: "LifeHub",
+		Body:  "Hello from LifeHub! This is a test notification.",
+		Tag:   "test",
+	}
+	opts := PushOptions{TTL: 30, Urgency: webpush.UrgencyNormal, Category: models.NotificationSystem}
+	if err := n.Notify(ctx, payload, opts); err != nil {
+		log.Printf("Test notification of channel %d failed: %v", ch.ID, err)
+		http.Error(w, "Test notification failed, check the channel settings", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"sent"}`))
+}
+
+// redactChannelConfig removes secrets from a channel config.
+func redactChannelConfig(config json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return json.RawMessage(`{}`)
+	}
+	for _, key := range channelSecretKeys {
+		delete(fields, key)
+	}
+	delete(fields, channelSecretsKey)
+	redacted, _ := json.Marshal(fields)
+	return redacted
+}
+
+// sealChannelConfig moves the secrets of a channel config into an encrypted
+// field, for storage.
+func sealChannelConfig(config json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, channelSecretsKey)
+	secrets := make(map[string]json.RawMessage)
+	for _, key := range channelSecretKeys {
+		if value, ok := fields[key]; ok {
+			secrets[key] = value
+			delete(fields, key)
+		}
+	}
+	if len(secrets) > 0 {
+		plain, err := json.Marshal(secrets)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := encryptSecret(string(plain))
+		if err != nil {
+			return nil, err
+		}
+		fields[channelSecretsKey], _ = json.Marshal(sealed)
+	}
+	return json.Marshal(fields)
+}
+
+// openChannelConfig reverses sealChannelConfig. Configs stored before
+// secrets were encrypted are returned as is.
+func openChannelConfig(config json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return nil, err
+	}
+	raw, ok := fields[channelSecretsKey]
+	if !ok {
+		return config, nil
+	}
+	var sealed string
+	if err := json.Unmarshal(raw, &sealed); err != nil {
+		return nil, err
+	}
+	plain, err := decryptSecret(sealed)
+	if err != nil {
+		return nil, err
+	}
+	var secrets map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(plain), &secrets); err != nil {
+		return nil, err
+	}
+	delete(fields, channelSecretsKey)
+	for key, value := range secrets {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
+
+// mergeChannelSecrets copies the stored secrets into an updated config when
+// the client left them out.
+func mergeChannelSecrets(updated, stored json.RawMessage) json.RawMessage {
+	var newFields, oldFields map[string]json.RawMessage
+	if err := json.Unmarshal(updated, &newFields); err != nil {
+		return updated
+	}
+	if err := json.Unmarshal(stored, &oldFields); err != nil {
+		return updated
+	}
+	for _, key := range channelSecretKeys {
+		value, ok := newFields[key]
+		if (!ok || string(value) == `""` || string(value) == "null") && oldFields[key] != nil {
+			newFields[key] = oldFields[key]
+		}
+	}
+	merged, _ := json.Marshal(newFields)
+	return merged
+}
+
+// EncryptChannelSecrets encrypts the secrets of the channels stored before
+// secrets were encrypted. It must run after InitEncryptionKey.
+func EncryptChannelSecrets() {
+	channels, err := database.GetAllNotificationChannels()
+	if err != nil {
+		log.Println("Failed to load notification channels:", err)
+		return
+	}
+	for _, ch := range channels {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(ch.Config, &fields); err != nil {
+			continue
+		}
+		plain := false
+		for _, key := range channelSecretKeys {
+			if _, ok := fields[key]; ok {
+				plain = true
+			}
+		}
+		if !plain {
+			continue
+		}
+		config, err := openChannelConfig(ch.Config)
+		if err == nil {
+			config, err = sealChannelConfig(config)
+		}
+		if err == nil {
+			err = database.UpdateNotificationChannelConfig(ch.ID, config)
+		}
+		if err != nil {
+			log.Printf("Failed to encrypt notification channel %d: %v\n", ch.ID, err)
+		}
+	}
+}
@@ -0,0 +1,531 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// allowLocalChannels lets channels reach the test servers, as
+// LIFEHUB_NOTIFY_ALLOW_LOCAL does.
+func allowLocalChannels(t *testing.T) {
+	t.Helper()
+	allow, client := allowLocalNotifiers, notifierHTTPClient
+	allowLocalNotifiers, notifierHTTPClient = true, newNotifierHTTPClient(true)
+	t.Cleanup(func() { allowLocalNotifiers, notifierHTTPClient = allow, client })
+}
+
+type notifierRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// notifierServer records the requests it receives, at the returned URL,
+// and answers them with status.
+func notifierServer(t *testing.T, status int) (string, <-chan notifierRequest) {
+	t.Helper()
+	allowLocalChannels(t)
+	received := make(chan notifierRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- notifierRequest{path: r.URL.Path, header: r.Header, body: body}
+		w.WriteHeader(status)
+		w.Write([]byte("internal detail"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+func createChannel(t *testing.T, userID int, ch map[string]any) models.NotificationChannel {
+	t.Helper()
+	w := serveAs(t, userID, HandleNotificationChannels, http.MethodPost, "/api/notifications/channels", ch)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var created models.NotificationChannel
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestNotificationChannelCRUD(t *testing.T) {
+	userID, other := newTestUser(t), newTestUser(t)
+	created := createChannel(t, userID, map[string]any{
+		"type":    "ntfy",
+		"enabled": true,
+		"config":  map[string]any{"serverUrl": "https://ntfy.example.com", "topic": "alerts", "token": "tk_secret"},
+	})
+	if created.Name != "ntfy" {
+		t.Errorf("default name = %q, want the type", created.Name)
+	}
+	path := "/api/notifications/channels/" + strconv.Itoa(created.ID)
+
+	w := serveAs(t, userID, HandleNotificationChannels, http.MethodGet, "/api/notifications/channels", nil)
+	var list []models.NotificationChannel
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Fatalf("list = %s", w.Body)
+	}
+
+	// Other users don't see it
+	if w := serveAs(t, other, HandleNotificationChannel, http.MethodPut, path, map[string]any{"name": "x"}); w.Code != http.StatusNotFound {
+		t.Errorf("update by another user: %d", w.Code)
+	}
+
+	// Updating without the token keeps it; the type can't change
+	w = serveAs(t, userID, HandleNotificationChannel, http.MethodPut, path, map[string]any{
+		"type":    "webhook",
+		"name":    "Phone",
+		"enabled": false,
+		"config":  map[string]any{"serverUrl": "https://ntfy.example.com", "topic": "other"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	stored, err := database.GetNotificationChannel(userID, created.ID)
+	if err != nil || stored == nil {
+		t.Fatal(stored, err)
+	}
+	if stored.Type != models.ChannelNtfy || stored.Name != "Phone" || stored.Enabled {
+		t.Errorf("stored = %+v", stored)
+	}
+	config, err := openChannelConfig(stored.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg NtfyConfig
+	json.Unmarshal(config, &cfg)
+	if cfg.Topic != "other" || cfg.Token != "tk_secret" {
+		t.Errorf("config = %s", config)
+	}
+
+	// Invalid configurations are rejected
+	w = serveAs(t, userID, HandleNotificationChannel, http.MethodPut, path, map[string]any{
+		"config": map[string]any{"serverUrl": "ftp://ntfy.example.com", "topic": "other"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid update: %d", w.Code)
+	}
+
+	if w := serveAs(t, other, HandleNotificationChannel, http.MethodDelete, path, nil); w.Code != http.StatusNotFound {
+		t.Errorf("delete by another user: %d", w.Code)
+	}
+	if w := serveAs(t, userID, HandleNotificationChannel, http.MethodDelete, path, nil); w.Code != http.StatusOK {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if stored, _ := database.GetNotificationChannel(userID, created.ID); stored != nil {
+		t.Error("channel not deleted")
+	}
+}
+
+func TestNotificationChannelSecrets(t *testing.T) {
+	userID := newTestUser(t)
+	secrets := []string{"hunter2", "tk_secret", "Bearer abc"}
+	channels := []map[string]any{
+		{"type": "smtp", "config": map[string]any{"host": "mail.example.com", "port": 587, "username": "me", "password": "hunter2", "from": "a@example.com", "to": "b@example.com"}},
+		{"type": "gotify", "config": map[string]any{"serverUrl": "https://gotify.example.com", "token": "tk_secret"}},
+		{"type": "webhook", "config": map[string]any{"url": "https://hooks.example.com", "headers": map[string]string{"Authorization": "Bearer abc"}}},
+	}
+	for _, ch := range channels {
+		created := createChannel(t, userID, ch)
+		for _, secret := range secrets {
+			if strings.Contains(string(created.Config), secret) {
+				t.Errorf("create response leaks %q: %s", secret, created.Config)
+			}
+		}
+	}
+
+	w := serveAs(t, userID, HandleNotificationChannels, http.MethodGet, "/api/notifications/channels", nil)
+	stored, err := database.GetNotificationChannels(userID, false)
+	if err != nil || len(stored) != len(channels) {
+		t.Fatal(stored, err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("list leaks %q: %s", secret, w.Body)
+		}
+		for _, ch := range stored {
+			if strings.Contains(string(ch.Config), secret) {
+				t.Errorf("%q stored in plain text: %s", secret, ch.Config)
+			}
+		}
+	}
+	if strings.Contains(w.Body.String(), channelSecretsKey) {
+		t.Errorf("list includes the encrypted secrets: %s", w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "mail.example.com") {
+		t.Errorf("list misses the config: %s", w.Body)
+	}
+}
+
+func TestEncryptChannelSecrets(t *testing.T) {
+	userID := newTestUser(t)
+	// Stored before secrets were encrypted
+	legacy := models.NotificationChannel{Type: models.ChannelGotify, Name: "g", Enabled: true,
+		Config: json.RawMessage(`{"serverUrl":"https://gotify.example.com","token":"tk_plain"}`)}
+	id, err := database.CreateNotificationChannel(userID, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	EncryptChannelSecrets()
+	stored, err := database.GetNotificationChannel(userID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stored.Config), "tk_plain") {
+		t.Fatalf("secret still in plain text: %s", stored.Config)
+	}
+	config, err := openChannelConfig(stored.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg GotifyConfig
+	json.Unmarshal(config, &cfg)
+	if cfg.Token != "tk_plain" || cfg.ServerURL != "https://gotify.example.com" {
+		t.Errorf("config = %s", config)
+	}
+}
+
+func TestNotificationChannelDelivery(t *testing.T) {
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusOK)
+	created := createChannel(t, userID, map[string]any{
+		"type":    "webhook",
+		"enabled": true,
+		"config":  map[string]any{"url": url, "headers": map[string]string{"Authorization": "Bearer abc"}},
+	})
+
+	path := "/api/notifications/channels/" + strconv.Itoa(created.ID) + "/test"
+	if w := serveAs(t, userID, HandleNotificationChannel, http.MethodPost, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("test: %d %s", w.Code, w.Body)
+	}
+	req := <-received
+	var body webhookBody
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if req.header.Get("Authorization") != "Bearer abc" || body.Tag != "test" {
+		t.Errorf("test notification = %+v", req)
+	}
+
+	// Without push subscriptions, the channel is the only delivery
+	delivered, err := dispatchNotification(userID, PushPayload{Title: "Hi", Body: "There"}, PushOptions{Category: models.NotificationReminders})
+	if err != nil || delivered != 1 {
+		t.Fatalf("dispatchNotification() = %d, %v", delivered, err)
+	}
+	req = <-received
+	body = webhookBody{}
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if req.header.Get("Authorization") != "Bearer abc" || body.Title != "Hi" || body.Category != "reminders" {
+		t.Errorf("notification = %+v", req)
+	}
+
+	// Disabled channels are skipped
+	update := "/api/notifications/channels/" + strconv.Itoa(created.ID)
+	serveAs(t, userID, HandleNotificationChannel, http.MethodPut, update, map[string]any{"enabled": false})
+	if delivered, _ := dispatchNotification(userID, PushPayload{Title: "Hi"}, PushOptions{}); delivered != 0 {
+		t.Errorf("delivered to %d channels, want none", delivered)
+	}
+}
+
+func TestNtfyDelivery(t *testing.T) {
+	t.Setenv("LIFEHUB_PUBLIC_URL", "https://lifehub.example.com")
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusOK)
+	createChannel(t, userID, map[string]any{
+		"type":    "ntfy",
+		"enabled": true,
+		"config":  map[string]any{"serverUrl": url + "/", "topic": "my alerts", "token": "tk_secret"},
+	})
+
+	payload := PushPayload{Title: "Café", Body: "Pay the rent", WidgetID: "w1"}
+	opts := PushOptions{Urgency: webpush.UrgencyHigh, Category: models.NotificationReminders}
+	if delivered, err := dispatchNotification(userID, payload, opts); err != nil || delivered != 1 {
+		t.Fatalf("dispatchNotification() = %d, %v", delivered, err)
+	}
+	req := <-received
+	title, err := new(mime.WordDecoder).DecodeHeader(req.header.Get("Title"))
+	if err != nil || title != "Café" {
+		t.Errorf("Title = %q (%q), %v", title, req.header.Get("Title"), err)
+	}
+	want := map[string]string{
+		"Authorization": "Bearer tk_secret",
+		"Priority":      "5",
+		"Tags":          "reminders",
+		"Click":         "https://lifehub.example.com" + WidgetURL("w1"),
+	}
+	for name, value := range want {
+		if got := req.header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if req.path != "/my alerts" || string(req.body) != "Pay the rent" {
+		t.Errorf("request to %q with body %q", req.path, req.body)
+	}
+}
+
+func TestGotifyDelivery(t *testing.T) {
+	t.Setenv("LIFEHUB_PUBLIC_URL", "https://lifehub.example.com")
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusOK)
+	createChannel(t, userID, map[string]any{
+		"type":    "gotify",
+		"enabled": true,
+		"config":  map[string]any{"serverUrl": url, "token": "tk_app"},
+	})
+
+	payload := PushPayload{Title: "Digest", Body: "3 tasks today", URL: "/#digest"}
+	if delivered, err := dispatchNotification(userID, payload, PushOptions{Urgency: webpush.UrgencyLow}); err != nil || delivered != 1 {
+		t.Fatalf("dispatchNotification() = %d, %v", delivered, err)
+	}
+	req := <-received
+	if req.path != "/message" || req.header.Get("X-Gotify-Key") != "tk_app" || req.header.Get("Content-Type") != "application/json" {
+		t.Errorf("request to %q with headers %v", req.path, req.header)
+	}
+	var message struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+		Extras   struct {
+			Notification struct {
+				Click struct {
+					URL string `json:"url"`
+				} `json:"click"`
+			} `json:"client::notification"`
+		} `json:"extras"`
+	}
+	if err := json.Unmarshal(req.body, &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Title != "Digest" || message.Message != "3 tasks today" || message.Priority != 3 ||
+		message.Extras.Notification.Click.URL != "https://lifehub.example.com/#digest" {
+		t.Errorf("message = %s", req.body)
+	}
+}
+
+// smtpSession is what the fake SMTP server received in a connection.
+type smtpSession struct {
+	commands []string // Up to QUIT, without the message
+	message  string
+}
+
+// smtpServer runs a fake SMTP server on a local port, offering STARTTLS or
+// expecting TLS from the start, and PLAIN authentication once encrypted.
+// Its certificate is trusted by the notifiers until the test ends.
+func smtpServer(t *testing.T, implicitTLS bool) (int, <-chan smtpSession) {
+	t.Helper()
+	allowLocalChannels(t)
+	certServer := httptest.NewUnstartedServer(http.NotFoundHandler())
+	certServer.StartTLS()
+	tlsConfig := &tls.Config{Certificates: certServer.TLS.Certificates}
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+	certServer.Close()
+	rootCAs := smtpRootCAs
+	smtpRootCAs = roots
+	t.Cleanup(func() { smtpRootCAs = rootCAs })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan smtpSession, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, tlsConfig, implicitTLS, sessions)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func serveSMTP(conn net.Conn, tlsConfig *tls.Config, implicitTLS bool, sessions chan<- smtpSession) {
+	defer func() { conn.Close() }()
+	encrypted := implicitTLS
+	if encrypted {
+		conn = tls.Server(conn, tlsConfig)
+	}
+	text := textproto.NewConn(conn)
+	var s smtpSession
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.commands = append(s.commands, line)
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if encrypted {
+				text.PrintfLine("250-fake\r\n250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250-fake\r\n250 STARTTLS")
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, encrypted = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			if !encrypted {
+				text.PrintfLine("538 encryption required")
+				continue
+			}
+			text.PrintfLine("235 authenticated")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.message = strings.Join(lines, "\r\n")
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			sessions <- s
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPDelivery(t *testing.T) {
+	t.Setenv("LIFEHUB_PUBLIC_URL", "https://lifehub.example.com")
+	auth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00me\x00hunter2"))
+	tests := []struct {
+		security string
+		commands []string
+	}{
+		{SMTPSecurityStartTLS, []string{"EHLO localhost", "STARTTLS", "EHLO localhost", auth,
+			"MAIL FROM:<a@example.com>", "RCPT TO:<b@example.com>", "RCPT TO:<c@example.com>", "DATA", "QUIT"}},
+		{SMTPSecurityTLS, []string{"EHLO localhost", auth,
+			"MAIL FROM:<a@example.com>", "RCPT TO:<b@example.com>", "RCPT TO:<c@example.com>", "DATA", "QUIT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.security, func(t *testing.T) {
+			userID := newTestUser(t)
+			port, sessions := smtpServer(t, tt.security == SMTPSecurityTLS)
+			created := createChannel(t, userID, map[string]any{
+				"type":    "smtp",
+				"enabled": true,
+				"config": map[string]any{"host": "127.0.0.1", "port": port, "username": "me", "password": "hunter2",
+					"from": "a@example.com", "to": "b@example.com, c@example.com", "security": tt.security},
+			})
+
+			path := "/api/notifications/channels/" + strconv.Itoa(created.ID) + "/test"
+			if w := serveAs(t, userID, HandleNotificationChannel, http.MethodPost, path, nil); w.Code != http.StatusOK {
+				t.Fatalf("test: %d %s", w.Code, w.Body)
+			}
+			s := <-sessions
+			if strings.Join(s.commands, "\n") != strings.Join(tt.commands, "\n") {
+				t.Errorf("commands = %q, want %q", s.commands, tt.commands)
+			}
+
+			payload := PushPayload{Title: "Café", Body: "Line 1\nLine 2", WidgetID: "w1"}
+			if delivered, err := dispatchNotification(userID, payload, PushOptions{}); err != nil || delivered != 1 {
+				t.Fatalf("dispatchNotification() = %d, %v", delivered, err)
+			}
+			s = <-sessions
+			msg, err := mail.ReadMessage(strings.NewReader(s.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if subject != "Café" || msg.Header.Get("From") != "a@example.com" || msg.Header.Get("To") != "b@example.com, c@example.com" {
+				t.Errorf("headers = %v", msg.Header)
+			}
+			if msg.Header.Get("Content-Type") != "text/plain; charset=utf-8" || msg.Header.Get("Date") == "" {
+				t.Errorf("headers = %v", msg.Header)
+			}
+			body, _ := io.ReadAll(msg.Body)
+			if want := "Line 1\r\nLine 2\r\n\r\nhttps://lifehub.example.com" + WidgetURL("w1"); string(body) != want {
+				t.Errorf("body = %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestNotificationChannelTestHidesErrors(t *testing.T) {
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusInternalServerError)
+	created := createChannel(t, userID, map[string]any{
+		"type":   "webhook",
+		"config": map[string]any{"url": url},
+	})
+
+	path := "/api/notifications/channels/" + strconv.Itoa(created.ID) + "/test"
+	w := serveAs(t, userID, HandleNotificationChannel, http.MethodPost, path, nil)
+	<-received
+	if w.Code != http.StatusBadGateway || strings.Contains(w.Body.String(), "internal detail") || strings.Contains(w.Body.String(), "500") {
+		t.Errorf("test: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestNotificationChannelLocalAddresses(t *testing.T) {
+	userID := newTestUser(t)
+	channels := []map[string]any{
+		{"type": "webhook", "config": map[string]any{"url": "http://127.0.0.1:8080/hook"}},
+		{"type": "webhook", "config": map[string]any{"url": "http://169.254.169.254/latest"}},
+		{"type": "ntfy", "config": map[string]any{"serverUrl": "http://[::1]", "topic": "a"}},
+		{"type": "gotify", "config": map[string]any{"serverUrl": "http://192.168.1.10", "token": "t"}},
+		{"type": "smtp", "config": map[string]any{"host": "10.0.0.1", "port": 25, "from": "a@example.com", "to": "b@example.com"}},
+	}
+	for _, ch := range channels {
+		w := serveAs(t, userID, HandleNotificationChannels, http.MethodPost, "/api/notifications/channels", ch)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d", ch, w.Code)
+		}
+	}
+
+	// Host names are checked once resolved
+	n := &WebhookNotifier{Config: WebhookConfig{URL: "http://localhost:1/hook"}, Client: notifierHTTPClient}
+	err := n.Notify(context.Background(), PushPayload{Title: "Hi"}, PushOptions{})
+	if !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("Notify() = %v, want %v", err, safehttp.ErrForbiddenAddress)
+	}
+	smtp := &SMTPNotifier{Config: SMTPConfig{Host: "localhost", Port: 1, From: "a@example.com", To: "b@example.com"}}
+	err = smtp.Notify(context.Background(), PushPayload{Title: "Hi"}, PushOptions{})
+	if !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("SMTP Notify() = %v, want %v", err, safehttp.ErrForbiddenAddress)
+	}
+
+	// Unless the admin allowed them
+	allowLocalChannels(t)
+	for _, ch := range channels {
+		if w := serveAs(t, userID, HandleNotificationChannels, http.MethodPost, "/api/notifications/channels", ch); w.Code != http.StatusCreated {
+			t.Errorf("%v with local addresses allowed: %d %s", ch, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// HandleNotificationSettings returns or updates the notification preferences
+// of the authenticated user.
+// Routes: GET /api/settings/notifications, PUT /api/settings/notifications
+func HandleNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := database.GetNotificationSettings(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch notification settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	case http.MethodPut:
+		settings := models.DefaultNotificationSettings()
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := time.Parse("15:04", settings.QuietHours.Start); err != nil {
+			http.Error(w, "Invalid quiet hours start, expected HH:MM", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.Parse("15:04", settings.QuietHours.End); err != nil {
+			http.Error(w, "Invalid quiet hours end, expected HH:MM", http.StatusBadRequest)
+			return
+		}
+		if settings.MutedDevices == nil {
+			settings.MutedDevices = []int{}
+		}
+
+		if err := database.SaveNotificationSettings(userID, settings); err != nil {
+			log.Println("Error saving notification settings:", err)
+			http.Error(w, "Failed to save notification settings", http.StatusInternalServerError)
+			return
+		}
+
+		// Return the stored state (unknown device IDs are dropped)
+		saved, err := database.GetNotificationSettings(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch notification settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// quietHoursEnd reports whether now (in the user's timezone) falls inside the
+// quiet hours, and if so when they end.
+func quietHoursEnd(q models.QuietHours, now time.Time) (time.Time, bool) {
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	startMin := start.Hour()*60 + start.Minute()
+	endMin := end.Hour()*60 + end.Minute()
+	nowMin := now.Hour()*60 + now.Minute()
+
+	var quiet bool
+	switch {
+	case startMin == endMin:
+		quiet = false
+	case startMin < endMin:
+		quiet = nowMin >= startMin && nowMin < endMin
+	default: // Spans midnight
+		quiet = nowMin >= startMin || nowMin < endMin
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	until := time.Date(now.Year(), now.Month(), now.Day(), end.Hour(), end.Minute(), 0, 0, now.Location())
+	if !until.After(now) {
+		until = time.Date(now.Year(), now.Month(), now.Day()+1, end.Hour(), end.Minute(), 0, 0, now.Location())
+	}
+	return until, true
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, loc)
+	}
+	night := models.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}
+	lunch := models.QuietHours{Enabled: true, Start: "13:00", End: "14:00"}
+
+	tests := []struct {
+		name  string
+		q     models.QuietHours
+		now   time.Time
+		until time.Time // Zero when not quiet
+	}{
+		{"before midnight", night, at(10, 23, 30), at(11, 7, 0)},
+		{"after midnight", night, at(11, 3, 0), at(11, 7, 0)},
+		{"at the start", night, at(10, 22, 0), at(11, 7, 0)},
+		{"at the end", night, at(11, 7, 0), time.Time{}},
+		{"before the start", night, at(10, 21, 59), time.Time{}},
+		{"daytime window", lunch, at(10, 13, 30), at(10, 14, 0)},
+		{"after a daytime window", lunch, at(10, 14, 0), time.Time{}},
+		{"empty window", models.QuietHours{Start: "08:00", End: "08:00"}, at(10, 8, 0), time.Time{}},
+		{"invalid", models.QuietHours{Start: "late", End: "07:00"}, at(10, 23, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		until, quiet := quietHoursEnd(tt.q, tt.now)
+		if quiet != !tt.until.IsZero() || !until.Equal(tt.until) {
+			t.Errorf("%s: quietHoursEnd() = %v, %v, want %v", tt.name, until, quiet, tt.until)
+		}
+	}
+}
+
+func TestNotificationSettingsEndpoint(t *testing.T) {
+	userID, other := newTestUser(t), newTestUser(t)
+	const path = "/api/settings/notifications"
+
+	w := serveAs(t, userID, HandleNotificationSettings, http.MethodGet, path, nil)
+	var settings models.NotificationSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Categories.Reminders || settings.QuietHours.Enabled || settings.MutedDevices == nil {
+		t.Errorf("defaults = %s", w.Body)
+	}
+
+	for _, q := range []models.QuietHours{{Start: "25:00", End: "07:00"}, {Start: "22:00", End: "7"}} {
+		body := models.DefaultNotificationSettings()
+		body.QuietHours = q
+		if w := serveAs(t, userID, HandleNotificationSettings, http.MethodPut, path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("put %+v: %d", q, w.Code)
+		}
+	}
+
+	subscription := func(userID int, endpoint string) int {
+		t.Helper()
+		if err := database.SaveSubscription(userID, endpoint, "p256dh", "auth"); err != nil {
+			t.Fatal(err)
+		}
+		subs, err := database.GetSubscriptionsByUserID(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range subs {
+			if s.Endpoint == endpoint {
+				return s.ID
+			}
+		}
+		t.Fatal("subscription not saved")
+		return 0
+	}
+	device := subscription(userID, "https://push.example.com/"+t.Name())
+	foreign := subscription(other, "https://push.example.com/"+t.Name()+"/other")
+
+	// Devices of other users can't be muted
+	body := models.DefaultNotificationSettings()
+	body.Categories.Hydration = false
+	body.QuietHours = models.QuietHours{Enabled: true, Start: "23:00", End: "06:30"}
+	body.MutedDevices = []int{device, foreign}
+	w = serveAs(t, userID, HandleNotificationSettings, http.MethodPut, path, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", w.Code, w.Body)
+	}
+	settings = models.NotificationSettings{}
+	json.Unmarshal(w.Body.Bytes(), &settings)
+	if settings.Categories.Hydration || !settings.Categories.Reminders || settings.QuietHours != body.QuietHours ||
+		len(settings.MutedDevices) != 1 || settings.MutedDevices[0] != device {
+		t.Errorf("saved = %s", w.Body)
+	}
+	if s, _ := database.GetNotificationSettings(other); len(s.MutedDevices) != 0 {
+		t.Errorf("other user's muted devices = %v", s.MutedDevices)
+	}
+}
+
+func TestNotifyUserPreferences(t *testing.T) {
+	userID := newTestUser(t)
+	url, received := notifierServer(t, http.StatusOK)
+	createChannel(t, userID, map[string]any{"type": "webhook", "enabled": true, "config": map[string]any{"url": url}})
+
+	// Quiet now, in the user's timezone (UTC by default)
+	now := time.Now().UTC()
+	prefs := models.DefaultNotificationSettings()
+	prefs.Categories.Pomodoro = false
+	prefs.QuietHours = models.QuietHours{Enabled: true, Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04")}
+	if err := database.SaveNotificationSettings(userID, prefs); err != nil {
+		t.Fatal(err)
+	}
+	sent := func() int {
+		n := 0
+		for {
+			select {
+			case <-received:
+				n++
+			default:
+				return n
+			}
+		}
+	}
+	notify := func(category models.NotificationCategory, urgency webpush.Urgency) error {
+		_, err := NotifyUser(userID, PushPayload{Title: string(category)}, PushOptions{Category: category, Urgency: urgency})
+		return err
+	}
+
+	if err := notify(models.NotificationPomodoro, webpush.UrgencyHigh); !errors.Is(err, ErrNotificationDisabled) || sent() != 0 {
+		t.Errorf("disabled category: %v", err)
+	}
+	// Urgent notifications aren't held back by quiet hours
+	if err := notify(models.NotificationHydration, webpush.UrgencyHigh); err != nil || sent() != 1 {
+		t.Errorf("urgent notification: %v", err)
+	}
+	if err := notify(models.NotificationReminders, webpush.UrgencyNormal); !errors.Is(err, ErrNotificationDeferred) || sent() != 0 {
+		t.Errorf("quiet hours: %v", err)
+	}
+	if err := notify(models.NotificationHydration, webpush.UrgencyLow); !errors.Is(err, ErrNotificationDeferred) {
+		t.Errorf("quiet hours: %v", err)
+	}
+
+	// Delivered after the quiet hours, unless turned off meanwhile
+	prefs.Categories.Hydration = false
+	if err := database.SaveNotificationSettings(userID, prefs); err != nil {
+		t.Fatal(err)
+	}
+	flushDeferredPushes(now.Add(2 * time.Hour))
+	if n := sent(); n != 1 {
+		t.Errorf("flushed %d notifications, want 1", n)
+	}
+	flushDeferredPushes(now.Add(3 * time.Hour))
+	if n := sent(); n != 0 {
+		t.Errorf("flushed %d notifications again", n)
+	}
+}
+
+func TestDeferredPushClaims(t *testing.T) {
+	userID := newTestUser(t)
+	now := time.Now()
+	if err := database.DeferPush(userID, `{}`, `{}`, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	claim := func(at time.Time) []database.DeferredPush {
+		t.Helper()
+		pushes, err := database.ClaimDuePushes(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var own []database.DeferredPush
+		for _, p := range pushes {
+			if p.UserID == userID {
+				own = append(own, p)
+			}
+		}
+		return own
+	}
+
+	if pushes := claim(now); len(pushes) != 0 {
+		t.Fatalf("claimed %d pushes before they were due", len(pushes))
+	}
+	pushes := claim(now.Add(2 * time.Hour))
+	if len(pushes) != 1 {
+		t.Fatalf("claimed %d pushes, want 1", len(pushes))
+	}
+	if again := claim(now.Add(2 * time.Hour)); len(again) != 0 {
+		t.Error("claimed a push being sent")
+	}
+
+	// Claims interrupted by a restart are sent again
+	if _, err := database.ReleaseInterruptedPushes(); err != nil {
+		t.Fatal(err)
+	}
+	if again := claim(now.Add(2 * time.Hour)); len(again) != 1 || again[0].ID != pushes[0].ID {
+		t.Fatalf("interrupted push claimed %d times", len(again))
+	}
+	if err := database.DeleteDeferredPush(pushes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	database.ReleaseInterruptedPushes()
+	if again := claim(now.Add(2 * time.Hour)); len(again) != 0 {
+		t.Error("claimed a sent push")
+	}
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/config"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// Notifier delivers a notification through one channel (Web Push, email, ...).
+type Notifier interface {
+	Notify(ctx context.Context, payload PushPayload, opts PushOptions) error
+}
+
+var (
+	// ErrNotificationDisabled is returned when the user turned off the category.
+	ErrNotificationDisabled = errors.New("notification category disabled")
+	// ErrNotificationDeferred is returned when quiet hours postponed the delivery.
+	ErrNotificationDeferred = errors.New("notification deferred by quiet hours")
+	// errNoSubscriptions is returned by the Web Push notifier when no device accepted the message.
+	errNoSubscriptions = errors.New("no push subscription accepted the message")
+)
+
+const notifyTimeout = 30 * time.Second
+
+// allowLocalNotifiers lets channels reach the local network, see
+// config.AllowLocalNotificationServers.
+var allowLocalNotifiers = config.AllowLocalNotificationServers()
+
+// notifierHTTPClient is shared by the HTTP based channels. Their URLs are
+// set by users: the client refuses local addresses unless allowed.
+var notifierHTTPClient = newNotifierHTTPClient(allowLocalNotifiers)
+
+func newNotifierHTTPClient(allowLocal bool) *http.Client {
+	if allowLocal {
+		return &http.Client{Timeout: 15 * time.Second}
+	}
+	return safehttp.NewClient(15 * time.Second)
+}
+
+// WebPushNotifier sends to the browsers subscribed by a user.
+type WebPushNotifier struct {
+	UserID int
+}
+
+func (n WebPushNotifier) Notify(ctx context.Context, payload PushPayload, opts PushOptions) error {
+	delivered, err := deliverPush(n.UserID, payload, opts)
+	if err != nil {
+		return err
+	}
+	if delivered == 0 {
+		return errNoSubscriptions
+	}
+	return nil
+}
+
+// NotifierForChannel builds the notifier of a user-configured channel.
+func NotifierForChannel(ch models.NotificationChannel) (Notifier, error) {
+	switch ch.Type {
+	case models.ChannelSMTP:
+		var cfg SMTPConfig
+		if err := json.Unmarshal(ch.Config, &cfg); err != nil {
+			return nil, err
+		}
+		return &SMTPNotifier{Config: cfg}, cfg.validate()
+	case models.ChannelNtfy:
+		var cfg NtfyConfig
+		if err := json.Unmarshal(ch.Config, &cfg); err != nil {
+			return nil, err
+		}
+		return &NtfyNotifier{Config: cfg, Client: notifierHTTPClient}, cfg.validate()
+	case models.ChannelGotify:
+		var cfg GotifyConfig
+		if err := json.Unmarshal(ch.Config, &cfg); err != nil {
+			return nil, err
+		}
+		return &GotifyNotifier{Config: cfg, Client: notifierHTTPClient}, cfg.validate()
+	case models.ChannelWebhook:
+		var cfg WebhookConfig
+		if err := json.Unmarshal(ch.Config, &cfg); err != nil {
+			return nil, err
+		}
+		return &WebhookNotifier{Config: cfg, Client: notifierHTTPClient}, cfg.validate()
+	default:
+		return nil, fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+}
+
+// NotifyUser delivers a notification to the user through Web Push and every
+// enabled channel. This is the single entry point for notification senders:
+// it applies the user's category toggles and quiet hours.
+// Returns the number of channels that accepted the message.
+func NotifyUser(userID int, payload PushPayload, opts PushOptions) (int, error) {
+	prefs, err := database.GetNotificationSettings(userID)
+	if err != nil {
+		return 0, err
+	}
+	if !prefs.Allows(opts.Category) {
+		return 0, ErrNotificationDisabled
+	}
+
+	if prefs.QuietHours.Enabled && opts.Urgency != webpush.UrgencyHigh {
+		settings, err := database.GetUserSettings(userID)
+		if err != nil {
+			return 0, err
+		}
+		if until, quiet := quietHoursEnd(prefs.QuietHours, time.Now().In(userLocation(settings))); quiet {
+			if err := deferPush(userID, payload, opts, until); err != nil {
+				return 0, err
+			}
+			return 0, ErrNotificationDeferred
+		}
+	}
+
+	return dispatchNotification(userID, payload, opts)
+}
+
+// notificationStatus returns the notification_log status of a NotifyUser result.
+func notificationStatus(delivered int, err error) string {
+	switch {
+	case errors.Is(err, ErrNotificationDisabled):
+		return database.NotificationSkipped
+	case errors.Is(err, ErrNotificationDeferred):
+		return database.NotificationDeferred
+	case err != nil || delivered == 0:
+		return database.NotificationFailed
+	default:
+		return database.NotificationSent
+	}
+}
+
+// dispatchNotification sends to all channels of the user, without checking
+// preferences. A failing channel doesn't prevent delivery on the others.
+// With opts.LogID, the channels that already accepted the notification count
+// as delivered without being sent it again.
+func dispatchNotification(userID int, payload PushPayload, opts PushOptions) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	done, err := notificationDeliveries(opts.LogID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Web Push records the delivery of each device itself
+	notifiers := []Notifier{WebPushNotifier{UserID: userID}}
+	keys := []string{""}
+
+	channels, err := database.GetNotificationChannels(userID, true)
+	if err != nil {
+		log.Println("Failed to load notification channels:", err)
+	}
+	for _, ch := range channels {
+		if ch.Config, err = openChannelConfig(ch.Config); err != nil {
+			log.Printf("Notification channel %d can't be decrypted: %v\n", ch.ID, err)
+			continue
+		}
+		n, err := NotifierForChannel(ch)
+		if err != nil {
+			log.Printf("Notification channel %d is misconfigured: %v\n", ch.ID, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+		keys = append(keys, fmt.Sprintf("channel:%d", ch.ID))
+	}
+
+	delivered := 0
+	var lastErr error
+	for i, n := range notifiers {
+		if done[keys[i]] {
+			delivered++
+			continue
+		}
+		if err := n.Notify(ctx, payload, opts); err != nil {
+			if err != errNoSubscriptions {
+				log.Printf("Notification via %T failed: %v\n", n, err)
+			}
+			lastErr = err
+			continue
+		}
+		delivered++
+		recordNotificationDelivery(opts.LogID, keys[i])
+	}
+
+	if delivered == 0 && lastErr != nil && lastErr != errNoSubscriptions {
+		return 0, lastErr
+	}
+	return delivered, nil
+}
+
+// notificationDeliveries returns the channels that accepted the logged
+// notification, none for logID 0.
+func notificationDeliveries(logID int64) (map[string]bool, error) {
+	if logID == 0 {
+		return nil, nil
+	}
+	return database.GetNotificationDeliveries(logID)
+}
+
+func recordNotificationDelivery(logID int64, channel string) {
+	if logID == 0 || channel == "" {
+		return
+	}
+	if err := database.RecordNotificationDelivery(logID, channel); err != nil {
+		log.Println(err)
+	}
+}
+
+func deferPush(userID int, payload PushPayload, opts PushOptions, until time.Time) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return database.DeferPush(userID, string(payloadJSON), string(optsJSON), until)
+}
+
+// StartDeferredPushWorker delivers notifications held back by quiet hours
+// once the quiet period is over, and retries the pushes that failed
+// transiently.
+func StartDeferredPushWorker() {
+	if n, err := database.ReleaseInterruptedPushes(); err != nil {
+		log.Println("Deferred push worker:", err)
+	} else if n > 0 {
+		log.Printf("Deferred push worker: resending %d interrupted notifications\n", n)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			now := time.Now()
+			flushDeferredPushes(now)
+			retryDuePushes(now)
+			<-ticker.C
+		}
+	}()
+}
+
+func flushDeferredPushes(now time.Time) {
+	pushes, err := database.ClaimDuePushes(now)
+	if err != nil {
+		log.Println("Deferred push worker:", err)
+		return
+	}
+
+	for _, p := range pushes {
+		flushDeferredPush(p)
+		if err := database.DeleteDeferredPush(p.ID); err != nil {
+			log.Println("Deferred push worker:", err)
+		}
+	}
+}
+
+func flushDeferredPush(p database.DeferredPush) {
+	var payload PushPayload
+	var opts PushOptions
+	if err := json.Unmarshal([]byte(p.Payload), &payload); err != nil {
+		return
+	}
+	if err := json.Unmarshal([]byte(p.Options), &opts); err != nil {
+		return
+	}
+
+	// The user may have turned the category off in the meantime
+	prefs, err := database.GetNotificationSettings(p.UserID)
+	if err != nil || !prefs.Allows(opts.Category) {
+		return
+	}
+	if _, err := dispatchNotification(p.UserID, payload, opts); err != nil {
+		log.Println("Deferred push worker:", err)
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// NtfyConfig is the configuration of an ntfy (https://ntfy.sh) channel.
+type NtfyConfig struct {
+	ServerURL string `json:"serverUrl"` // e.g. https://ntfy.sh
+	Topic     string `json:"topic"`
+	Token     string `json:"token,omitempty"` // Access token for protected topics
+}
+
+func (c NtfyConfig) validate() error {
+	if c.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	return validateChannelURL(c.ServerURL)
+}
+
+// NtfyNotifier publishes notifications to an ntfy topic.
+type NtfyNotifier struct {
+	Config NtfyConfig
+	Client *http.Client
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, payload PushPayload, opts PushOptions) error {
+	payload = payload.withDefaults()
+	endpoint := strings.TrimRight(n.Config.ServerURL, "/") + "/" + url.PathEscape(n.Config.Topic)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(payload.Body))
+	if err != nil {
+		return err
+	}
+	// ntfy headers must be ASCII; RFC 2047 encoding is understood by ntfy
+	req.Header.Set("Title", mime.BEncoding.Encode("utf-8", payload.Title))
+	req.Header.Set("Priority", ntfyPriority(opts.Urgency))
+	if opts.Category != "" {
+		req.Header.Set("Tags", string(opts.Category))
+	}
+	if link := payload.absoluteURL(); link != "" {
+		req.Header.Set("Click", link)
+	}
+	if n.Config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Config.Token)
+	}
+	return doNotifierRequest(n.Client, req)
+}
+
+// ntfyPriority maps RFC 8030 urgency to ntfy priorities (1-5).
+func ntfyPriority(u webpush.Urgency) string {
+	switch u {
+	case webpush.UrgencyVeryLow:
+		return "1"
+	case webpush.UrgencyLow:
+		return "2"
+	case webpush.UrgencyHigh:
+		return "5"
+	default:
+		return "3"
+	}
+}
+
+// GotifyConfig is the configuration of a Gotify (https://gotify.net) channel.
+type GotifyConfig struct {
+	ServerURL string `json:"serverUrl"`
+	Token     string `json:"token"` // Application token
+}
+
+func (c GotifyConfig) validate() error {
+	if c.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	return validateChannelURL(c.ServerURL)
+}
+
+// GotifyNotifier sends notifications to a Gotify server.
+type GotifyNotifier struct {
+	Config GotifyConfig
+	Client *http.Client
+}
+
+func (n *GotifyNotifier) Notify(ctx context.Context, payload PushPayload, opts PushOptions) error {
+	payload = payload.withDefaults()
+	message := map[string]any{
+		"title":    payload.Title,
+		"message":  payload.Body,
+		"priority": gotifyPriority(opts.Urgency),
+	}
+	if link := payload.absoluteURL(); link != "" {
+		message["extras"] = map[string]any{
+			"client::notification": map[string]any{
+				"click": map[string]string{"url": link},
+			},
+		}
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(n.Config.ServerURL, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", n.Config.Token)
+	return doNotifierRequest(n.Client, req)
+}
+
+// gotifyPriority maps RFC 8030 urgency to Gotify priorities (0-10).
+func gotifyPriority(u webpush.Urgency) int {
+	switch u {
+	case webpush.UrgencyVeryLow:
+		return 1
+	case webpush.UrgencyLow:
+		return 3
+	case webpush.UrgencyHigh:
+		return 8
+	default:
+		return 5
+	}
+}
+
+// WebhookConfig is the configuration of a generic webhook channel.
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"` // e.g. Authorization
+}
+
+func (c WebhookConfig) validate() error {
+	return validateChannelURL(c.URL)
+}
+
+// WebhookNotifier POSTs the notification as JSON to an arbitrary URL.
+type WebhookNotifier struct {
+	Config WebhookConfig
+	Client *http.Client
+}
+
+// webhookBody is the JSON document sent by WebhookNotifier.
+type webhookBody struct {
+	PushPayload
+	AbsoluteURL string          `json:"absoluteUrl,omitempty"`
+	Category    string          `json:"category,omitempty"`
+	Urgency     webpush.Urgency `json:"urgency,omitempty"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, payload PushPayload, opts PushOptions) error {
+	payload = payload.withDefaults()
+	body, err := json.Marshal(webhookBody{
+		PushPayload: payload,
+		AbsoluteURL: payload.absoluteURL(),
+		Category:    string(opts.Category),
+		Urgency:     opts.Urgency,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Config.Headers {
+		req.Header.Set(k, v)
+	}
+	return doNotifierRequest(n.Client, req)
+}
+
+func doNotifierRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// validateHTTPURL checks a URL the server is asked to reach. The clients of
+// safehttp check the addresses host names resolve to.
+func validateHTTPURL(raw string) error {
+	return safehttp.ValidateURL(raw)
+}
+
+// validateChannelURL checks the URL of a channel, which may be local if the
+// admin allowed it.
+func validateChannelURL(raw string) error {
+	err := validateHTTPURL(raw)
+	if allowLocalNotifiers && errors.Is(err, safehttp.ErrForbiddenAddress) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"mime"
+	"net"
+	"net/netip"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/safehttp"
+)
+
+// SMTP security modes.
+const (
+	SMTPSecurityStartTLS = "starttls" // Plain connection upgraded with STARTTLS (port 587)
+	SMTPSecurityTLS      = "tls"      // Implicit TLS (port 465)
+	SMTPSecurityNone     = "none"     // Unencrypted, only for local relays
+)
+
+// SMTPConfig is the configuration of an email channel.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Security string `json:"security"` // starttls (default), tls or none
+}
+
+func (c SMTPConfig) validate() error {
+	if c.Host == "" || c.Port == 0 || c.From == "" || c.To == "" {
+		return fmt.Errorf("host, port, from and to are required")
+	}
+	if addr, err := netip.ParseAddr(c.Host); err == nil && !allowLocalNotifiers && !safehttp.Allowed(addr) {
+		return fmt.Errorf("%w: %s", safehttp.ErrForbiddenAddress, addr)
+	}
+	switch c.Security {
+	case "", SMTPSecurityStartTLS, SMTPSecurityTLS, SMTPSecurityNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown security mode %q", c.Security)
+	}
+}
+
+// smtpRootCAs verifies the certificates of mail servers, the system roots
+// when nil. Set by tests.
+var smtpRootCAs *x509.CertPool
+
+// SMTPNotifier sends notifications by email. Like the HTTP channels, it
+// refuses to connect to the local network unless allowed, checking the
+// addresses host names resolve to.
+type SMTPNotifier struct {
+	Config SMTPConfig
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, payload PushPayload, opts PushOptions) error {
+	cfg := n.Config
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowLocalNotifiers {
+		dialer.Control = safehttp.Control
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, RootCAs: smtpRootCAs}
+	var conn net.Conn
+	var err error
+	if cfg.Security == SMTPSecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if cfg.Security == "" || cfg.Security == SMTPSecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if cfg.Username != "" {
+		// PlainAuth refuses to send credentials over unencrypted connections
+		// except to localhost, which is what we want.
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("smtp mail: %w", err)
+	}
+	for _, rcpt := range strings.Split(cfg.To, ",") {
+		if err := client.Rcpt(strings.TrimSpace(rcpt)); err != nil {
+			return fmt.Errorf("smtp rcpt: %w", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(buildEmail(cfg, payload)); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildEmail renders the notification as a plain text email.
+func buildEmail(cfg SMTPConfig, payload PushPayload) []byte {
+	payload = payload.withDefaults()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", cfg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", payload.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(payload.Body, "\n", "\r\n")
+	b.WriteString(body)
+	b.WriteString("\r\n")
+	if link := payload.absoluteURL(); link != "" {
+		fmt.Fprintf(&b, "\r\n%s\r\n", link)
+	}
+	return b.Bytes()
+}
@@ -6,10 +6,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/SherClockHolmes/webpush-go"
 	"github.com/gabrielhirakawa/lifehub/internal/config"
 	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
 )
 
 var (
@@ -103,55 +106,138 @@ func HandleSubscribe(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
-// HandleSendNotification sends a test notification to all subscribers (or specific user if implemented).
+// HandleSendNotification sends a test notification through all of the current user's channels.
 func HandleSendNotification(w http.ResponseWriter, r *http.Request) {
-	// For test, we can send to the current user only, or all.
-	// Let's send to the current user if logged in, otherwise all (for admin testing).
-	// But this endpoint is protected now? Not yet, we need to wrap it.
-	
 	userID, err := GetUserIDFromContext(r)
-	var subs []database.Subscription
-	
-	if err == nil {
-		// Send only to this user
-		subs, err = database.GetSubscriptionsByUserID(userID)
-	} else {
-		// Fallback or Admin mode: Send to all (be careful in prod)
-		// For now, let's just require auth for this too.
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	if err != nil {
-		http.Error(w, "Failed to get subscriptions", http.StatusInternalServerError)
+	payload := PushPayload{
+		Title: "LifeHub",
+		Body:  "Hello from LifeHub! This is a test notification.",
+		Tag:   "test",
+	}
+	// High urgency so the test goes through quiet hours
+	opts := PushOptions{TTL: 30, Urgency: webpush.UrgencyHigh, Category: models.NotificationSystem}
+	if _, err := NotifyUser(userID, payload, opts); err != nil {
+		http.Error(w, "Failed to send notifications", http.StatusInternalServerError)
 		return
 	}
 
-	message := "Hello from LifeHub! This is a test notification."
+	w.Write([]byte("Notifications sent!"))
+}
 
+// deliverPush sends to the user's devices that are not muted. Devices that
+// already accepted the logged notification of opts.LogID count as delivered.
+func deliverPush(userID int, payload PushPayload, opts PushOptions) (int, error) {
+	subs, err := database.GetSubscriptionsByUserID(userID)
+	if err != nil {
+		return 0, err
+	}
+	done, err := notificationDeliveries(opts.LogID)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	active := subs[:0]
 	for _, s := range subs {
-		sub := &webpush.Subscription{
-			Endpoint: s.Endpoint,
-			Keys: webpush.Keys{
-				P256dh: s.P256dh,
-				Auth:   s.Auth,
-			},
+		switch {
+		case s.Muted:
+		case done[pushDeliveryKey(s.ID)]:
+			delivered++
+		default:
+			active = append(active, s)
 		}
+	}
+	sent, err := sendPush(active, payload, opts)
+	return delivered + sent, err
+}
+
+func sendPush(subs []database.Subscription, payload PushPayload, opts PushOptions) (int, error) {
+	message, err := payload.encode()
+	if err != nil {
+		return 0, err
+	}
 
-		// Send Notification
-		resp, err := webpush.SendNotification([]byte(message), sub, &webpush.Options{
-			Subscriber:      "mailto:admin@lifehub.com", // Required by VAPID
-			VAPIDPublicKey:  VapidPublicKey,
-			VAPIDPrivateKey: VapidPrivateKey,
-			TTL:             30,
-		})
-		if err != nil {
-			log.Println("Failed to send push:", err)
-		} else {
-			log.Println("Push sent, status:", resp.Status)
-			defer resp.Body.Close()
+	// Messages queued for a retry count as delivered: the retry worker takes
+	// over
+	delivered := 0
+	for _, s := range subs {
+		if outcome := pushSender.Send(s, message, opts); outcome == PushDelivered || outcome == PushQueued {
+			delivered++
+			recordNotificationDelivery(opts.LogID, pushDeliveryKey(s.ID))
 		}
 	}
+	return delivered, nil
+}
 
-	w.Write([]byte("Notifications sent!"))
+// pushDeliveryKey identifies a device in notification_deliveries.
+func pushDeliveryKey(subscriptionID int) string {
+	return "push:" + strconv.Itoa(subscriptionID)
+}
+
+// HandleListSubscriptions returns the push subscriptions (devices) of the
+// authenticated user with their delivery status.
+// Route: GET /api/push/subscriptions
+func HandleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subs, err := database.GetSubscriptionsByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get subscriptions", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []database.Subscription{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// HandleDeleteSubscription removes one of the authenticated user's subscriptions.
+// Route: DELETE /api/push/subscriptions/{id}
+func HandleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "push", "subscriptions", "{id}"]
+	if len(parts) < 5 || parts[4] == "" {
+		http.Error(w, "Subscription ID required", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(parts[4])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeleteUserSubscription(userID, id); err != nil {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"deleted"}`))
 }
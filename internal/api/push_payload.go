@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/config"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// PushAction is a button shown on the notification.
+// Clicking it opens URL when set, otherwise the payload URL.
+type PushAction struct {
+	Action string `json:"action"`
+	Title  string `json:"title"`
+	URL    string `json:"url,omitempty"`
+}
+
+// PushPayload is the JSON message delivered to the service worker (sw.js).
+// Every push sender uses it so notifications render consistently.
+type PushPayload struct {
+	Title    string       `json:"title"`
+	Body     string       `json:"body"`
+	Tag      string       `json:"tag,omitempty"` // Same tag replaces the previous notification on the device
+	URL      string       `json:"url,omitempty"` // Page opened on click
+	Icon     string       `json:"icon,omitempty"`
+	Actions  []PushAction `json:"actions,omitempty"`
+	WidgetID string       `json:"widgetId,omitempty"`
+}
+
+// PushOptions are the RFC 8030 delivery options of a push message, plus the
+// category used to apply the user's notification preferences.
+// High urgency messages are delivered even during quiet hours.
+type PushOptions struct {
+	TTL      int                         `json:"ttl"`             // Seconds the push service keeps the message for offline devices
+	Urgency  webpush.Urgency             `json:"urgency"`         // very-low, low, normal or high
+	Topic    string                      `json:"topic,omitempty"` // Pending messages with the same topic are replaced
+	Category models.NotificationCategory `json:"category"`
+	// LogID is the notification_log entry of the notification, 0 for none.
+	// The channels that accept it are recorded, and skipped by its retries.
+	LogID int64 `json:"logId,omitempty"`
+}
+
+const defaultPushIcon = "/favicon.svg"
+
+// WidgetURL returns the deep link to a widget on the dashboard.
+func WidgetURL(widgetID string) string {
+	return "/#widget-" + widgetID
+}
+
+// PushTopic derives a valid RFC 8030 topic (max 32 URL-safe base64 chars)
+// from an arbitrary key, e.g. a notification tag.
+func PushTopic(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:32]
+}
+
+// withDefaults fills in the title, icon and URL when missing.
+func (p PushPayload) withDefaults() PushPayload {
+	if p.Title == "" {
+		p.Title = "LifeHub"
+	}
+	if p.Icon == "" {
+		p.Icon = defaultPushIcon
+	}
+	if p.URL == "" {
+		if p.WidgetID != "" {
+			p.URL = WidgetURL(p.WidgetID)
+		} else {
+			p.URL = "/"
+		}
+	}
+	return p
+}
+
+// absoluteURL returns the click URL prefixed with the public server URL, for
+// channels outside the browser. Empty when no public URL is configured.
+func (p PushPayload) absoluteURL() string {
+	base := config.GetPublicURL()
+	if base == "" {
+		return ""
+	}
+	return base + p.withDefaults().URL
+}
+
+// encode fills in defaults and serializes the payload.
+func (p PushPayload) encode() ([]byte, error) {
+	return json.Marshal(p.withDefaults())
+}
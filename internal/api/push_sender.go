@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+)
+
+// PushOutcome classifies the response of a push service.
+type PushOutcome int
+
+const (
+	PushDelivered PushOutcome = iota // 2xx: accepted by the push service
+	PushGone                         // 404/410: subscription expired or unsubscribed
+	PushRetryable                    // 429/5xx or network error: try again later
+	PushRejected                     // Any other 4xx: our request is wrong, don't retry
+	PushQueued                       // Retryable, queued for another attempt (only returned by Send)
+)
+
+// ClassifyPushResponse maps a push service status code to an outcome.
+// A status of 0 means the request never got a response.
+func ClassifyPushResponse(status int) PushOutcome {
+	switch {
+	case status >= 200 && status < 300:
+		return PushDelivered
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return PushGone
+	case status == 0 || status == http.StatusTooManyRequests || status >= 500:
+		return PushRetryable
+	default:
+		return PushRejected
+	}
+}
+
+// PushSender delivers Web Push messages, retrying transient failures and
+// keeping the subscription table clean. Retries are queued in push_retries
+// and sent by the scheduler, see retryDuePushes.
+type PushSender struct {
+	Client      *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration // Also caps Retry-After
+}
+
+// NewPushSender returns a sender with production defaults.
+func NewPushSender() *PushSender {
+	return &PushSender{
+		Client:      &http.Client{Timeout: 15 * time.Second},
+		MaxAttempts: 4,
+		BaseBackoff: time.Minute,
+		MaxBackoff:  15 * time.Minute,
+	}
+}
+
+var pushSender = NewPushSender()
+
+// Send delivers the message to one subscription and records the result.
+// Gone subscriptions are deleted.
+func (ps *PushSender) Send(s database.Subscription, message []byte, opts PushOptions) PushOutcome {
+	return ps.send(s, message, opts, 1)
+}
+
+func (ps *PushSender) send(s database.Subscription, message []byte, opts PushOptions, attempt int) PushOutcome {
+	sub := &webpush.Subscription{
+		Endpoint: s.Endpoint,
+		Keys: webpush.Keys{
+			P256dh: s.P256dh,
+			Auth:   s.Auth,
+		},
+	}
+	resp, err := webpush.SendNotification(message, sub, &webpush.Options{
+		HTTPClient:      ps.Client,
+		Subscriber:      "mailto:admin@lifehub.com", // Required by VAPID
+		VAPIDPublicKey:  VapidPublicKey,
+		VAPIDPrivateKey: VapidPrivateKey,
+		TTL:             opts.TTL,
+		Urgency:         opts.Urgency,
+		Topic:           opts.Topic,
+	})
+
+	var status int
+	var lastErr string
+	var retryAfter time.Duration
+	if err != nil {
+		lastErr = err.Error()
+	} else {
+		status = resp.StatusCode
+		if status >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			lastErr = fmt.Sprintf("%s: %s", resp.Status, body)
+		}
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		resp.Body.Close()
+	}
+
+	outcome := ClassifyPushResponse(status)
+	if outcome == PushRetryable && attempt < ps.MaxAttempts {
+		err := ps.queueRetry(s.ID, message, opts, attempt+1, time.Now().Add(ps.backoff(attempt, retryAfter)))
+		if err == nil {
+			return PushQueued
+		}
+		log.Println(err)
+	}
+
+	switch outcome {
+	case PushDelivered:
+		if err := database.RecordPushSuccess(s.ID, status); err != nil {
+			log.Println(err)
+		}
+	case PushGone:
+		log.Printf("Push subscription %d is gone (status %d), removing it\n", s.ID, status)
+		if err := database.DeleteSubscription(s.ID); err != nil {
+			log.Println(err)
+		}
+	default:
+		log.Printf("Failed to send push to subscription %d: %s\n", s.ID, lastErr)
+		if err := database.RecordPushFailure(s.ID, status, lastErr); err != nil {
+			log.Println(err)
+		}
+	}
+	return outcome
+}
+
+func (ps *PushSender) queueRetry(subscriptionID int, message []byte, opts PushOptions, attempt int, at time.Time) error {
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return database.QueuePushRetry(database.PushRetry{
+		SubscriptionID: subscriptionID,
+		Message:        string(message),
+		Options:        string(options),
+		Attempt:        attempt,
+		NextAttemptAt:  at,
+	})
+}
+
+// retryDuePushes makes the push attempts queued by Send that are due at the
+// given time. Retries to subscriptions deleted or muted since are dropped.
+func retryDuePushes(now time.Time) {
+	retries, err := database.TakeDuePushRetries(now)
+	if err != nil {
+		log.Println("Push retry worker:", err)
+		return
+	}
+
+	for _, r := range retries {
+		var opts PushOptions
+		if err := json.Unmarshal([]byte(r.Options), &opts); err != nil {
+			continue
+		}
+		s, err := database.GetSubscription(r.SubscriptionID)
+		if err != nil {
+			log.Println("Push retry worker:", err)
+			continue
+		}
+		if s == nil || s.Muted {
+			continue
+		}
+		pushSender.send(*s, []byte(r.Message), opts, r.Attempt)
+	}
+}
+
+// backoff returns the wait before the next attempt: the server's Retry-After
+// when given, otherwise exponential backoff. Both are capped by MaxBackoff.
+func (ps *PushSender) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := retryAfter
+	if wait <= 0 {
+		wait = ps.BaseBackoff << (attempt - 1)
+	}
+	if wait > ps.MaxBackoff {
+		wait = ps.MaxBackoff
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header in either delay-seconds or
+// HTTP-date form. Returns 0 when absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
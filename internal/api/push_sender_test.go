@@ -0,0 +1,101 @@
+package api
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+)
+
+// pushService answers the pushes it receives with the given statuses, then
+// with 201, at the endpoint of a new subscription of the user.
+func pushService(t *testing.T, userID int, statuses ...int) (database.Subscription, *atomic.Int32) {
+	t.Helper()
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(received.Add(1))
+		if n <= len(statuses) {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	client := pushSender.Client
+	pushSender.Client = srv.Client()
+	t.Cleanup(func() { pushSender.Client = client })
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	endpoint := srv.URL + "/push/" + t.Name()
+	p256dh := base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	if err := database.SaveSubscription(userID, endpoint, p256dh, base64.RawURLEncoding.EncodeToString(auth)); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := database.GetSubscriptionsByUserID(userID)
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("subscriptions = %+v, %v", subs, err)
+	}
+	return subs[0], &received
+}
+
+func TestPushRetriesAreScheduled(t *testing.T) {
+	InitVAPID()
+	userID := newTestUser(t)
+	sub, received := pushService(t, userID, http.StatusServiceUnavailable)
+
+	start := time.Now()
+	if outcome := pushSender.Send(sub, []byte(`{"title":"Hi"}`), PushOptions{TTL: 60}); outcome != PushQueued {
+		t.Fatalf("Send() = %v, want %v", outcome, PushQueued)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Send() waited %v for the retry", time.Since(start))
+	}
+
+	// Not before the Retry-After of the push service
+	retryDuePushes(time.Now().Add(time.Minute))
+	if n := received.Load(); n != 1 {
+		t.Fatalf("push service got %d requests before the retry was due", n)
+	}
+	retryDuePushes(time.Now().Add(3 * time.Minute))
+	if n := received.Load(); n != 2 {
+		t.Fatalf("push service got %d requests, want the retry", n)
+	}
+	if s, _ := database.GetSubscription(sub.ID); s == nil || s.LastSuccessAt == nil || s.FailureCount != 0 {
+		t.Errorf("subscription after the retry = %+v", s)
+	}
+}
+
+func TestPushRetriesAreBounded(t *testing.T) {
+	InitVAPID()
+	userID := newTestUser(t)
+	statuses := make([]int, pushSender.MaxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusTooManyRequests
+	}
+	sub, received := pushService(t, userID, statuses...)
+
+	pushSender.Send(sub, []byte(`{"title":"Hi"}`), PushOptions{TTL: 60})
+	at := time.Now()
+	for i := 0; i < pushSender.MaxAttempts; i++ {
+		at = at.Add(pushSender.MaxBackoff + time.Minute)
+		retryDuePushes(at)
+	}
+	if n := int(received.Load()); n != pushSender.MaxAttempts {
+		t.Errorf("push service got %d requests, want %d", n, pushSender.MaxAttempts)
+	}
+	if s, _ := database.GetSubscription(sub.ID); s == nil || s.FailureCount != 1 || s.LastStatus != http.StatusTooManyRequests {
+		t.Errorf("subscription after the last attempt = %+v", s)
+	}
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/recurrence"
+)
+
+// HandleSkipOccurrence skips the current occurrence of a recurring todo or
+// reminder: its date is recorded as an exception and the item moves to the
+// next occurrence. Skipping the last occurrence removes the item.
+// Routes: POST /api/widgets/{id}/todos/{todoId}/skip
+// POST /api/widgets/{id}/reminders/{reminderId}/skip
+func HandleSkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "widgets", "{id}", "todos|reminders", "{itemId}", "skip"]
+	if len(parts) != 7 || parts[3] == "" || parts[5] == "" || parts[6] != "skip" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID, itemID := parts[3], parts[5]
+
+	var item any
+	switch parts[4] {
+	case "todos":
+		err = mutateTodos(userID, widgetID, 0, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			for i := range todos {
+				t := &todos[i]
+				if t.ID != itemID {
+					continue
+				}
+				if t.Completed {
+					return nil, fmt.Errorf("%w: todo already completed", errInvalidWidget)
+				}
+				next, ok, err := skipOccurrence(&t.Recurrence, t.ID, t.DueDate)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					item = nil
+					return append(todos[:i], todos[i+1:]...), nil
+				}
+				t.DueDate, t.RolledOver = next, 0
+				item = *t
+				return todos, nil
+			}
+			return nil, errItemNotFound
+		})
+
+	case "reminders":
+		err = mutateReminders(userID, widgetID, 0, func(reminders []models.ReminderItem) ([]models.ReminderItem, error) {
+			for i := range reminders {
+				rem := &reminders[i]
+				if rem.ID != itemID {
+					continue
+				}
+				if rem.Completed {
+					return nil, fmt.Errorf("%w: reminder already completed", errInvalidWidget)
+				}
+				next, ok, err := skipOccurrence(&rem.Recurrence, rem.ID, rem.Date)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					item = nil
+					return append(reminders[:i], reminders[i+1:]...), nil
+				}
+				rem.Date = next
+				item = *rem
+				return reminders, nil
+			}
+			return nil, errItemNotFound
+		})
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	if item == nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// validateRecurrence checks the recurrence of an item occurring on date.
+func validateRecurrence(rec models.Recurrence, date string) error {
+	if rec.RRule == "" {
+		return nil
+	}
+	if date == "" {
+		return errors.New("recurring items require a date")
+	}
+	if _, err := recurrence.Parse(rec.RRule); err != nil {
+		return fmt.Errorf("invalid rrule: %w", err)
+	}
+	for _, d := range append([]string{rec.SeriesStart}, rec.ExDates...) {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return fmt.Errorf("invalid date %q", d)
+		}
+	}
+	return nil
+}
+
+// seriesOf returns the recurrence of an item with its series filled in:
+// the first occurrence of a series is the item itself.
+func seriesOf(rec models.Recurrence, id, date string) models.Recurrence {
+	if rec.SeriesID == "" {
+		rec.SeriesID = id
+	}
+	if rec.SeriesStart == "" {
+		rec.SeriesStart = date
+	}
+	rec.ExDates = append([]string(nil), rec.ExDates...)
+	return rec
+}
+
+// nextOccurrence returns the date of the occurrence following the one of
+// an item on date, and the recurrence it shares with the item.
+func nextOccurrence(rec models.Recurrence, id, date string) (string, models.Recurrence, bool) {
+	rec = seriesOf(rec, id, date)
+	rule, err := recurrence.Parse(rec.RRule)
+	if err != nil {
+		return "", rec, false
+	}
+	next, ok := rule.Next(rec.SeriesStart, date, rec.ExDates)
+	return next, rec, ok
+}
+
+// occurrenceID is the ID of a materialised occurrence. It is derived from
+// the series, so that an occurrence is never materialised twice.
+func occurrenceID(rec models.Recurrence, date string) string {
+	return rec.SeriesID + "-" + strings.ReplaceAll(date, "-", "")
+}
+
+// skipOccurrence records the occurrence of an item on date as an exception
+// and returns the date of the next occurrence, false if there is none.
+func skipOccurrence(rec *models.Recurrence, id, date string) (string, bool, error) {
+	if rec.RRule == "" {
+		return "", false, fmt.Errorf("%w: not a recurring item", errInvalidWidget)
+	}
+	*rec = seriesOf(*rec, id, date)
+	rec.ExDates = append(rec.ExDates, date)
+	next, _, ok := nextOccurrence(*rec, id, date)
+	return next, ok, nil
+}
+
+// expandTodos appends the next occurrence of the recurring todos completed
+// in after but not in before.
+func expandTodos(before, after []models.TodoItem) []models.TodoItem {
+	wasCompleted := make(map[string]bool)
+	for _, t := range before {
+		wasCompleted[t.ID] = t.Completed
+	}
+	ids := make(map[string]bool)
+	for _, t := range after {
+		ids[t.ID] = true
+	}
+
+	for _, t := range after {
+		if t.RRule == "" || !t.Completed || wasCompleted[t.ID] {
+			continue
+		}
+		next, rec, ok := nextOccurrence(t.Recurrence, t.ID, t.DueDate)
+		if !ok || ids[occurrenceID(rec, next)] {
+			continue
+		}
+		ids[occurrenceID(rec, next)] = true
+		after = append(after, models.TodoItem{
+			ID:         occurrenceID(rec, next),
+			Text:       t.Text,
+			Priority:   t.Priority,
+			DueDate:    next,
+			Recurrence: rec,
+		})
+	}
+	return after
+}
+
+// expandReminders appends the next occurrence of the recurring reminders
+// completed in after but not in before.
+func expandReminders(before, after []models.ReminderItem) []models.ReminderItem {
+	wasCompleted := make(map[string]bool)
+	for _, r := range before {
+		wasCompleted[r.ID] = r.Completed
+	}
+	ids := make(map[string]bool)
+	for _, r := range after {
+		ids[r.ID] = true
+	}
+
+	for _, r := range after {
+		if r.RRule == "" || !r.Completed || wasCompleted[r.ID] {
+			continue
+		}
+		next, rec, ok := nextOccurrence(r.Recurrence, r.ID, r.Date)
+		if !ok || ids[occurrenceID(rec, next)] {
+			continue
+		}
+		ids[occurrenceID(rec, next)] = true
+		after = append(after, models.ReminderItem{
+			ID:             occurrenceID(rec, next),
+			Text:           r.Text,
+			Date:           next,
+			Recurrence:     rec,
+			SourceID:       r.SourceID,
+			SubscriptionID: r.SubscriptionID,
+		})
+	}
+	return after
+}
+
+// expandWidgetRecurrences validates the recurring items of a Todo or
+// Reminder widget being saved over old (nil for a new widget) and
+// materialises the next occurrence of the ones completed by the save.
+// Returns whether the content was changed.
+func expandWidgetRecurrences(old *models.Widget, widget *models.Widget) (bool, error) {
+	if widget.Type != models.WidgetTypeTodo && widget.Type != models.WidgetTypeReminder {
+		return false, nil
+	}
+	content, err := widgetContentFields(*widget)
+	if err != nil {
+		return false, err
+	}
+	var before models.WidgetContentWrapper
+	if old != nil && old.Type == widget.Type {
+		json.Unmarshal(old.Content, &before)
+	}
+
+	var field string
+	var items any
+	switch widget.Type {
+	case models.WidgetTypeTodo:
+		var todos []models.TodoItem
+		if content["todos"] != nil {
+			if err := json.Unmarshal(content["todos"], &todos); err != nil {
+				return false, fmt.Errorf("invalid todos: %w", err)
+			}
+		}
+		for _, t := range todos {
+			if err := validateRecurrence(t.Recurrence, t.DueDate); err != nil {
+				return false, err
+			}
+		}
+		expanded := expandTodos(before.Todos, todos)
+		if len(expanded) == len(todos) {
+			return false, nil
+		}
+		field, items = "todos", expanded
+
+	case models.WidgetTypeReminder:
+		var reminders []models.ReminderItem
+		if content["reminders"] != nil {
+			if err := json.Unmarshal(content["reminders"], &reminders); err != nil {
+				return false, fmt.Errorf("invalid reminders: %w", err)
+			}
+		}
+		for _, r := range reminders {
+			if err := validateRecurrence(r.Recurrence, r.Date); err != nil {
+				return false, err
+			}
+		}
+		expanded := expandReminders(before.Reminders, reminders)
+		if len(expanded) == len(reminders) {
+			return false, nil
+		}
+		field, items = "reminders", expanded
+	}
+
+	if content[field], err = json.Marshal(items); err != nil {
+		return false, err
+	}
+	if widget.Content, err = json.Marshal(content); err != nil {
+		return false, err
+	}
+	return true, nil
+}
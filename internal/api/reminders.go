@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	reminderCheckInterval = time.Minute
+	// reminderCatchUpWindow bounds how late a reminder may still be delivered,
+	// e.g. after the server was down. Older reminders are not sent at all.
+	reminderCatchUpWindow = 24 * time.Hour
+)
+
+// StartReminderScheduler periodically sends push notifications for due reminders.
+// Delivery is tracked in notification_log, so restarts don't skip reminders
+// that became due while the server was down. Notifications interrupted by a
+// restart are retried on the channels that didn't record their delivery.
+func StartReminderScheduler() {
+	if n, err := database.ReleaseInterruptedNotifications(); err != nil {
+		log.Println("Reminder scheduler:", err)
+	} else if n > 0 {
+		log.Printf("Reminder scheduler: retrying %d interrupted notifications\n", n)
+	}
+
+	go func() {
+		ticker := time.NewTicker(reminderCheckInterval)
+		defer ticker.Stop()
+		for {
+			checkDueReminders(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// checkDueReminders sends every reminder that is due at the given time and
+// has not been notified yet.
+func checkDueReminders(now time.Time) {
+	widgets, err := database.GetActiveWidgetsByType(models.WidgetTypeReminder)
+	if err != nil {
+		log.Println("Reminder scheduler failed to load widgets:", err)
+		return
+	}
+
+	settingsCache := make(map[int]models.UserSettings)
+	for _, widget := range widgets {
+		var content models.WidgetContentWrapper
+		if err := json.Unmarshal(widget.Content, &content); err != nil {
+			continue
+		}
+
+		settings, ok := settingsCache[widget.UserID]
+		if !ok {
+			settings, err = database.GetUserSettings(widget.UserID)
+			if err != nil {
+				log.Println("Reminder scheduler failed to load settings:", err)
+				continue
+			}
+			settingsCache[widget.UserID] = settings
+		}
+
+		for _, item := range content.Reminders {
+			if item.Completed {
+				continue
+			}
+			dueAt, ok := reminderDueTime(item, settings)
+			if !ok || dueAt.After(now) || now.Sub(dueAt) > reminderCatchUpWindow {
+				continue
+			}
+			notifyReminder(widget, item, dueAt, now)
+		}
+	}
+}
+
+// reminderDueTime returns the instant a reminder is due: its date at the
+// user's reminder time, in the user's timezone.
+func reminderDueTime(item models.ReminderItem, settings models.UserSettings) (time.Time, bool) {
+	loc := userLocation(settings)
+	date, err := time.ParseInLocation("2006-01-02", item.Date, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	clock, err := time.Parse("15:04", settings.ReminderTime)
+	if err != nil {
+		clock, _ = time.Parse("15:04", models.DefaultUserSettings().ReminderTime)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, loc), true
+}
+
+func notifyReminder(widget models.Widget, item models.ReminderItem, dueAt, now time.Time) {
+	logID, claimed, err := database.ClaimNotification(widget.UserID, widget.ID, item.ID, dueAt.UTC().Format(time.RFC3339), now)
+	if err != nil {
+		log.Println("Reminder scheduler:", err)
+		return
+	}
+	if !claimed {
+		return // Already sent, or waiting for a retry
+	}
+
+	tag := "reminder-" + widget.ID + "-" + item.ID
+	payload := PushPayload{
+		Title:    widget.Title,
+		Body:     item.Text,
+		Tag:      tag,
+		WidgetID: widget.ID,
+		Actions: []PushAction{
+			{Action: "open", Title: "Open"},
+		},
+	}
+	// Normal urgency: reminders wait for the end of quiet hours
+	opts := PushOptions{
+		TTL:      int(reminderCatchUpWindow.Seconds()),
+		Urgency:  webpush.UrgencyNormal,
+		Topic:    PushTopic(tag),
+		Category: models.NotificationReminders,
+		LogID:    logID,
+	}
+	delivered, err := NotifyUser(widget.UserID, payload, opts)
+	if err := database.MarkNotification(logID, notificationStatus(delivered, err)); err != nil {
+		log.Println("Reminder scheduler:", err)
+	}
+}
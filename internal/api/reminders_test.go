@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestNotificationRetries(t *testing.T) {
+	userID := newTestUser(t)
+	widgetID, dueAt := uuid.NewString(), "2026-10-18T12:00:00Z"
+	claim := func(now time.Time) (int64, bool) {
+		t.Helper()
+		id, claimed, err := database.ClaimNotification(userID, widgetID, "a", dueAt, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, claimed
+	}
+
+	now := time.Now()
+	id, claimed := claim(now)
+	if !claimed {
+		t.Fatal("first claim failed")
+	}
+	if _, claimed := claim(now); claimed {
+		t.Error("claimed a notification being sent")
+	}
+
+	// Retried after a delay doubling with every attempt, then given up
+	delay := time.Minute
+	for attempt := 2; attempt <= database.NotificationMaxAttempts; attempt++ {
+		if err := database.MarkNotification(id, database.NotificationFailed); err != nil {
+			t.Fatal(err)
+		}
+		failedAt := time.Now()
+		if _, claimed := claim(failedAt.Add(delay - 10*time.Second)); claimed {
+			t.Fatalf("attempt %d claimed before its delay of %v", attempt, delay)
+		}
+		retry, claimed := claim(failedAt.Add(delay + 10*time.Second))
+		if !claimed || retry != id {
+			t.Fatalf("attempt %d not claimed after %v", attempt, delay)
+		}
+		delay *= 2
+	}
+	if err := database.MarkNotification(id, database.NotificationFailed); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed := claim(now.Add(24 * time.Hour)); claimed {
+		t.Error("claimed a notification out of attempts")
+	}
+
+	// Claims interrupted by a restart count as failed attempts
+	if _, claimed, err := database.ClaimNotification(userID, widgetID, "c", dueAt, now); err != nil || !claimed {
+		t.Fatalf("claim: %v", err)
+	}
+	if _, err := database.ReleaseInterruptedNotifications(); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed, _ := database.ClaimNotification(userID, widgetID, "c", dueAt, now); !claimed {
+		t.Error("interrupted notification not claimed again")
+	}
+
+	// A sent notification is never claimed again
+	sentID, _, err := database.ClaimNotification(userID, widgetID, "b", dueAt, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.MarkNotification(sentID, database.NotificationSent)
+	if _, claimed, _ := database.ClaimNotification(userID, widgetID, "b", dueAt, now.Add(24*time.Hour)); claimed {
+		t.Error("claimed a sent notification")
+	}
+}
+
+func TestReminderRetrySkipsDeliveredChannels(t *testing.T) {
+	userID := newTestUser(t)
+	deliveredURL, deliveredReqs := notifierServer(t, http.StatusOK)
+	pendingURL, pendingReqs := notifierServer(t, http.StatusOK)
+	delivered := createChannel(t, userID, map[string]any{"type": "webhook", "enabled": true, "config": map[string]any{"url": deliveredURL}})
+	createChannel(t, userID, map[string]any{"type": "webhook", "enabled": true, "config": map[string]any{"url": pendingURL}})
+	widgetID := newTestWidget(t, userID, models.WidgetTypeReminder, `{"reminders":[{"id":"r1","text":"Call","date":"2026-10-18","completed":false}]}`)
+
+	// The server stopped after the first channel accepted the reminder
+	dueAt := "2026-10-18T09:00:00Z"
+	now := time.Date(2026, 10, 18, 9, 5, 0, 0, time.UTC)
+	logID, claimed, err := database.ClaimNotification(userID, widgetID, "r1", dueAt, now)
+	if err != nil || !claimed {
+		t.Fatalf("claim: %v", err)
+	}
+	if err := database.RecordNotificationDelivery(logID, fmt.Sprintf("channel:%d", delivered.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.ReleaseInterruptedNotifications(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDueReminders(now)
+	select {
+	case req := <-pendingReqs:
+		var body webhookBody
+		if err := json.Unmarshal(req.body, &body); err != nil || body.Body != "Call" {
+			t.Errorf("retry = %s", req.body)
+		}
+	default:
+		t.Fatal("retry skipped the pending channel")
+	}
+	select {
+	case <-deliveredReqs:
+		t.Error("retry sent the reminder again to the channel that got it")
+	default:
+	}
+
+	// Delivered, so never claimed again
+	if _, claimed, _ := database.ClaimNotification(userID, widgetID, "r1", dueAt, now.Add(24*time.Hour)); claimed {
+		t.Error("claimed a delivered reminder")
+	}
+}
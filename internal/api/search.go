@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	searchPageSize    = 20
+	searchMaxPageSize = 100
+)
+
+// HandleSearch searches the text of the user's widgets and of those shared
+// with them: note tabs, wiki pages, todos, Kanban cards, links and
+// reminders. Every word of q must match, the last one as a prefix. Results
+// are ranked by relevance, titles weighing more than the text. ?type= takes
+// comma separated widget types; ?from= and ?to= (YYYY-MM-DD, inclusive)
+// filter on the last change of the item.
+// Route: GET /api/search?q=&type=&from=&to=&limit=20
+func HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	match := searchMatch(q.Get("q"))
+	if match == "" {
+		http.Error(w, "Query required", http.StatusBadRequest)
+		return
+	}
+
+	var filter database.SearchFilter
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			filter.Types = append(filter.Types, models.WidgetType(strings.ToUpper(strings.TrimSpace(t))))
+		}
+	}
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	limit := searchPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, searchMaxPageSize)
+	}
+
+	results, err := database.Search(userID, match, filter, limit)
+	if err != nil {
+		log.Println("Error searching:", err)
+		http.Error(w, "Failed to search", http.StatusInternalServerError)
+		return
+	}
+	for i := range results {
+		results[i].Title = searchHighlight(results[i].Title)
+		results[i].Snippet = searchHighlight(results[i].Snippet)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// searchMatch turns the words of a search into an FTS5 query. Words are
+// quoted so that the query syntax can't be used (or broken) from the input.
+func searchMatch(q string) string {
+	words := strings.Fields(q)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// searchHighlight escapes a title or snippet for HTML, marking the matches.
+func searchHighlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, database.SearchMatchStart, "<mark>")
+	return strings.ReplaceAll(s, database.SearchMatchEnd, "</mark>")
+}
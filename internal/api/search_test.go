@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestSearchMatch(t *testing.T) {
+	tests := []struct {
+		q, want string
+	}{
+		{"apple", `"apple"*`},
+		{"  apple   pie ", `"apple" "pie"*`},
+		{`say "hi"`, `"say" """hi"""*`},
+		{"NOT OR", `"NOT" "OR"*`},
+		{"title:x*", `"title:x*"*`},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := searchMatch(tt.q); got != tt.want {
+			t.Errorf("searchMatch(%q) = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	s := "<b>" + database.SearchMatchStart + "apple & pie" + database.SearchMatchEnd + "</b>"
+	if got, want := searchHighlight(s), "&lt;b&gt;<mark>apple &amp; pie</mark>&lt;/b&gt;"; got != want {
+		t.Errorf("searchHighlight() = %s, want %s", got, want)
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	userID, userName := newNamedTestUser(t)
+	other := newTestUser(t)
+
+	note := newTestWidget(t, userID, models.WidgetTypeNote,
+		`{"notes":[{"id":"n1","title":"Groceries","content":"buy <script>alert(1)</script> apples"}]}`)
+	todo := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"apple pie","completed":false}]}`)
+	deleted := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"apple crumble","completed":false}]}`)
+	if err := database.DeleteWidget(userID, deleted, 0); err != nil {
+		t.Fatal(err)
+	}
+	shared := newTestWidget(t, other, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"apple juice","completed":false}]}`)
+	shareTestWidget(t, other, shared, userName, models.ShareRoleViewer)
+	unshared := newTestWidget(t, other, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"apple tart","completed":false}]}`)
+
+	search := func(params url.Values) []models.SearchResult {
+		t.Helper()
+		w := serveAs(t, userID, HandleSearch, http.MethodGet, "/api/search?"+params.Encode(), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %v: %d %s", params, w.Code, w.Body)
+		}
+		var results []models.SearchResult
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	widgets := func(results []models.SearchResult) []string {
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.WidgetID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+
+	// Own and shared active widgets, the last word as a prefix
+	results := search(url.Values{"q": {"appl"}})
+	if got := widgets(results); !slices.Equal(got, sorted(note, todo, shared)) {
+		t.Errorf("widgets = %v, want %v (not %s, %s)", got, sorted(note, todo, shared), deleted, unshared)
+	}
+	if got := widgets(search(url.Values{"q": {"apple pi"}})); !slices.Equal(got, []string{todo}) {
+		t.Errorf("prefix on the last word: %v", got)
+	}
+	if got := widgets(search(url.Values{"q": {"app pie"}})); len(got) != 0 {
+		t.Errorf("prefix on the first word: %v", got)
+	}
+
+	// Matches are marked in escaped text
+	for _, r := range results {
+		if r.WidgetID != note {
+			continue
+		}
+		if r.ItemID != "n1" || r.Title != "Groceries" || !strings.Contains(r.Snippet, "&lt;script&gt;") ||
+			!strings.Contains(r.Snippet, "<mark>apples</mark>") || strings.Contains(r.Snippet, "<script>") {
+			t.Errorf("note result = %+v", r)
+		}
+	}
+
+	// The query syntax can't be used from the input
+	for _, q := range []string{`apple"`, "AND", `"`, "title:apple", "NEAR(apple pie)", "apple*"} {
+		search(url.Values{"q": {q}})
+	}
+
+	if got := widgets(search(url.Values{"q": {"apple"}, "type": {"note, wiki"}})); !slices.Equal(got, []string{note}) {
+		t.Errorf("type filter: %v", got)
+	}
+	today := time.Now().UTC()
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format("2006-01-02") }
+	if got := search(url.Values{"q": {"apple"}, "from": {day(0)}, "to": {day(0)}}); len(got) != 3 {
+		t.Errorf("changed today: %d results", len(got))
+	}
+	if got := search(url.Values{"q": {"apple"}, "from": {day(1)}}); len(got) != 0 {
+		t.Errorf("changed from tomorrow: %d results", len(got))
+	}
+	if got := search(url.Values{"q": {"apple"}, "to": {day(-1)}}); len(got) != 0 {
+		t.Errorf("changed until yesterday: %d results", len(got))
+	}
+
+	for _, params := range []url.Values{{"q": {" "}}, {"q": {"apple"}, "from": {"yesterday"}}, {"q": {"apple"}, "limit": {"0"}}} {
+		if w := serveAs(t, userID, HandleSearch, http.MethodGet, "/api/search?"+params.Encode(), nil); w.Code != http.StatusBadRequest {
+			t.Errorf("search %v: %d", params, w.Code)
+		}
+	}
+}
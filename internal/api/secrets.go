@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gabrielhirakawa/lifehub/internal/config"
+)
+
+var encryptionKey []byte
+
+// InitEncryptionKey initializes the key used to encrypt secrets at rest
+// (e.g. AI provider API keys).
+// It tries to load from data/encryption_key, or generates a new one if not found.
+func InitEncryptionKey() {
+	keyFile := filepath.Join(config.GetDataDir(), "encryption_key")
+
+	// 1. Try to load existing key
+	if data, err := os.ReadFile(keyFile); err == nil {
+		key, err := hex.DecodeString(string(data))
+		if err != nil || len(key) != 32 {
+			log.Fatal("Invalid encryption key in ", keyFile)
+		}
+		encryptionKey = key
+		log.Println("Loaded encryption key from storage.")
+		return
+	}
+
+	// 2. Generate new key
+	log.Println("Generating new encryption key...")
+	key := make([]byte, 32) // AES-256
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("Failed to generate encryption key:", err)
+	}
+	encryptionKey = key
+
+	// 3. Save to file
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		log.Printf("Warning: Failed to save encryption key: %v\n", err)
+	} else {
+		log.Println("New encryption key generated and saved.")
+	}
+}
+
+// encryptSecret encrypts a value with AES-256-GCM.
+// The result is base64(nonce || ciphertext).
+func encryptSecret(plain string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret reverses encryptSecret.
+func decryptSecret(encoded string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	if len(encryptionKey) == 0 {
+		return nil, fmt.Errorf("encryption key not initialized")
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// HandleSettings returns or updates the settings of the authenticated user.
+// Routes: GET /api/settings, PUT /api/settings
+func HandleSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := database.GetUserSettings(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	case http.MethodPut:
+		var settings models.UserSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "" {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.Parse("15:04", settings.ReminderTime); err != nil {
+			http.Error(w, "Invalid reminder time, expected HH:MM", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.SaveUserSettings(userID, settings); err != nil {
+			log.Println("Error saving settings:", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// userLocation resolves the timezone of the user settings, defaulting to UTC.
+func userLocation(settings models.UserSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
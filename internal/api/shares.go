@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// WidgetShareRequest shares a widget with a user, or changes their role.
+type WidgetShareRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"` // viewer (default) or editor
+}
+
+// HandleWidgetShares manages the users a widget is shared with. Only the
+// owner lists and grants access; recipients may revoke their own.
+// Routes: GET, POST /api/widgets/{id}/shares
+// DELETE /api/widgets/{id}/shares/{userId}
+func HandleWidgetShares(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "widgets", "{id}", "shares", "{userId}"]
+	if len(parts) < 5 || len(parts) > 6 || parts[3] == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID := parts[3]
+
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil || !widget.IsActive {
+		http.Error(w, "Widget not found", http.StatusNotFound)
+		return
+	}
+	owner := widget.Role == ""
+
+	if len(parts) == 6 {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		recipientID, err := strconv.Atoi(parts[5])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !owner && recipientID != userID {
+			http.Error(w, "Only the owner can manage shares", http.StatusForbidden)
+			return
+		}
+		if err := database.DeleteWidgetShare(widgetID, recipientID); err != nil {
+			http.Error(w, "Share not found", http.StatusNotFound)
+			return
+		}
+		publishWidgetChange([]int{recipientID}, widgetEventDeleted, widgetID, 0)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+		return
+	}
+
+	if !owner {
+		http.Error(w, "Only the owner can manage shares", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeWidgetShares(w, widgetID, http.StatusOK)
+
+	case http.MethodPost:
+		var req WidgetShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.ShareRoleViewer
+		}
+		if req.Role != models.ShareRoleViewer && req.Role != models.ShareRoleEditor {
+			http.Error(w, "Role must be viewer or editor", http.StatusBadRequest)
+			return
+		}
+		recipientID, err := database.GetUserIDByUsername(strings.TrimSpace(req.Username))
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if recipientID == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if recipientID == userID {
+			http.Error(w, "Cannot share a widget with yourself", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.SaveWidgetShare(widgetID, recipientID, req.Role); err != nil {
+			log.Println("Error sharing widget:", err)
+			http.Error(w, "Failed to share widget", http.StatusInternalServerError)
+			return
+		}
+		publishWidgetChange([]int{recipientID}, widgetEventChanged, widgetID, widget.Version)
+		writeWidgetShares(w, widgetID, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeWidgetShares(w http.ResponseWriter, widgetID string, status int) {
+	shares, err := database.GetWidgetShares(widgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch shares", http.StatusInternalServerError)
+		return
+	}
+	if shares == nil {
+		shares = []models.WidgetShare{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(shares)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// shareTestWidget shares a widget of the owner through the endpoint.
+func shareTestWidget(t *testing.T, ownerID int, widgetID, username, role string) {
+	t.Helper()
+	w := serveAs(t, ownerID, HandleWidgetShares, http.MethodPost, "/api/widgets/"+widgetID+"/shares", WidgetShareRequest{Username: username, Role: role})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("share with %s: %d %s", username, w.Code, w.Body)
+	}
+}
+
+// getTestWidget returns the widget as the user sees it, nil without access.
+func getTestWidget(t *testing.T, userID int, widgetID string) *models.Widget {
+	t.Helper()
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return widget
+}
+
+func TestSharedWidgetSaves(t *testing.T) {
+	owner := newTestUser(t)
+	viewer, viewerName := newNamedTestUser(t)
+	editor, editorName := newNamedTestUser(t)
+	id := newTestWidget(t, owner, models.WidgetTypeNote, `{"text":"hello"}`)
+	shareTestWidget(t, owner, id, viewerName, models.ShareRoleViewer)
+	shareTestWidget(t, owner, id, editorName, models.ShareRoleEditor)
+
+	save := func(userID int, content string, position int) int {
+		t.Helper()
+		widget := models.Widget{ID: id, Type: models.WidgetTypeNote, Title: string(models.WidgetTypeNote), IsActive: true,
+			Content: json.RawMessage(content), Position: position, Cols: 2}
+		return serveAs(t, userID, HandleSaveWidget, http.MethodPost, "/api/widgets", widget).Code
+	}
+
+	// Viewers may move the widget, but nothing is stored when they edit it
+	if code := save(viewer, `{"text":"hello"}`, 3); code != http.StatusOK {
+		t.Fatalf("viewer layout: %d", code)
+	}
+	if code := save(viewer, `{"text":"vandalised"}`, 7); code != http.StatusForbidden {
+		t.Errorf("viewer edit: %d", code)
+	}
+	if widget := getTestWidget(t, viewer, id); widget.Position != 3 || string(widget.Content) != `{"text":"hello"}` {
+		t.Errorf("after the viewer's edit: position %d, content %s", widget.Position, widget.Content)
+	}
+
+	// Editors store the content with their own layout
+	if code := save(editor, `{"text":"edited"}`, 5); code != http.StatusOK {
+		t.Fatalf("editor edit: %d", code)
+	}
+	if widget := getTestWidget(t, editor, id); widget.Position != 5 || widget.Cols != 2 {
+		t.Errorf("editor layout: position %d, cols %d", widget.Position, widget.Cols)
+	}
+	ownerView := getTestWidget(t, owner, id)
+	if string(ownerView.Content) != `{"text":"edited"}` || ownerView.Position != 0 {
+		t.Errorf("owner sees position %d, content %s", ownerView.Position, ownerView.Content)
+	}
+}
+
+func TestWidgetShareManagement(t *testing.T) {
+	owner := newTestUser(t)
+	first, firstName := newNamedTestUser(t)
+	second, secondName := newNamedTestUser(t)
+	_, ownerName := newNamedTestUser(t)
+	id := newTestWidget(t, owner, models.WidgetTypeNote, `{}`)
+	shareTestWidget(t, owner, id, firstName, models.ShareRoleEditor)
+	shareTestWidget(t, owner, id, secondName, "")
+
+	sharesPath := "/api/widgets/" + id + "/shares"
+	w := serveAs(t, owner, HandleWidgetShares, http.MethodGet, sharesPath, nil)
+	var shares []models.WidgetShare
+	if err := json.Unmarshal(w.Body.Bytes(), &shares); err != nil || len(shares) != 2 {
+		t.Fatalf("shares = %s", w.Body)
+	}
+	for _, s := range shares {
+		if s.UserID == second && s.Role != models.ShareRoleViewer {
+			t.Errorf("default role = %q", s.Role)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		body   WidgetShareRequest
+		want   int
+	}{
+		{"unknown user", owner, WidgetShareRequest{Username: "nobody"}, http.StatusNotFound},
+		{"invalid role", owner, WidgetShareRequest{Username: secondName, Role: "admin"}, http.StatusBadRequest},
+		{"editor shares", first, WidgetShareRequest{Username: ownerName}, http.StatusForbidden},
+		{"viewer shares", second, WidgetShareRequest{Username: ownerName}, http.StatusForbidden},
+		{"stranger shares", newTestUser(t), WidgetShareRequest{Username: ownerName}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serveAs(t, tt.userID, HandleWidgetShares, http.MethodPost, sharesPath, tt.body); w.Code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if w := serveAs(t, first, HandleWidgetShares, http.MethodGet, sharesPath, nil); w.Code != http.StatusForbidden {
+		t.Errorf("recipient lists shares: %d", w.Code)
+	}
+	if w := serveAs(t, first, HandleWidgetShares, http.MethodDelete, fmt.Sprintf("%s/%d", sharesPath, second), nil); w.Code != http.StatusForbidden {
+		t.Errorf("recipient revokes another: %d", w.Code)
+	}
+
+	// Recipients may leave, the owner may revoke anyone
+	if w := serveAs(t, second, HandleWidgetShares, http.MethodDelete, fmt.Sprintf("%s/%d", sharesPath, second), nil); w.Code != http.StatusOK {
+		t.Errorf("self revoke: %d", w.Code)
+	}
+	if w := serveAs(t, owner, HandleWidgetShares, http.MethodDelete, fmt.Sprintf("%s/%d", sharesPath, first), nil); w.Code != http.StatusOK {
+		t.Errorf("owner revokes: %d", w.Code)
+	}
+
+	// Revoked users lose access
+	for name, userID := range map[string]int{"editor": first, "viewer": second} {
+		if w := serveAs(t, userID, HandleGetWidgetByID, http.MethodGet, "/api/widgets/"+id, nil); w.Code != http.StatusNotFound {
+			t.Errorf("revoked %s reads: %d", name, w.Code)
+		}
+		widget := models.Widget{ID: id, Type: models.WidgetTypeNote, IsActive: true, Content: json.RawMessage(`{"text":"mine"}`)}
+		if w := serveAs(t, userID, HandleSaveWidget, http.MethodPost, "/api/widgets", widget); w.Code != http.StatusForbidden {
+			t.Errorf("revoked %s saves: %d", name, w.Code)
+		}
+	}
+	if widget := getTestWidget(t, owner, id); string(widget.Content) != `{}` {
+		t.Errorf("content = %s", widget.Content)
+	}
+}
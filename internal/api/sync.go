@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+const (
+	syncPageSize     = 200
+	syncMaxMutations = 100
+)
+
+// Operations of a SyncMutation
+const (
+	syncOpSave   = "save"
+	syncOpDelete = "delete"
+)
+
+// Statuses of a SyncResult
+const (
+	syncAccepted = "accepted"
+	syncConflict = "conflict"
+	syncRejected = "rejected"
+)
+
+// SyncChange is a widget changed since the cursor. Widget is omitted when
+// the widget was deleted or is no longer shared with the user.
+type SyncChange struct {
+	ID      string         `json:"id"`
+	Deleted bool           `json:"deleted"`
+	Widget  *models.Widget `json:"widget,omitempty"`
+}
+
+// SyncResponse is a page of changes, oldest first. Clients store Cursor and
+// ask again while More is set.
+type SyncResponse struct {
+	Cursor  int64        `json:"cursor"`
+	Changes []SyncChange `json:"changes"`
+	More    bool         `json:"more"`
+}
+
+// SyncMutation is a change made offline. BaseVersion is the version of the
+// widget the client changed, 0 for a widget it created.
+type SyncMutation struct {
+	ID          string         `json:"id"`
+	Op          string         `json:"op"` // save or delete
+	BaseVersion int            `json:"baseVersion"`
+	Widget      *models.Widget `json:"widget,omitempty"`
+}
+
+// SyncRequest is a batch of mutations, applied in order.
+type SyncRequest struct {
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+// SyncResult is the outcome of a mutation: accepted with the new version,
+// conflict with the server's widget (omitted if it was deleted), or
+// rejected with the reason.
+type SyncResult struct {
+	ID      string         `json:"id"`
+	Status  string         `json:"status"`
+	Version int            `json:"version,omitempty"`
+	Widget  *models.Widget `json:"widget,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// HandleSync lets offline clients catch up and send the changes they
+// queued. GET returns the widgets changed after ?since= (a cursor from a
+// previous response, 0 for everything), including deletions. POST applies
+// mutations only if the widget is still at their base version, so that
+// clients can reconcile conflicts themselves.
+// Routes: GET, POST /api/sync
+func HandleSync(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var since int64
+		if v := r.URL.Query().Get("since"); v != "" {
+			if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+		}
+
+		resp, err := syncChanges(userID, since)
+		if err != nil {
+			log.Println("Error syncing widgets:", err)
+			http.Error(w, "Failed to fetch changes", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodPost:
+		var req SyncRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Mutations) > syncMaxMutations {
+			http.Error(w, "Too many mutations", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		results := make([]SyncResult, 0, len(req.Mutations))
+		for _, m := range req.Mutations {
+			results = append(results, applySyncMutation(userID, m))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// syncChanges returns the next page of changes after since.
+func syncChanges(userID int, since int64) (SyncResponse, error) {
+	resp := SyncResponse{Cursor: since, Changes: []SyncChange{}}
+	changes, err := database.GetWidgetChanges(userID, since, syncPageSize+1)
+	if err != nil {
+		return resp, err
+	}
+	if len(changes) > syncPageSize {
+		changes = changes[:syncPageSize]
+		resp.More = true
+	}
+
+	for _, c := range changes {
+		widget, err := database.GetWidgetByID(userID, c.WidgetID)
+		if err != nil {
+			return resp, err
+		}
+		change := SyncChange{ID: c.WidgetID}
+		if widget == nil || !widget.IsActive {
+			change.Deleted = true
+		} else {
+			change.Widget = widget
+		}
+		resp.Changes = append(resp.Changes, change)
+		resp.Cursor = c.Seq
+	}
+	return resp, nil
+}
+
+// applySyncMutation applies a mutation if the widget is still at its base
+// version.
+func applySyncMutation(userID int, m SyncMutation) SyncResult {
+	result := SyncResult{ID: m.ID}
+	if m.ID == "" {
+		result.Status, result.Error = syncRejected, "ID required"
+		return result
+	}
+
+	current, err := database.GetWidgetByID(userID, m.ID)
+	if err != nil {
+		log.Println("Error syncing widget:", err)
+		result.Status, result.Error = syncRejected, "Failed to fetch widget"
+		return result
+	}
+	conflict := func() SyncResult {
+		if current, _ = database.GetWidgetByID(userID, m.ID); current != nil && current.IsActive {
+			result.Widget, result.Version = current, current.Version
+		}
+		result.Status = syncConflict
+		return result
+	}
+
+	switch m.Op {
+	case syncOpSave:
+		if m.Widget == nil {
+			result.Status, result.Error = syncRejected, "Widget required"
+			return result
+		}
+		if (current == nil && m.BaseVersion != 0) || (current != nil && current.Version != m.BaseVersion) {
+			return conflict()
+		}
+
+		widget := *m.Widget
+		widget.ID = m.ID
+		err = saveWidgetVersion(userID, &widget, m.BaseVersion)
+
+	case syncOpDelete:
+		if current == nil || !current.IsActive {
+			result.Status = syncAccepted // Already gone
+			return result
+		}
+		if current.Version != m.BaseVersion {
+			return conflict()
+		}
+		version := m.BaseVersion
+		if current.Role != "" {
+			version = 0 // Only removes the share
+		}
+		if err = deleteWidget(userID, m.ID, version); err != nil {
+			return conflict()
+		}
+		result.Status = syncAccepted
+		return result
+
+	default:
+		result.Status, result.Error = syncRejected, "Unknown op"
+		return result
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, errPreconditionFailed):
+		return conflict()
+	case errors.Is(err, errInvalidWidget), errors.Is(err, errWidgetForbidden), errors.Is(err, errWIPLimitReached):
+		result.Status, result.Error = syncRejected, err.Error()
+		return result
+	default:
+		log.Println("Error syncing widget:", err)
+		result.Status, result.Error = syncRejected, "Failed to save widget"
+		return result
+	}
+
+	if saved, err := database.GetWidgetByID(userID, m.ID); err == nil && saved != nil {
+		result.Version = saved.Version
+	}
+	result.Status = syncAccepted
+	return result
+}
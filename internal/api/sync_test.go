@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func syncSince(t *testing.T, userID int, since int64) SyncResponse {
+	t.Helper()
+	w := serveAs(t, userID, HandleSync, http.MethodGet, "/api/sync?since="+strconv.FormatInt(since, 10), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sync: %d %s", w.Code, w.Body)
+	}
+	var resp SyncResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// expectChanges checks the changes after a cursor, and returns the new one.
+func expectChanges(t *testing.T, userID int, since int64, want ...SyncChange) int64 {
+	t.Helper()
+	resp := syncSince(t, userID, since)
+	if len(resp.Changes) != len(want) {
+		t.Fatalf("changes since %d = %+v, want %+v", since, resp.Changes, want)
+	}
+	for i, c := range resp.Changes {
+		if c.ID != want[i].ID || c.Deleted != want[i].Deleted {
+			t.Errorf("change %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+	return resp.Cursor
+}
+
+func TestSyncRecordsChangesWithWrites(t *testing.T) {
+	owner, recipient := newTestUser(t), newTestUser(t)
+	ownerCursor := syncSince(t, owner, 0).Cursor
+	recipientCursor := syncSince(t, recipient, 0).Cursor
+
+	widgetID := newTestWidget(t, owner, models.WidgetTypeNote, `{"notes":[]}`)
+	ownerCursor = expectChanges(t, owner, ownerCursor, SyncChange{ID: widgetID})
+
+	// Sharing records the widget for the recipient only
+	if err := database.SaveWidgetShare(widgetID, recipient, models.ShareRoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, owner, ownerCursor)
+	recipientCursor = expectChanges(t, recipient, recipientCursor, SyncChange{ID: widgetID})
+
+	// Content writes reach both
+	stored, err := database.UpdateWidgetContent(owner, widgetID, 1, json.RawMessage(`{"notes":[{"id":"a","title":"A","content":"x"}]}`), nil)
+	if err != nil || !stored {
+		t.Fatal(stored, err)
+	}
+	ownerCursor = expectChanges(t, owner, ownerCursor, SyncChange{ID: widgetID})
+	recipientCursor = expectChanges(t, recipient, recipientCursor, SyncChange{ID: widgetID})
+
+	// So do saves of the whole widget, which update it with an upsert
+	saveTestWidget(t, owner, widgetID, models.WidgetTypeNote, `{"notes":[{"id":"a","title":"A","content":"y"}]}`)
+	ownerCursor = expectChanges(t, owner, ownerCursor, SyncChange{ID: widgetID})
+	recipientCursor = expectChanges(t, recipient, recipientCursor, SyncChange{ID: widgetID})
+
+	// A write lost to a concurrent one records nothing
+	if stored, err := database.UpdateWidgetContent(owner, widgetID, 2, json.RawMessage(`{"notes":[]}`), nil); err != nil || stored {
+		t.Fatal(stored, err)
+	}
+	expectChanges(t, owner, ownerCursor)
+
+	// Mutations through the sync endpoint
+	w := serveAs(t, recipient, HandleSync, http.MethodPost, "/api/sync", SyncRequest{Mutations: []SyncMutation{{
+		ID: widgetID, Op: syncOpSave, BaseVersion: 3,
+		Widget: &models.Widget{Title: "Renamed", Content: json.RawMessage(`{"notes":[]}`)},
+	}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("mutation: %d %s", w.Code, w.Body)
+	}
+	ownerCursor = expectChanges(t, owner, ownerCursor, SyncChange{ID: widgetID})
+	recipientCursor = expectChanges(t, recipient, recipientCursor, SyncChange{ID: widgetID})
+
+	// Unsharing tells the recipient the widget is gone, even once the owner
+	// wrote it again
+	if err := database.DeleteWidgetShare(widgetID, recipient); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteWidget(owner, widgetID, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, recipient, recipientCursor, SyncChange{ID: widgetID, Deleted: true})
+	expectChanges(t, owner, ownerCursor, SyncChange{ID: widgetID, Deleted: true})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/tags"
+)
+
+// HandleTags lists the tags of the user's items, including those of the
+// widgets shared with them, and the items having a tag across widgets.
+// Todos, reminders, Kanban cards (their labels), note tabs and wiki pages
+// are tagged explicitly or with #tag in their text.
+// Routes: GET /api/tags
+// GET /api/tags/{tag}/items
+func HandleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Path == "/api/tags" {
+		list, err := database.GetTags(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	// Expected: /api/tags/{tag}/items, tags may contain '/'
+	tag, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/tags/"), "/items")
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	tag = tags.Normalize(tag)
+	if tag == "" {
+		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+
+	items, err := database.GetTaggedItems(userID, tag)
+	if err != nil {
+		http.Error(w, "Failed to fetch tagged items", http.StatusInternalServerError)
+		return
+	}
+	for i := range items {
+		items[i].URL = "/#widget-" + items[i].WidgetID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
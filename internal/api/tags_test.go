@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestTagsEndpoints(t *testing.T) {
+	userID, userName := newNamedTestUser(t)
+	other := newTestUser(t)
+
+	note := newTestWidget(t, userID, models.WidgetTypeNote,
+		`{"notes":[{"id":"n1","title":"Garden","content":"plant roses #House/Garden","tags":["weekend"]}]}`)
+	board := newTestWidget(t, userID, models.WidgetTypeKanban,
+		`{"kanban":[{"id":"todo","title":"To do","items":[{"id":"k1","content":"Fence","labels":["house/garden","In review"]}]}]}`)
+	todos := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[]}`)
+	shared := newTestWidget(t, other, models.WidgetTypeWiki,
+		`{"wiki":{"pages":[{"id":"p1","title":"Compost","content":"#house/garden tips"}]}}`)
+	shareTestWidget(t, other, shared, userName, models.ShareRoleViewer)
+	newTestWidget(t, other, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"#house/garden secret"}]}`)
+	deleted := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"t1","text":"#house/garden old"}]}`)
+	if err := database.DeleteWidget(userID, deleted, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Explicit tags of the endpoints are normalized, invalid ones rejected
+	todosPath := "/api/widgets/" + todos + "/todos"
+	text := "Mow the lawn #weekend"
+	if w := serveAs(t, userID, HandleWidgetTodos, http.MethodPost, todosPath, TodoInput{Text: &text, Tags: &[]string{"#42"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag: %d", w.Code)
+	}
+	w := serveAs(t, userID, HandleWidgetTodos, http.MethodPost, todosPath, TodoInput{Text: &text, Tags: &[]string{"#House/Garden"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create todo: %d %s", w.Code, w.Body)
+	}
+	var todo models.TodoItem
+	json.Unmarshal(w.Body.Bytes(), &todo)
+
+	w = serveAs(t, userID, HandleTags, http.MethodGet, "/api/tags", nil)
+	var counts []models.TagCount
+	if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+		t.Fatalf("tags: %d %s", w.Code, w.Body)
+	}
+	want := []models.TagCount{{Tag: "house/garden", Count: 4}, {Tag: "weekend", Count: 2}, {Tag: "in-review", Count: 1}}
+	if len(counts) != len(want) {
+		t.Fatalf("tags = %+v, want %+v", counts, want)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("tag %d = %+v, want %+v", i, counts[i], want[i])
+		}
+	}
+
+	w = serveAs(t, userID, HandleTags, http.MethodGet, "/api/tags/House/Garden/items", nil)
+	var items []models.TaggedItem
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatalf("tagged items: %d %s", w.Code, w.Body)
+	}
+	found := make(map[string]models.TaggedItem)
+	for _, item := range items {
+		found[item.WidgetID+"/"+item.ItemID] = item
+	}
+	for key, title := range map[string]string{note + "/n1": "Garden", board + "/k1": "Fence", todos + "/" + todo.ID: text, shared + "/p1": "Compost"} {
+		if item, ok := found[key]; !ok || item.Title != title || item.URL != "/#widget-"+item.WidgetID {
+			t.Errorf("item %s = %+v", key, item)
+		}
+	}
+	if len(items) != 4 {
+		t.Errorf("items = %+v", items)
+	}
+
+	for path, code := range map[string]int{"/api/tags/%2342/items": http.StatusBadRequest, "/api/tags/work": http.StatusNotFound} {
+		if w := serveAs(t, userID, HandleTags, http.MethodGet, path, nil); w.Code != code {
+			t.Errorf("%s: %d, want %d", path, w.Code, code)
+		}
+	}
+	if w := serveAs(t, userID, HandleTags, http.MethodPost, "/api/tags", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("post: %d", w.Code)
+	}
+}
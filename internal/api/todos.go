@@ -0,0 +1,514 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/tags"
+	"github.com/google/uuid"
+)
+
+const (
+	todoRolloverInterval = time.Minute
+	// widgetWriteAttempts bounds the retries of a change racing with other
+	// saves of the widget.
+	widgetWriteAttempts = 3
+)
+
+var (
+	errWidgetNotFound = errors.New("widget not found")
+	errItemNotFound   = errors.New("item not found")
+	errWidgetConflict = errors.New("widget changed concurrently")
+	// errPreconditionFailed rejects changes made against an outdated
+	// version of a widget or item (If-Match)
+	errPreconditionFailed = errors.New("precondition failed")
+	// errWidgetForbidden rejects changes to a widget shared read-only
+	errWidgetForbidden = errors.New("widget is read-only")
+)
+
+// TodoInput is the body of the todo endpoints. On update, omitted fields
+// are left unchanged and an empty priority or due date clears it.
+type TodoInput struct {
+	Text      *string   `json:"text"`
+	Completed *bool     `json:"completed"`
+	Archived  *bool     `json:"archived"`
+	Priority  *string   `json:"priority"`
+	DueDate   *string   `json:"dueDate"`
+	RRule     *string   `json:"rrule"` // Recurring todos require a due date
+	Tags      *[]string `json:"tags"`  // Explicit tags, besides the #tags of the text
+}
+
+// HandleWidgetTodos manages the tasks of a Todo widget. The list can be
+// filtered with archived=true or archived=false.
+// Routes: GET, POST /api/widgets/{id}/todos
+// PUT, DELETE /api/widgets/{id}/todos/{todoId}
+func HandleWidgetTodos(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "widgets", "{id}", "todos", "{todoId}"]
+	if len(parts) < 5 || parts[3] == "" || parts[4] != "todos" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	widgetID := parts[3]
+	todoID := ""
+	if len(parts) > 5 {
+		todoID = parts[5]
+	}
+
+	switch {
+	case todoID == "" && r.Method == http.MethodGet:
+		listTodos(w, r, userID, widgetID)
+
+	case todoID == "" && r.Method == http.MethodPost:
+		var input TodoInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if input.Text == nil || strings.TrimSpace(*input.Text) == "" {
+			http.Error(w, "Text required", http.StatusBadRequest)
+			return
+		}
+		if msg := validateTodoInput(input); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		todo := models.TodoItem{ID: uuid.NewString()}
+		applyTodoInput(&todo, input, time.Now())
+
+		err := mutateTodos(userID, widgetID, 0, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			return append(todos, todo), nil
+		})
+		if err != nil {
+			writeItemError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(todo)
+
+	case todoID != "" && r.Method == http.MethodPut:
+		var input TodoInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if msg := validateTodoInput(input); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		var updated models.TodoItem
+		err := mutateTodos(userID, widgetID, 0, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			for i := range todos {
+				if todos[i].ID == todoID {
+					applyTodoInput(&todos[i], input, time.Now())
+					updated = todos[i]
+					return todos, nil
+				}
+			}
+			return nil, errItemNotFound
+		})
+		if err != nil {
+			writeItemError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+
+	case todoID != "" && r.Method == http.MethodDelete:
+		err := mutateTodos(userID, widgetID, 0, func(todos []models.TodoItem) ([]models.TodoItem, error) {
+			for i := range todos {
+				if todos[i].ID == todoID {
+					return append(todos[:i], todos[i+1:]...), nil
+				}
+			}
+			return nil, errItemNotFound
+		})
+		if err != nil {
+			writeItemError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"deleted"}`))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listTodos(w http.ResponseWriter, r *http.Request, userID int, widgetID string) {
+	widget, err := database.GetWidgetByID(userID, widgetID)
+	if err != nil {
+		http.Error(w, "Failed to fetch widget", http.StatusInternalServerError)
+		return
+	}
+	if widget == nil || !widget.IsActive || widget.Type != models.WidgetTypeTodo {
+		http.Error(w, "Widget not found", http.StatusNotFound)
+		return
+	}
+
+	var content models.WidgetContentWrapper
+	json.Unmarshal(widget.Content, &content)
+
+	archived := r.URL.Query().Get("archived")
+	todos := []models.TodoItem{}
+	for _, todo := range content.Todos {
+		if (archived == "true" && !todo.Archived) || (archived == "false" && todo.Archived) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(todos)
+}
+
+// validateTodoInput returns a message describing the first invalid field
+// of the input, if any.
+func validateTodoInput(input TodoInput) string {
+	if input.Text != nil && strings.TrimSpace(*input.Text) == "" {
+		return "Text required"
+	}
+	if input.Priority != nil {
+		switch *input.Priority {
+		case "", models.TodoPriorityLow, models.TodoPriorityMedium, models.TodoPriorityHigh:
+		default:
+			return "Invalid priority, expected low, medium or high"
+		}
+	}
+	if input.DueDate != nil && *input.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", *input.DueDate); err != nil {
+			return "Invalid due date, expected YYYY-MM-DD"
+		}
+	}
+	if input.Tags != nil {
+		for _, tag := range *input.Tags {
+			if tags.Normalize(tag) == "" {
+				return fmt.Sprintf("Invalid tag %q", tag)
+			}
+		}
+	}
+	return ""
+}
+
+// applyTodoInput applies the given fields of a validated input to a todo,
+// tracking when it was completed.
+func applyTodoInput(todo *models.TodoItem, input TodoInput, now time.Time) {
+	if input.Text != nil {
+		todo.Text = strings.TrimSpace(*input.Text)
+	}
+	if input.Priority != nil {
+		todo.Priority = *input.Priority
+	}
+	if input.DueDate != nil {
+		todo.DueDate = *input.DueDate
+	}
+	if input.Tags != nil {
+		todo.Tags = tags.Merge(*input.Tags)
+	}
+	// A new rule starts from the current occurrence
+	if input.RRule != nil && *input.RRule != todo.RRule {
+		todo.RRule = *input.RRule
+		todo.SeriesStart = ""
+	}
+	if input.Completed != nil && *input.Completed != todo.Completed {
+		todo.Completed = *input.Completed
+		todo.CompletedAt = ""
+		if todo.Completed {
+			todo.CompletedAt = now.UTC().Format(time.RFC3339)
+		}
+	}
+	if input.Archived != nil {
+		todo.Archived = *input.Archived
+	}
+}
+
+// writeItemError reports the errors of the changes made to the items of a
+// widget through mutateWidgetContent.
+func writeItemError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errWidgetNotFound):
+		http.Error(w, "Widget not found", http.StatusNotFound)
+	case errors.Is(err, errItemNotFound):
+		http.Error(w, "Item not found", http.StatusNotFound)
+	case errors.Is(err, errWidgetConflict):
+		http.Error(w, "Widget was modified, try again", http.StatusConflict)
+	case errors.Is(err, errWIPLimitReached):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errPreconditionFailed):
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+	case errors.Is(err, errInvalidWidget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errWidgetForbidden):
+		http.Error(w, "Widget is read-only", http.StatusForbidden)
+	default:
+		log.Println("Error updating widget items:", err)
+		http.Error(w, "Failed to update widget", http.StatusInternalServerError)
+	}
+}
+
+// mutateTodos applies fn to the todos of a Todo widget of the user, at
+// version unless 0, and stores the result, materialising the next
+// occurrence of the recurring todos it completed.
+func mutateTodos(userID int, widgetID string, version int, fn func([]models.TodoItem) ([]models.TodoItem, error)) error {
+	_, err := mutateWidgetVersion(userID, widgetID, models.WidgetTypeTodo, version, func(content map[string]json.RawMessage) error {
+		var before, todos []models.TodoItem
+		if content["todos"] != nil {
+			if err := json.Unmarshal(content["todos"], &before); err != nil {
+				return err
+			}
+			json.Unmarshal(content["todos"], &todos)
+		}
+		todos, err := fn(todos)
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			if err := validateRecurrence(todo.Recurrence, todo.DueDate); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidWidget, err)
+			}
+		}
+		todos = expandTodos(before, todos)
+		if todos == nil {
+			todos = []models.TodoItem{}
+		}
+		content["todos"], err = json.Marshal(todos)
+		return err
+	})
+	return err
+}
+
+// mutateReminders is mutateTodos for the reminders of a Reminder widget.
+func mutateReminders(userID int, widgetID string, version int, fn func([]models.ReminderItem) ([]models.ReminderItem, error)) error {
+	_, err := mutateWidgetVersion(userID, widgetID, models.WidgetTypeReminder, version, func(content map[string]json.RawMessage) error {
+		var before, reminders []models.ReminderItem
+		if content["reminders"] != nil {
+			if err := json.Unmarshal(content["reminders"], &before); err != nil {
+				return err
+			}
+			json.Unmarshal(content["reminders"], &reminders)
+		}
+		reminders, err := fn(reminders)
+		if err != nil {
+			return err
+		}
+		for _, rem := range reminders {
+			if err := validateRecurrence(rem.Recurrence, rem.Date); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidWidget, err)
+			}
+		}
+		reminders = expandReminders(before, reminders)
+		if reminders == nil {
+			reminders = []models.ReminderItem{}
+		}
+		content["reminders"], err = json.Marshal(reminders)
+		return err
+	})
+	return err
+}
+
+// mutateWidgetContent applies fn to the content of a widget the user owns or
+// edits and stores the result, keeping the fields fn doesn't touch. fn is
+// called again if the widget was saved in the meantime.
+func mutateWidgetContent(userID int, widgetID string, widgetType models.WidgetType, fn func(map[string]json.RawMessage) error) error {
+	_, err := mutateWidgetVersion(userID, widgetID, widgetType, 0, fn)
+	return err
+}
+
+// mutateWidgetVersion is mutateWidgetContent for clients holding a version
+// of the widget: the change fails with errPreconditionFailed once the widget
+// is past that version (0 skips the check). Returns the new version.
+func mutateWidgetVersion(userID int, widgetID string, widgetType models.WidgetType, version int, fn func(map[string]json.RawMessage) error) (int, error) {
+	for attempt := 0; attempt < widgetWriteAttempts; attempt++ {
+		widget, err := database.GetWidgetByID(userID, widgetID)
+		if err != nil {
+			return 0, err
+		}
+		if widget == nil || !widget.IsActive || widget.Type != widgetType {
+			return 0, errWidgetNotFound
+		}
+		if widget.Role == models.ShareRoleViewer {
+			return 0, errWidgetForbidden
+		}
+		if version != 0 && widget.Version != version {
+			return 0, errPreconditionFailed
+		}
+
+		content, err := widgetContentFields(*widget)
+		if err != nil {
+			return 0, err
+		}
+		if err := fn(content); err != nil {
+			return 0, err
+		}
+
+		stored, err := storeWidgetContent(userID, *widget, content)
+		if err != nil {
+			return 0, err
+		}
+		if stored {
+			return widget.Version + 1, nil
+		}
+	}
+	return 0, errWidgetConflict
+}
+
+// storeWidgetContent writes the content of a widget unless it was saved
+// since it was read, with the card transitions of a Kanban widget.
+func storeWidgetContent(userID int, widget models.Widget, content map[string]json.RawMessage) (bool, error) {
+	updated, err := json.Marshal(content)
+	if err != nil {
+		return false, err
+	}
+	var events []models.KanbanEvent
+	if widget.Type == models.WidgetTypeKanban {
+		if events, err = kanbanEvents(widget.Content, updated); err != nil {
+			return false, err
+		}
+	}
+	stored, err := database.UpdateWidgetContent(userID, widget.ID, widget.Version, updated, events)
+	if stored {
+		notifyWidgetChanged(widget.ID)
+	}
+	return stored, err
+}
+
+// StartTodoRollover periodically runs the daily rollover of the Todo
+// widgets once the user's local day changed. See rolloverTodos.
+func StartTodoRollover() {
+	go func() {
+		ticker := time.NewTicker(todoRolloverInterval)
+		defer ticker.Stop()
+		for {
+			rolloverAllTodos(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+func rolloverAllTodos(now time.Time) {
+	widgets, err := database.GetActiveWidgetsByType(models.WidgetTypeTodo)
+	if err != nil {
+		log.Println("Todo rollover failed to load widgets:", err)
+		return
+	}
+	dates, err := database.GetTodoRolloverDates()
+	if err != nil {
+		log.Println("Todo rollover failed to load dates:", err)
+		return
+	}
+
+	locations := make(map[int]*time.Location)
+	for _, widget := range widgets {
+		loc, ok := locations[widget.UserID]
+		if !ok {
+			settings, err := database.GetUserSettings(widget.UserID)
+			if err != nil {
+				log.Println("Todo rollover failed to load settings:", err)
+				continue
+			}
+			loc = userLocation(settings)
+			locations[widget.UserID] = loc
+		}
+
+		local := now.In(loc)
+		today := local.Format("2006-01-02")
+		last, ok := dates[widget.ID]
+		if last >= today {
+			continue
+		}
+		content, err := widgetContentFields(widget)
+		if err != nil {
+			continue
+		}
+		if !ok && content["rolloverDate"] != nil {
+			// Widgets rolled over before the dates were kept server-side
+			json.Unmarshal(content["rolloverDate"], &last)
+		}
+
+		changed, err := rolloverTodos(content, last, local)
+		if err != nil {
+			log.Println("Todo rollover:", err)
+			continue
+		}
+		if changed {
+			// A concurrent save wins: the rollover runs again on the next
+			// tick
+			stored, err := storeWidgetContent(widget.UserID, widget, content)
+			if err != nil {
+				log.Println("Todo rollover:", err)
+			}
+			if !stored {
+				continue
+			}
+		}
+		if err := database.SetTodoRolloverDate(widget.ID, today); err != nil {
+			log.Println("Todo rollover:", err)
+		}
+	}
+}
+
+// rolloverTodos runs the rollover of a Todo widget content on the local day
+// of now, last being the local date of the previous one: completed tasks are
+// archived and the overdue ones are carried over to today. Returns whether
+// the content changed; the caller keeps the date of the rollover.
+func rolloverTodos(content map[string]json.RawMessage, last string, now time.Time) (bool, error) {
+	today := now.Format("2006-01-02")
+	// The first rollover only starts tracking the day: tasks completed today
+	// before the upgrade have no completion time
+	if last == "" || last >= today {
+		return false, nil
+	}
+
+	var todos []models.TodoItem
+	if content["todos"] != nil {
+		if err := json.Unmarshal(content["todos"], &todos); err != nil {
+			return false, err
+		}
+	}
+	changed := false
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := range todos {
+		todo := &todos[i]
+		switch {
+		case todo.Archived:
+		case todo.Completed:
+			// Tasks completed since midnight stay visible until the next rollover
+			if completedAt, err := time.Parse(time.RFC3339, todo.CompletedAt); err != nil || completedAt.Before(midnight) {
+				todo.Archived = true
+				changed = true
+			}
+		case todo.DueDate != "" && todo.DueDate < today:
+			// Recurring tasks keep their schedule
+			todo.Recurrence = seriesOf(todo.Recurrence, todo.ID, todo.DueDate)
+			// Dates are compared in UTC, where days are always 24 hours long
+			due, err1 := time.Parse("2006-01-02", todo.DueDate)
+			day, err2 := time.Parse("2006-01-02", today)
+			if err1 == nil && err2 == nil {
+				todo.RolledOver += int(day.Sub(due).Hours() / 24)
+			}
+			todo.DueDate = today
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	// Replaced by the todo_rollovers table
+	delete(content, "rolloverDate")
+	var err error
+	content["todos"], err = json.Marshal(todos)
+	return true, err
+}
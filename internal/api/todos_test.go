@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func TestTodoRollover(t *testing.T) {
+	userID := newTestUser(t)
+	settings := models.DefaultUserSettings()
+	settings.Timezone = "America/Sao_Paulo" // UTC-3
+	if err := database.SaveUserSettings(userID, settings); err != nil {
+		t.Fatal(err)
+	}
+	id := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[
+		{"id":"done","text":"Done","completed":true,"completedAt":"2026-03-09T12:00:00Z"},
+		{"id":"late","text":"Late","completed":false,"dueDate":"2026-03-08"},
+		{"id":"next","text":"Next","completed":false,"dueDate":"2026-03-20"}
+	]}`)
+	quiet := newTestWidget(t, userID, models.WidgetTypeTodo, `{"todos":[{"id":"next","text":"Next","completed":false,"dueDate":"2026-03-20"}]}`)
+	// Rolled over before the dates were kept server-side
+	legacy := newTestWidget(t, userID, models.WidgetTypeTodo,
+		`{"rolloverDate":"2026-03-08","todos":[{"id":"late","text":"Late","completed":false,"dueDate":"2026-03-08"}]}`)
+
+	state := func(id string) (int, map[string]models.TodoItem, map[string]json.RawMessage) {
+		t.Helper()
+		widget, err := database.GetWidgetByID(userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content map[string]json.RawMessage
+		var wrapper models.WidgetContentWrapper
+		json.Unmarshal(widget.Content, &content)
+		json.Unmarshal(widget.Content, &wrapper)
+		todos := make(map[string]models.TodoItem)
+		for _, todo := range wrapper.Todos {
+			todos[todo.ID] = todo
+		}
+		return widget.Version, todos, content
+	}
+	version, _, _ := state(id)
+	quietVersion, _, _ := state(quiet)
+
+	// The first rollover, at 23:00 on the 9th in São Paulo, only tracks the
+	// day
+	rolloverAllTodos(time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC))
+	if v, todos, _ := state(id); v != version || todos["late"].DueDate != "2026-03-08" {
+		t.Fatalf("first rollover wrote the widget: version %d, todos %+v", v, todos)
+	}
+	if _, todos, content := state(legacy); todos["late"].DueDate != "2026-03-09" || content["rolloverDate"] != nil {
+		t.Errorf("legacy widget: todos %+v, content %v", todos, content)
+	}
+
+	// Midnight in UTC isn't midnight in São Paulo
+	rolloverAllTodos(time.Date(2026, 3, 10, 2, 30, 0, 0, time.UTC))
+	if v, _, _ := state(id); v != version {
+		t.Fatalf("rolled over at midnight UTC: version %d", v)
+	}
+
+	rolloverAllTodos(time.Date(2026, 3, 10, 3, 30, 0, 0, time.UTC))
+	v, todos, _ := state(id)
+	if v != version+1 {
+		t.Fatalf("version = %d, want %d", v, version+1)
+	}
+	if !todos["done"].Archived || todos["late"].DueDate != "2026-03-10" || todos["late"].RolledOver != 2 ||
+		todos["next"].DueDate != "2026-03-20" || todos["next"].Archived {
+		t.Errorf("todos = %+v", todos)
+	}
+
+	// Idempotent within the day
+	rolloverAllTodos(time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC))
+	if again, _, _ := state(id); again != v {
+		t.Errorf("version = %d after a second rollover, want %d", again, v)
+	}
+
+	// Widgets are only written when their tasks change
+	rolloverAllTodos(time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC))
+	if v, _, _ := state(quiet); v != quietVersion {
+		t.Errorf("quiet widget version = %d, want %d", v, quietVersion)
+	}
+	dates, err := database.GetTodoRolloverDates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dates[quiet] != "2026-03-11" {
+		t.Errorf("rollover date = %q", dates[quiet])
+	}
+}
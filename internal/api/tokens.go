@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/database"
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// apiTokenPrefix makes tokens recognisable, e.g. when given as a password.
+const apiTokenPrefix = "lh_"
+
+// APITokenRequest is the payload to create an API token.
+type APITokenRequest struct {
+	Name string `json:"name"`
+}
+
+// APITokenResponse is a newly created token. The token itself is only
+// returned once.
+type APITokenResponse struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// HandleAPITokens lists the API tokens of the authenticated user, or
+// creates one.
+// Routes: GET, POST /api/tokens
+func HandleAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := database.GetAPITokens(userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch API tokens", http.StatusInternalServerError)
+			return
+		}
+		if tokens == nil {
+			tokens = []models.APIToken{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		var req APITokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		bytes := make([]byte, 32)
+		if _, err := rand.Read(bytes); err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		token := apiTokenPrefix + hex.EncodeToString(bytes)
+		id, err := database.CreateAPIToken(userID, req.Name, hashAPIToken(token))
+		if err != nil {
+			log.Println("Error creating API token:", err)
+			http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(APITokenResponse{
+			APIToken: models.APIToken{ID: id, Name: req.Name, CreatedAt: time.Now()},
+			Token:    token,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleDeleteAPIToken revokes an API token.
+// Route: DELETE /api/tokens/{id}
+func HandleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	// Expected: ["", "api", "tokens", "{id}"]
+	if len(parts) != 4 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeleteAPIToken(userID, id); err != nil {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"deleted"}`))
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BasicAuthMiddleware authenticates clients that can't use the login
+// cookie: with HTTP Basic credentials, where the password is either the
+// account password or an API token, or with an API token as Bearer token.
+// Failures are answered with a Basic challenge.
+func BasicAuthMiddleware(realm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := basicAuthUser(r)
+		if err != nil {
+			log.Println("Basic auth:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if userID == 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "userID", userID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// basicAuthUser returns the user authenticated by the request, 0 if none.
+func basicAuthUser(r *http.Request) (int, error) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return database.UseAPIToken(hashAPIToken(strings.TrimSpace(bearer)), time.Now())
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return 0, nil
+	}
+	// The token identifies its user: the username is not checked, since
+	// clients require one even when only the token matters
+	if strings.HasPrefix(password, apiTokenPrefix) {
+		return database.UseAPIToken(hashAPIToken(password), time.Now())
+	}
+	userID, err := database.ValidateUser(username, password)
+	if err != nil {
+		return 0, nil
+	}
+	return userID, nil
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/gabrielhirakawa/lifehub/internal/database"
@@ -38,6 +41,8 @@ func HandleGetWidgets(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleSaveWidget creates or updates a widget for the authenticated user.
+// Saving a Kanban board records its card transitions, and fails with 409 if
+// cards enter a column over its strict WIP limit.
 func HandleSaveWidget(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -56,15 +61,214 @@ func HandleSaveWidget(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.SaveWidget(userID, widget); err != nil {
+	sent := string(widget.Content)
+	if err := saveWidget(userID, &widget); err != nil {
+		if errors.Is(err, errInvalidWidget) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, errWidgetForbidden) {
+			http.Error(w, "Widget is read-only", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errWIPLimitReached) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, errWidgetConflict) {
+			http.Error(w, "Widget was modified, try again", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to save widget", http.StatusInternalServerError)
 		return
 	}
 
+	// Send back the content when the server changed it, e.g. to materialise
+	// the next occurrence of a recurring todo
+	if string(widget.Content) != sent {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": "success", "content": widget.Content})
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"success"}`))
 }
 
+// errInvalidWidget is returned by saveWidget for widgets that can't be stored.
+var errInvalidWidget = errors.New("invalid widget")
+
+// saveWidget validates and stores a widget. It is the write path of both
+// the save endpoint and the changes made on the user's behalf, such as the
+// actions confirmed in the AI Coach.
+func saveWidget(userID int, widget *models.Widget) error {
+	return saveWidgetVersion(userID, widget, 0)
+}
+
+// saveWidgetVersion is saveWidget for clients holding a version of the
+// widget: saving an existing widget fails with errPreconditionFailed once it
+// is past that version (0 skips the check).
+func saveWidgetVersion(userID int, widget *models.Widget, version int) error {
+	if widget.ID == "" {
+		return fmt.Errorf("%w: ID required", errInvalidWidget)
+	}
+	if len(widget.Content) > 0 && !json.Valid(widget.Content) {
+		return fmt.Errorf("%w: content is not valid JSON", errInvalidWidget)
+	}
+
+	// Provider API keys and chat history are not stored in widget content
+	if widget.Type == models.WidgetTypeAIAssistant {
+		content, err := sanitizeAIWidgetContent(userID, widget.Content)
+		if err != nil {
+			return fmt.Errorf("%w: invalid AI configuration", errInvalidWidget)
+		}
+		widget.Content = content
+	}
+
+	// A save without a version is pinned to the version it was read at: the
+	// recurrences and card transitions derived from the previous content
+	// only hold for it
+	sent := *widget
+	for attempt := 0; attempt < widgetWriteAttempts; attempt++ {
+		*widget = sent
+		err := storeWidget(userID, widget, version)
+		if !errors.Is(err, errWidgetConflict) {
+			return err
+		}
+	}
+	return errWidgetConflict
+}
+
+// storeWidget is an attempt of saveWidgetVersion. Fails with
+// errWidgetConflict if the widget was saved since it was read.
+func storeWidget(userID int, widget *models.Widget, version int) error {
+	old, err := database.GetWidgetByID(userID, widget.ID)
+	if err != nil {
+		return err
+	}
+	if old != nil && old.Role != "" {
+		return saveSharedWidget(userID, old, widget, version)
+	}
+
+	if widget.Type == models.WidgetTypeTodo || widget.Type == models.WidgetTypeReminder {
+		if _, err := expandWidgetRecurrences(old, widget); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidWidget, err)
+		}
+	}
+	events, err := widgetKanbanEvents(old, widget)
+	if err != nil {
+		return err
+	}
+
+	at := version
+	if at == 0 && old != nil {
+		at = old.Version
+	}
+	if err := database.SaveWidget(userID, *widget, at, events); err != nil {
+		if errors.Is(err, database.ErrAccessDenied) {
+			if old == nil {
+				return errWidgetForbidden
+			}
+			if version != 0 {
+				return errPreconditionFailed
+			}
+			return errWidgetConflict
+		}
+		return err
+	}
+	notifyWidgetChanged(widget.ID)
+	return nil
+}
+
+// saveSharedWidget stores the recipient's layout of a widget shared with
+// them and, for editors, its title and content. Viewers may only move the
+// widget: other changes fail with errWidgetForbidden, storing nothing.
+func saveSharedWidget(userID int, old *models.Widget, widget *models.Widget, version int) error {
+	changed, err := widgetChanged(old, widget)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidWidget, err)
+	}
+	if !changed {
+		// Only the recipient's layout changed
+		if err := database.SaveWidgetShareLayout(widget.ID, userID, widget.Position, widget.Cols); err != nil {
+			return err
+		}
+		publishWidgetChange([]int{userID}, widgetEventChanged, widget.ID, old.Version)
+		return nil
+	}
+	if old.Role != models.ShareRoleEditor {
+		return errWidgetForbidden
+	}
+
+	widget.Type = old.Type
+	if len(widget.Content) == 0 {
+		widget.Content = old.Content
+	}
+	if widget.Type == models.WidgetTypeTodo || widget.Type == models.WidgetTypeReminder {
+		if _, err := expandWidgetRecurrences(old, widget); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidWidget, err)
+		}
+	}
+	events, err := widgetKanbanEvents(old, widget)
+	if err != nil {
+		return err
+	}
+
+	at := version
+	if at == 0 {
+		at = old.Version
+	}
+	if err := database.UpdateSharedWidget(userID, *widget, at, events); err != nil {
+		if errors.Is(err, database.ErrAccessDenied) {
+			if version == 0 {
+				// Saved or unshared since it was read
+				return errWidgetConflict
+			}
+			if version != old.Version {
+				return errPreconditionFailed
+			}
+			return errWidgetForbidden
+		}
+		return err
+	}
+	notifyWidgetChanged(widget.ID)
+	return nil
+}
+
+// widgetKanbanEvents returns the card transitions of saving a Kanban widget
+// over old, nil for a new widget.
+func widgetKanbanEvents(old, widget *models.Widget) ([]models.KanbanEvent, error) {
+	if widget.Type != models.WidgetTypeKanban {
+		return nil, nil
+	}
+	var before json.RawMessage
+	if old != nil && old.Type == models.WidgetTypeKanban {
+		before = old.Content
+	}
+	return kanbanEvents(before, widget.Content)
+}
+
+// widgetChanged reports whether a save changes the title or content of a
+// widget. Content is compared as JSON, since clients may serialise it
+// differently.
+func widgetChanged(old, widget *models.Widget) (bool, error) {
+	if widget.Title != old.Title {
+		return true, nil
+	}
+	if len(widget.Content) == 0 {
+		return false, nil
+	}
+	var before, after any
+	if len(old.Content) > 0 {
+		if err := json.Unmarshal(old.Content, &before); err != nil {
+			return true, nil
+		}
+	}
+	if err := json.Unmarshal(widget.Content, &after); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(before, after), nil
+}
+
 // HandleDeleteWidget removes a widget for the authenticated user.
 func HandleDeleteWidget(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -86,7 +290,7 @@ func HandleDeleteWidget(w http.ResponseWriter, r *http.Request) {
 	}
 	id := parts[4]
 
-	if err := database.DeleteWidget(userID, id); err != nil {
+	if err := deleteWidget(userID, id, 0); err != nil {
 		http.Error(w, "Failed to delete widget", http.StatusInternalServerError)
 		return
 	}
@@ -95,6 +299,28 @@ func HandleDeleteWidget(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"status":"deleted"}`))
 }
 
+// deleteWidget deletes a widget of the user, if still at version (0 skips
+// the check). Recipients of a shared widget only remove it from their
+// dashboard.
+func deleteWidget(userID int, id string, version int) error {
+	widget, err := database.GetWidgetByID(userID, id)
+	if err != nil {
+		return err
+	}
+	if widget != nil && widget.Role != "" {
+		if err := database.DeleteWidgetShare(id, userID); err != nil {
+			return err
+		}
+		publishWidgetChange([]int{userID}, widgetEventDeleted, id, 0)
+		return nil
+	}
+	if err := database.DeleteWidget(userID, id, version); err != nil {
+		return err
+	}
+	notifyWidgetChanged(id)
+	return nil
+}
+
 // HandleGetWidgetByID returns a single widget for the authenticated user.
 func HandleGetWidgetByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
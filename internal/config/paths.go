@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // GetDataDir returns the path to the data directory.
@@ -23,3 +25,29 @@ func GetDataDir() string {
 	// 3. Default fallback (production binaries or unknown structure)
 	return "data"
 }
+
+// GetPublicURL returns the externally reachable base URL of the server
+// (e.g. "https://lifehub.example.com"), taken from LIFEHUB_PUBLIC_URL.
+// It is used to build absolute links for channels outside the browser, such
+// as email or ntfy. Returns an empty string when not configured.
+func GetPublicURL() string {
+	return strings.TrimRight(os.Getenv("LIFEHUB_PUBLIC_URL"), "/")
+}
+
+// AllowLocalAIServers reports whether the AI Coach may reach servers of the
+// local network, such as an Ollama running next to LifeHub. Set by
+// LIFEHUB_AI_ALLOW_LOCAL; off by default, since users could otherwise make
+// the server send requests to any host of its network.
+func AllowLocalAIServers() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("LIFEHUB_AI_ALLOW_LOCAL"))
+	return allow
+}
+
+// AllowLocalNotificationServers reports whether notification channels may
+// reach servers of the local network, such as a self-hosted ntfy, Gotify or
+// mail relay. Set by LIFEHUB_NOTIFY_ALLOW_LOCAL; off by default for the same
+// reason as AllowLocalAIServers.
+func AllowLocalNotificationServers() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("LIFEHUB_NOTIFY_ALLOW_LOCAL"))
+	return allow
+}
@@ -0,0 +1,55 @@
+package crdt
+
+import "fmt"
+
+// Diff returns the operations turning the text from, made of the characters
+// base, into the text to, and the IDs of the characters of to. The changed
+// range, between the common prefix and suffix, is deleted and inserted
+// again by site, with counters above clock.
+//
+// It is used to merge edits made to a copy of the text outside of the
+// document: concurrent changes of the document are kept.
+func Diff(site string, clock int, base []ID, from, to string) ([]Op, []ID, error) {
+	a, b := []rune(from), []rune(to)
+	if len(a) != len(base) {
+		return nil, nil, fmt.Errorf("%w: %d IDs for %d characters", ErrInvalidOp, len(base), len(a))
+	}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	if deleted := base[prefix : len(a)-suffix]; len(deleted) > 0 {
+		op := Op{Op: OpDelete}
+		for _, id := range deleted {
+			op.IDs = append(op.IDs, id.String())
+		}
+		ops = append(ops, op)
+	}
+
+	ids := append([]ID(nil), base[:prefix]...)
+	after := ID{}
+	if prefix > 0 {
+		after = base[prefix-1]
+	}
+	inserted := b[prefix : len(b)-suffix]
+	for len(inserted) > 0 {
+		n := min(len(inserted), MaxInsertLength)
+		id := ID{Site: site, Counter: clock + 1}
+		ops = append(ops, Op{Op: OpInsert, ID: id.String(), After: after.String(), Text: string(inserted[:n])})
+		for i := range n {
+			ids = append(ids, ID{Site: site, Counter: clock + 1 + i})
+		}
+		clock += n
+		after = ids[len(ids)-1]
+		inserted = inserted[n:]
+	}
+	ids = append(ids, base[len(a)-suffix:]...)
+	return ops, ids, nil
+}
@@ -0,0 +1,395 @@
+// Package crdt implements a Replicated Growable Array (RGA), a sequence CRDT
+// for collaborative text editing.
+//
+// Every character has a unique ID made of the site (editor session) that
+// inserted it and a counter. Counters are Lamport timestamps: a site numbers
+// its insertions above every counter it has seen, so concurrent inserts at
+// the same place are ordered the same way on every replica, newest first.
+// Deleted characters stay as tombstones so that later operations can still
+// refer to them.
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Operation types
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Limits of the operations Apply accepts. MaxDocLength counts the visible
+// characters.
+const (
+	MaxInsertLength = 64 * 1024
+	MaxDocLength    = 1024 * 1024
+)
+
+var (
+	// ErrUnknownID rejects operations referring to characters the document
+	// doesn't have, e.g. from a replica that is ahead.
+	ErrUnknownID = errors.New("unknown character ID")
+	ErrInvalidOp = errors.New("invalid operation")
+)
+
+// ID identifies a character. The zero ID is the start of the document.
+type ID struct {
+	Site    string
+	Counter int
+}
+
+// String formats the ID as "site:counter", empty for the start.
+func (id ID) String() string {
+	if id == (ID{}) {
+		return ""
+	}
+	return id.Site + ":" + strconv.Itoa(id.Counter)
+}
+
+// ParseID parses an ID formatted by String.
+func ParseID(s string) (ID, error) {
+	if s == "" {
+		return ID{}, nil
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return ID{}, fmt.Errorf("%w: malformed ID %q", ErrInvalidOp, s)
+	}
+	counter, err := strconv.Atoi(s[i+1:])
+	if err != nil || counter <= 0 {
+		return ID{}, fmt.Errorf("%w: malformed ID %q", ErrInvalidOp, s)
+	}
+	return ID{Site: s[:i], Counter: counter}, nil
+}
+
+// newer orders IDs: higher counters first, then by site.
+func (id ID) newer(other ID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter > other.Counter
+	}
+	return id.Site > other.Site
+}
+
+// Op is an update of a document. An insert puts Text after the character
+// After (empty for the start); its characters take the IDs ID, ID+1, and so
+// on. A delete removes the characters IDs.
+type Op struct {
+	Op    string   `json:"op"`
+	ID    string   `json:"id,omitempty"`
+	After string   `json:"after,omitempty"`
+	Text  string   `json:"text,omitempty"`
+	IDs   []string `json:"ids,omitempty"`
+}
+
+type element struct {
+	id      ID
+	char    rune
+	deleted bool
+}
+
+// Doc is a replica of a text document.
+type Doc struct {
+	elems   []element
+	ids     map[ID]bool // Characters of the document, true while visible
+	visible int
+	clock   int
+}
+
+// New returns an empty document.
+func New() *Doc {
+	return &Doc{ids: make(map[ID]bool)}
+}
+
+// FromText returns a document holding text, inserted by site.
+func FromText(site, text string) *Doc {
+	d := New()
+	if text != "" {
+		d.insert(ID{Site: site, Counter: 1}, ID{}, []rune(text))
+	}
+	return d
+}
+
+// change is a validated operation.
+type change struct {
+	insert  bool
+	id      ID
+	after   ID
+	text    []rune
+	applied bool // Insert received before
+	ids     []ID
+}
+
+// overlay is the state of the characters of a document as changed by
+// operations not applied yet, so that a batch can be validated as a whole.
+type overlay struct {
+	d       *Doc
+	ids     map[ID]bool
+	visible int
+}
+
+func (d *Doc) overlay() *overlay {
+	return &overlay{d: d, ids: make(map[ID]bool), visible: d.visible}
+}
+
+func (o *overlay) lookup(id ID) (exists, visible bool) {
+	if visible, ok := o.ids[id]; ok {
+		return true, visible
+	}
+	visible, exists = o.d.ids[id]
+	return exists, visible
+}
+
+// prepare validates an operation against the overlay, and records its
+// effect there.
+func (o *overlay) prepare(op Op) (change, error) {
+	switch op.Op {
+	case OpInsert:
+		id, err := ParseID(op.ID)
+		if err != nil {
+			return change{}, err
+		}
+		after, err := ParseID(op.After)
+		if err != nil {
+			return change{}, err
+		}
+		text := []rune(op.Text)
+		if id == (ID{}) || len(text) == 0 || len(text) > MaxInsertLength || !utf8.ValidString(op.Text) {
+			return change{}, fmt.Errorf("%w: invalid insert", ErrInvalidOp)
+		}
+		if exists, _ := o.lookup(after); after != (ID{}) && !exists {
+			return change{}, fmt.Errorf("%w: %s", ErrUnknownID, op.After)
+		}
+
+		// An insert is applied whole, so it was received before if its
+		// first character exists; IDs can't be reused otherwise.
+		c := change{insert: true, id: id, after: after, text: text}
+		first, _ := o.lookup(id)
+		for i := range text {
+			next := ID{Site: id.Site, Counter: id.Counter + i}
+			if exists, _ := o.lookup(next); exists != first {
+				return change{}, fmt.Errorf("%w: reused ID %s", ErrInvalidOp, next)
+			}
+			if !first {
+				o.ids[next] = true
+			}
+		}
+		if first {
+			c.applied = true
+			return c, nil
+		}
+		if o.visible+len(text) > MaxDocLength {
+			return change{}, fmt.Errorf("%w: document too large", ErrInvalidOp)
+		}
+		o.visible += len(text)
+		return c, nil
+
+	case OpDelete:
+		if len(op.IDs) == 0 {
+			return change{}, fmt.Errorf("%w: invalid delete", ErrInvalidOp)
+		}
+		c := change{ids: make([]ID, 0, len(op.IDs))}
+		for _, s := range op.IDs {
+			id, err := ParseID(s)
+			if err != nil {
+				return change{}, err
+			}
+			exists, visible := o.lookup(id)
+			if !exists {
+				return change{}, fmt.Errorf("%w: %s", ErrUnknownID, s)
+			}
+			if visible {
+				o.ids[id] = false
+				o.visible--
+			}
+			c.ids = append(c.ids, id)
+		}
+		return c, nil
+
+	default:
+		return change{}, fmt.Errorf("%w: unknown type %q", ErrInvalidOp, op.Op)
+	}
+}
+
+// Apply integrates an operation. Operations already applied are ignored, so
+// that a replica can receive an operation more than once.
+func (d *Doc) Apply(op Op) error {
+	c, err := d.overlay().prepare(op)
+	if err != nil {
+		return err
+	}
+	d.apply(c)
+	return nil
+}
+
+// Check returns the error Apply would return for the first operation of a
+// batch that doesn't apply, each applied after the previous ones. The
+// document is left unchanged.
+func (d *Doc) Check(ops []Op) error {
+	o := d.overlay()
+	for _, op := range ops {
+		if _, err := o.prepare(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Doc) apply(c change) {
+	if !c.insert {
+		ids := make(map[ID]bool, len(c.ids))
+		for _, id := range c.ids {
+			ids[id] = true
+		}
+		for i := range d.elems {
+			e := &d.elems[i]
+			if ids[e.id] && !e.deleted {
+				e.deleted = true
+				d.ids[e.id] = false
+				d.visible--
+			}
+		}
+		return
+	}
+	if !c.applied {
+		d.insert(c.id, c.after, c.text)
+	}
+}
+
+// insert integrates the characters of text, the first after the character
+// after and each following one after the previous, as one block: nothing
+// can have been inserted between them, as they are new.
+func (d *Doc) insert(id, after ID, text []rune) {
+	// Skip the characters inserted concurrently at the same place with
+	// newer IDs, and the characters inserted after them
+	i := d.indexOf(after) + 1
+	for i < len(d.elems) && d.elems[i].id.newer(id) {
+		i++
+	}
+	block := make([]element, len(text))
+	for j, char := range text {
+		block[j] = element{id: ID{Site: id.Site, Counter: id.Counter + j}, char: char}
+		d.ids[block[j].id] = true
+	}
+	d.elems = slices.Insert(d.elems, i, block...)
+	d.visible += len(text)
+	d.clock = max(d.clock, id.Counter+len(text)-1)
+}
+
+// indexOf returns the position of a character, -1 for the start.
+func (d *Doc) indexOf(id ID) int {
+	if id == (ID{}) {
+		return -1
+	}
+	for i := range d.elems {
+		if d.elems[i].id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Text returns the visible text.
+func (d *Doc) Text() string {
+	var b strings.Builder
+	for _, e := range d.elems {
+		if !e.deleted {
+			b.WriteRune(e.char)
+		}
+	}
+	return b.String()
+}
+
+// VisibleIDs returns the IDs of the characters of the visible text.
+func (d *Doc) VisibleIDs() []ID {
+	ids := make([]ID, 0, d.visible)
+	for _, e := range d.elems {
+		if !e.deleted {
+			ids = append(ids, e.id)
+		}
+	}
+	return ids
+}
+
+// Clock returns the highest counter of the document. Sites number their
+// next insertion above it.
+func (d *Doc) Clock() int {
+	return d.clock
+}
+
+// Compact drops the tombstones. Only safe when no replica may still send
+// operations referring to them.
+func (d *Doc) Compact() {
+	elems := d.elems[:0]
+	for _, e := range d.elems {
+		if e.deleted {
+			delete(d.ids, e.id)
+			continue
+		}
+		elems = append(elems, e)
+	}
+	d.elems = elems
+}
+
+// run is the JSON form of consecutive characters of a site with consecutive
+// counters and the same state.
+type run struct {
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// MarshalJSON encodes the document as a list of runs in document order,
+// the state new replicas start from.
+func (d *Doc) MarshalJSON() ([]byte, error) {
+	runs := []run{}
+	var b strings.Builder
+	for i, e := range d.elems {
+		if i > 0 {
+			prev := d.elems[i-1]
+			if prev.id.Site != e.id.Site || prev.id.Counter+1 != e.id.Counter || prev.deleted != e.deleted {
+				runs[len(runs)-1].Text = b.String()
+				b.Reset()
+			}
+		}
+		if b.Len() == 0 {
+			runs = append(runs, run{ID: e.id.String(), Deleted: e.deleted})
+		}
+		b.WriteRune(e.char)
+	}
+	if len(runs) > 0 {
+		runs[len(runs)-1].Text = b.String()
+	}
+	return json.Marshal(runs)
+}
+
+// UnmarshalJSON decodes a document encoded by MarshalJSON.
+func (d *Doc) UnmarshalJSON(data []byte) error {
+	var runs []run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return err
+	}
+	*d = *New()
+	for _, r := range runs {
+		id, err := ParseID(r.ID)
+		if err != nil {
+			return err
+		}
+		for _, char := range r.Text {
+			d.elems = append(d.elems, element{id: id, char: char, deleted: r.Deleted})
+			d.ids[id] = !r.Deleted
+			if !r.Deleted {
+				d.visible++
+			}
+			d.clock = max(d.clock, id.Counter)
+			id.Counter++
+		}
+	}
+	return nil
+}
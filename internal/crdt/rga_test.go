@@ -0,0 +1,269 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func insert(id, after, text string) Op {
+	return Op{Op: OpInsert, ID: id, After: after, Text: text}
+}
+
+func del(ids ...string) Op {
+	return Op{Op: OpDelete, IDs: ids}
+}
+
+func mustApply(t *testing.T, d *Doc, ops ...Op) {
+	t.Helper()
+	for _, op := range ops {
+		if err := d.Apply(op); err != nil {
+			t.Fatalf("Apply(%+v): %v", op, err)
+		}
+	}
+}
+
+func TestConcurrentInsertsAtSamePlace(t *testing.T) {
+	ops := []Op{
+		insert("a:1", "", "Hello"),
+		insert("b:1", "", "World"),
+		insert("c:2", "", "!"),
+	}
+	var texts []string
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		d := New()
+		for _, i := range order {
+			mustApply(t, d, ops[i])
+		}
+		texts = append(texts, d.Text())
+	}
+	// Newest first: counter 2, then site b before a for counter 1
+	if texts[0] != "!WorldHello" {
+		t.Errorf("Text() = %q, want %q", texts[0], "!WorldHello")
+	}
+	for _, text := range texts[1:] {
+		if text != texts[0] {
+			t.Errorf("replicas diverged: %q != %q", text, texts[0])
+		}
+	}
+}
+
+func TestInsertKeepsRunsTogether(t *testing.T) {
+	d := FromText("s", "ac")
+	// Both insert between a and c, concurrently
+	x, y := insert("x:3", "s:1", "XX"), insert("y:3", "s:1", "YY")
+	mustApply(t, d, x, y)
+	other := FromText("s", "ac")
+	mustApply(t, other, y, x)
+	if d.Text() != "aYYXXc" || other.Text() != d.Text() {
+		t.Errorf("Text() = %q and %q, want %q", d.Text(), other.Text(), "aYYXXc")
+	}
+}
+
+func TestDeleteAndInsertConcurrently(t *testing.T) {
+	a, b := FromText("s", "abc"), FromText("s", "abc")
+	deleteB := del("s:2")
+	insertAfterB := insert("t:4", "s:2", "X")
+	mustApply(t, a, deleteB, insertAfterB)
+	mustApply(t, b, insertAfterB, deleteB)
+	if a.Text() != "aXc" || b.Text() != "aXc" {
+		t.Errorf("Text() = %q and %q, want %q", a.Text(), b.Text(), "aXc")
+	}
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	d := New()
+	ops := []Op{insert("a:1", "", "abc"), del("a:2")}
+	mustApply(t, d, ops...)
+	mustApply(t, d, ops...)
+	if d.Text() != "ac" {
+		t.Errorf("Text() = %q, want %q", d.Text(), "ac")
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	d := FromText("s", "abc")
+	tests := []struct {
+		name string
+		op   Op
+		err  error
+	}{
+		{"unknown after", insert("a:4", "z:1", "x"), ErrUnknownID},
+		{"unknown delete", del("z:1"), ErrUnknownID},
+		{"empty insert", insert("a:4", "", ""), ErrInvalidOp},
+		{"start ID", insert("", "", "x"), ErrInvalidOp},
+		{"malformed ID", insert("a", "", "x"), ErrInvalidOp},
+		{"reused ID", insert("s:3", "", "xy"), ErrInvalidOp},
+		{"empty delete", del(), ErrInvalidOp},
+		{"unknown type", Op{Op: "move"}, ErrInvalidOp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := d.Apply(tt.op); !errors.Is(err, tt.err) {
+				t.Errorf("Apply() = %v, want %v", err, tt.err)
+			}
+			if d.Text() != "abc" {
+				t.Errorf("Text() = %q after a failed Apply", d.Text())
+			}
+		})
+	}
+}
+
+func TestMaxDocLengthCountsVisibleCharacters(t *testing.T) {
+	d := FromText("s", strings.Repeat("a", MaxDocLength))
+	if err := d.Apply(insert("t:1", "", "b")); !errors.Is(err, ErrInvalidOp) {
+		t.Fatalf("Apply() over the limit = %v, want %v", err, ErrInvalidOp)
+	}
+	mustApply(t, d, del("s:1"))
+	mustApply(t, d, insert(fmt.Sprintf("t:%d", MaxDocLength+1), "", "b"))
+}
+
+func TestCheckIsAtomic(t *testing.T) {
+	d := FromText("s", "ab")
+	ok := []Op{insert("t:3", "s:2", "c"), del("t:3"), insert("t:4", "t:3", "d")}
+	if err := d.Check(ok); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+	bad := []Op{insert("t:3", "s:2", "c"), del("z:1")}
+	if err := d.Check(bad); !errors.Is(err, ErrUnknownID) {
+		t.Fatalf("Check() = %v, want %v", err, ErrUnknownID)
+	}
+	if d.Text() != "ab" || d.Clock() != 2 {
+		t.Errorf("Check changed the document: %q, clock %d", d.Text(), d.Clock())
+	}
+	mustApply(t, d, ok...)
+	if d.Text() != "abd" {
+		t.Errorf("Text() = %q, want %q", d.Text(), "abd")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	d := FromText("s", "héllo")
+	mustApply(t, d, del("s:2"), insert("t:6", "s:5", " world"))
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Doc
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text() != d.Text() || got.Clock() != d.Clock() {
+		t.Errorf("round trip = %q (clock %d), want %q (clock %d)", got.Text(), got.Clock(), d.Text(), d.Clock())
+	}
+	// Tombstones are kept for later operations
+	mustApply(t, &got, insert("u:12", "s:2", "e"))
+	if got.Text() != "hello world" {
+		t.Errorf("Text() = %q, want %q", got.Text(), "hello world")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	d := FromText("s", "abc")
+	mustApply(t, d, del("s:2"))
+	d.Compact()
+	if d.Text() != "ac" || len(d.elems) != 2 {
+		t.Errorf("Compact left %d characters, text %q", len(d.elems), d.Text())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct{ from, to string }{
+		{"hello world", "hello brave world"},
+		{"hello world", "hello"},
+		{"hello", ""},
+		{"", "new"},
+		{"abc", "abc"},
+		{"abcabc", "abc"},
+		{"naïve café", "naive cafe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			d := FromText("s", tt.from)
+			ops, ids, err := Diff("server", d.Clock(), d.VisibleIDs(), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustApply(t, d, ops...)
+			if d.Text() != tt.to {
+				t.Errorf("Text() = %q, want %q", d.Text(), tt.to)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(d.VisibleIDs()) {
+				t.Errorf("IDs = %v, want %v", ids, d.VisibleIDs())
+			}
+		})
+	}
+}
+
+func TestDiffKeepsConcurrentEdits(t *testing.T) {
+	base := "The cat sat"
+	d := FromText("s", base)
+	ids := d.VisibleIDs()
+	// An editor appends while the text is changed outside the document
+	mustApply(t, d, insert("e:12", "s:11", " down"))
+	ops, _, err := Diff("server", d.Clock(), ids, base, "The dog sat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustApply(t, d, ops...)
+	if d.Text() != "The dog sat down" {
+		t.Errorf("Text() = %q, want %q", d.Text(), "The dog sat down")
+	}
+}
+
+// TestConvergence has replicas edit concurrently, then exchange their
+// operations in random orders, for several rounds.
+func TestConvergence(t *testing.T) {
+	const sites, rounds, opsPerRound = 4, 30, 8
+	rng := rand.New(rand.NewSource(1))
+	replicas := make([]*Doc, sites)
+	for i := range replicas {
+		replicas[i] = FromText("init", "shared text")
+	}
+
+	for round := 0; round < rounds; round++ {
+		local := make([][]Op, sites)
+		for i, d := range replicas {
+			site := fmt.Sprintf("site%d", i)
+			for n := 0; n < opsPerRound; n++ {
+				visible := d.VisibleIDs()
+				var op Op
+				if len(visible) > 0 && rng.Intn(3) == 0 {
+					op = del(visible[rng.Intn(len(visible))].String())
+				} else {
+					after := ""
+					if pos := rng.Intn(len(visible) + 1); pos > 0 {
+						after = visible[pos-1].String()
+					}
+					text := string(rune('a'+rng.Intn(26))) + string(rune('a'+rng.Intn(26)))
+					op = insert(ID{Site: site, Counter: d.Clock() + 1}.String(), after, text)
+				}
+				mustApply(t, d, op)
+				local[i] = append(local[i], op)
+			}
+		}
+
+		// Each replica receives the others' operations, site by site in a
+		// random order, some twice
+		for i, d := range replicas {
+			for _, j := range rng.Perm(sites) {
+				if j == i {
+					continue
+				}
+				mustApply(t, d, local[j]...)
+				if rng.Intn(4) == 0 {
+					mustApply(t, d, local[j]...)
+				}
+			}
+		}
+
+		for i := 1; i < sites; i++ {
+			if replicas[i].Text() != replicas[0].Text() {
+				t.Fatalf("round %d: replica %d diverged:\n%q\n%q", round, i, replicas[i].Text(), replicas[0].Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package dashboard summarises a user's widgets as plain text, for the AI
+// coach, the daily digest and external agents.
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// DefaultTokenBudget is the size of the context sent along AI requests.
+const DefaultTokenBudget = 2000
+
+// Options controls how a context is built.
+type Options struct {
+	Language string
+	// Now is the current time in the user's timezone; it decides what "today" is.
+	Now time.Time
+	// MaxTokens is the approximate token budget of the whole context.
+	// Zero means no limit.
+	MaxTokens int
+}
+
+// EstimateTokens approximates the number of tokens of a text. Tokenizers of
+// the supported providers average about four characters per token.
+func EstimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// BuildContext describes the widgets, one section per widget. When the
+// description exceeds the token budget, the largest sections are truncated
+// first so that every widget keeps at least its header.
+func BuildContext(widgets []models.Widget, opts Options) string {
+	t := TermsFor(opts.Language)
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	today := opts.Now.Format("2006-01-02")
+
+	intro := fmt.Sprintf("%s (%s %s):\n", t.Intro, t.TodayIs, today)
+	sections := make([][]string, len(widgets))
+	for i, w := range widgets {
+		sections[i] = describeWidget(w, t, opts.Now)
+	}
+
+	if opts.MaxTokens > 0 {
+		fitSections(sections, opts.MaxTokens-EstimateTokens(intro), t)
+	}
+
+	var b strings.Builder
+	b.WriteString(intro)
+	for _, lines := range sections {
+		for _, line := range lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// describeWidget returns the lines describing one widget, header first.
+func describeWidget(w models.Widget, t Terms, now time.Time) []string {
+	lines := []string{fmt.Sprintf("- Widget %q (%s):", w.Title, w.Type)}
+	add := func(format string, args ...any) {
+		lines = append(lines, "  "+fmt.Sprintf(format, args...))
+	}
+
+	var content models.WidgetContentWrapper
+	json.Unmarshal(w.Content, &content)
+	today := now.Format("2006-01-02")
+
+	switch w.Type {
+	case models.WidgetTypeTodo:
+		var pending []string
+		completed, total, archived := 0, 0, 0
+		for _, todo := range content.Todos {
+			if todo.Archived {
+				archived++
+				continue
+			}
+			total++
+			if todo.Completed {
+				completed++
+			} else {
+				pending = append(pending, todo.Text)
+			}
+		}
+		add("%s: %d/%d %s.", t.ActiveList, completed, total, t.TasksCompleted)
+		if len(pending) > 0 {
+			add("%s: %s", t.PendingTasks, strings.Join(pending, ", "))
+		}
+		if archived > 0 {
+			add("(%d %s)", archived, t.ArchivedTasks)
+		}
+
+	case models.WidgetTypeWellness:
+		var amount float64
+		if content.Wellness != nil {
+			amount = content.Wellness.WaterIntakeMl
+			for _, r := range content.Wellness.History {
+				if r.Date == today {
+					amount = r.Amount
+					break
+				}
+			}
+		}
+		add("%s: %s.", t.WaterConsumed, formatWater(amount))
+
+	case models.WidgetTypeNote:
+		if len(content.Notes) > 0 {
+			for _, note := range content.Notes {
+				add("%s [%s]: %s...", t.Note, note.Title, truncateRunes(note.Content, 100))
+			}
+		} else if content.Text != "" {
+			add("%s: %s...", t.NoteContent, truncateRunes(content.Text, 100))
+		}
+
+	case models.WidgetTypeReminder:
+		var upcoming []string
+		for _, r := range content.Reminders {
+			if !r.Completed {
+				upcoming = append(upcoming, fmt.Sprintf("%s %s %s", r.Text, t.On, r.Date))
+			}
+		}
+		if len(upcoming) > 0 {
+			add("%s: %s", t.UpcomingReminders, strings.Join(upcoming, "; "))
+		} else {
+			add("%s.", t.NoReminders)
+		}
+
+	case models.WidgetTypeKanban:
+		for _, col := range content.Kanban {
+			var items []string
+			for _, item := range col.Items {
+				items = append(items, item.Content)
+			}
+			if len(items) > 0 {
+				add("%s '%s': %s", t.Column, col.Title, strings.Join(items, ", "))
+			}
+		}
+
+	case models.WidgetTypeGym:
+		gym := content.Gym
+		if gym == nil {
+			break
+		}
+		add("%s", t.GymIntro)
+		if gym.ActiveSession != nil {
+			add("%s: %s", t.ActiveWorkout, gym.ActiveSession.TemplateName)
+		}
+		if len(gym.History) > 0 {
+			add("%s:", t.RecentHistory)
+			for i := len(gym.History) - 1; i >= 0 && i >= len(gym.History)-10; i-- {
+				h := gym.History[i]
+				add("  - %s: %s", formatDate(h.StartTime, now.Location()), h.TemplateName)
+			}
+		}
+		if len(gym.Templates) > 0 {
+			add("%s:", t.AvailableWorkouts)
+			for _, tmpl := range gym.Templates {
+				exercises := t.NoExercises
+				if len(tmpl.Exercises) > 0 {
+					exercises = strings.Join(tmpl.Exercises, ", ")
+				}
+				add("  - %s: [%s]", tmpl.Name, exercises)
+			}
+		}
+
+	case models.WidgetTypeLinks:
+		var links []string
+		for _, l := range content.Links {
+			links = append(links, fmt.Sprintf("%s (%s)", l.Title, l.URL))
+		}
+		if len(links) > 0 {
+			add("%s %s", t.LinksIntro, strings.Join(links, ", "))
+		}
+
+	case models.WidgetTypePomodoro:
+		p := content.Pomodoro
+		if p == nil {
+			break
+		}
+		timeLeft := p.TimeLeft
+		if p.IsActive && p.EndTime > 0 {
+			// timeLeft is only refreshed when the timer is paused
+			timeLeft = max(0, int(time.UnixMilli(p.EndTime).Sub(now).Seconds()))
+		}
+		add("%s", t.PomodoroIntro)
+		add("%s: %s (%ds %s)", t.PomodoroMode, p.Mode, timeLeft, t.PomodoroLeft)
+		add("%s: %d", t.PomodoroCycles, p.CyclesCompleted)
+		if p.IsActive {
+			add("%s", t.PomodoroActive)
+		}
+
+	case models.WidgetTypeDiet:
+		d := content.Diet
+		if d == nil {
+			break
+		}
+		var calories, protein float64
+		for _, day := range d.History {
+			if day.Date != today {
+				continue
+			}
+			for _, meal := range day.Meals {
+				for _, food := range meal.Items {
+					calories += food.Calories
+					protein += food.Protein
+				}
+			}
+		}
+		add("%s", t.DietIntro)
+		add("%s: %s / %s", t.CaloriesConsumed, formatNumber(calories), formatNumber(d.CalorieGoal))
+		add("%s: %sg", t.ProteinConsumed, formatNumber(protein))
+	}
+
+	return lines
+}
+
+// fitSections truncates sections in place so that they fit in budget tokens.
+// Budget is shared fairly: sections smaller than their share are kept whole
+// and what they leave is split among the larger ones.
+func fitSections(sections [][]string, budget int, t Terms) {
+	sizes := make([]int, len(sections))
+	total := 0
+	for i, lines := range sections {
+		sizes[i] = sectionTokens(lines)
+		total += sizes[i]
+	}
+	if total <= budget {
+		return
+	}
+
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+
+	remaining := max(budget, 0)
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		if sizes[i] <= share {
+			remaining -= sizes[i]
+			continue
+		}
+		sections[i] = truncateSection(sections[i], share, t)
+		remaining -= min(sectionTokens(sections[i]), remaining)
+	}
+}
+
+// truncateSection keeps the header and as many lines as fit in budget,
+// shortening the last one if needed, and notes how many lines were dropped.
+func truncateSection(lines []string, budget int, t Terms) []string {
+	kept := []string{lines[0]}
+	used := sectionTokens(kept)
+
+	for i := 1; i < len(lines); i++ {
+		marker := fmt.Sprintf("  (... %d %s)", len(lines)-i, t.Truncated)
+		room := budget - used - EstimateTokens(marker)
+		cost := EstimateTokens(lines[i]) + 1
+
+		if cost <= room {
+			kept = append(kept, lines[i])
+			used += cost
+			continue
+		}
+		// Long lines (lists joined by commas) are worth keeping partially
+		if room > 8 {
+			kept = append(kept, truncateRunes(lines[i], (room-1)*4)+"...")
+			if i+1 < len(lines) {
+				kept = append(kept, fmt.Sprintf("  (... %d %s)", len(lines)-i-1, t.Truncated))
+			}
+			return kept
+		}
+		return append(kept, marker)
+	}
+	return kept
+}
+
+// sectionTokens estimates the tokens of lines joined by newlines.
+func sectionTokens(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		n += EstimateTokens(line) + 1
+	}
+	return n
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func formatWater(ml float64) string {
+	if ml >= 1000 {
+		return strconv.FormatFloat(ml/1000, 'f', 2, 64) + "L"
+	}
+	return formatNumber(ml) + "ml"
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatDate returns the local date of an ISO timestamp, or the raw value if
+// it can't be parsed.
+func formatDate(iso string, loc *time.Location) string {
+	ts, err := time.Parse(time.RFC3339, iso)
+	if err != nil {
+		return iso
+	}
+	return ts.In(loc).Format("2006-01-02")
+}
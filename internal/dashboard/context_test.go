@@ -0,0 +1,201 @@
+package dashboard
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+func widget(widgetType models.WidgetType, title, content string) models.Widget {
+	return models.Widget{ID: title, Type: widgetType, Title: title, IsActive: true, Content: []byte(content)}
+}
+
+func TestTerms(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	english := reflect.ValueOf(terms[LangEnglish])
+	for lang, tt := range terms {
+		v := reflect.ValueOf(tt)
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			s := v.Field(i).String()
+			if s == "" {
+				t.Errorf("%s: %s is empty", lang, name)
+			}
+			// Translations take the same arguments
+			want := verbs.FindAllString(english.Field(i).String(), -1)
+			if got := verbs.FindAllString(s, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %s has verbs %v, want %v", lang, name, got, want)
+			}
+		}
+	}
+
+	for lang, want := range map[string]string{"pt-br": LangPortuguese, "en-us": LangEnglish, "fr": LangEnglish, "": LangEnglish} {
+		if got := NormalizeLanguage(lang); got != want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", lang, got, want)
+		}
+	}
+	if TermsFor("de").Intro != terms[LangEnglish].Intro {
+		t.Error("unsupported languages don't fall back to English")
+	}
+}
+
+func TestDescribeWidget(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	endTime := now.Add(90 * time.Second).UnixMilli()
+	long := strings.Repeat("é", 120)
+
+	tests := []struct {
+		widget models.Widget
+		want   []string
+	}{
+		{widget(models.WidgetTypeTodo, "Tasks", `{"todos":[
+			{"id":"1","text":"Write","completed":true},{"id":"2","text":"Call Ana","completed":false},
+			{"id":"3","text":"Pay","completed":false},{"id":"4","text":"Old","completed":true,"archived":true}]}`), []string{
+			`- Widget "Tasks" (TODO):`,
+			"  Current Active List: 1/3 tasks completed.",
+			"  Pending tasks: Call Ana, Pay",
+			"  (1 tasks archived)",
+		}},
+		{widget(models.WidgetTypeWellness, "Water", `{"wellness":{"waterIntakeMl":500,"history":[
+			{"date":"2026-03-09","amount":2000},{"date":"2026-03-10","amount":1250}]}}`), []string{
+			`- Widget "Water" (WELLNESS):`,
+			"  Water Consumed Today: 1.25L.",
+		}},
+		{widget(models.WidgetTypeWellness, "Legacy water", `{"wellness":{"waterIntakeMl":500}}`), []string{
+			`- Widget "Legacy water" (WELLNESS):`,
+			"  Water Consumed Today: 500ml.",
+		}},
+		{widget(models.WidgetTypeNote, "Notes", `{"notes":[{"id":"1","title":"Ideas","content":"`+long+`"}]}`), []string{
+			`- Widget "Notes" (NOTE):`,
+			"  Note [Ideas]: " + strings.Repeat("é", 100) + "...",
+		}},
+		{widget(models.WidgetTypeNote, "Legacy note", `{"text":"Buy milk"}`), []string{
+			`- Widget "Legacy note" (NOTE):`,
+			"  Note Content: Buy milk...",
+		}},
+		{widget(models.WidgetTypeReminder, "Reminders", `{"reminders":[
+			{"id":"1","text":"Dentist","date":"2026-03-12","completed":false},{"id":"2","text":"Done","date":"2026-03-01","completed":true}]}`), []string{
+			`- Widget "Reminders" (REMINDER):`,
+			"  Upcoming Reminders: Dentist on 2026-03-12",
+		}},
+		{widget(models.WidgetTypeReminder, "No reminders", `{"reminders":[]}`), []string{
+			`- Widget "No reminders" (REMINDER):`,
+			"  No pending reminders.",
+		}},
+		{widget(models.WidgetTypeKanban, "Board", `{"kanban":[
+			{"id":"a","title":"To do","items":[{"id":"1","content":"Fence"},{"id":"2","content":"Roof"}]},{"id":"b","title":"Empty","items":[]}]}`), []string{
+			`- Widget "Board" (KANBAN):`,
+			"  Column 'To do': Fence, Roof",
+		}},
+		{widget(models.WidgetTypeLinks, "Links", `{"links":[{"id":"1","title":"Docs","url":"https://example.com"}]}`), []string{
+			`- Widget "Links" (LINKS):`,
+			"  Pinned Links: Docs (https://example.com)",
+		}},
+		{widget(models.WidgetTypePomodoro, "Focus", fmt.Sprintf(`{"pomodoro":{"timeLeft":1500,"endTime":%d,"isActive":true,"mode":"work","cyclesCompleted":2}}`, endTime)), []string{
+			`- Widget "Focus" (POMODORO):`,
+			"  Focus/Pomodoro Timer Status:",
+			"  Current mode: work (90s left)",
+			"  Cycles completed: 2",
+			"  User is currently running a focus timer",
+		}},
+		{widget(models.WidgetTypeDiet, "Diet", `{"diet":{"calorieGoal":2000,"history":[
+			{"date":"2026-03-09","meals":[{"id":"m","name":"Dinner","items":[{"id":"f","name":"Pizza","calories":900}]}]},
+			{"date":"2026-03-10","meals":[{"id":"m","name":"Breakfast","items":[
+				{"id":"f1","name":"Eggs","calories":150.5,"protein":12},{"id":"f2","name":"Toast","calories":100,"protein":3}]}]}]}}`), []string{
+			`- Widget "Diet" (DIET):`,
+			"  Diet & Nutrition Stats:",
+			"  Calories consumed today: 250.5 / 2000",
+			"  Protein consumed: 15g",
+		}},
+		{widget(models.WidgetTypeGym, "Gym", `{"gym":{
+			"templates":[{"id":"t","name":"Legs","exercises":["Squat"]},{"id":"u","name":"Rest","exercises":[]}],
+			"history":[{"id":"s","templateName":"Legs","startTime":"2026-03-10T01:00:00Z","logs":[]}]}}`), []string{
+			`- Widget "Gym" (GYM):`,
+			"  Gym/Workout Stats:",
+			"  Recent History (Last 10):",
+			"    - 2026-03-09: Legs",
+			"  Available workout routines:",
+			"    - Legs: [Squat]",
+			"    - Rest: [No exercises]",
+		}},
+	}
+	// Dates are local to the user
+	loc := time.FixedZone("UTC-3", -3*60*60)
+	for _, tt := range tests {
+		if got := describeWidget(tt.widget, terms[LangEnglish], now.In(loc)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.widget.Title, got, tt.want)
+		}
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	widgets := []models.Widget{widget(models.WidgetTypeNote, "Notes", `{"text":"Buy milk"}`)}
+
+	got := BuildContext(widgets, Options{Language: LangPortuguese, Now: now})
+	want := "Aqui está o estado atual do painel LifeHub do usuário (Hoje é 2026-03-10):\n" +
+		"- Widget \"Notes\" (NOTE):\n" +
+		"  Conteúdo da Nota: Buy milk...\n"
+	if got != want {
+		t.Errorf("BuildContext() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildContextTruncation(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	var pending []string
+	for i := range 200 {
+		pending = append(pending, fmt.Sprintf(`{"id":"%d","text":"Task number %d","completed":false}`, i, i))
+	}
+	var columns []string
+	for i := range 40 {
+		columns = append(columns, fmt.Sprintf(`{"id":"%d","title":"Column %d","items":[{"id":"c%d","content":"Card %d"}]}`, i, i, i, i))
+	}
+	widgets := []models.Widget{
+		widget(models.WidgetTypeTodo, "Big list", `{"todos":[`+strings.Join(pending, ",")+`]}`),
+		widget(models.WidgetTypeKanban, "Wide board", `{"kanban":[`+strings.Join(columns, ",")+`]}`),
+		widget(models.WidgetTypeNote, "Small note", `{"text":"Buy milk"}`),
+		widget(models.WidgetTypeReminder, "Reminders", `{"reminders":[]}`),
+	}
+
+	full := BuildContext(widgets, Options{Now: now})
+	if !strings.Contains(full, "Task number 199") || !strings.Contains(full, "Column 'Column 39'") {
+		t.Fatal("context without a budget is truncated")
+	}
+
+	const budget = 300
+	got := BuildContext(widgets, Options{Now: now, MaxTokens: budget})
+	if n := EstimateTokens(got); n > budget {
+		t.Errorf("context takes %d tokens, over the budget of %d", n, budget)
+	}
+	// Every widget keeps its header, small sections are kept whole
+	for _, w := range widgets {
+		if !strings.Contains(got, fmt.Sprintf("- Widget %q (%s):", w.Title, w.Type)) {
+			t.Errorf("header of %s dropped", w.Title)
+		}
+	}
+	for _, line := range []string{"  Note Content: Buy milk...", "  No pending reminders.", "  Current Active List: 0/200 tasks completed."} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("line %q dropped", line)
+		}
+	}
+	// The long list is cut, the many lines are counted
+	if !strings.Contains(got, "Task number 1, ") || strings.Contains(got, "Task number 199") {
+		t.Error("long line isn't shortened")
+	}
+	if !regexp.MustCompile(`\(\.\.\. \d+ more lines omitted\)`).MatchString(got) || strings.Contains(got, "Column 39") {
+		t.Error("omitted lines aren't counted")
+	}
+
+	// Even a tiny budget keeps the headers
+	tiny := BuildContext(widgets, Options{Now: now, MaxTokens: 10})
+	if strings.Count(tiny, "- Widget ") != len(widgets) {
+		t.Errorf("tiny budget: %q", tiny)
+	}
+}
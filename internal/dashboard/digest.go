@@ -0,0 +1,291 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// DefaultWaterGoalMl is used when the Wellness widget has no goal.
+const DefaultWaterGoalMl = 2000
+
+// digestMaxItems bounds the tasks and reminders listed in a digest.
+const digestMaxItems = 5
+
+// Digest is the morning summary of a dashboard.
+type Digest struct {
+	Kind     string          `json:"kind"` // daily or weekly
+	Date     string          `json:"date"` // YYYY-MM-DD in the user's timezone
+	Title    string          `json:"title"`
+	Sections []DigestSection `json:"sections"`
+}
+
+// DigestSection is a titled group of lines of a digest.
+type DigestSection struct {
+	Title string   `json:"title"`
+	Lines []string `json:"lines"`
+}
+
+// Text renders the digest as plain text, for notifications and emails.
+func (d Digest) Text() string {
+	var b strings.Builder
+	b.WriteString(d.Title)
+	for _, s := range d.Sections {
+		b.WriteString("\n\n" + s.Title + ":")
+		for _, line := range s.Lines {
+			b.WriteString("\n- " + line)
+		}
+	}
+	return b.String()
+}
+
+// digestData gathers what the digest reports from every widget.
+type digestData struct {
+	hasTodos, hasReminders, hasWellness, hasDiet, hasGym bool
+
+	pendingTodos   []string
+	todayReminders []string
+	waterByDate    map[string]float64
+	waterGoal      float64
+	caloriesByDate map[string]float64
+	proteinByDate  map[string]float64
+	calorieGoal    float64
+	workouts       []models.GymSession // Finished, oldest first
+}
+
+// BuildDigest composes the digest of the widgets for the day of opts.Now:
+// pending todos, today's reminders, yesterday's water and calories against
+// their goals and the last workout. Weekly digests add the last 7 days.
+func BuildDigest(widgets []models.Widget, kind string, opts Options) Digest {
+	t := TermsFor(opts.Language)
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	now := opts.Now
+	today := now.Format("2006-01-02")
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+
+	data := collectDigestData(widgets, today)
+	d := Digest{Kind: kind, Date: today, Title: t.DailyDigest}
+	if kind == models.DigestWeekly {
+		d.Title = t.WeeklyDigest
+	}
+
+	if data.hasTodos {
+		lines := listLines(data.pendingTodos, t)
+		if len(lines) == 0 {
+			lines = []string{t.NoPendingTasks}
+		}
+		d.Sections = append(d.Sections, DigestSection{Title: t.PendingTasks, Lines: lines})
+	}
+
+	if data.hasReminders {
+		lines := listLines(data.todayReminders, t)
+		if len(lines) == 0 {
+			lines = []string{t.NoRemindersToday}
+		}
+		d.Sections = append(d.Sections, DigestSection{Title: t.TodaysReminders, Lines: lines})
+	}
+
+	var yesterdayLines []string
+	if data.hasWellness {
+		water := data.waterByDate[yesterday]
+		yesterdayLines = append(yesterdayLines, fmt.Sprintf("%s: %s / %s (%d%%)",
+			t.Water, formatWater(water), formatWater(data.waterGoal), percent(water, data.waterGoal)))
+	}
+	if data.hasDiet {
+		line := fmt.Sprintf("%s: %s / %s kcal", t.Calories,
+			formatNumber(data.caloriesByDate[yesterday]), formatNumber(data.calorieGoal))
+		if protein := data.proteinByDate[yesterday]; protein > 0 {
+			line += fmt.Sprintf(" (%s %sg)", t.Protein, formatNumber(protein))
+		}
+		yesterdayLines = append(yesterdayLines, line)
+	}
+	if len(yesterdayLines) > 0 {
+		d.Sections = append(d.Sections, DigestSection{Title: t.Yesterday, Lines: yesterdayLines})
+	}
+
+	if data.hasGym {
+		line := t.NoWorkouts
+		if n := len(data.workouts); n > 0 {
+			line = t.LastWorkout + " " + describeWorkout(data.workouts[n-1], t, now.Location())
+		}
+		d.Sections = append(d.Sections, DigestSection{Title: t.Workouts, Lines: []string{line}})
+	}
+
+	if kind == models.DigestWeekly {
+		if lines := weeklyLines(data, t, now); len(lines) > 0 {
+			d.Sections = append(d.Sections, DigestSection{Title: t.LastSevenDays, Lines: lines})
+		}
+	}
+	return d
+}
+
+func collectDigestData(widgets []models.Widget, today string) digestData {
+	data := digestData{
+		waterByDate:    map[string]float64{},
+		caloriesByDate: map[string]float64{},
+		proteinByDate:  map[string]float64{},
+	}
+
+	for _, w := range widgets {
+		var content models.WidgetContentWrapper
+		json.Unmarshal(w.Content, &content)
+
+		switch w.Type {
+		case models.WidgetTypeTodo:
+			data.hasTodos = true
+			for _, todo := range content.Todos {
+				if !todo.Completed && !todo.Archived {
+					data.pendingTodos = append(data.pendingTodos, todo.Text)
+				}
+			}
+
+		case models.WidgetTypeReminder:
+			data.hasReminders = true
+			for _, r := range content.Reminders {
+				if !r.Completed && r.Date == today {
+					data.todayReminders = append(data.todayReminders, r.Text)
+				}
+			}
+
+		case models.WidgetTypeWellness:
+			data.hasWellness = true
+			if content.Wellness == nil {
+				break
+			}
+			for _, r := range content.Wellness.History {
+				data.waterByDate[r.Date] += r.Amount
+			}
+			if data.waterGoal == 0 {
+				data.waterGoal = content.Wellness.GoalMl
+			}
+
+		case models.WidgetTypeDiet:
+			data.hasDiet = true
+			if content.Diet == nil {
+				break
+			}
+			for _, day := range content.Diet.History {
+				for _, meal := range day.Meals {
+					for _, food := range meal.Items {
+						data.caloriesByDate[day.Date] += food.Calories
+						data.proteinByDate[day.Date] += food.Protein
+					}
+				}
+			}
+			if data.calorieGoal == 0 {
+				data.calorieGoal = content.Diet.CalorieGoal
+			}
+
+		case models.WidgetTypeGym:
+			data.hasGym = true
+			if content.Gym == nil {
+				break
+			}
+			for _, s := range content.Gym.History {
+				if _, err := time.Parse(time.RFC3339, s.StartTime); err == nil {
+					data.workouts = append(data.workouts, s)
+				}
+			}
+		}
+	}
+
+	if data.waterGoal <= 0 {
+		data.waterGoal = DefaultWaterGoalMl
+	}
+	// Oldest first, whatever the order they were logged in
+	sort.SliceStable(data.workouts, func(i, j int) bool {
+		return workoutStart(data.workouts[i]).Before(workoutStart(data.workouts[j]))
+	})
+	return data
+}
+
+// weeklyLines summarises the 7 days before today.
+func weeklyLines(data digestData, t Terms, now time.Time) []string {
+	var lines []string
+	start := now.AddDate(0, 0, -7)
+	dates := make([]string, 7)
+	for i := range dates {
+		dates[i] = start.AddDate(0, 0, i).Format("2006-01-02")
+	}
+
+	if data.hasWellness {
+		total, met := 0.0, 0
+		for _, date := range dates {
+			total += data.waterByDate[date]
+			if data.waterByDate[date] >= data.waterGoal {
+				met++
+			}
+		}
+		lines = append(lines, fmt.Sprintf(t.WeeklyWaterFormat, formatWater(math.Round(total/7)), met))
+	}
+
+	if data.hasDiet {
+		total, logged := 0.0, 0
+		for _, date := range dates {
+			if calories := data.caloriesByDate[date]; calories > 0 {
+				total += calories
+				logged++
+			}
+		}
+		average := 0.0
+		if logged > 0 {
+			average = total / float64(logged)
+		}
+		lines = append(lines, fmt.Sprintf(t.WeeklyCaloriesFormat,
+			formatNumber(math.Round(average)), formatNumber(data.calorieGoal), logged))
+	}
+
+	if data.hasGym {
+		from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, now.Location())
+		to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		var names []string
+		for _, s := range data.workouts {
+			if at := workoutStart(s); !at.Before(from) && at.Before(to) {
+				names = append(names, s.TemplateName)
+			}
+		}
+		line := fmt.Sprintf("%s: %d", t.Workouts, len(names))
+		if len(names) > 0 {
+			line += " (" + strings.Join(names, ", ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// listLines returns up to digestMaxItems items, noting how many were left out.
+func listLines(items []string, t Terms) []string {
+	if len(items) <= digestMaxItems {
+		return items
+	}
+	lines := append([]string{}, items[:digestMaxItems]...)
+	return append(lines, fmt.Sprintf("(+%d %s)", len(items)-digestMaxItems, t.More))
+}
+
+func describeWorkout(s models.GymSession, t Terms, loc *time.Location) string {
+	start := workoutStart(s)
+	desc := fmt.Sprintf("%s %s %s", s.TemplateName, t.On, start.In(loc).Format("2006-01-02"))
+	if end, err := time.Parse(time.RFC3339, s.EndTime); err == nil && end.After(start) {
+		desc += fmt.Sprintf(" (%d min)", int(end.Sub(start).Minutes()))
+	}
+	return desc
+}
+
+func workoutStart(s models.GymSession) time.Time {
+	start, _ := time.Parse(time.RFC3339, s.StartTime)
+	return start
+}
+
+func percent(value, goal float64) int {
+	if goal <= 0 {
+		return 0
+	}
+	return int(value / goal * 100)
+}
@@ -0,0 +1,104 @@
+package dashboard
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// digestWidgets is a dashboard on Tuesday 2026-03-10.
+var digestWidgets = []models.Widget{
+	widget(models.WidgetTypeTodo, "Tasks", `{"todos":[
+		{"id":"1","text":"One","completed":false},{"id":"2","text":"Two","completed":false},
+		{"id":"3","text":"Three","completed":false},{"id":"4","text":"Four","completed":false},
+		{"id":"5","text":"Five","completed":false},{"id":"6","text":"Six","completed":false},
+		{"id":"7","text":"Seven","completed":false},{"id":"8","text":"Done","completed":true},
+		{"id":"9","text":"Archived","completed":false,"archived":true}]}`),
+	widget(models.WidgetTypeReminder, "Reminders", `{"reminders":[
+		{"id":"1","text":"Dentist","date":"2026-03-10","completed":false},
+		{"id":"2","text":"Taxes","date":"2026-03-11","completed":false},
+		{"id":"3","text":"Call","date":"2026-03-10","completed":true}]}`),
+	widget(models.WidgetTypeWellness, "Water", `{"wellness":{"goalMl":2500,"history":[
+		{"date":"2026-03-03","amount":2500},{"date":"2026-03-08","amount":3000},{"date":"2026-03-09","amount":1250},
+		{"date":"2026-03-10","amount":500}]}}`),
+	widget(models.WidgetTypeDiet, "Diet", `{"diet":{"calorieGoal":2000,"history":[
+		{"date":"2026-03-08","meals":[{"id":"m","name":"Lunch","items":[{"id":"f","name":"Rice","calories":1800}]}]},
+		{"date":"2026-03-09","meals":[{"id":"m","name":"Lunch","items":[{"id":"f","name":"Fish","calories":1200,"protein":40}]}]}]}}`),
+	widget(models.WidgetTypeGym, "Gym", `{"gym":{"templates":[],"history":[
+		{"id":"b","templateName":"Legs","startTime":"2026-03-09T22:00:00Z","endTime":"2026-03-09T22:45:00Z","logs":[]},
+		{"id":"a","templateName":"Push","startTime":"2026-03-05T12:00:00Z","logs":[]},
+		{"id":"c","templateName":"Old","startTime":"2026-02-20T12:00:00Z","logs":[]},
+		{"id":"d","templateName":"Broken","startTime":"yesterday","logs":[]}]}}`),
+}
+
+func TestBuildDigest(t *testing.T) {
+	// 08:00 in São Paulo, the last workout started there on the 9th
+	loc := time.FixedZone("UTC-3", -3*60*60)
+	now := time.Date(2026, 3, 10, 8, 0, 0, 0, loc)
+
+	daily := BuildDigest(digestWidgets, models.DigestDaily, Options{Now: now})
+	want := []DigestSection{
+		{Title: "Pending tasks", Lines: []string{"One", "Two", "Three", "Four", "Five", "(+2 more)"}},
+		{Title: "Today's reminders", Lines: []string{"Dentist"}},
+		{Title: "Yesterday", Lines: []string{"Water: 1.25L / 2.50L (50%)", "Calories: 1200 / 2000 kcal (protein 40g)"}},
+		{Title: "Workouts", Lines: []string{"Last workout was Legs on 2026-03-09 (45 min)"}},
+	}
+	if daily.Kind != models.DigestDaily || daily.Date != "2026-03-10" || daily.Title != "Good morning! Here is your day" {
+		t.Errorf("digest = %+v", daily)
+	}
+	checkSections(t, daily.Sections, want)
+
+	weekly := BuildDigest(digestWidgets, models.DigestWeekly, Options{Now: now})
+	want = append(want, DigestSection{Title: "Last 7 days", Lines: []string{
+		"Water: 964ml per day on average, goal met on 2 of 7 days",
+		"Calories: 1500 kcal per day on average (goal 2000), 2 days logged",
+		"Workouts: 2 (Push, Legs)",
+	}})
+	if weekly.Title != "Good morning! Here is your week in review" {
+		t.Errorf("weekly title = %q", weekly.Title)
+	}
+	checkSections(t, weekly.Sections, want)
+
+	text := daily.Text()
+	if !strings.HasPrefix(text, daily.Title+"\n\nPending tasks:\n- One\n") || !strings.HasSuffix(text, "\n\nWorkouts:\n- Last workout was Legs on 2026-03-09 (45 min)") {
+		t.Errorf("Text() = %q", text)
+	}
+}
+
+func TestBuildDigestEmpty(t *testing.T) {
+	now := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	widgets := []models.Widget{
+		widget(models.WidgetTypeTodo, "Tasks", `{"todos":[]}`),
+		widget(models.WidgetTypeReminder, "Reminders", `{}`),
+		widget(models.WidgetTypeWellness, "Water", `{}`),
+		widget(models.WidgetTypeGym, "Gym", `{}`),
+		widget(models.WidgetTypeNote, "Notes", `{"text":"Not in the digest"}`),
+	}
+	d := BuildDigest(widgets, models.DigestDaily, Options{Language: LangPortuguese, Now: now})
+	checkSections(t, d.Sections, []DigestSection{
+		{Title: "Tarefas pendentes", Lines: []string{"Nenhuma tarefa pendente"}},
+		{Title: "Lembretes de hoje", Lines: []string{"Nenhum lembrete hoje"}},
+		{Title: "Ontem", Lines: []string{"Água: 0ml / 2.00L (0%)"}},
+		{Title: "Treinos", Lines: []string{"Nenhum treino registrado"}},
+	})
+
+	// Widgets missing from the dashboard have no section
+	if d := BuildDigest(nil, models.DigestWeekly, Options{Now: now}); len(d.Sections) != 0 {
+		t.Errorf("sections = %+v", d.Sections)
+	}
+}
+
+func checkSections(t *testing.T, got, want []DigestSection) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("sections = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Title != want[i].Title || !slices.Equal(got[i].Lines, want[i].Lines) {
+			t.Errorf("section %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package dashboard
+
+// Supported context languages.
+const (
+	LangEnglish    = "en-us"
+	LangPortuguese = "pt-br"
+)
+
+// Terms holds the translated labels used to describe a dashboard and to
+// compose its digest. Fields ending in Format are fmt format strings.
+type Terms struct {
+	Intro             string
+	TodayIs           string
+	ActiveList        string
+	TasksCompleted    string
+	PendingTasks      string
+	ArchivedTasks     string
+	WaterConsumed     string
+	Note              string
+	NoteContent       string
+	UpcomingReminders string
+	NoReminders       string
+	On                string
+	Column            string
+	GymIntro          string
+	LastWorkout       string
+	ActiveWorkout     string
+	RecentHistory     string
+	AvailableWorkouts string
+	NoExercises       string
+	LinksIntro        string
+	PomodoroIntro     string
+	PomodoroActive    string
+	PomodoroMode      string
+	PomodoroLeft      string
+	PomodoroCycles    string
+	DietIntro         string
+	CaloriesConsumed  string
+	CalorieGoal       string
+	ProteinConsumed   string
+	Truncated         string
+	SystemPrompt      string
+
+	DailyDigest          string
+	WeeklyDigest         string
+	NoPendingTasks       string
+	More                 string
+	TodaysReminders      string
+	NoRemindersToday     string
+	Yesterday            string
+	Water                string
+	Calories             string
+	Protein              string
+	Workouts             string
+	NoWorkouts           string
+	LastSevenDays        string
+	WeeklyWaterFormat    string
+	WeeklyCaloriesFormat string
+	DigestRewritePrompt  string
+}
+
+var terms = map[string]Terms{
+	LangEnglish: {
+		Intro:             "Here is the current state of the user's LifeHub dashboard",
+		TodayIs:           "Today is",
+		ActiveList:        "Current Active List",
+		TasksCompleted:    "tasks completed",
+		PendingTasks:      "Pending tasks",
+		ArchivedTasks:     "tasks archived",
+		WaterConsumed:     "Water Consumed Today",
+		Note:              "Note",
+		NoteContent:       "Note Content",
+		UpcomingReminders: "Upcoming Reminders",
+		NoReminders:       "No pending reminders",
+		On:                "on",
+		Column:            "Column",
+		GymIntro:          "Gym/Workout Stats:",
+		LastWorkout:       "Last workout was",
+		ActiveWorkout:     "User is currently doing a workout",
+		RecentHistory:     "Recent History (Last 10)",
+		AvailableWorkouts: "Available workout routines",
+		NoExercises:       "No exercises",
+		LinksIntro:        "Pinned Links:",
+		PomodoroIntro:     "Focus/Pomodoro Timer Status:",
+		PomodoroActive:    "User is currently running a focus timer",
+		PomodoroMode:      "Current mode",
+		PomodoroLeft:      "left",
+		PomodoroCycles:    "Cycles completed",
+		DietIntro:         "Diet & Nutrition Stats:",
+		CaloriesConsumed:  "Calories consumed today",
+		CalorieGoal:       "Daily Calorie Goal",
+		ProteinConsumed:   "Protein consumed",
+		Truncated:         "more lines omitted",
+		SystemPrompt:      "You are a helpful, encouraging Life Coach. Be concise (max 2 sentences unless asked otherwise). Always respond in English.",
+
+		DailyDigest:          "Good morning! Here is your day",
+		WeeklyDigest:         "Good morning! Here is your week in review",
+		NoPendingTasks:       "No pending tasks",
+		More:                 "more",
+		TodaysReminders:      "Today's reminders",
+		NoRemindersToday:     "No reminders today",
+		Yesterday:            "Yesterday",
+		Water:                "Water",
+		Calories:             "Calories",
+		Protein:              "protein",
+		Workouts:             "Workouts",
+		NoWorkouts:           "No workouts logged yet",
+		LastSevenDays:        "Last 7 days",
+		WeeklyWaterFormat:    "Water: %s per day on average, goal met on %d of 7 days",
+		WeeklyCaloriesFormat: "Calories: %s kcal per day on average (goal %s), %d days logged",
+		DigestRewritePrompt:  "You are a friendly Life Coach. Rewrite the user's dashboard summary as a short, encouraging morning message. Keep every fact and number, invent nothing. Plain text, no markdown. Always respond in English.",
+	},
+	LangPortuguese: {
+		Intro:             "Aqui está o estado atual do painel LifeHub do usuário",
+		TodayIs:           "Hoje é",
+		ActiveList:        "Lista Ativa Atual",
+		TasksCompleted:    "tarefas concluídas",
+		PendingTasks:      "Tarefas pendentes",
+		ArchivedTasks:     "tarefas arquivadas",
+		WaterConsumed:     "Água Consumida Hoje",
+		Note:              "Nota",
+		NoteContent:       "Conteúdo da Nota",
+		UpcomingReminders: "Próximos Lembretes",
+		NoReminders:       "Sem lembretes pendentes",
+		On:                "em",
+		Column:            "Coluna",
+		GymIntro:          "Estatísticas de Academia/Treino:",
+		LastWorkout:       "Último treino foi",
+		ActiveWorkout:     "Usuário está treinando agora",
+		RecentHistory:     "Histórico Recente (Últimos 10)",
+		AvailableWorkouts: "Rotinas de treino disponíveis",
+		NoExercises:       "Sem exercícios",
+		LinksIntro:        "Links Fixados:",
+		PomodoroIntro:     "Status do Temporizador Pomodoro/Foco:",
+		PomodoroActive:    "Usuário está com o temporizador rodando",
+		PomodoroMode:      "Modo atual",
+		PomodoroLeft:      "restantes",
+		PomodoroCycles:    "Ciclos completados",
+		DietIntro:         "Estatísticas de Dieta/Nutrição:",
+		CaloriesConsumed:  "Calorias consumidas hoje",
+		CalorieGoal:       "Meta diária de calorias",
+		ProteinConsumed:   "Proteína consumida",
+		Truncated:         "linhas omitidas",
+		SystemPrompt:      "Você é um Life Coach prestativo e encorajador. Seja conciso (máximo 2 frases, a menos que solicitado o contrário). Responda sempre em Português do Brasil.",
+
+		DailyDigest:          "Bom dia! Aqui está o seu dia",
+		WeeklyDigest:         "Bom dia! Aqui está o resumo da sua semana",
+		NoPendingTasks:       "Nenhuma tarefa pendente",
+		More:                 "mais",
+		TodaysReminders:      "Lembretes de hoje",
+		NoRemindersToday:     "Nenhum lembrete hoje",
+		Yesterday:            "Ontem",
+		Water:                "Água",
+		Calories:             "Calorias",
+		Protein:              "proteína",
+		Workouts:             "Treinos",
+		NoWorkouts:           "Nenhum treino registrado",
+		LastSevenDays:        "Últimos 7 dias",
+		WeeklyWaterFormat:    "Água: média de %s por dia, meta atingida em %d de 7 dias",
+		WeeklyCaloriesFormat: "Calorias: média de %s kcal por dia (meta %s), %d dias registrados",
+		DigestRewritePrompt:  "Você é um Life Coach amigável. Reescreva o resumo do painel do usuário como uma mensagem matinal curta e encorajadora. Mantenha todos os fatos e números, não invente nada. Texto simples, sem markdown. Responda sempre em Português do Brasil.",
+	},
+}
+
+// NormalizeLanguage returns a supported language, defaulting to English.
+func NormalizeLanguage(lang string) string {
+	if _, ok := terms[lang]; ok {
+		return lang
+	}
+	return LangEnglish
+}
+
+// TermsFor returns the labels of a language, defaulting to English.
+func TermsFor(lang string) Terms {
+	return terms[NormalizeLanguage(lang)]
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// InitAITables creates the AI related tables if they don't exist.
+func InitAITables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ai_keys (
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		encrypted_key TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, provider)
+	);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	// Migration: base URL of OpenAI-compatible servers. Ignore error if exists.
+	DB.Exec("ALTER TABLE ai_keys ADD COLUMN base_url TEXT DEFAULT ''")
+	return nil
+}
+
+// AIKeyInfo describes a stored provider configuration without revealing the key.
+type AIKeyInfo struct {
+	Provider  string    `json:"provider"`
+	BaseURL   string    `json:"baseUrl,omitempty"`
+	HasKey    bool      `json:"hasKey"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AIKey is a stored provider configuration. The key may be empty for local
+// servers that don't require one.
+type AIKey struct {
+	EncryptedKey string
+	BaseURL      string
+}
+
+// SaveAIKey stores the encrypted API key and base URL of a provider for a user.
+func SaveAIKey(userID int, provider string, key AIKey) error {
+	query := `
+	INSERT INTO ai_keys (user_id, provider, encrypted_key, base_url, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id, provider) DO UPDATE SET
+		encrypted_key = excluded.encrypted_key,
+		base_url = excluded.base_url,
+		updated_at = CURRENT_TIMESTAMP;`
+	if _, err := DB.Exec(query, userID, provider, key.EncryptedKey, key.BaseURL); err != nil {
+		return fmt.Errorf("failed to save AI key: %w", err)
+	}
+	return nil
+}
+
+// GetAIKey retrieves the stored configuration of a provider for a user.
+// Returns nil if none is stored.
+func GetAIKey(userID int, provider string) (*AIKey, error) {
+	var key AIKey
+	err := DB.QueryRow(`SELECT encrypted_key, COALESCE(base_url, '') FROM ai_keys WHERE user_id = ? AND provider = ?`, userID, provider).Scan(&key.EncryptedKey, &key.BaseURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get AI key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListAIKeys returns the providers a user has configured.
+func ListAIKeys(userID int) ([]AIKeyInfo, error) {
+	rows, err := DB.Query(`SELECT provider, COALESCE(base_url, ''), encrypted_key != '', updated_at FROM ai_keys WHERE user_id = ? ORDER BY provider`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query AI keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []AIKeyInfo{}
+	for rows.Next() {
+		var k AIKeyInfo
+		if err := rows.Scan(&k.Provider, &k.BaseURL, &k.HasKey, &k.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan AI key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAIKey removes the stored key of a provider for a user.
+func DeleteAIKey(userID int, provider string) error {
+	if _, err := DB.Exec(`DELETE FROM ai_keys WHERE user_id = ? AND provider = ?`, userID, provider); err != nil {
+		return fmt.Errorf("failed to delete AI key: %w", err)
+	}
+	return nil
+}
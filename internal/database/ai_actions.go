@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// InitAIActionsTable creates the table of actions proposed by the AI Coach.
+func InitAIActionsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ai_actions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		conversation_id TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		widget_id TEXT NOT NULL,
+		tool TEXT NOT NULL,
+		arguments TEXT NOT NULL,
+		summary TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_ai_actions_message ON ai_actions(message_id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+const aiActionColumns = `id, conversation_id, message_id, widget_id, tool, arguments, summary, status, error, created_at, resolved_at`
+
+func scanAIAction(scan func(dest ...any) error) (models.AIAction, error) {
+	var a models.AIAction
+	var args string
+	var resolvedAt sql.NullTime
+	err := scan(&a.ID, &a.ConversationID, &a.MessageID, &a.WidgetID, &a.Tool, &args,
+		&a.Summary, &a.Status, &a.Error, &a.CreatedAt, &resolvedAt)
+	a.Arguments = []byte(args)
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+	}
+	return a, err
+}
+
+// CreateAIAction stores a proposed action, setting its ID and status.
+func CreateAIAction(userID int, a *models.AIAction) error {
+	a.ID = uuid.NewString()
+	a.Status = models.AIActionProposed
+	a.CreatedAt = time.Now().UTC()
+	query := `
+	INSERT INTO ai_actions (id, user_id, conversation_id, message_id, widget_id, tool, arguments, summary, status, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := DB.Exec(query, a.ID, userID, a.ConversationID, a.MessageID, a.WidgetID, a.Tool,
+		string(a.Arguments), a.Summary, a.Status, sqlTime(a.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create AI action: %w", err)
+	}
+	return nil
+}
+
+// GetAIAction retrieves an action of the user. Returns nil if it doesn't exist.
+func GetAIAction(userID int, id string) (*models.AIAction, error) {
+	query := `SELECT ` + aiActionColumns + ` FROM ai_actions WHERE id = ? AND user_id = ?`
+	a, err := scanAIAction(DB.QueryRow(query, id, userID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan AI action: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAIActionsByMessage returns the actions proposed in the given messages,
+// grouped by message ID.
+func GetAIActionsByMessage(messageIDs []int64) (map[int64][]models.AIAction, error) {
+	actions := map[int64][]models.AIAction{}
+	if len(messageIDs) == 0 {
+		return actions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messageIDs)), ",")
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	query := `SELECT ` + aiActionColumns + ` FROM ai_actions WHERE message_id IN (` + placeholders + `) ORDER BY rowid`
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query AI actions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAIAction(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan AI action: %w", err)
+		}
+		actions[a.MessageID] = append(actions[a.MessageID], a)
+	}
+	return actions, rows.Err()
+}
+
+// ClaimAIAction moves a proposed action to the given status. It returns
+// false if the action was already resolved, so that it is applied only once
+// even if the user confirms twice.
+func ClaimAIAction(userID int, id, status string) (bool, error) {
+	query := `UPDATE ai_actions SET status = ?, resolved_at = ? WHERE id = ? AND user_id = ? AND status = ?`
+	res, err := DB.Exec(query, status, sqlTime(time.Now()), id, userID, models.AIActionProposed)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim AI action: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// FinishAIAction records the outcome of an action being applied.
+func FinishAIAction(id, status, errMsg string) error {
+	query := `UPDATE ai_actions SET status = ?, error = ?, resolved_at = ? WHERE id = ?`
+	if _, err := DB.Exec(query, status, errMsg, sqlTime(time.Now()), id); err != nil {
+		return fmt.Errorf("failed to update AI action: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/google/uuid"
+)
+
+// InitAIConversationTables creates the AI chat history tables if they don't exist.
+func InitAIConversationTables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS ai_conversations (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		widget_id TEXT DEFAULT '',
+		title TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_ai_conversations_user ON ai_conversations(user_id, updated_at);
+
+	CREATE TABLE IF NOT EXISTS ai_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL,
+		provider TEXT DEFAULT '',
+		model TEXT DEFAULT '',
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cost_usd REAL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_ai_messages_conversation ON ai_messages(conversation_id, id);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+	return migrateWidgetChatHistories()
+}
+
+// ConversationTitle derives a title from the first question of a conversation.
+func ConversationTitle(text string) string {
+	title := strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(title) > 60 {
+		title = string([]rune(title)[:60]) + "..."
+	}
+	return title
+}
+
+const conversationColumns = `
+	c.id, c.widget_id, c.title, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM ai_messages m WHERE m.conversation_id = c.id),
+	(SELECT COALESCE(SUM(input_tokens), 0) FROM ai_messages m WHERE m.conversation_id = c.id),
+	(SELECT COALESCE(SUM(output_tokens), 0) FROM ai_messages m WHERE m.conversation_id = c.id),
+	(SELECT COALESCE(SUM(cost_usd), 0) FROM ai_messages m WHERE m.conversation_id = c.id)`
+
+func scanConversation(scan func(dest ...any) error) (models.AIConversation, error) {
+	var c models.AIConversation
+	err := scan(&c.ID, &c.WidgetID, &c.Title, &c.CreatedAt, &c.UpdatedAt,
+		&c.MessageCount, &c.InputTokens, &c.OutputTokens, &c.CostUSD)
+	return c, err
+}
+
+// CreateAIConversation starts a new conversation, optionally attached to an
+// AI_ASSISTANT widget.
+func CreateAIConversation(userID int, widgetID, title string) (*models.AIConversation, error) {
+	id := uuid.NewString()
+	query := `INSERT INTO ai_conversations (id, user_id, widget_id, title) VALUES (?, ?, ?, ?)`
+	if _, err := DB.Exec(query, id, userID, widgetID, title); err != nil {
+		return nil, fmt.Errorf("failed to create AI conversation: %w", err)
+	}
+	return GetAIConversation(userID, id)
+}
+
+// GetAIConversation retrieves a conversation of the user with its totals.
+// Returns nil if it doesn't exist.
+func GetAIConversation(userID int, id string) (*models.AIConversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM ai_conversations c WHERE c.id = ? AND c.user_id = ?`
+	c, err := scanConversation(DB.QueryRow(query, id, userID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan AI conversation: %w", err)
+	}
+	return &c, nil
+}
+
+// ListAIConversations returns the user's conversations, most recent first.
+func ListAIConversations(userID int) ([]models.AIConversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM ai_conversations c WHERE c.user_id = ? ORDER BY c.updated_at DESC, c.created_at DESC`
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query AI conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.AIConversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan AI conversation: %w", err)
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// RenameAIConversation changes the title of a conversation.
+func RenameAIConversation(userID int, id, title string) error {
+	query := `UPDATE ai_conversations SET title = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`
+	if _, err := DB.Exec(query, title, id, userID); err != nil {
+		return fmt.Errorf("failed to rename AI conversation: %w", err)
+	}
+	return nil
+}
+
+// DeleteAIConversation removes a conversation, its messages and the actions
+// they proposed.
+func DeleteAIConversation(userID int, id string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM ai_conversations WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete AI conversation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`DELETE FROM ai_messages WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete AI messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM ai_actions WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete AI actions: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ClearAIMessages removes every message of a conversation and the actions
+// they proposed, keeping the conversation. Callers must check the
+// conversation belongs to the user.
+func ClearAIMessages(conversationID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM ai_messages WHERE conversation_id = ?`, conversationID); err != nil {
+		return fmt.Errorf("failed to clear AI messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM ai_actions WHERE conversation_id = ?`, conversationID); err != nil {
+		return fmt.Errorf("failed to clear AI actions: %w", err)
+	}
+	return tx.Commit()
+}
+
+// AddAIMessage appends a message to a conversation, setting its ID.
+// Callers must check the conversation belongs to the user.
+func AddAIMessage(m *models.AIMessage) error {
+	query := `
+	INSERT INTO ai_messages (conversation_id, role, content, provider, model, input_tokens, output_tokens, cost_usd)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := DB.Exec(query, m.ConversationID, m.Role, m.Text, m.Provider, m.Model, m.InputTokens, m.OutputTokens, m.CostUSD)
+	if err != nil {
+		return fmt.Errorf("failed to add AI message: %w", err)
+	}
+	if m.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get AI message id: %w", err)
+	}
+	DB.Exec(`UPDATE ai_conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, m.ConversationID)
+	return nil
+}
+
+// GetAIMessages returns up to limit messages older than the message ID
+// before (0 for the latest), in chronological order, and whether older
+// messages remain.
+func GetAIMessages(conversationID string, before int64, limit int) ([]models.AIMessage, bool, error) {
+	query := `
+	SELECT id, conversation_id, role, content, provider, model, input_tokens, output_tokens, cost_usd, created_at
+	FROM ai_messages
+	WHERE conversation_id = ? AND (? = 0 OR id < ?)
+	ORDER BY id DESC
+	LIMIT ?`
+	rows, err := DB.Query(query, conversationID, before, before, limit+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query AI messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.AIMessage{}
+	for rows.Next() {
+		var m models.AIMessage
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Text, &m.Provider, &m.Model,
+			&m.InputTokens, &m.OutputTokens, &m.CostUSD, &m.CreatedAt); err != nil {
+			return nil, false, fmt.Errorf("failed to scan AI message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	// Newest first -> chronological
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, hasMore, nil
+}
+
+// migrateWidgetChatHistories moves the chatHistory array that used to be
+// stored in AI_ASSISTANT widget content into a conversation, leaving a
+// conversationId reference in the widget.
+func migrateWidgetChatHistories() error {
+	rows, err := DB.Query(`SELECT id, user_id, content FROM widgets WHERE type = ? AND content LIKE '%"chatHistory"%'`, models.WidgetTypeAIAssistant)
+	if err != nil {
+		return fmt.Errorf("failed to query AI widgets: %w", err)
+	}
+	type pending struct {
+		id      string
+		userID  int
+		content string
+	}
+	var widgets []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan AI widget: %w", err)
+		}
+		widgets = append(widgets, p)
+	}
+	rows.Close()
+
+	for _, w := range widgets {
+		if err := migrateWidgetChatHistory(w.id, w.userID, w.content); err != nil {
+			log.Printf("Failed to migrate chat history of widget %s: %v\n", w.id, err)
+		}
+	}
+	return nil
+}
+
+func migrateWidgetChatHistory(widgetID string, userID int, content string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return err
+	}
+	var history []struct {
+		Role string `json:"role"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(fields["chatHistory"], &history)
+	delete(fields, "chatHistory")
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(history) > 0 && fields["conversationId"] == nil {
+		title := ""
+		for _, m := range history {
+			if m.Role == models.AIRoleUser {
+				title = ConversationTitle(m.Text)
+				break
+			}
+		}
+		id := uuid.NewString()
+		query := `INSERT INTO ai_conversations (id, user_id, widget_id, title) VALUES (?, ?, ?, ?)`
+		if _, err := tx.Exec(query, id, userID, widgetID, title); err != nil {
+			return fmt.Errorf("failed to create AI conversation: %w", err)
+		}
+		for _, m := range history {
+			role := models.AIRoleUser
+			if m.Role == models.AIRoleModel {
+				role = models.AIRoleModel
+			}
+			if _, err := tx.Exec(`INSERT INTO ai_messages (conversation_id, role, content) VALUES (?, ?, ?)`, id, role, m.Text); err != nil {
+				return fmt.Errorf("failed to add AI message: %w", err)
+			}
+		}
+		fields["conversationId"], _ = json.Marshal(id)
+	}
+
+	updated, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	// Bump the version so that clients holding the old content reload it
+	// rather than saving the history back
+	query := `
+	UPDATE widgets SET content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND content = ?`
+	if _, err := tx.Exec(query, string(updated), widgetID, content); err != nil {
+		return fmt.Errorf("failed to update widget: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitAPITokensTable creates the api_tokens table if it doesn't exist.
+func InitAPITokensTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE, -- SHA-256, hex
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// GetAPITokens retrieves the API tokens of a user.
+func GetAPITokens(userID int) ([]models.APIToken, error) {
+	rows, err := DB.Query(`SELECT id, name, created_at, last_used_at FROM api_tokens WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var t models.APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// CreateAPIToken stores the hash of a new token and returns its ID.
+func CreateAPIToken(userID int, name, tokenHash string) (int, error) {
+	result, err := DB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash) VALUES (?, ?, ?)`, userID, name, tokenHash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create api token: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create api token: %w", err)
+	}
+	return int(id), nil
+}
+
+// UseAPIToken returns the user owning a token hash, 0 if none does, and
+// records the use of the token.
+func UseAPIToken(tokenHash string, now time.Time) (int, error) {
+	var id, userID int
+	err := DB.QueryRow(`SELECT id, user_id FROM api_tokens WHERE token_hash = ?`, tokenHash).Scan(&id, &userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get api token: %w", err)
+	}
+	if _, err := DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, sqlTime(now), id); err != nil {
+		return 0, fmt.Errorf("failed to update api token: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteAPIToken revokes a token, ensuring it belongs to the user.
+func DeleteAPIToken(userID, id int) error {
+	result, err := DB.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api token: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("api token not found or access denied")
+	}
+	return nil
+}
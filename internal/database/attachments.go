@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitAttachmentsTable creates the attachments table if it doesn't exist.
+func InitAttachmentsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_user ON attachments(user_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// ErrQuotaExceeded is returned when an attachment doesn't fit in the
+// storage quota of its owner.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// CreateAttachment stores the metadata of an uploaded file, unless the
+// uploads of the user would then take more than quota bytes.
+// The usage is checked by the insert itself, so concurrent uploads can't
+// exceed the quota together.
+func CreateAttachment(a models.Attachment, quota int64) error {
+	query := `
+	INSERT INTO attachments (id, user_id, hash, filename, mime_type, size)
+	SELECT ?, ?, ?, ?, ?, ?
+	WHERE (SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = ?) + ? <= ?`
+	result, err := DB.Exec(query, a.ID, a.UserID, a.Hash, a.Filename, a.MimeType, a.Size, a.UserID, a.Size, quota)
+	if err != nil {
+		return fmt.Errorf("failed to save attachment: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// DeleteAttachment removes the metadata of an attachment, e.g. when its
+// blob couldn't be stored.
+func DeleteAttachment(id string) error {
+	if _, err := DB.Exec(`DELETE FROM attachments WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return nil
+}
+
+// GetAttachment retrieves attachment metadata by ID.
+// Returns nil if not found.
+func GetAttachment(id string) (*models.Attachment, error) {
+	query := `SELECT id, user_id, hash, filename, mime_type, size, created_at FROM attachments WHERE id = ?`
+	var a models.Attachment
+	err := DB.QueryRow(query, id).Scan(&a.ID, &a.UserID, &a.Hash, &a.Filename, &a.MimeType, &a.Size, &a.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// IsAttachmentPublic reports whether the attachment is referenced by a public
+// wiki page of its owner, in which case it may be served without auth.
+func IsAttachmentPublic(a *models.Attachment) (bool, error) {
+	query := `SELECT content FROM widgets WHERE type = 'WIKI' AND is_active = 1 AND user_id = ? AND content LIKE ?`
+	rows, err := DB.Query(query, a.UserID, "%"+a.ID+"%")
+	if err != nil {
+		return false, fmt.Errorf("failed to query widgets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contentStr string
+		if err := rows.Scan(&contentStr); err != nil {
+			continue
+		}
+
+		var wrapper models.WidgetContentWrapper
+		if err := json.Unmarshal([]byte(contentStr), &wrapper); err != nil || wrapper.Wiki == nil {
+			continue
+		}
+
+		for _, page := range wrapper.Wiki.Pages {
+			if page.IsPublic && strings.Contains(page.Content, a.ID) {
+				return true, nil
+			}
+		}
+	}
+	return false, rows.Err()
+}
+
+// IsAttachmentShared reports whether the attachment is referenced by a
+// widget both its owner and the user have access to, e.g. an image uploaded
+// to a shared wiki by one of its editors.
+func IsAttachmentShared(a *models.Attachment, userID int) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM widgets w
+		WHERE w.is_active = 1 AND w.content LIKE ?
+		AND (w.user_id = ? OR EXISTS (SELECT 1 FROM widget_shares s WHERE s.widget_id = w.id AND s.user_id = ?))
+		AND (w.user_id = ? OR EXISTS (SELECT 1 FROM widget_shares s WHERE s.widget_id = w.id AND s.user_id = ?))
+	)`
+	var shared bool
+	err := DB.QueryRow(query, "%"+a.ID+"%", a.UserID, a.UserID, userID, userID).Scan(&shared)
+	if err != nil {
+		return false, fmt.Errorf("failed to query widgets: %w", err)
+	}
+	return shared, nil
+}
+
+// GetOrphanAttachments returns attachments created before the given time that
+// are not referenced by the content of any widget, whoever it belongs to:
+// a link copied to another user's widget keeps the attachment.
+// Soft deleted widgets still count as references so restoring them keeps
+// their images.
+func GetOrphanAttachments(createdBefore time.Time) ([]models.Attachment, error) {
+	query := `
+	SELECT a.id, a.user_id, a.hash, a.filename, a.mime_type, a.size, a.created_at
+	FROM attachments a
+	WHERE a.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM widgets w WHERE w.content LIKE '%' || a.id || '%')`
+	rows, err := DB.Query(query, sqlTime(createdBefore))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orphan attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Hash, &a.Filename, &a.MimeType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteOrphanAttachment removes an attachment returned by
+// GetOrphanAttachments, unless a widget referenced it since. Reports whether
+// the attachment was removed; its blob is left to the caller, see
+// IsAttachmentHashUsed.
+func DeleteOrphanAttachment(id string) (bool, error) {
+	query := `
+	DELETE FROM attachments
+	WHERE id = ? AND NOT EXISTS (SELECT 1 FROM widgets w WHERE w.content LIKE '%' || attachments.id || '%')`
+	result, err := DB.Exec(query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// IsAttachmentHashUsed reports whether an attachment points to the blob with
+// the given hash.
+func IsAttachmentHashUsed(hash string) (bool, error) {
+	var used bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM attachments WHERE hash = ?)`, hash).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	return used, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitAuditLogTable creates the audit log table if it doesn't exist.
+func InitAuditLogTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		widget_id TEXT DEFAULT '',
+		details TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(user_id, id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// AddAuditEntry records an action. Details are stored as JSON.
+func AddAuditEntry(userID int, action, widgetID string, details any) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO audit_log (user_id, action, widget_id, details) VALUES (?, ?, ?, ?)`
+	if _, err := DB.Exec(query, userID, action, widgetID, string(detailsJSON)); err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the latest entries of the user, most recent first.
+func GetAuditLog(userID, limit int) ([]models.AuditEntry, error) {
+	query := `SELECT id, action, widget_id, details, created_at FROM audit_log WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := DB.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var details string
+		if err := rows.Scan(&e.ID, &e.Action, &e.WidgetID, &details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if details != "" {
+			e.Details = json.RawMessage(details)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
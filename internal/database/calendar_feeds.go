@@ -0,0 +1,108 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// InitCalendarFeedsTable creates the calendar_feeds table if it doesn't exist.
+// Each user has at most one feed, identified by a secret token. Only the
+// SHA-256 hash of the token is stored, so the feed URLs can't be recovered
+// from the database.
+func InitCalendarFeedsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		user_id INTEGER PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+	return hashCalendarFeedTokens()
+}
+
+// hashCalendarFeedTokens migrates feeds created when the tokens were stored
+// in clear. Their URLs keep working.
+func hashCalendarFeedTokens() error {
+	rows, err := DB.Query(`SELECT user_id, token FROM calendar_feeds`)
+	if err != nil {
+		return nil // Already migrated: no token column
+	}
+	tokens := make(map[int]string)
+	for rows.Next() {
+		var userID int
+		var token string
+		if err := rows.Scan(&userID, &token); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan calendar feed: %w", err)
+		}
+		tokens[userID] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for userID, token := range tokens {
+		if _, err := tx.Exec(`UPDATE calendar_feeds SET token = ? WHERE user_id = ?`, hashCalendarFeedToken(token), userID); err != nil {
+			return fmt.Errorf("failed to hash calendar feed token: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`ALTER TABLE calendar_feeds RENAME COLUMN token TO token_hash`); err != nil {
+		return fmt.Errorf("failed to migrate calendar feeds: %w", err)
+	}
+	return tx.Commit()
+}
+
+func hashCalendarFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasCalendarFeed reports whether the feed of a user is enabled.
+func HasCalendarFeed(userID int) (bool, error) {
+	var enabled bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM calendar_feeds WHERE user_id = ?)`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+	return enabled, nil
+}
+
+// SetCalendarFeedToken replaces the feed token of a user, invalidating the
+// previous feed URL.
+func SetCalendarFeedToken(userID int, token string) error {
+	query := `
+	INSERT INTO calendar_feeds (user_id, token_hash) VALUES (?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = CURRENT_TIMESTAMP`
+	if _, err := DB.Exec(query, userID, hashCalendarFeedToken(token)); err != nil {
+		return fmt.Errorf("failed to set calendar feed token: %w", err)
+	}
+	return nil
+}
+
+// DeleteCalendarFeedToken disables the feed of a user.
+func DeleteCalendarFeedToken(userID int) error {
+	if _, err := DB.Exec(`DELETE FROM calendar_feeds WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete calendar feed token: %w", err)
+	}
+	return nil
+}
+
+// GetCalendarFeedUser returns the user owning a feed token, 0 if none does.
+func GetCalendarFeedUser(token string) (int, error) {
+	var userID int
+	err := DB.QueryRow(`SELECT user_id FROM calendar_feeds WHERE token_hash = ?`, hashCalendarFeedToken(token)).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+	return userID, nil
+}
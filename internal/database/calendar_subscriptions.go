@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitCalendarSubscriptionsTable creates the calendar_subscriptions table if
+// it doesn't exist.
+func InitCalendarSubscriptionsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS calendar_subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		widget_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		last_synced_at DATETIME,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_calendar_subscriptions_user ON calendar_subscriptions(user_id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+const calendarSubscriptionColumns = `id, widget_id, url, last_synced_at, last_error, created_at`
+
+func scanCalendarSubscription(scan func(dest ...any) error) (models.CalendarSubscription, error) {
+	var sub models.CalendarSubscription
+	var lastSynced sql.NullTime
+	if err := scan(&sub.ID, &sub.WidgetID, &sub.URL, &lastSynced, &sub.LastError, &sub.CreatedAt); err != nil {
+		return sub, err
+	}
+	if lastSynced.Valid {
+		sub.LastSyncedAt = &lastSynced.Time
+	}
+	return sub, nil
+}
+
+// GetCalendarSubscriptions retrieves the calendar subscriptions of a user.
+func GetCalendarSubscriptions(userID int) ([]models.CalendarSubscription, error) {
+	rows, err := DB.Query(`SELECT `+calendarSubscriptionColumns+` FROM calendar_subscriptions WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calendar subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.CalendarSubscription
+	for rows.Next() {
+		sub, err := scanCalendarSubscription(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan calendar subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// GetCalendarSubscription retrieves a subscription, ensuring it belongs to
+// the user. Returns nil if not found.
+func GetCalendarSubscription(userID, id int) (*models.CalendarSubscription, error) {
+	query := `SELECT ` + calendarSubscriptionColumns + ` FROM calendar_subscriptions WHERE id = ? AND user_id = ?`
+	sub, err := scanCalendarSubscription(DB.QueryRow(query, id, userID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan calendar subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// DueCalendarSubscription is a subscription to sync, with its owner.
+type DueCalendarSubscription struct {
+	UserID int
+	models.CalendarSubscription
+}
+
+// GetDueCalendarSubscriptions returns the subscriptions of all users not
+// synced since before.
+func GetDueCalendarSubscriptions(before time.Time) ([]DueCalendarSubscription, error) {
+	query := `SELECT user_id, ` + calendarSubscriptionColumns + ` FROM calendar_subscriptions
+	WHERE last_synced_at IS NULL OR last_synced_at < ? ORDER BY id`
+	rows, err := DB.Query(query, sqlTime(before))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calendar subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []DueCalendarSubscription
+	for rows.Next() {
+		var due DueCalendarSubscription
+		due.CalendarSubscription, err = scanCalendarSubscription(func(dest ...any) error {
+			return rows.Scan(append([]any{&due.UserID}, dest...)...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan calendar subscription: %w", err)
+		}
+		subs = append(subs, due)
+	}
+	return subs, rows.Err()
+}
+
+// CreateCalendarSubscription stores a new subscription and returns its ID.
+func CreateCalendarSubscription(userID int, widgetID, url string) (int, error) {
+	result, err := DB.Exec(`INSERT INTO calendar_subscriptions (user_id, widget_id, url) VALUES (?, ?, ?)`, userID, widgetID, url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create calendar subscription: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create calendar subscription: %w", err)
+	}
+	return int(id), nil
+}
+
+// SetCalendarSubscriptionSynced records the outcome of a sync. syncErr is
+// empty on success.
+func SetCalendarSubscriptionSynced(id int, syncedAt time.Time, syncErr string) error {
+	_, err := DB.Exec(`UPDATE calendar_subscriptions SET last_synced_at = ?, last_error = ? WHERE id = ?`, sqlTime(syncedAt), syncErr, id)
+	if err != nil {
+		return fmt.Errorf("failed to update calendar subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteCalendarSubscription removes a subscription, ensuring it belongs to
+// the user.
+func DeleteCalendarSubscription(userID, id int) error {
+	result, err := DB.Exec(`DELETE FROM calendar_subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete calendar subscription: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("calendar subscription not found or access denied")
+	}
+	return nil
+}
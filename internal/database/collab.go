@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitCollabTables creates the tables of the collaborative documents: their
+// compacted state, and the updates received since.
+func InitCollabTables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS collab_documents (
+		id TEXT PRIMARY KEY,
+		widget_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		text TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS collab_updates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id TEXT NOT NULL,
+		ops TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_collab_updates_document ON collab_updates(document_id, id);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+	DB.Exec(`ALTER TABLE collab_updates ADD COLUMN text TEXT`)
+	return nil
+}
+
+// GetCollabDocument returns the compacted state of a document, nil if none.
+func GetCollabDocument(id string) (*models.CollabDocument, error) {
+	query := `SELECT id, widget_id, state, text, updated_at FROM collab_documents WHERE id = ?`
+	var doc models.CollabDocument
+	var state string
+	err := DB.QueryRow(query, id).Scan(&doc.ID, &doc.WidgetID, &state, &doc.Text, &doc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collab document: %w", err)
+	}
+	doc.State = json.RawMessage(state)
+	return &doc, nil
+}
+
+// GetCollabUpdates returns the updates of a document not compacted yet,
+// oldest first.
+func GetCollabUpdates(documentID string) ([]models.CollabUpdate, error) {
+	rows, err := DB.Query(`SELECT id, ops, text FROM collab_updates WHERE document_id = ? ORDER BY id`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collab updates: %w", err)
+	}
+	defer rows.Close()
+
+	var updates []models.CollabUpdate
+	for rows.Next() {
+		var u models.CollabUpdate
+		var ops string
+		var text sql.NullString
+		if err := rows.Scan(&u.ID, &ops, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan collab update: %w", err)
+		}
+		u.Ops = json.RawMessage(ops)
+		if text.Valid {
+			u.Text = &text.String
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+// AddCollabUpdate stores an update of a document, with the text it merges
+// if any. Returns its ID.
+func AddCollabUpdate(documentID string, ops json.RawMessage, text *string) (int64, error) {
+	result, err := DB.Exec(`INSERT INTO collab_updates (document_id, ops, text) VALUES (?, ?, ?)`, documentID, string(ops), text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add collab update: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// SaveCollabDocument stores the compacted state of a document and drops the
+// updates it includes, up to the update ID upTo.
+func SaveCollabDocument(doc models.CollabDocument, upTo int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save collab document: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO collab_documents (id, widget_id, state, text, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(id) DO UPDATE SET
+		state = excluded.state,
+		text = excluded.text,
+		updated_at = CURRENT_TIMESTAMP`
+	if _, err := tx.Exec(query, doc.ID, doc.WidgetID, string(doc.State), doc.Text); err != nil {
+		return fmt.Errorf("failed to save collab document: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM collab_updates WHERE document_id = ? AND id <= ?`, doc.ID, upTo); err != nil {
+		return fmt.Errorf("failed to delete collab updates: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetPendingCollabDocuments returns the IDs of the documents with updates
+// not compacted yet.
+func GetPendingCollabDocuments() ([]string, error) {
+	rows, err := DB.Query(`SELECT DISTINCT document_id FROM collab_updates`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collab updates: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan collab update: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
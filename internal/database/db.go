@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gabrielhirakawa/lifehub/internal/config"
 	_ "modernc.org/sqlite" // Import the SQLite driver
@@ -23,7 +24,9 @@ func InitDB() error {
 
 	dbPath := filepath.Join(dataDir, "lifehub.db")
 	var err error
-	DB, err = sql.Open("sqlite", dbPath)
+	// Background jobs write concurrently with requests: wait for locks
+	// instead of failing with SQLITE_BUSY
+	DB, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -46,6 +49,90 @@ func InitDB() error {
 		return fmt.Errorf("failed to create push table: %w", err)
 	}
 
+	if err := InitAttachmentsTable(); err != nil {
+		return fmt.Errorf("failed to create attachments table: %w", err)
+	}
+
+	if err := InitSettingsTable(); err != nil {
+		return fmt.Errorf("failed to create settings table: %w", err)
+	}
+
+	if err := InitNotificationLogTable(); err != nil {
+		return fmt.Errorf("failed to create notification log table: %w", err)
+	}
+
+	if err := InitNotificationSettingsTable(); err != nil {
+		return fmt.Errorf("failed to create notification settings table: %w", err)
+	}
+
+	if err := InitDigestSettingsTable(); err != nil {
+		return fmt.Errorf("failed to create digest settings table: %w", err)
+	}
+
+	if err := InitDeferredPushTable(); err != nil {
+		return fmt.Errorf("failed to create deferred push table: %w", err)
+	}
+
+	if err := InitPushRetryTable(); err != nil {
+		return fmt.Errorf("failed to create push retry table: %w", err)
+	}
+
+	if err := InitNotificationChannelsTable(); err != nil {
+		return fmt.Errorf("failed to create notification channels table: %w", err)
+	}
+
+	if err := InitAITables(); err != nil {
+		return fmt.Errorf("failed to create AI tables: %w", err)
+	}
+
+	if err := InitAIConversationTables(); err != nil {
+		return fmt.Errorf("failed to create AI conversation tables: %w", err)
+	}
+
+	if err := InitAIActionsTable(); err != nil {
+		return fmt.Errorf("failed to create AI actions table: %w", err)
+	}
+
+	if err := InitAuditLogTable(); err != nil {
+		return fmt.Errorf("failed to create audit log table: %w", err)
+	}
+
+	if err := InitCalendarFeedsTable(); err != nil {
+		return fmt.Errorf("failed to create calendar feeds table: %w", err)
+	}
+
+	if err := InitCalendarSubscriptionsTable(); err != nil {
+		return fmt.Errorf("failed to create calendar subscriptions table: %w", err)
+	}
+
+	if err := InitAPITokensTable(); err != nil {
+		return fmt.Errorf("failed to create api tokens table: %w", err)
+	}
+
+	if err := InitKanbanEventsTable(); err != nil {
+		return fmt.Errorf("failed to create kanban events table: %w", err)
+	}
+
+	if err := InitWidgetSharesTable(); err != nil {
+		return fmt.Errorf("failed to create widget shares table: %w", err)
+	}
+
+	if err := InitWidgetChangesTable(); err != nil {
+		return fmt.Errorf("failed to create widget changes table: %w", err)
+	}
+
+	if err := InitCollabTables(); err != nil {
+		return fmt.Errorf("failed to create collab tables: %w", err)
+	}
+
+	if err := InitIndexTables(); err != nil {
+		return fmt.Errorf("failed to create index tables: %w", err)
+	}
+
+	if err := InitTodoRolloversTable(); err != nil {
+		return fmt.Errorf("failed to create todo rollovers table: %w", err)
+	}
+
 	return nil
 }
 
@@ -60,6 +147,7 @@ func createTables() error {
 		position INTEGER DEFAULT 0,
 		is_active BOOLEAN DEFAULT 1,
 		content TEXT, -- JSON content
+		version INTEGER NOT NULL DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -73,6 +161,14 @@ func createTables() error {
 	// Migration: Add user_id column if it doesn't exist (for existing DBs)
 	// SQLite doesn't support IF NOT EXISTS in ADD COLUMN, so we ignore error
 	DB.Exec(`ALTER TABLE widgets ADD COLUMN user_id INTEGER`)
+	// Migration: Add version column, incremented on every write
+	DB.Exec(`ALTER TABLE widgets ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
 
 	return nil
 }
+
+// sqlTime formats a time like SQLite's CURRENT_TIMESTAMP (UTC), so values we
+// bind compare correctly against columns filled by the database.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
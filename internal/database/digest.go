@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitDigestSettingsTable creates the digest_settings table if it doesn't exist.
+func InitDigestSettingsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS digest_settings (
+		user_id INTEGER PRIMARY KEY,
+		daily BOOLEAN NOT NULL DEFAULT 0,
+		weekly BOOLEAN NOT NULL DEFAULT 0,
+		time TEXT NOT NULL DEFAULT '07:00',
+		weekly_day TEXT NOT NULL DEFAULT 'monday',
+		language TEXT NOT NULL DEFAULT 'en-us',
+		ai_provider TEXT NOT NULL DEFAULT '',
+		ai_model TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+const digestSettingsColumns = `daily, weekly, time, weekly_day, language, ai_provider, ai_model`
+
+func scanDigestSettings(scan func(dest ...any) error, s *models.DigestSettings) error {
+	return scan(&s.Daily, &s.Weekly, &s.Time, &s.WeeklyDay, &s.Language, &s.AIProvider, &s.AIModel)
+}
+
+// GetDigestSettings retrieves the digest settings of a user, falling back to defaults.
+func GetDigestSettings(userID int) (models.DigestSettings, error) {
+	s := models.DefaultDigestSettings()
+	query := `SELECT ` + digestSettingsColumns + ` FROM digest_settings WHERE user_id = ?`
+	err := scanDigestSettings(DB.QueryRow(query, userID).Scan, &s)
+	if err != nil && err != sql.ErrNoRows {
+		return s, fmt.Errorf("failed to get digest settings: %w", err)
+	}
+	return s, nil
+}
+
+// SaveDigestSettings inserts or updates the digest settings of a user.
+func SaveDigestSettings(userID int, s models.DigestSettings) error {
+	query := `
+	INSERT INTO digest_settings (user_id, daily, weekly, time, weekly_day, language, ai_provider, ai_model, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET
+		daily = excluded.daily,
+		weekly = excluded.weekly,
+		time = excluded.time,
+		weekly_day = excluded.weekly_day,
+		language = excluded.language,
+		ai_provider = excluded.ai_provider,
+		ai_model = excluded.ai_model,
+		updated_at = CURRENT_TIMESTAMP;`
+	_, err := DB.Exec(query, userID, s.Daily, s.Weekly, s.Time, s.WeeklyDay, s.Language, s.AIProvider, s.AIModel)
+	if err != nil {
+		return fmt.Errorf("failed to save digest settings: %w", err)
+	}
+	return nil
+}
+
+// GetDigestSubscribers returns the settings of the users who enabled a
+// digest, keyed by user ID. Used by the digest scheduler.
+func GetDigestSubscribers() (map[int]models.DigestSettings, error) {
+	query := `SELECT user_id, ` + digestSettingsColumns + ` FROM digest_settings WHERE daily = 1 OR weekly = 1`
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest settings: %w", err)
+	}
+	defer rows.Close()
+
+	subscribers := make(map[int]models.DigestSettings)
+	for rows.Next() {
+		var userID int
+		var s models.DigestSettings
+		err := scanDigestSettings(func(dest ...any) error {
+			return rows.Scan(append([]any{&userID}, dest...)...)
+		}, &s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan digest settings: %w", err)
+		}
+		subscribers[userID] = s
+	}
+	return subscribers, rows.Err()
+}
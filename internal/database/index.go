@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+	"github.com/gabrielhirakawa/lifehub/internal/tags"
+)
+
+// InitIndexTables creates the tables derived from the items of the active
+// widgets, with the owner of the widget:
+//   - search_index, the full-text index; updated is the last time the text
+//     of the item changed
+//   - tags, the tags of the items, with the title shown for the item
+//
+// Existing widgets are indexed when one of them is created.
+func InitIndexTables() error {
+	var existing int
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE name IN ('search_index', 'tags')`
+	if err := DB.QueryRow(query).Scan(&existing); err != nil {
+		return err
+	}
+	query = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+		title,
+		body,
+		widget_id UNINDEXED,
+		item_id UNINDEXED,
+		user_id UNINDEXED,
+		widget_type UNINDEXED,
+		updated UNINDEXED,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	CREATE TABLE IF NOT EXISTS tags (
+		tag TEXT NOT NULL,
+		widget_id TEXT NOT NULL,
+		item_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		widget_type TEXT NOT NULL,
+		title TEXT NOT NULL,
+		PRIMARY KEY (tag, widget_id, item_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_tags_widget ON tags(widget_id);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+	if existing == 2 {
+		return nil
+	}
+
+	rows, err := DB.Query(`SELECT id FROM widgets WHERE is_active = 1`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if err := IndexWidget(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexItem is the searchable text and the tags of an item of a widget.
+type indexItem struct {
+	ID    string
+	Title string
+	Body  string
+	Tags  []string
+}
+
+// label is how the item is shown in tag listings: its title, else the start
+// of its text.
+func (item indexItem) label() string {
+	if item.Title != "" {
+		return item.Title
+	}
+	label, _, _ := strings.Cut(strings.TrimSpace(item.Body), "\n")
+	if r := []rune(label); len(r) > 100 {
+		label = string(r[:100]) + "…"
+	}
+	return label
+}
+
+// indexItems extracts the items of a widget: note tabs, wiki pages, todos,
+// reminders, links and Kanban cards.
+func indexItems(widgetType models.WidgetType, content json.RawMessage) []indexItem {
+	var c models.WidgetContentWrapper
+	if len(content) == 0 || json.Unmarshal(content, &c) != nil {
+		return nil
+	}
+
+	var items []indexItem
+	switch widgetType {
+	case models.WidgetTypeNote:
+		if c.Text != "" {
+			items = append(items, indexItem{Body: c.Text, Tags: tags.Parse(c.Text)})
+		}
+		for _, tab := range c.Notes {
+			items = append(items, indexItem{ID: tab.ID, Title: tab.Title, Body: tab.Content, Tags: tags.Merge(tab.Tags, tab.Title, tab.Content)})
+		}
+	case models.WidgetTypeWiki:
+		if c.Wiki != nil {
+			for _, page := range c.Wiki.Pages {
+				items = append(items, indexItem{ID: page.ID, Title: page.Title, Body: page.Content, Tags: tags.Merge(page.Tags, page.Title, page.Content)})
+			}
+		}
+	case models.WidgetTypeTodo:
+		for _, todo := range c.Todos {
+			items = append(items, indexItem{ID: todo.ID, Body: todo.Text, Tags: tags.Merge(todo.Tags, todo.Text)})
+		}
+	case models.WidgetTypeReminder:
+		for _, reminder := range c.Reminders {
+			items = append(items, indexItem{ID: reminder.ID, Body: reminder.Text, Tags: tags.Merge(reminder.Tags, reminder.Text)})
+		}
+	case models.WidgetTypeLinks:
+		for _, link := range c.Links {
+			items = append(items, indexItem{ID: link.ID, Title: link.Title, Body: link.URL})
+		}
+	case models.WidgetTypeKanban:
+		for _, col := range c.Kanban {
+			for _, card := range col.Items {
+				body := []string{card.Description}
+				for _, entry := range card.Checklist {
+					body = append(body, entry.Text)
+				}
+				body = append(body, card.Labels...)
+				items = append(items, indexItem{
+					ID:    card.ID,
+					Title: card.Content,
+					Body:  strings.TrimSpace(strings.Join(body, "\n")),
+					Tags:  tags.Merge(card.Labels, card.Content, card.Description),
+				})
+			}
+		}
+	}
+
+	nonEmpty := items[:0]
+	for _, item := range items {
+		if item.Title != "" || item.Body != "" {
+			nonEmpty = append(nonEmpty, item)
+		}
+	}
+	return nonEmpty
+}
+
+// IndexWidget updates the search index and tags of a widget from its stored
+// content. Items whose text didn't change keep their search date.
+func IndexWidget(widgetID string) error {
+	var userID int
+	var widgetType models.WidgetType
+	var active bool
+	var content string
+	var updatedAt time.Time
+	query := `SELECT COALESCE(user_id, 0), type, is_active, content, updated_at FROM widgets WHERE id = ?`
+	err := DB.QueryRow(query, widgetID).Scan(&userID, &widgetType, &active, &content, &updatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query widget: %w", err)
+	}
+	var items []indexItem
+	if err == nil && active {
+		items = indexItems(widgetType, json.RawMessage(content))
+	}
+
+	rows, err := DB.Query(`SELECT item_id, title, body, updated FROM search_index WHERE widget_id = ?`, widgetID)
+	if err != nil {
+		return fmt.Errorf("failed to query search index: %w", err)
+	}
+	type indexed struct {
+		title, body, updated string
+	}
+	previous := make(map[string]indexed)
+	for rows.Next() {
+		var id string
+		var e indexed
+		if err := rows.Scan(&id, &e.title, &e.body, &e.updated); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan search index: %w", err)
+		}
+		previous[id] = e
+	}
+	rows.Close()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to index widget: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_index WHERE widget_id = ?`, widgetID); err != nil {
+		return fmt.Errorf("failed to index widget: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM tags WHERE widget_id = ?`, widgetID); err != nil {
+		return fmt.Errorf("failed to index widget: %w", err)
+	}
+	insertSearch := `INSERT INTO search_index (title, body, widget_id, item_id, user_id, widget_type, updated) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	insertTag := `INSERT OR IGNORE INTO tags (tag, widget_id, item_id, user_id, widget_type, title) VALUES (?, ?, ?, ?, ?, ?)`
+	for _, item := range items {
+		updated := sqlTime(updatedAt)
+		if e, ok := previous[item.ID]; ok && e.title == item.Title && e.body == item.Body {
+			updated = e.updated
+		}
+		if _, err := tx.Exec(insertSearch, item.Title, item.Body, widgetID, item.ID, userID, widgetType, updated); err != nil {
+			return fmt.Errorf("failed to index widget: %w", err)
+		}
+		for _, tag := range item.Tags {
+			if _, err := tx.Exec(insertTag, tag, widgetID, item.ID, userID, widgetType, item.label()); err != nil {
+				return fmt.Errorf("failed to index widget: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// indexWidget updates the index after a write. The write already
+// committed, so failures are only logged.
+func indexWidget(widgetID string) {
+	if err := IndexWidget(widgetID); err != nil {
+		log.Printf("Failed to index widget %s: %v\n", widgetID, err)
+	}
+}
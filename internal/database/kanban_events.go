@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitKanbanEventsTable creates the kanban_events table if it doesn't exist.
+func InitKanbanEventsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS kanban_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		widget_id TEXT NOT NULL,
+		card_id TEXT NOT NULL,
+		from_column TEXT NOT NULL DEFAULT '',
+		to_column TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_kanban_events_widget ON kanban_events(widget_id, id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// addKanbanEvents records the card transitions of a change to a board, in
+// the transaction writing the change.
+func addKanbanEvents(tx *sql.Tx, widgetID string, events []models.KanbanEvent, at time.Time) error {
+	query := `INSERT INTO kanban_events (widget_id, card_id, from_column, to_column, created_at) VALUES (?, ?, ?, ?, ?)`
+	for _, e := range events {
+		if _, err := tx.Exec(query, widgetID, e.CardID, e.FromColumn, e.ToColumn, sqlTime(at)); err != nil {
+			return fmt.Errorf("failed to add kanban event: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetKanbanEvents returns the events of a board, oldest first.
+func GetKanbanEvents(widgetID string) ([]models.KanbanEvent, error) {
+	query := `SELECT id, card_id, from_column, to_column, created_at FROM kanban_events WHERE widget_id = ? ORDER BY id`
+	rows, err := DB.Query(query, widgetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query kanban events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.KanbanEvent
+	for rows.Next() {
+		var e models.KanbanEvent
+		if err := rows.Scan(&e.ID, &e.CardID, &e.FromColumn, &e.ToColumn, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan kanban event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitNotificationChannelsTable creates the notification_channels table if it doesn't exist.
+func InitNotificationChannelsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS notification_channels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		name TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		config TEXT NOT NULL, -- JSON, type specific
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_notification_channels_user ON notification_channels(user_id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+func scanChannel(scan func(dest ...any) error) (models.NotificationChannel, error) {
+	var ch models.NotificationChannel
+	var configStr string
+	if err := scan(&ch.ID, &ch.Type, &ch.Name, &ch.Enabled, &configStr, &ch.CreatedAt); err != nil {
+		return ch, err
+	}
+	ch.Config = json.RawMessage(configStr)
+	return ch, nil
+}
+
+// GetNotificationChannels retrieves the channels of a user.
+// If enabledOnly is set, disabled channels are skipped.
+func GetNotificationChannels(userID int, enabledOnly bool) ([]models.NotificationChannel, error) {
+	query := `SELECT id, type, name, enabled, config, created_at FROM notification_channels WHERE user_id = ?`
+	if enabledOnly {
+		query += ` AND enabled = 1`
+	}
+	query += ` ORDER BY id`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []models.NotificationChannel
+	for rows.Next() {
+		ch, err := scanChannel(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// GetNotificationChannel retrieves a channel, ensuring it belongs to the user.
+// Returns nil if not found.
+func GetNotificationChannel(userID, id int) (*models.NotificationChannel, error) {
+	query := `SELECT id, type, name, enabled, config, created_at FROM notification_channels WHERE id = ? AND user_id = ?`
+	ch, err := scanChannel(DB.QueryRow(query, id, userID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+	}
+	return &ch, nil
+}
+
+// CreateNotificationChannel stores a new channel and returns its ID.
+func CreateNotificationChannel(userID int, ch models.NotificationChannel) (int, error) {
+	query := `INSERT INTO notification_channels (user_id, type, name, enabled, config) VALUES (?, ?, ?, ?, ?)`
+	result, err := DB.Exec(query, userID, ch.Type, ch.Name, ch.Enabled, string(ch.Config))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create notification channel: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create notification channel: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateNotificationChannel updates a channel, ensuring it belongs to the user.
+func UpdateNotificationChannel(userID int, ch models.NotificationChannel) error {
+	query := `UPDATE notification_channels SET name = ?, enabled = ?, config = ? WHERE id = ? AND user_id = ?`
+	result, err := DB.Exec(query, ch.Name, ch.Enabled, string(ch.Config), ch.ID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update notification channel: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("notification channel not found or access denied")
+	}
+	return nil
+}
+
+// DeleteNotificationChannel removes a channel, ensuring it belongs to the user.
+func DeleteNotificationChannel(userID, id int) error {
+	result, err := DB.Exec(`DELETE FROM notification_channels WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification channel: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("notification channel not found or access denied")
+	}
+	return nil
+}
+
+// GetAllNotificationChannels retrieves the channels of every user.
+func GetAllNotificationChannels() ([]models.NotificationChannel, error) {
+	rows, err := DB.Query(`SELECT id, type, name, enabled, config, created_at FROM notification_channels ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []models.NotificationChannel
+	for rows.Next() {
+		ch, err := scanChannel(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// UpdateNotificationChannelConfig replaces the config of a channel.
+func UpdateNotificationChannelConfig(id int, config json.RawMessage) error {
+	if _, err := DB.Exec(`UPDATE notification_channels SET config = ? WHERE id = ?`, string(config), id); err != nil {
+		return fmt.Errorf("failed to update notification channel: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitNotificationSettingsTable creates the notification_settings table if it doesn't exist.
+func InitNotificationSettingsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS notification_settings (
+		user_id INTEGER PRIMARY KEY,
+		reminders BOOLEAN NOT NULL DEFAULT 1,
+		pomodoro BOOLEAN NOT NULL DEFAULT 1,
+		hydration BOOLEAN NOT NULL DEFAULT 1,
+		digest BOOLEAN NOT NULL DEFAULT 1,
+		quiet_enabled BOOLEAN NOT NULL DEFAULT 0,
+		quiet_start TEXT NOT NULL DEFAULT '22:00',
+		quiet_end TEXT NOT NULL DEFAULT '07:00',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// GetNotificationSettings retrieves the notification preferences of a user,
+// falling back to defaults.
+func GetNotificationSettings(userID int) (models.NotificationSettings, error) {
+	s := models.DefaultNotificationSettings()
+	query := `SELECT reminders, pomodoro, hydration, digest, quiet_enabled, quiet_start, quiet_end FROM notification_settings WHERE user_id = ?`
+	err := DB.QueryRow(query, userID).Scan(
+		&s.Categories.Reminders, &s.Categories.Pomodoro, &s.Categories.Hydration, &s.Categories.Digest,
+		&s.QuietHours.Enabled, &s.QuietHours.Start, &s.QuietHours.End,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return s, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+
+	rows, err := DB.Query(`SELECT id FROM push_subscriptions WHERE user_id = ? AND muted = 1 ORDER BY id`, userID)
+	if err != nil {
+		return s, fmt.Errorf("failed to get muted devices: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return s, err
+		}
+		s.MutedDevices = append(s.MutedDevices, id)
+	}
+	return s, rows.Err()
+}
+
+// SaveNotificationSettings stores the notification preferences of a user.
+// Devices not listed in MutedDevices are unmuted.
+func SaveNotificationSettings(userID int, s models.NotificationSettings) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO notification_settings (user_id, reminders, pomodoro, hydration, digest, quiet_enabled, quiet_start, quiet_end, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET
+		reminders = excluded.reminders,
+		pomodoro = excluded.pomodoro,
+		hydration = excluded.hydration,
+		digest = excluded.digest,
+		quiet_enabled = excluded.quiet_enabled,
+		quiet_start = excluded.quiet_start,
+		quiet_end = excluded.quiet_end,
+		updated_at = CURRENT_TIMESTAMP;`
+	_, err = tx.Exec(query, userID,
+		s.Categories.Reminders, s.Categories.Pomodoro, s.Categories.Hydration, s.Categories.Digest,
+		s.QuietHours.Enabled, s.QuietHours.Start, s.QuietHours.End,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE push_subscriptions SET muted = 0 WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to update muted devices: %w", err)
+	}
+	for _, id := range s.MutedDevices {
+		if _, err := tx.Exec(`UPDATE push_subscriptions SET muted = 1 WHERE id = ? AND user_id = ?`, id, userID); err != nil {
+			return fmt.Errorf("failed to update muted devices: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Notification log statuses.
+const (
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+	// NotificationSkipped means the user disabled the category.
+	NotificationSkipped = "skipped"
+	// NotificationDeferred means quiet hours postponed the delivery.
+	NotificationDeferred = "deferred"
+)
+
+const (
+	// NotificationMaxAttempts bounds the deliveries of a notification that
+	// keeps failing.
+	NotificationMaxAttempts = 5
+	// notificationRetryDelay is the wait before retrying a failed
+	// notification, doubled after every attempt.
+	notificationRetryDelay = time.Minute
+)
+
+// InitNotificationLogTable creates the notification_log table if it doesn't exist.
+// Each row records a notification that was (or is being) delivered, so the
+// scheduler sends every reminder occurrence once. Failed deliveries are
+// retried at retry_at, up to NotificationMaxAttempts attempts.
+//
+// notification_deliveries records the channels and devices that accepted a
+// notification, so retries skip them. Delivery is still at least once: a
+// channel may get the notification twice if the server stops between
+// sending it and recording the delivery.
+func InitNotificationLogTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS notification_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		widget_id TEXT NOT NULL,
+		item_id TEXT NOT NULL,
+		due_at TEXT NOT NULL, -- RFC3339 UTC
+		status TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		retry_at DATETIME,
+		UNIQUE(widget_id, item_id, due_at)
+	);
+
+	CREATE TABLE IF NOT EXISTS notification_deliveries (
+		log_id INTEGER NOT NULL,
+		channel TEXT NOT NULL, -- "push:{subscription id}" or "channel:{channel id}"
+		delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (log_id, channel)
+	);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	// Migration: retry columns (ignore "duplicate column" errors)
+	DB.Exec(`ALTER TABLE notification_log ADD COLUMN attempts INTEGER NOT NULL DEFAULT 1`)
+	DB.Exec(`ALTER TABLE notification_log ADD COLUMN retry_at DATETIME`)
+	return nil
+}
+
+// ClaimNotification records that a notification is about to be sent.
+// It returns false if this occurrence was already claimed, which makes the
+// claim safe to attempt on every scheduler tick. A failed notification is
+// claimed again once its retry is due at now, until it ran out of attempts.
+func ClaimNotification(userID int, widgetID, itemID, dueAt string, now time.Time) (int64, bool, error) {
+	query := `
+	INSERT INTO notification_log (user_id, widget_id, item_id, due_at, status)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(widget_id, item_id, due_at) DO UPDATE SET
+		status = excluded.status,
+		attempts = attempts + 1
+	WHERE status = ? AND attempts < ? AND (retry_at IS NULL OR retry_at <= ?)
+	RETURNING id`
+	var id int64
+	err := DB.QueryRow(query, userID, widgetID, itemID, dueAt, NotificationSending,
+		NotificationFailed, NotificationMaxAttempts, sqlTime(now)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim notification: %w", err)
+	}
+	return id, true, nil
+}
+
+// MarkNotification sets the final status of a claimed notification. A
+// failed notification is retried after a delay doubling with every attempt.
+func MarkNotification(id int64, status string) error {
+	query := `
+	UPDATE notification_log SET status = ?, sent_at = CURRENT_TIMESTAMP,
+		retry_at = CASE WHEN ? = ? THEN datetime(?, '+' || (? << (attempts - 1)) || ' seconds') END
+	WHERE id = ?`
+	_, err := DB.Exec(query, status, status, NotificationFailed, sqlTime(time.Now()), int(notificationRetryDelay.Seconds()), id)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	return nil
+}
+
+// GetNotificationDeliveries returns the channels that accepted a logged
+// notification.
+func GetNotificationDeliveries(logID int64) (map[string]bool, error) {
+	rows, err := DB.Query(`SELECT channel FROM notification_deliveries WHERE log_id = ?`, logID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	delivered := make(map[string]bool)
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, fmt.Errorf("failed to scan notification delivery: %w", err)
+		}
+		delivered[channel] = true
+	}
+	return delivered, rows.Err()
+}
+
+// RecordNotificationDelivery records that a channel accepted a logged
+// notification.
+func RecordNotificationDelivery(logID int64, channel string) error {
+	query := `INSERT OR IGNORE INTO notification_deliveries (log_id, channel) VALUES (?, ?)`
+	if _, err := DB.Exec(query, logID, channel); err != nil {
+		return fmt.Errorf("failed to record notification delivery: %w", err)
+	}
+	return nil
+}
+
+// ReleaseInterruptedNotifications marks the claims left in the "sending"
+// state by a previous process (e.g. a crash mid-send) as failed, so they are
+// retried like failed deliveries, within their attempts. The retries skip
+// the channels that recorded a delivery.
+func ReleaseInterruptedNotifications() (int64, error) {
+	query := `UPDATE notification_log SET status = ?, retry_at = NULL WHERE status = ?`
+	result, err := DB.Exec(query, NotificationFailed, NotificationSending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release notifications: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeferredPush is a notification held back by quiet hours.
+type DeferredPush struct {
+	ID           int64
+	UserID       int
+	Payload      string // JSON encoded api.PushPayload
+	Options      string // JSON encoded api.PushOptions
+	DeliverAfter time.Time
+}
+
+// InitDeferredPushTable creates the deferred_pushes table if it doesn't exist.
+// A push is claimed (claimed_at) while it is sent and deleted once sent, so
+// a crash mid-send doesn't lose it.
+func InitDeferredPushTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS deferred_pushes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		payload TEXT NOT NULL,
+		options TEXT NOT NULL,
+		deliver_after DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		claimed_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_deferred_pushes_due ON deferred_pushes(deliver_after);`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	// Migration: claim column (ignore "duplicate column" errors)
+	DB.Exec(`ALTER TABLE deferred_pushes ADD COLUMN claimed_at DATETIME`)
+	return nil
+}
+
+// DeferPush queues a notification until the given time.
+func DeferPush(userID int, payload, options string, deliverAfter time.Time) error {
+	query := `INSERT INTO deferred_pushes (user_id, payload, options, deliver_after) VALUES (?, ?, ?, ?)`
+	if _, err := DB.Exec(query, userID, payload, options, sqlTime(deliverAfter)); err != nil {
+		return fmt.Errorf("failed to defer push: %w", err)
+	}
+	return nil
+}
+
+// ClaimDuePushes claims and returns the deferred notifications due at the
+// given time that are not being sent. Delete them with DeleteDeferredPush
+// once sent.
+func ClaimDuePushes(now time.Time) ([]DeferredPush, error) {
+	query := `
+	UPDATE deferred_pushes SET claimed_at = ?
+	WHERE deliver_after <= ? AND claimed_at IS NULL
+	RETURNING id, user_id, payload, options, deliver_after`
+	rows, err := DB.Query(query, sqlTime(now), sqlTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deferred pushes: %w", err)
+	}
+	defer rows.Close()
+
+	var pushes []DeferredPush
+	for rows.Next() {
+		var p DeferredPush
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Payload, &p.Options, &p.DeliverAfter); err != nil {
+			return nil, fmt.Errorf("failed to scan deferred push: %w", err)
+		}
+		pushes = append(pushes, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(pushes, func(a, b DeferredPush) int { return cmp.Compare(a.ID, b.ID) })
+	return pushes, nil
+}
+
+// DeleteDeferredPush removes a deferred notification once sent.
+func DeleteDeferredPush(id int64) error {
+	if _, err := DB.Exec(`DELETE FROM deferred_pushes WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete deferred push: %w", err)
+	}
+	return nil
+}
+
+// ReleaseInterruptedPushes releases the deferred notifications claimed by a
+// previous process (e.g. a crash mid-send), so they are sent again.
+func ReleaseInterruptedPushes() (int64, error) {
+	result, err := DB.Exec(`UPDATE deferred_pushes SET claimed_at = NULL WHERE claimed_at IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release deferred pushes: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -1,9 +1,9 @@
 package database
 
 import (
-	"fmt"
 	"database/sql"
-
+	"fmt"
+	"time"
 )
 
 // InitPushTable creates the push_subscriptions table if it doesn't exist.
@@ -17,8 +17,18 @@ func InitPushTable() error {
 		user_id INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
-	_, err := DB.Exec(query)
-	return err
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	// Migration: delivery tracking columns (ignore "duplicate column" errors)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN last_success_at DATETIME`)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN last_failure_at DATETIME`)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN last_status INTEGER`)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN last_error TEXT`)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN failure_count INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE push_subscriptions ADD COLUMN muted BOOLEAN DEFAULT 0`)
+	return nil
 }
 
 // SaveSubscription saves a new push subscription.
@@ -31,54 +41,182 @@ func SaveSubscription(userID int, endpoint, p256dh, auth string) error {
 	return nil
 }
 
-// GetAllSubscriptions retrieves all subscriptions to broadcast messages.
+// Subscription is a browser push subscription along with its delivery status.
 type Subscription struct {
-	Endpoint string
-	P256dh   string
-	Auth     string
-	UserID   int
+	ID            int        `json:"id"`
+	Endpoint      string     `json:"endpoint"`
+	P256dh        string     `json:"-"`
+	Auth          string     `json:"-"`
+	UserID        int        `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+	LastFailureAt *time.Time `json:"lastFailureAt,omitempty"`
+	LastStatus    int        `json:"lastStatus,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	FailureCount  int        `json:"failureCount"`
+	Muted         bool       `json:"muted"`
 }
 
-func GetAllSubscriptions() ([]Subscription, error) {
-	query := `SELECT endpoint, p256dh, auth, user_id FROM push_subscriptions`
-	rows, err := DB.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+const subscriptionColumns = `id, endpoint, p256dh, auth, user_id, created_at, last_success_at, last_failure_at, last_status, last_error, failure_count, COALESCE(muted, 0)`
 
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
 	var subs []Subscription
 	for rows.Next() {
 		var s Subscription
-		var uid sql.NullInt64
-		if err := rows.Scan(&s.Endpoint, &s.P256dh, &s.Auth, &uid); err != nil {
+		var uid, status, failures sql.NullInt64
+		var success, failure sql.NullTime
+		var lastErr sql.NullString
+		if err := rows.Scan(&s.ID, &s.Endpoint, &s.P256dh, &s.Auth, &uid, &s.CreatedAt, &success, &failure, &status, &lastErr, &failures, &s.Muted); err != nil {
 			return nil, err
 		}
 		if uid.Valid {
 			s.UserID = int(uid.Int64)
 		}
+		if success.Valid {
+			s.LastSuccessAt = &success.Time
+		}
+		if failure.Valid {
+			s.LastFailureAt = &failure.Time
+		}
+		s.LastStatus = int(status.Int64)
+		s.LastError = lastErr.String
+		s.FailureCount = int(failures.Int64)
 		subs = append(subs, s)
 	}
-	return subs, nil
+	return subs, rows.Err()
+}
+
+// GetAllSubscriptions retrieves all subscriptions to broadcast messages.
+func GetAllSubscriptions() ([]Subscription, error) {
+	rows, err := DB.Query(`SELECT ` + subscriptionColumns + ` FROM push_subscriptions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSubscriptions(rows)
 }
 
 // GetSubscriptionsByUserID retrieves subscriptions for a specific user.
 func GetSubscriptionsByUserID(userID int) ([]Subscription, error) {
-	query := `SELECT endpoint, p256dh, auth FROM push_subscriptions WHERE user_id = ?`
-	rows, err := DB.Query(query, userID)
+	rows, err := DB.Query(`SELECT `+subscriptionColumns+` FROM push_subscriptions WHERE user_id = ? ORDER BY id`, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanSubscriptions(rows)
+}
 
-	var subs []Subscription
+// RecordPushSuccess stores a successful delivery to a subscription.
+func RecordPushSuccess(id, status int) error {
+	query := `UPDATE push_subscriptions SET last_success_at = CURRENT_TIMESTAMP, last_status = ?, last_error = NULL, failure_count = 0 WHERE id = ?`
+	if _, err := DB.Exec(query, status, id); err != nil {
+		return fmt.Errorf("failed to record push success: %w", err)
+	}
+	return nil
+}
+
+// RecordPushFailure stores a failed delivery to a subscription.
+// status is 0 when the push service could not be reached at all.
+func RecordPushFailure(id, status int, message string) error {
+	query := `UPDATE push_subscriptions SET last_failure_at = CURRENT_TIMESTAMP, last_status = ?, last_error = ?, failure_count = COALESCE(failure_count, 0) + 1 WHERE id = ?`
+	if _, err := DB.Exec(query, status, message, id); err != nil {
+		return fmt.Errorf("failed to record push failure: %w", err)
+	}
+	return nil
+}
+
+// GetSubscription retrieves a subscription by ID.
+// Returns nil if not found.
+func GetSubscription(id int) (*Subscription, error) {
+	rows, err := DB.Query(`SELECT `+subscriptionColumns+` FROM push_subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs, err := scanSubscriptions(rows)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	return &subs[0], nil
+}
+
+// DeleteSubscription removes a subscription, e.g. once the push service
+// reports it as gone.
+func DeleteSubscription(id int) error {
+	if _, err := DB.Exec(`DELETE FROM push_subscriptions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSubscription removes a subscription, ensuring it belongs to the user.
+func DeleteUserSubscription(userID, id int) error {
+	result, err := DB.Exec(`DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("subscription not found or access denied")
+	}
+	return nil
+}
+
+// PushRetry is a push message to send again to a subscription, after a
+// transient failure.
+type PushRetry struct {
+	ID             int64
+	SubscriptionID int
+	Message        string
+	Options        string // JSON encoded api.PushOptions
+	Attempt        int    // Number of the attempt to make
+	NextAttemptAt  time.Time
+}
+
+// InitPushRetryTable creates the push_retries table if it doesn't exist.
+func InitPushRetryTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS push_retries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		subscription_id INTEGER NOT NULL,
+		message TEXT NOT NULL,
+		options TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		next_attempt_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_push_retries_due ON push_retries(next_attempt_at);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// QueuePushRetry schedules another attempt at sending a push message.
+func QueuePushRetry(r PushRetry) error {
+	query := `INSERT INTO push_retries (subscription_id, message, options, attempt, next_attempt_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := DB.Exec(query, r.SubscriptionID, r.Message, r.Options, r.Attempt, sqlTime(r.NextAttemptAt)); err != nil {
+		return fmt.Errorf("failed to queue push retry: %w", err)
+	}
+	return nil
+}
+
+// TakeDuePushRetries removes and returns the push retries due at the given time.
+func TakeDuePushRetries(now time.Time) ([]PushRetry, error) {
+	query := `
+	DELETE FROM push_retries WHERE next_attempt_at <= ?
+	RETURNING id, subscription_id, message, options, attempt, next_attempt_at`
+	rows, err := DB.Query(query, sqlTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to take push retries: %w", err)
+	}
+	defer rows.Close()
+
+	var retries []PushRetry
 	for rows.Next() {
-		var s Subscription
-		if err := rows.Scan(&s.Endpoint, &s.P256dh, &s.Auth); err != nil {
-			return nil, err
+		var r PushRetry
+		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.Message, &r.Options, &r.Attempt, &r.NextAttemptAt); err != nil {
+			return nil, fmt.Errorf("failed to scan push retry: %w", err)
 		}
-		s.UserID = userID
-		subs = append(subs, s)
+		retries = append(retries, r)
 	}
-	return subs, nil
+	return retries, rows.Err()
 }
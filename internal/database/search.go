@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// Delimiters of the matched terms in search titles and snippets, replaced
+// once the text is escaped.
+const (
+	SearchMatchStart = "\x02"
+	SearchMatchEnd   = "\x03"
+)
+
+// SearchFilter narrows a search to widget types and to items changed in
+// [From, To). Zero values don't filter.
+type SearchFilter struct {
+	Types []models.WidgetType
+	From  time.Time
+	To    time.Time
+}
+
+// Search returns the items of the widgets of the user, and of those shared
+// with them, matching an FTS5 query, best first. Title and Snippet are raw
+// text delimiting the matches with SearchMatchStart and SearchMatchEnd.
+func Search(userID int, match string, filter SearchFilter, limit int) ([]models.SearchResult, error) {
+	query := `
+	SELECT search_index.widget_id, search_index.widget_type, w.title, search_index.item_id,
+		highlight(search_index, 0, ?, ?),
+		snippet(search_index, 1, ?, ?, '…', 16),
+		bm25(search_index, 5.0, 1.0) AS rank,
+		search_index.updated
+	FROM search_index
+	JOIN widgets w ON w.id = search_index.widget_id
+	WHERE search_index MATCH ? AND w.is_active = 1
+		AND (search_index.user_id = ? OR search_index.widget_id IN (SELECT widget_id FROM widget_shares WHERE user_id = ?))`
+	args := []any{SearchMatchStart, SearchMatchEnd, SearchMatchStart, SearchMatchEnd, match, userID, userID}
+
+	if len(filter.Types) > 0 {
+		query += ` AND search_index.widget_type IN (?` + strings.Repeat(", ?", len(filter.Types)-1) + `)`
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	if !filter.From.IsZero() {
+		query += ` AND search_index.updated >= ?`
+		args = append(args, sqlTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query += ` AND search_index.updated < ?`
+		args = append(args, sqlTime(filter.To))
+	}
+	query += ` ORDER BY rank LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var r models.SearchResult
+		var updated string
+		if err := rows.Scan(&r.WidgetID, &r.WidgetType, &r.WidgetTitle, &r.ItemID, &r.Title, &r.Snippet, &r.Rank, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updated)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
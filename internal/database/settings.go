@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// InitSettingsTable creates the user_settings table if it doesn't exist.
+func InitSettingsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS user_settings (
+		user_id INTEGER PRIMARY KEY,
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		reminder_time TEXT NOT NULL DEFAULT '09:00',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// GetUserSettings retrieves the settings of a user, falling back to defaults.
+func GetUserSettings(userID int) (models.UserSettings, error) {
+	settings := models.DefaultUserSettings()
+	query := `SELECT timezone, reminder_time FROM user_settings WHERE user_id = ?`
+	err := DB.QueryRow(query, userID).Scan(&settings.Timezone, &settings.ReminderTime)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, fmt.Errorf("failed to get user settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveUserSettings inserts or updates the settings of a user.
+func SaveUserSettings(userID int, s models.UserSettings) error {
+	query := `
+	INSERT INTO user_settings (user_id, timezone, reminder_time, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET
+		timezone = excluded.timezone,
+		reminder_time = excluded.reminder_time,
+		updated_at = CURRENT_TIMESTAMP;`
+	if _, err := DB.Exec(query, userID, s.Timezone, s.ReminderTime); err != nil {
+		return fmt.Errorf("failed to save user settings: %w", err)
+	}
+	return nil
+}
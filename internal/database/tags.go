@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// accessibleTags restricts the tags table to the widgets of the user and to
+// those shared with them.
+const accessibleTags = `
+	FROM tags
+	JOIN widgets w ON w.id = tags.widget_id
+	WHERE w.is_active = 1
+		AND (tags.user_id = ? OR tags.widget_id IN (SELECT widget_id FROM widget_shares WHERE user_id = ?))`
+
+// GetTags returns the tags of the items the user can access, most used first.
+func GetTags(userID int) ([]models.TagCount, error) {
+	query := `SELECT tags.tag, COUNT(*)` + accessibleTags + ` GROUP BY tags.tag ORDER BY COUNT(*) DESC, tags.tag ASC`
+	rows, err := DB.Query(query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []models.TagCount{}
+	for rows.Next() {
+		var t models.TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// GetTaggedItems returns the items with a tag the user can access, grouped
+// by widget in dashboard order.
+func GetTaggedItems(userID int, tag string) ([]models.TaggedItem, error) {
+	query := `SELECT tags.widget_id, tags.widget_type, w.title, tags.item_id, tags.title` + accessibleTags + `
+		AND tags.tag = ?
+	ORDER BY w.position ASC, tags.widget_id, tags.rowid`
+	rows, err := DB.Query(query, userID, userID, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tagged items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.TaggedItem{}
+	for rows.Next() {
+		var item models.TaggedItem
+		if err := rows.Scan(&item.WidgetID, &item.WidgetType, &item.WidgetTitle, &item.ItemID, &item.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan tagged item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
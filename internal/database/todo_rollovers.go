@@ -0,0 +1,47 @@
+package database
+
+import "fmt"
+
+// InitTodoRolloversTable creates the todo_rollovers table if it doesn't
+// exist. It keeps the local date of the last daily rollover of each Todo
+// widget, so that the widget is only written when tasks change.
+func InitTodoRolloversTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS todo_rollovers (
+		widget_id TEXT PRIMARY KEY,
+		date TEXT NOT NULL
+	);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// GetTodoRolloverDates returns the date (YYYY-MM-DD) of the last rollover of
+// the Todo widgets, keyed by widget ID.
+func GetTodoRolloverDates() (map[string]string, error) {
+	rows, err := DB.Query(`SELECT widget_id, date FROM todo_rollovers`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todo rollovers: %w", err)
+	}
+	defer rows.Close()
+
+	dates := make(map[string]string)
+	for rows.Next() {
+		var id, date string
+		if err := rows.Scan(&id, &date); err != nil {
+			return nil, fmt.Errorf("failed to scan todo rollover: %w", err)
+		}
+		dates[id] = date
+	}
+	return dates, rows.Err()
+}
+
+// SetTodoRolloverDate records the date of the last rollover of a Todo widget.
+func SetTodoRolloverDate(widgetID, date string) error {
+	query := `
+	INSERT INTO todo_rollovers (widget_id, date) VALUES (?, ?)
+	ON CONFLICT(widget_id) DO UPDATE SET date = excluded.date`
+	if _, err := DB.Exec(query, widgetID, date); err != nil {
+		return fmt.Errorf("failed to save todo rollover: %w", err)
+	}
+	return nil
+}
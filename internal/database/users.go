@@ -65,3 +65,13 @@ func ValidateUser(username, password string) (int, error) {
 
 	return id, nil
 }
+
+// GetUserIDByUsername returns the ID of a user, 0 if there is none.
+func GetUserIDByUsername(username string) (int, error) {
+	var id int
+	err := DB.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
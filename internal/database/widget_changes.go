@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+)
+
+// InitWidgetChangesTable creates the widget_changes table if it doesn't
+// exist. It holds, for each widget and user with access to it, the sequence
+// number of its last change; the sequence only grows, so clients sync from
+// the last number they saw. Existing widgets are recorded on creation.
+//
+// Changes are recorded by triggers on widgets and widget_shares, in the
+// transaction of the write: for the owner and the recipients when a widget
+// is written, and for the recipient when a share is added, moved on their
+// dashboard or removed. A change replaces the previous row, moving it to
+// the end of the sequence. The triggers delete it explicitly rather than
+// with INSERT OR REPLACE: within triggers, the conflict policy of the
+// outer statement wins, and the upsert of SaveWidget aborts. They are
+// recreated on startup so that their definition stays current.
+func InitWidgetChangesTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS widget_changes (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		widget_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		UNIQUE(widget_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_widget_changes_user ON widget_changes(user_id, seq);
+
+	DROP TRIGGER IF EXISTS widget_changes_insert;
+	DROP TRIGGER IF EXISTS widget_changes_update;
+	DROP TRIGGER IF EXISTS widget_changes_share_insert;
+	DROP TRIGGER IF EXISTS widget_changes_share_update;
+	DROP TRIGGER IF EXISTS widget_changes_share_delete;
+	CREATE TRIGGER widget_changes_insert AFTER INSERT ON widgets
+	WHEN NEW.user_id IS NOT NULL
+	BEGIN
+		DELETE FROM widget_changes WHERE widget_id = NEW.id AND user_id = NEW.user_id;
+		INSERT INTO widget_changes (widget_id, user_id) VALUES (NEW.id, NEW.user_id);
+	END;
+	CREATE TRIGGER widget_changes_update AFTER UPDATE ON widgets
+	WHEN NEW.user_id IS NOT NULL
+	BEGIN
+		DELETE FROM widget_changes WHERE widget_id = NEW.id AND (user_id = NEW.user_id OR user_id IN (
+			SELECT user_id FROM widget_shares WHERE widget_id = NEW.id
+		));
+		INSERT INTO widget_changes (widget_id, user_id)
+		SELECT NEW.id, NEW.user_id
+		UNION ALL
+		SELECT widget_id, user_id FROM widget_shares WHERE widget_id = NEW.id AND user_id != NEW.user_id;
+	END;
+	CREATE TRIGGER widget_changes_share_insert AFTER INSERT ON widget_shares
+	BEGIN
+		DELETE FROM widget_changes WHERE widget_id = NEW.widget_id AND user_id = NEW.user_id;
+		INSERT INTO widget_changes (widget_id, user_id) VALUES (NEW.widget_id, NEW.user_id);
+	END;
+	CREATE TRIGGER widget_changes_share_update AFTER UPDATE ON widget_shares
+	BEGIN
+		DELETE FROM widget_changes WHERE widget_id = NEW.widget_id AND user_id = NEW.user_id;
+		INSERT INTO widget_changes (widget_id, user_id) VALUES (NEW.widget_id, NEW.user_id);
+	END;
+	CREATE TRIGGER widget_changes_share_delete AFTER DELETE ON widget_shares
+	BEGIN
+		DELETE FROM widget_changes WHERE widget_id = OLD.widget_id AND user_id = OLD.user_id;
+		INSERT INTO widget_changes (widget_id, user_id) VALUES (OLD.widget_id, OLD.user_id);
+	END;`
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	var count int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM widget_changes`).Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	_, err := DB.Exec(`
+	INSERT OR IGNORE INTO widget_changes (widget_id, user_id)
+	SELECT id, user_id FROM widgets WHERE user_id IS NOT NULL
+	UNION ALL
+	SELECT widget_id, user_id FROM widget_shares
+	ORDER BY 1`)
+	return err
+}
+
+// WidgetChange is the last change of a widget for a user.
+type WidgetChange struct {
+	Seq      int64
+	WidgetID string
+}
+
+// GetWidgetChanges returns the widgets of a user changed after the sequence
+// number since, oldest change first.
+func GetWidgetChanges(userID int, since int64, limit int) ([]WidgetChange, error) {
+	query := `SELECT seq, widget_id FROM widget_changes WHERE user_id = ? AND seq > ? ORDER BY seq LIMIT ?`
+	rows, err := DB.Query(query, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query widget changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []WidgetChange
+	for rows.Next() {
+		var c WidgetChange
+		if err := rows.Scan(&c.Seq, &c.WidgetID); err != nil {
+			return nil, fmt.Errorf("failed to scan widget change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// GetWidgetChangeSeq returns the last sequence number of the changes of a
+// user, 0 if none.
+func GetWidgetChangeSeq(userID int) (int64, error) {
+	var seq int64
+	err := DB.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM widget_changes WHERE user_id = ?`, userID).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query widget changes: %w", err)
+	}
+	return seq, nil
+}
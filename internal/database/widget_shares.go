@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gabrielhirakawa/lifehub/internal/models"
+)
+
+// ErrAccessDenied is returned when writing a widget the user may not change.
+var ErrAccessDenied = errors.New("access denied")
+
+// InitWidgetSharesTable creates the widget_shares table if it doesn't exist.
+// The recipient's layout of the widget is kept on the share.
+func InitWidgetSharesTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS widget_shares (
+		widget_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		cols INTEGER DEFAULT 1,
+		position INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (widget_id, user_id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_widget_shares_user ON widget_shares(user_id);`
+	_, err := DB.Exec(query)
+	return err
+}
+
+// GetWidgetShares returns the users a widget is shared with.
+func GetWidgetShares(widgetID string) ([]models.WidgetShare, error) {
+	query := `
+	SELECT s.user_id, u.username, s.role, s.created_at
+	FROM widget_shares s JOIN users u ON u.id = s.user_id
+	WHERE s.widget_id = ?
+	ORDER BY s.created_at, s.user_id`
+	rows, err := DB.Query(query, widgetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query widget shares: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []models.WidgetShare
+	for rows.Next() {
+		var s models.WidgetShare
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Role, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan widget share: %w", err)
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// SaveWidgetShare shares a widget with a user, or changes their role. New
+// recipients get the widget at the end of their dashboard.
+func SaveWidgetShare(widgetID string, userID int, role string) error {
+	query := `
+	INSERT INTO widget_shares (widget_id, user_id, role, cols, position)
+	SELECT ?, ?, ?, w.cols, (
+		SELECT COALESCE(MAX(position), -1) + 1 FROM widgets WHERE user_id = ? AND is_active = 1
+	)
+	FROM widgets w WHERE w.id = ?
+	ON CONFLICT(widget_id, user_id) DO UPDATE SET role = excluded.role`
+	if _, err := DB.Exec(query, widgetID, userID, role, userID, widgetID); err != nil {
+		return fmt.Errorf("failed to save widget share: %w", err)
+	}
+	return nil
+}
+
+// DeleteWidgetShare revokes the access of a user to a widget.
+func DeleteWidgetShare(widgetID string, userID int) error {
+	result, err := DB.Exec(`DELETE FROM widget_shares WHERE widget_id = ? AND user_id = ?`, widgetID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete widget share: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("widget share not found")
+	}
+	return nil
+}
+
+// SaveWidgetShareLayout stores the recipient's position and width of a
+// widget shared with them.
+func SaveWidgetShareLayout(widgetID string, userID, position, cols int) error {
+	query := `UPDATE widget_shares SET position = ?, cols = ? WHERE widget_id = ? AND user_id = ?`
+	if _, err := DB.Exec(query, position, cols, widgetID, userID); err != nil {
+		return fmt.Errorf("failed to save widget layout: %w", err)
+	}
+	return nil
+}
+
+// UpdateSharedWidget stores the title and content of a widget shared with
+// the user, with the user's layout, only if it is still at version (0 skips
+// the check). Fails with ErrAccessDenied unless the user is an editor.
+// events are recorded with the write, as in SaveWidget.
+func UpdateSharedWidget(userID int, w models.Widget, version int, events []models.KanbanEvent) error {
+	query := `
+	UPDATE widgets SET title = ?, content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND is_active = 1 AND (? = 0 OR version = ?) AND id IN (
+		SELECT widget_id FROM widget_shares WHERE user_id = ? AND role = ?
+	)`
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save widget: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, w.Title, string(w.Content), w.ID, version, version, userID, models.ShareRoleEditor)
+	if err != nil {
+		return fmt.Errorf("failed to save widget: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrAccessDenied
+	}
+	layout := `UPDATE widget_shares SET position = ?, cols = ? WHERE widget_id = ? AND user_id = ?`
+	if _, err := tx.Exec(layout, w.Position, w.Cols, w.ID, userID); err != nil {
+		return fmt.Errorf("failed to save widget layout: %w", err)
+	}
+	if err := addKanbanEvents(tx, w.ID, events, time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save widget: %w", err)
+	}
+	indexWidget(w.ID)
+	return nil
+}
+
+// GetWidgetAudience returns the owner and the recipients of a widget, with
+// its current version and state. users is empty if the widget doesn't
+// exist.
+func GetWidgetAudience(widgetID string) (users []int, version int, active bool, err error) {
+	query := `SELECT COALESCE(user_id, 0), version, is_active FROM widgets WHERE id = ?`
+	var owner int
+	if err := DB.QueryRow(query, widgetID).Scan(&owner, &version, &active); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, fmt.Errorf("failed to query widget: %w", err)
+	}
+	users = append(users, owner)
+
+	rows, err := DB.Query(`SELECT user_id FROM widget_shares WHERE widget_id = ?`, widgetID)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to query widget shares: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, 0, false, fmt.Errorf("failed to scan widget share: %w", err)
+		}
+		users = append(users, id)
+	}
+	return users, version, active, rows.Err()
+}
+
+// IsWidgetMember reports whether the user with the given name owns the widget
+// or is one of its recipients.
+func IsWidgetMember(widgetID, username string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM users u
+		WHERE u.username = ?
+		AND (EXISTS (SELECT 1 FROM widgets w WHERE w.id = ? AND w.user_id = u.id)
+			OR EXISTS (SELECT 1 FROM widget_shares s WHERE s.widget_id = ? AND s.user_id = u.id))
+	)`
+	var member bool
+	if err := DB.QueryRow(query, username, widgetID, widgetID).Scan(&member); err != nil {
+		return false, fmt.Errorf("failed to query widget members: %w", err)
+	}
+	return member, nil
+}
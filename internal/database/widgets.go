@@ -4,14 +4,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"database/sql"
+	"time"
 
 	"github.com/gabrielhirakawa/lifehub/internal/models"
 )
 
-// GetAllWidgets retrieves all active widgets for a specific user.
+// GetAllWidgets retrieves all active widgets for a specific user, including
+// the widgets shared with them, at their own position.
 func GetAllWidgets(userID int) ([]models.Widget, error) {
-	query := `SELECT id, type, title, cols, position, is_active, content, created_at, updated_at FROM widgets WHERE is_active = 1 AND user_id = ? ORDER BY position ASC`
-	rows, err := DB.Query(query, userID)
+	query := `
+	SELECT id, type, title, cols, position, is_active, content, version, created_at, updated_at, '', ''
+	FROM widgets WHERE is_active = 1 AND user_id = ?
+	UNION ALL
+	SELECT w.id, w.type, w.title, s.cols, s.position, w.is_active, w.content, w.version, w.created_at, w.updated_at, s.role, COALESCE(u.username, '')
+	FROM widget_shares s
+	JOIN widgets w ON w.id = s.widget_id
+	LEFT JOIN users u ON u.id = w.user_id
+	WHERE w.is_active = 1 AND s.user_id = ?
+	ORDER BY position ASC`
+	rows, err := DB.Query(query, userID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query widgets: %w", err)
 	}
@@ -22,7 +33,7 @@ func GetAllWidgets(userID int) ([]models.Widget, error) {
 		var w models.Widget
 		var contentStr string // Temporary string to hold JSON content
 
-		if err := rows.Scan(&w.ID, &w.Type, &w.Title, &w.Cols, &w.Position, &w.IsActive, &contentStr, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		if err := rows.Scan(&w.ID, &w.Type, &w.Title, &w.Cols, &w.Position, &w.IsActive, &contentStr, &w.Version, &w.CreatedAt, &w.UpdatedAt, &w.Role, &w.Owner); err != nil {
 			return nil, fmt.Errorf("failed to scan widget: %w", err)
 		}
 
@@ -38,8 +49,12 @@ func GetAllWidgets(userID int) ([]models.Widget, error) {
 	return widgets, nil
 }
 
-// SaveWidget inserts or updates a widget for a specific user.
-func SaveWidget(userID int, w models.Widget) error {
+// SaveWidget inserts or updates a widget for a specific user. A non-zero
+// version is the version an existing widget must still be at. Fails with
+// ErrAccessDenied if the ID is taken by a widget of another user or the
+// version didn't match. events are the card transitions of a Kanban widget,
+// recorded with the write.
+func SaveWidget(userID int, w models.Widget, version int, events []models.KanbanEvent) error {
 	// Check if widget exists and belongs to user (for update)
 	// Or just upsert with user_id.
 	// If it's a new widget, we insert with user_id.
@@ -60,28 +75,47 @@ func SaveWidget(userID int, w models.Widget) error {
 		position = excluded.position,
 		is_active = excluded.is_active,
 		content = excluded.content,
+		version = version + 1,
 		updated_at = CURRENT_TIMESTAMP
+	WHERE widgets.user_id = excluded.user_id AND (? = 0 OR widgets.version = ?)
 		-- We don't update user_id to prevent taking over other's widgets if ID collision happens (very rare)
-		-- But actually, if we want to enforce ownership, we should check before saving.
-		-- For now, let's assume the frontend sends valid IDs for the user.
+		-- Widgets shared with the user are saved with UpdateSharedWidget.
 		;
 	`
 
 	// Convert RawMessage to string for storage
 	contentStr := string(w.Content)
 
-	_, err := DB.Exec(query, w.ID, userID, w.Type, w.Title, w.Cols, w.Position, w.IsActive, contentStr)
+	tx, err := DB.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to save widget: %w", err)
 	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, w.ID, userID, w.Type, w.Title, w.Cols, w.Position, w.IsActive, contentStr, version, version)
+	if err != nil {
+		return fmt.Errorf("failed to save widget: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrAccessDenied
+	}
+	if err := addKanbanEvents(tx, w.ID, events, time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save widget: %w", err)
+	}
+	indexWidget(w.ID)
 
 	return nil
 }
 
 // DeleteWidget soft deletes a widget by setting is_active to false, ensuring it belongs to user.
-func DeleteWidget(userID int, id string) error {
-	query := `UPDATE widgets SET is_active = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`
-	result, err := DB.Exec(query, id, userID)
+// A non-zero version is the version the widget must still be at.
+func DeleteWidget(userID int, id string, version int) error {
+	query := `UPDATE widgets SET is_active = 0, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND (? = 0 OR version = ?)`
+	result, err := DB.Exec(query, id, userID, version, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete widget: %w", err)
 	}
@@ -89,18 +123,27 @@ func DeleteWidget(userID int, id string) error {
 	if rows == 0 {
 		return fmt.Errorf("widget not found or access denied")
 	}
+	indexWidget(id)
 	return nil
 }
 
-// GetWidgetByID retrieves a single widget by ID for a specific user.
+// GetWidgetByID retrieves a single widget by ID for a specific user, either
+// their own or shared with them. For shared widgets, Role is set and UserID
+// is the owner.
 func GetWidgetByID(userID int, id string) (*models.Widget, error) {
-	query := `SELECT id, type, title, cols, position, is_active, content, created_at, updated_at FROM widgets WHERE id = ? AND user_id = ?`
-	row := DB.QueryRow(query, id, userID)
+	query := `
+	SELECT w.id, w.type, w.title, COALESCE(s.cols, w.cols), COALESCE(s.position, w.position), w.is_active, w.content, w.version, w.created_at, w.updated_at,
+		COALESCE(w.user_id, 0), COALESCE(s.role, ''), COALESCE(u.username, '')
+	FROM widgets w
+	LEFT JOIN widget_shares s ON s.widget_id = w.id AND s.user_id = ?
+	LEFT JOIN users u ON u.id = w.user_id AND s.user_id IS NOT NULL
+	WHERE w.id = ? AND (w.user_id = ? OR s.user_id IS NOT NULL)`
+	row := DB.QueryRow(query, userID, id, userID)
 
 	var w models.Widget
 	var contentStr string
 
-	if err := row.Scan(&w.ID, &w.Type, &w.Title, &w.Cols, &w.Position, &w.IsActive, &contentStr, &w.CreatedAt, &w.UpdatedAt); err != nil {
+	if err := row.Scan(&w.ID, &w.Type, &w.Title, &w.Cols, &w.Position, &w.IsActive, &contentStr, &w.Version, &w.CreatedAt, &w.UpdatedAt, &w.UserID, &w.Role, &w.Owner); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Not found
 		}
@@ -108,5 +151,72 @@ func GetWidgetByID(userID int, id string) (*models.Widget, error) {
 	}
 
 	w.Content = json.RawMessage(contentStr)
+	if w.Role == "" {
+		w.UserID = 0
+	}
 	return &w, nil
 }
+
+// GetActiveWidgetsByType retrieves the active widgets of a type across all users.
+// Used by background jobs; the owner is returned in Widget.UserID.
+func GetActiveWidgetsByType(widgetType models.WidgetType) ([]models.Widget, error) {
+	query := `SELECT id, user_id, type, title, cols, position, is_active, content, version, created_at, updated_at FROM widgets WHERE is_active = 1 AND type = ? AND user_id IS NOT NULL`
+	rows, err := DB.Query(query, widgetType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query widgets: %w", err)
+	}
+	defer rows.Close()
+
+	var widgets []models.Widget
+	for rows.Next() {
+		var w models.Widget
+		var contentStr string
+
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Type, &w.Title, &w.Cols, &w.Position, &w.IsActive, &contentStr, &w.Version, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan widget: %w", err)
+		}
+
+		w.Content = json.RawMessage(contentStr)
+		widgets = append(widgets, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return widgets, nil
+}
+
+// UpdateWidgetContent replaces the content of a widget the user owns or
+// edits, only if it is still at version. Returns false if the widget changed
+// in the meantime, so that server-side changes never overwrite concurrent
+// saves. events are recorded with the write, as in SaveWidget.
+func UpdateWidgetContent(userID int, id string, version int, content json.RawMessage, events []models.KanbanEvent) (bool, error) {
+	query := `
+	UPDATE widgets SET content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND version = ? AND (user_id = ? OR id IN (
+		SELECT widget_id FROM widget_shares WHERE user_id = ? AND role = ?
+	))`
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to update widget content: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, string(content), id, version, userID, userID, models.ShareRoleEditor)
+	if err != nil {
+		return false, fmt.Errorf("failed to update widget content: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return false, nil
+	}
+	if err := addKanbanEvents(tx, id, events, time.Now()); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to update widget content: %w", err)
+	}
+	indexWidget(id)
+	return true, nil
+}
@@ -0,0 +1,115 @@
+// Package ical reads and writes the parts of iCalendar (RFC 5545) used by
+// the calendar feed and CalDAV: calendars of VEVENT and VTODO components.
+package ical
+
+import (
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of iCalendar documents.
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineLength is the maximum length of a content line, in octets,
+// excluding the line break.
+const maxLineLength = 75
+
+// Writer builds an iCalendar document.
+type Writer struct {
+	b strings.Builder
+}
+
+// Begin opens a component, e.g. VCALENDAR or VEVENT.
+func (w *Writer) Begin(component string) {
+	w.line("BEGIN:" + component)
+}
+
+// End closes a component.
+func (w *Writer) End(component string) {
+	w.line("END:" + component)
+}
+
+// Text writes a property with a text value, escaping it. Empty values
+// are omitted.
+func (w *Writer) Text(name, value string) {
+	if value != "" {
+		w.line(name + ":" + Escape(value))
+	}
+}
+
+// Raw writes a property whose value is already formatted, such as dates or
+// recurrence rules. name may include parameters: "DTSTART;VALUE=DATE".
+// Empty values are omitted.
+func (w *Writer) Raw(name, value string) {
+	if value != "" {
+		w.line(name + ":" + value)
+	}
+}
+
+// String returns the document.
+func (w *Writer) String() string {
+	return w.b.String()
+}
+
+// line writes a content line, folded at 75 octets without splitting UTF-8
+// sequences.
+func (w *Writer) line(s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8Start(s[cut]) {
+			cut--
+		}
+		w.b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = maxLineLength - 1 // Continuation lines start with a space
+	}
+	w.b.WriteString(s + "\r\n")
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// Escape escapes a text value.
+func Escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// Unescape reverses Escape.
+func Unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Date formats a YYYY-MM-DD date as a DATE value. Returns "" for invalid
+// dates.
+func Date(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	return t.Format("20060102")
+}
+
+// UTC formats an instant as a UTC DATE-TIME value.
+func UTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Property is a content line: NAME;PARAM=value:VALUE. Names and parameter
+// names are upper case; values are kept raw (see Unescape).
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a BEGIN/END block, e.g. a VCALENDAR and its VEVENTs.
+type Component struct {
+	Name       string
+	Properties []Property
+	Children   []*Component
+}
+
+// Get returns the first property with the given name, nil if none.
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Text returns the unescaped value of the first property with the given
+// name, empty if none.
+func (c *Component) Text(name string) string {
+	if p := c.Get(name); p != nil {
+		return Unescape(p.Value)
+	}
+	return ""
+}
+
+// All returns the properties with the given name.
+func (c *Component) All(name string) []Property {
+	var props []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Components returns the children with the given name.
+func (c *Component) Components(name string) []*Component {
+	var children []*Component
+	for _, child := range c.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// maxParseLines bounds the documents Parse accepts.
+const maxParseLines = 200000
+
+// Parse reads an iCalendar document and returns its first VCALENDAR.
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	var calendar *Component
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			c := &Component{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("unexpected END:%s", prop.Value)
+			}
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 && c.Name == "VCALENDAR" {
+				return c, nil
+			}
+			if len(stack) == 0 && calendar == nil {
+				calendar = c
+			}
+		default:
+			if len(stack) == 0 {
+				continue // Garbage outside of the calendar
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, prop)
+		}
+	}
+	if calendar == nil || calendar.Name != "VCALENDAR" {
+		return nil, errors.New("no VCALENDAR found")
+	}
+	return calendar, nil
+}
+
+// unfold reads the content lines of a document, joining folded lines.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if len(lines) >= maxParseLines {
+			return nil, errors.New("calendar too large")
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into its name, parameters and value.
+// Quoted parameter values may contain ':' and ';'.
+func parseLine(line string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return prop, fmt.Errorf("invalid content line %q", line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return prop, fmt.Errorf("invalid parameter in %s", prop.Name)
+		}
+		name := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return prop, fmt.Errorf("unterminated quote in %s", prop.Name)
+			}
+			value = line[1 : end+1]
+			line = line[end+2:]
+			i = 0
+		} else {
+			i = strings.IndexAny(line, ";:")
+			if i < 0 {
+				return prop, fmt.Errorf("missing value in %s", prop.Name)
+			}
+			value = line[:i]
+			line = line[i:]
+			i = 0
+		}
+		prop.Params[name] = value
+		if line == "" {
+			return prop, fmt.Errorf("missing value in %s", prop.Name)
+		}
+	}
+	if line[i] != ':' {
+		return prop, fmt.Errorf("invalid content line in %s", prop.Name)
+	}
+	prop.Value = line[i+1:]
+	return prop, nil
+}
+
+// DateTime parses a DATE or DATE-TIME property value. Floating times and
+// unknown TZIDs are read in loc. allDay is true for DATE values.
+func (p *Property) DateTime(loc *time.Location) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.Value)
+	if p.Params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err = time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// Dates parses the comma separated values of a multi-valued date property
+// such as EXDATE.
+func (p *Property) Dates(loc *time.Location) []time.Time {
+	var dates []time.Time
+	for _, v := range strings.Split(p.Value, ",") {
+		single := Property{Name: p.Name, Params: p.Params, Value: v}
+		if t, _, err := single.DateTime(loc); err == nil {
+			dates = append(dates, t)
+		}
+	}
+	return dates
+}
@@ -0,0 +1,100 @@
+package ical
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFixture(t *testing.T, name string) *Component {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cal, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func TestParse(t *testing.T) {
+	cal := parseFixture(t, "calendar.ics")
+	if cal.Name != "VCALENDAR" || cal.Text("X-WR-CALNAME") != "Team, shared" {
+		t.Fatalf("calendar = %s %q", cal.Name, cal.Text("X-WR-CALNAME"))
+	}
+	if n := len(cal.Components("VEVENT")); n != 2 {
+		t.Fatalf("%d events, want 2", n)
+	}
+	if n := len(cal.Components("VTODO")); n != 1 {
+		t.Fatalf("%d todos, want 1", n)
+	}
+
+	event := cal.Components("VEVENT")[0]
+	want := "Quarterly review: budget; hiring, and a very long summary that is folded over two lines"
+	if got := event.Text("SUMMARY"); got != want {
+		t.Errorf("SUMMARY = %q, want %q", got, want)
+	}
+	if got := event.Text("DESCRIPTION"); got != "First line\nSecond line" {
+		t.Errorf("DESCRIPTION = %q", got)
+	}
+	attendee := event.Get("ATTENDEE")
+	if attendee.Params["CN"] != "Doe, Jane" || attendee.Params["ROLE"] != "REQ-PARTICIPANT" || attendee.Value != "mailto:jane@example.com" {
+		t.Errorf("ATTENDEE = %+v", attendee)
+	}
+	if alarms := event.Components("VALARM"); len(alarms) != 1 || alarms[0].Text("TRIGGER") != "-PT15M" {
+		t.Errorf("VALARM = %+v", alarms)
+	}
+	if event.Get("TRIGGER") != nil {
+		t.Error("properties of a child component leaked into its parent")
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	cal := parseFixture(t, "calendar.ics")
+	events := cal.Components("VEVENT")
+	ny, _ := time.LoadLocation("America/New_York")
+
+	// TZID wins over the default location; Paris is still on CET
+	start, allDay, err := events[0].Get("DTSTART").DateTime(ny)
+	if err != nil || allDay {
+		t.Fatal(start, allDay, err)
+	}
+	if want := time.Date(2030, 3, 25, 9, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("DTSTART = %v, want %v", start.UTC(), want)
+	}
+
+	holiday, allDay, err := events[1].Get("DTSTART").DateTime(ny)
+	if err != nil || !allDay || holiday.Format("2006-01-02") != "2030-07-14" || holiday.Location() != ny {
+		t.Errorf("DATE = %v, %v, %v", holiday, allDay, err)
+	}
+
+	due, _, err := cal.Components("VTODO")[0].Get("DUE").DateTime(ny)
+	if err != nil || !due.Equal(time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("UTC DUE = %v, %v", due, err)
+	}
+
+	exdates := events[0].Get("EXDATE").Dates(ny)
+	if len(exdates) != 2 || exdates[1].UTC().Format(time.DateTime) != "2030-04-08 08:00:00" {
+		t.Errorf("EXDATE = %v", exdates)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"no calendar":       "BEGIN:VEVENT\nUID:x\nEND:VEVENT\n",
+		"unbalanced END":    "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n",
+		"invalid line":      "BEGIN:VCALENDAR\nnot a content line\nEND:VCALENDAR\n",
+		"unterminated":      "BEGIN:VCALENDAR\nATTENDEE;CN=\"Doe:mailto:x\nEND:VCALENDAR\n",
+		"missing value":     "BEGIN:VCALENDAR\nDTSTART;TZID=Europe/Paris\nEND:VCALENDAR\n",
+		"missing parameter": "BEGIN:VCALENDAR\nDTSTART;TZID:20300101T000000\nEND:VCALENDAR\n",
+	}
+	for name, doc := range tests {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: Parse() succeeded", name)
+		}
+	}
+}
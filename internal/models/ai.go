@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AI message roles, matching the roles of the AI Coach chat history.
+const (
+	AIRoleUser  = "user"
+	AIRoleModel = "model"
+)
+
+// AIConversation is a chat thread with the AI Coach. Token and cost totals
+// are summed from its messages.
+type AIConversation struct {
+	ID           string    `json:"id"`
+	WidgetID     string    `json:"widgetId,omitempty"`
+	Title        string    `json:"title"`
+	MessageCount int       `json:"messageCount"`
+	InputTokens  int       `json:"inputTokens"`
+	OutputTokens int       `json:"outputTokens"`
+	CostUSD      float64   `json:"costUsd"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AIMessage is one message of a conversation. Usage is recorded on the
+// model's answers: the input tokens include the dashboard context and the
+// history sent along the question.
+type AIMessage struct {
+	ID             int64      `json:"id"`
+	ConversationID string     `json:"conversationId"`
+	Role           string     `json:"role"` // "user" or "model"
+	Text           string     `json:"text"`
+	Provider       string     `json:"provider,omitempty"`
+	Model          string     `json:"model,omitempty"`
+	InputTokens    int        `json:"inputTokens,omitempty"`
+	OutputTokens   int        `json:"outputTokens,omitempty"`
+	CostUSD        float64    `json:"costUsd,omitempty"`
+	Actions        []AIAction `json:"actions,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// AI action statuses. Actions proposed by the model are only applied once
+// the user confirms them.
+const (
+	AIActionProposed = "proposed"
+	AIActionApplying = "applying"
+	AIActionApplied  = "applied"
+	AIActionRejected = "rejected"
+	AIActionFailed   = "failed"
+)
+
+// AIAction is a change to a widget proposed by the AI Coach through a tool
+// call (add a todo, log water...).
+type AIAction struct {
+	ID             string          `json:"id"`
+	ConversationID string          `json:"conversationId"`
+	MessageID      int64           `json:"messageId"`
+	WidgetID       string          `json:"widgetId"`
+	Tool           string          `json:"tool"`
+	Arguments      json.RawMessage `json:"arguments"`
+	Summary        string          `json:"summary"`
+	Status         string          `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ResolvedAt     *time.Time      `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Attachment represents an uploaded file (e.g. an image pasted into a note).
+// The file bytes are stored on disk, addressed by their SHA-256 hash, so
+// identical uploads share the same blob.
+type Attachment struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"-"`
+	Hash      string    `json:"-"`
+	Filename  string    `json:"filename"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
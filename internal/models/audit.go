@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records a change made on behalf of the user by something other
+// than the user editing a widget, such as an AI action.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"` // e.g. "ai.add_todo"
+	WidgetID  string          `json:"widgetId,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// CalendarSubscription is an iCalendar URL whose events are periodically
+// imported into a Reminder widget.
+type CalendarSubscription struct {
+	ID           int        `json:"id"`
+	WidgetID     string     `json:"widgetId"`
+	URL          string     `json:"url"`
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
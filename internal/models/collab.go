@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CollabDocument is the compacted state of a text edited collaboratively:
+// a wiki page or a note tab. Text is the plain Markdown it was compacted
+// to, as stored in the widget content.
+type CollabDocument struct {
+	ID        string          `json:"id"` // {widgetId}/{pageId or tabId}
+	WidgetID  string          `json:"widgetId"`
+	State     json.RawMessage `json:"state"`
+	Text      string          `json:"text"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// CollabUpdate is a batch of CRDT operations not compacted yet. Text is set
+// for the updates merging a text saved with the widget: the text merged.
+type CollabUpdate struct {
+	ID   int64           `json:"id"`
+	Ops  json.RawMessage `json:"ops"`
+	Text *string         `json:"text,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// Digest kinds.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSettings controls the morning summary of the dashboard. The weekly
+// digest replaces the daily one on its day. Delivery also follows the
+// "digest" notification category and quiet hours.
+type DigestSettings struct {
+	Daily     bool   `json:"daily"`
+	Weekly    bool   `json:"weekly"`
+	Time      string `json:"time"`      // HH:MM local time
+	WeeklyDay string `json:"weeklyDay"` // "monday" ... "sunday"
+	Language  string `json:"language"`  // en-us or pt-br
+	// AIProvider rewrites the digest with the user's configured provider
+	// when set; AIModel defaults to the provider's default model.
+	AIProvider string `json:"aiProvider,omitempty"`
+	AIModel    string `json:"aiModel,omitempty"`
+}
+
+// DefaultDigestSettings returns the settings used until the user opts in.
+func DefaultDigestSettings() DigestSettings {
+	return DigestSettings{
+		Time:      "07:00",
+		WeeklyDay: "monday",
+		Language:  "en-us",
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// KanbanEvent records a card entering or leaving a column of a Kanban
+// widget. FromColumn is empty when the card was created, ToColumn when it
+// was deleted.
+type KanbanEvent struct {
+	ID         int64     `json:"id"`
+	CardID     string    `json:"cardId"`
+	FromColumn string    `json:"fromColumn,omitempty"`
+	ToColumn   string    `json:"toColumn,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NotificationCategory groups notifications so users can toggle them.
+type NotificationCategory string
+
+const (
+	NotificationReminders NotificationCategory = "reminders"
+	NotificationPomodoro  NotificationCategory = "pomodoro"
+	NotificationHydration NotificationCategory = "hydration"
+	NotificationDigest    NotificationCategory = "digest"
+	// NotificationSystem covers test and account messages; it can't be disabled.
+	NotificationSystem NotificationCategory = "system"
+)
+
+// NotificationCategories holds the per-category toggles.
+type NotificationCategories struct {
+	Reminders bool `json:"reminders"`
+	Pomodoro  bool `json:"pomodoro"`
+	Hydration bool `json:"hydration"`
+	Digest    bool `json:"digest"`
+}
+
+// QuietHours is a daily window (in the user's timezone) during which
+// non-urgent notifications are held back. Start may be after End for
+// windows spanning midnight, e.g. 22:00-07:00.
+type QuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"` // HH:MM
+	End     string `json:"end"`   // HH:MM
+}
+
+// NotificationSettings are the notification preferences of a user.
+type NotificationSettings struct {
+	Categories   NotificationCategories `json:"categories"`
+	QuietHours   QuietHours             `json:"quietHours"`
+	MutedDevices []int                  `json:"mutedDevices"` // Push subscription IDs
+}
+
+// DefaultNotificationSettings enables everything, without quiet hours.
+func DefaultNotificationSettings() NotificationSettings {
+	return NotificationSettings{
+		Categories: NotificationCategories{
+			Reminders: true,
+			Pomodoro:  true,
+			Hydration: true,
+			Digest:    true,
+		},
+		QuietHours: QuietHours{
+			Start: "22:00",
+			End:   "07:00",
+		},
+		MutedDevices: []int{},
+	}
+}
+
+// Allows reports whether notifications of the category are enabled.
+func (s NotificationSettings) Allows(category NotificationCategory) bool {
+	switch category {
+	case NotificationReminders:
+		return s.Categories.Reminders
+	case NotificationPomodoro:
+		return s.Categories.Pomodoro
+	case NotificationHydration:
+		return s.Categories.Hydration
+	case NotificationDigest:
+		return s.Categories.Digest
+	default:
+		return true
+	}
+}
+
+// ChannelType identifies how a notification channel delivers messages.
+type ChannelType string
+
+const (
+	ChannelSMTP    ChannelType = "smtp"
+	ChannelNtfy    ChannelType = "ntfy"
+	ChannelGotify  ChannelType = "gotify"
+	ChannelWebhook ChannelType = "webhook"
+)
+
+// NotificationChannel is a user-configured delivery target besides Web Push.
+// Config holds the type specific settings (see the api package notifiers).
+type NotificationChannel struct {
+	ID        int             `json:"id"`
+	Type      ChannelType     `json:"type"`
+	Name      string          `json:"name"`
+	Enabled   bool            `json:"enabled"`
+	Config    json.RawMessage `json:"config"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SearchResult is an item of a widget matching a search: a note tab, a wiki
+// page, a todo, a Kanban card, a link or a reminder. Title and Snippet are
+// HTML escaped, with the matched terms in <mark> tags.
+type SearchResult struct {
+	WidgetID    string     `json:"widgetId"`
+	WidgetType  WidgetType `json:"widgetType"`
+	WidgetTitle string     `json:"widgetTitle"`
+	ItemID      string     `json:"itemId,omitempty"` // Empty for the legacy single note
+	Title       string     `json:"title,omitempty"`
+	Snippet     string     `json:"snippet"`
+	Rank        float64    `json:"rank"`       // Lower is better
+	UpdatedAt   time.Time  `json:"updated_at"` // Last change of the item's text
+}
@@ -0,0 +1,15 @@
+package models
+
+// UserSettings holds per-user preferences used by server-side features.
+type UserSettings struct {
+	Timezone     string `json:"timezone"`     // IANA name, e.g. "America/Sao_Paulo"
+	ReminderTime string `json:"reminderTime"` // HH:MM local time reminders are due
+}
+
+// DefaultUserSettings returns the settings used until the user saves their own.
+func DefaultUserSettings() UserSettings {
+	return UserSettings{
+		Timezone:     "UTC",
+		ReminderTime: "09:00",
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Roles of the users a widget is shared with. Viewers can read the widget
+// and arrange it on their dashboard; editors can also change it.
+const (
+	ShareRoleViewer = "viewer"
+	ShareRoleEditor = "editor"
+)
+
+// WidgetShare grants another user access to a widget. The recipient keeps
+// their own layout of the widget.
+type WidgetShare struct {
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
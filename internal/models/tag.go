@@ -0,0 +1,18 @@
+package models
+
+// TagCount is a tag of the user's items, with the number of items having it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TaggedItem is an item having a tag: a todo, a reminder, a Kanban card, a
+// note tab or a wiki page. URL opens its widget on the dashboard.
+type TaggedItem struct {
+	WidgetID    string     `json:"widgetId"`
+	WidgetType  WidgetType `json:"widgetType"`
+	WidgetTitle string     `json:"widgetTitle"`
+	ItemID      string     `json:"itemId,omitempty"` // Empty for the legacy single note
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+}
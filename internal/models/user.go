@@ -9,3 +9,12 @@ type User struct {
 	Password  string    `json:"-"` // Never return password in JSON
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// APIToken is a credential for clients that can't log in with a cookie,
+// such as CalDAV apps. Only a hash of the token is stored.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
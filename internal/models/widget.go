@@ -24,13 +24,14 @@ const (
 
 // WikiPage represents a single page in the Wiki widget
 type WikiPage struct {
-	ID       string `json:"id"`
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	IsPublic bool   `json:"isPublic"`
-	PublicID string `json:"publicId,omitempty"`
-	Author   string `json:"author,omitempty"`
-	Date     string `json:"date,omitempty"`
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	IsPublic bool     `json:"isPublic"`
+	PublicID string   `json:"publicId,omitempty"`
+	Author   string   `json:"author,omitempty"`
+	Date     string   `json:"date,omitempty"`
+	Tags     []string `json:"tags,omitempty"` // Explicit tags, besides the #tags of the content
 }
 
 // WikiData represents the data structure for the Wiki widget
@@ -39,21 +40,220 @@ type WikiData struct {
 	ActivePageID string     `json:"activePageId,omitempty"`
 }
 
+// Todo priorities
+const (
+	TodoPriorityLow    = "low"
+	TodoPriorityMedium = "medium"
+	TodoPriorityHigh   = "high"
+)
+
+// Recurrence makes a todo or reminder repeat. Only the current occurrence
+// of a series is stored as pending: completing it materialises the next one,
+// with the same Recurrence.
+type Recurrence struct {
+	RRule       string   `json:"rrule,omitempty"`       // RFC 5545 RRULE, e.g. FREQ=WEEKLY;BYDAY=MO,WE
+	SeriesID    string   `json:"seriesId,omitempty"`    // ID of the first occurrence
+	SeriesStart string   `json:"seriesStart,omitempty"` // Date of the first occurrence (DTSTART)
+	ExDates     []string `json:"exdates,omitempty"`     // Skipped occurrences, YYYY-MM-DD
+}
+
+// TodoItem represents a single task in the Todo widget
+type TodoItem struct {
+	ID          string   `json:"id"`
+	Text        string   `json:"text"`
+	Completed   bool     `json:"completed"`
+	Archived    bool     `json:"archived,omitempty"`
+	Priority    string   `json:"priority,omitempty"`    // low, medium or high
+	DueDate     string   `json:"dueDate,omitempty"`     // YYYY-MM-DD
+	CompletedAt string   `json:"completedAt,omitempty"` // RFC3339
+	RolledOver  int      `json:"rolledOver,omitempty"`  // Days the task was carried over past its due date
+	Tags        []string `json:"tags,omitempty"`        // Explicit tags, besides the #tags of the text
+	Recurrence           // Recurring tasks require a due date
+}
+
+// ReminderItem represents a single entry in the Reminder widget
+type ReminderItem struct {
+	ID        string   `json:"id"`
+	Text      string   `json:"text"`
+	Date      string   `json:"date"` // YYYY-MM-DD
+	Completed bool     `json:"completed"`
+	Tags      []string `json:"tags,omitempty"` // Explicit tags, besides the #tags of the text
+	Recurrence
+	// Imported reminders: UID of the calendar event, and the subscription
+	// it comes from (0 for uploaded files)
+	SourceID       string `json:"sourceId,omitempty"`
+	SubscriptionID int    `json:"subscriptionId,omitempty"`
+}
+
+// NoteTab represents a tab of the Note widget
+type NoteTab struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags,omitempty"` // Explicit tags, besides the #tags of the content
+}
+
+// LinkItem represents a pinned link in the Links widget
+type LinkItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// KanbanChecklistItem is an entry of the checklist of a Kanban card
+type KanbanChecklistItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// KanbanItem represents a card in a Kanban column
+type KanbanItem struct {
+	ID          string                `json:"id"`
+	Content     string                `json:"content"` // Title of the card
+	Description string                `json:"description,omitempty"`
+	Labels      []string              `json:"labels,omitempty"`  // Also the tags of the card
+	DueDate     string                `json:"dueDate,omitempty"` // YYYY-MM-DD
+	Checklist   []KanbanChecklistItem `json:"checklist,omitempty"`
+	Assignee    string                `json:"assignee,omitempty"` // Username, on shared boards
+}
+
+// KanbanColumn represents a column of the Kanban widget
+type KanbanColumn struct {
+	ID        string       `json:"id"`
+	Title     string       `json:"title"`
+	Items     []KanbanItem `json:"items"`
+	WIPLimit  int          `json:"wipLimit,omitempty"`  // Maximum number of cards, 0 for none
+	WIPStrict bool         `json:"wipStrict,omitempty"` // Reject cards over the limit instead of warning
+}
+
+// WellnessRecord is the water intake (ml) of one day
+type WellnessRecord struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	Amount float64 `json:"amount"`
+}
+
+// WellnessData represents the data structure for the Wellness widget
+type WellnessData struct {
+	WaterIntakeMl float64          `json:"waterIntakeMl,omitempty"` // Deprecated, replaced by History
+	History       []WellnessRecord `json:"history,omitempty"`
+	GoalMl        float64          `json:"goalMl,omitempty"` // Daily goal, used by the digest
+}
+
+// GymSet is a set of an exercise. Reps and weight are typed freely in the
+// UI, so they may be numbers or strings.
+type GymSet struct {
+	ID        string          `json:"id"`
+	Reps      json.RawMessage `json:"reps"`
+	Weight    json.RawMessage `json:"weight"`
+	Completed bool            `json:"completed"`
+}
+
+// GymExerciseLog holds the sets done for one exercise in a session
+type GymExerciseLog struct {
+	ExerciseName string   `json:"exerciseName"`
+	Sets         []GymSet `json:"sets"`
+}
+
+// GymSession is a workout, finished or in progress
+type GymSession struct {
+	ID           string           `json:"id"`
+	TemplateName string           `json:"templateName"`
+	StartTime    string           `json:"startTime"`         // ISO string
+	EndTime      string           `json:"endTime,omitempty"` // ISO string
+	Logs         []GymExerciseLog `json:"logs"`
+}
+
+// GymTemplate is a workout routine
+type GymTemplate struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Exercises []string `json:"exercises"`
+}
+
+// GymData represents the data structure for the Gym widget
+type GymData struct {
+	Templates     []GymTemplate `json:"templates"`
+	History       []GymSession  `json:"history"`
+	ActiveSession *GymSession   `json:"activeSession,omitempty"`
+}
+
+// PomodoroData represents the state of the Pomodoro widget
+type PomodoroData struct {
+	TimeLeft        int    `json:"timeLeft"`          // Seconds
+	EndTime         int64  `json:"endTime,omitempty"` // Unix milliseconds
+	IsActive        bool   `json:"isActive"`
+	Mode            string `json:"mode"` // work, shortBreak or longBreak
+	CyclesCompleted int    `json:"cyclesCompleted"`
+}
+
+// DietFood is a food entry of a meal
+type DietFood struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Calories float64 `json:"calories"`
+	Protein  float64 `json:"protein,omitempty"`
+}
+
+// DietMeal is a meal of a day (Breakfast, Lunch...)
+type DietMeal struct {
+	ID    string     `json:"id"`
+	Name  string     `json:"name"`
+	Items []DietFood `json:"items"`
+}
+
+// DietDayLog holds the meals of one day
+type DietDayLog struct {
+	Date  string     `json:"date"` // YYYY-MM-DD
+	Meals []DietMeal `json:"meals"`
+}
+
+// DietData represents the data structure for the Diet widget
+type DietData struct {
+	CalorieGoal float64      `json:"calorieGoal"`
+	History     []DietDayLog `json:"history"`
+}
+
+// AIConfig is the AI Coach configuration. The API key is no longer kept in
+// widget content: it is moved to the server-side key store on save.
+type AIConfig struct {
+	Provider string `json:"provider"`
+	APIKey   string `json:"apiKey,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
 // WidgetContentWrapper is a helper to unmarshal the raw content
 type WidgetContentWrapper struct {
-	Wiki *WikiData `json:"wiki,omitempty"`
+	Wiki         *WikiData      `json:"wiki,omitempty"`
+	Todos        []TodoItem     `json:"todos,omitempty"`
+	RolloverDate string         `json:"rolloverDate,omitempty"` // Deprecated: replaced by the todo_rollovers table
+	Text         string         `json:"text,omitempty"`         // Deprecated single note, replaced by Notes
+	Notes        []NoteTab      `json:"notes,omitempty"`
+	Wellness     *WellnessData  `json:"wellness,omitempty"`
+	Kanban       []KanbanColumn `json:"kanban,omitempty"`
+	Reminders    []ReminderItem `json:"reminders,omitempty"`
+	Gym          *GymData       `json:"gym,omitempty"`
+	Links        []LinkItem     `json:"links,omitempty"`
+	Pomodoro     *PomodoroData  `json:"pomodoro,omitempty"`
+	Diet         *DietData      `json:"diet,omitempty"`
+	AIConfig     *AIConfig      `json:"aiConfig,omitempty"`
 }
 
 // Widget represents a dashboard widget.
 // It mirrors the frontend WidgetData interface.
 type Widget struct {
 	ID        string          `json:"id" db:"id"`
+	UserID    int             `json:"-" db:"user_id"` // Only set by queries spanning users
 	Type      WidgetType      `json:"type" db:"type"`
 	Title     string          `json:"title" db:"title"`
 	Cols      int             `json:"cols" db:"cols"`
 	Position  int             `json:"position" db:"position"`
 	IsActive  bool            `json:"isActive" db:"is_active"`
-	Content   json.RawMessage `json:"content" db:"content"` // Stored as JSON string in DB
+	Content   json.RawMessage `json:"content" db:"content"`   // Stored as JSON string in DB
+	Version   int             `json:"version" db:"version"`   // Incremented on every write
+	Role      string          `json:"role,omitempty" db:"-"`  // Access to a widget shared with the user, empty for their own
+	Owner     string          `json:"owner,omitempty" db:"-"` // Username of the owner of a shared widget
 	CreatedAt time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
 }
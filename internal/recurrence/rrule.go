@@ -0,0 +1,301 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules
+// used by recurring todos and reminders.
+//
+// Occurrences are calendar dates (YYYY-MM-DD), without a time of day: the
+// time is applied in the user's timezone when an occurrence is due, so that
+// expanding a rule never depends on the timezone or on DST transitions.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+const dateLayout = "2006-01-02"
+
+// maxPeriods bounds the expansion of rules that never match, such as the
+// 31st of every second February.
+const maxPeriods = 5000
+
+var weekdayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a BYDAY value: a weekday, optionally the Nth of the month
+// (N < 0 counts from the end, 0 means every such weekday).
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE. Supported parts are FREQ (DAILY, WEEKLY, MONTHLY,
+// YEARLY), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and WKST.
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time // Zero if unbounded
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	WeekStart  time.Weekday
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE".
+// A leading "RRULE:" is accepted.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1, WeekStart: time.Monday}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return r, errors.New("empty rule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid rule part %q", part)
+		}
+		value = strings.ToUpper(value)
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			switch value {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = value
+			default:
+				return r, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid interval %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid count %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			// Only the date matters: YYYYMMDD or YYYYMMDDTHHMMSS[Z]
+			if len(value) < 8 {
+				return r, fmt.Errorf("invalid until %q", value)
+			}
+			until, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return r, fmt.Errorf("invalid until %q", value)
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := parseWeekdayNum(v)
+				if err != nil {
+					return r, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return r, fmt.Errorf("invalid month day %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			day, ok := weekdayNames[value]
+			if !ok {
+				return r, fmt.Errorf("invalid week start %q", value)
+			}
+			r.WeekStart = day
+		default:
+			return r, fmt.Errorf("unsupported rule part %q", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return r, errors.New("FREQ required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return r, errors.New("COUNT and UNTIL are exclusive")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return r, errors.New("numbered BYDAY is only supported with FREQ=MONTHLY")
+		}
+	}
+	if r.Freq == Yearly && (len(r.ByDay) > 0 || len(r.ByMonthDay) > 0) {
+		return r, errors.New("BYDAY and BYMONTHDAY are not supported with FREQ=YEARLY")
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	day, ok := weekdayNames[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	n := 0
+	if prefix := s[:len(s)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+		}
+	}
+	return WeekdayNum{N: n, Day: day}, nil
+}
+
+// Next returns the first occurrence after the date after of the series
+// starting on start (DTSTART), skipping the dates in exdates. All dates are
+// YYYY-MM-DD. Returns false once the series has ended.
+func (r Rule) Next(start, after string, exdates []string) (string, bool) {
+	dtstart, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return "", false
+	}
+	from, err := time.Parse(dateLayout, after)
+	if err != nil {
+		return "", false
+	}
+	skip := make(map[string]bool, len(exdates))
+	for _, d := range exdates {
+		skip[d] = true
+	}
+
+	count := 0
+	for p := 0; p < maxPeriods; p++ {
+		for _, date := range r.period(dtstart, p) {
+			if date.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && date.After(r.Until) {
+				return "", false
+			}
+			// Excluded dates still count, as in RFC 5545
+			count++
+			if r.Count > 0 && count > r.Count {
+				return "", false
+			}
+			if s := date.Format(dateLayout); date.After(from) && !skip[s] {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// period returns the candidate dates of the pth period of the rule, sorted.
+// Dates are UTC midnights, so that adding days never crosses a DST change.
+func (r Rule) period(dtstart time.Time, p int) []time.Time {
+	var dates []time.Time
+	switch r.Freq {
+	case Daily:
+		day := dtstart.AddDate(0, 0, p*r.Interval)
+		if r.matchesDay(day) && r.matchesMonthDay(day) {
+			dates = append(dates, day)
+		}
+
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := dtstart.AddDate(0, 0, -offset+7*p*r.Interval)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesDay(day) && r.matchesMonthDay(day) {
+				dates = append(dates, day)
+			}
+		}
+
+	case Monthly:
+		first := time.Date(dtstart.Year(), dtstart.Month()+time.Month(p*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+		last := first.AddDate(0, 1, -1).Day()
+		for d := 1; d <= last; d++ {
+			day := first.AddDate(0, 0, d-1)
+			switch {
+			case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+				if d != dtstart.Day() {
+					continue
+				}
+			case !r.matchesMonthDay(day) || !r.matchesMonthWeekday(day, last):
+				continue
+			}
+			dates = append(dates, day)
+		}
+
+	case Yearly:
+		year := dtstart.Year() + p*r.Interval
+		day := time.Date(year, dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, time.UTC)
+		// February 29th only occurs on leap years
+		if day.Day() == dtstart.Day() {
+			dates = append(dates, day)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+// matchesDay checks day against the unnumbered BYDAY values.
+func (r Rule) matchesDay(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthWeekday checks day against BYDAY values within its month,
+// last being the number of days of the month.
+func (r Rule) matchesMonthWeekday(day time.Time, last int) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	nth := (day.Day()-1)/7 + 1
+	nthFromEnd := -((last-day.Day())/7 + 1)
+	for _, d := range r.ByDay {
+		if d.Day == day.Weekday() && (d.N == 0 || d.N == nth || d.N == nthFromEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, n := range r.ByMonthDay {
+		if n == day.Day() || (n < 0 && last+n+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
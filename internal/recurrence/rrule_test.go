@@ -0,0 +1,168 @@
+package recurrence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// occurrences returns up to limit occurrences after the date after.
+func occurrences(t *testing.T, rrule, start, after string, exdates []string, limit int) []string {
+	t.Helper()
+	r, err := Parse(rrule)
+	if err != nil {
+		t.Fatalf("Parse(%q) = %v", rrule, err)
+	}
+	var dates []string
+	for len(dates) < limit {
+		next, ok := r.Next(start, after, exdates)
+		if !ok {
+			break
+		}
+		dates = append(dates, next)
+		after = next
+	}
+	return dates
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		rrule   string
+		start   string
+		after   string
+		exdates []string
+		want    []string
+	}{
+		{"daily", "FREQ=DAILY", "2026-03-01", "2026-03-01", nil, []string{"2026-03-02", "2026-03-03", "2026-03-04"}},
+		{"after is before start", "FREQ=DAILY;INTERVAL=2", "2026-03-05", "2026-03-01", nil, []string{"2026-03-05", "2026-03-07", "2026-03-09"}},
+		{"weekly on several days", "FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-03-02", "2026-03-02", nil, []string{"2026-03-04", "2026-03-06", "2026-03-09"}},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", "2026-03-03", "2026-03-03", nil, []string{"2026-03-05", "2026-03-17", "2026-03-19"}},
+		// Example of RFC 5545, section 3.8.5.3: WKST changes the weeks
+		{"week starting on monday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=MO", "2026-03-03", "2026-03-03", nil, []string{"2026-03-08", "2026-03-17", "2026-03-22"}},
+		{"week starting on sunday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=SU", "2026-03-03", "2026-03-03", nil, []string{"2026-03-15", "2026-03-17", "2026-03-29"}},
+		{"last friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", "2026-01-30", "2026-01-30", nil, []string{"2026-02-27", "2026-03-27", "2026-04-24"}},
+		{"second monday of the month", "FREQ=MONTHLY;BYDAY=2MO", "2026-01-12", "2026-01-12", nil, []string{"2026-02-09", "2026-03-09", "2026-04-13"}},
+		{"31st skips shorter months", "FREQ=MONTHLY", "2026-01-31", "2026-01-31", nil, []string{"2026-03-31", "2026-05-31", "2026-07-31"}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-31", "2026-01-31", nil, []string{"2026-02-28", "2026-03-31", "2026-04-30"}},
+		{"leap day", "FREQ=YEARLY", "2024-02-29", "2024-02-29", nil, []string{"2028-02-29", "2032-02-29", "2036-02-29"}},
+		{"count includes the start", "FREQ=DAILY;COUNT=3", "2026-03-01", "2026-03-01", nil, []string{"2026-03-02", "2026-03-03"}},
+		{"count includes exdates", "FREQ=DAILY;COUNT=3", "2026-03-01", "2026-03-01", []string{"2026-03-02"}, []string{"2026-03-03"}},
+		{"count with byday", "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3", "2026-03-04", "2026-03-01", nil, []string{"2026-03-06", "2026-03-09", "2026-03-13"}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20260303", "2026-03-01", "2026-03-01", nil, []string{"2026-03-02", "2026-03-03"}},
+		{"until with a time", "FREQ=DAILY;UNTIL=20260303T235959Z", "2026-03-01", "2026-03-01", nil, []string{"2026-03-02", "2026-03-03"}},
+		{"until before start", "FREQ=DAILY;UNTIL=20260201", "2026-03-01", "2026-02-01", nil, nil},
+		{"until ends on a skipped date", "FREQ=WEEKLY;BYDAY=MO;UNTIL=20260315", "2026-03-02", "2026-03-02", []string{"2026-03-09"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrences(t, tt.rrule, tt.start, tt.after, tt.exdates, 3)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("occurrences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNextAcrossDST checks that occurrences keep their time of day in a
+// timezone with DST. The United States changed clocks on 2026-03-08 and
+// 2026-11-01.
+func TestNextAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone database unavailable:", err)
+	}
+
+	tests := []struct {
+		name  string
+		rrule string
+		start string
+		want  []string
+	}{
+		{"daily, spring forward", "FREQ=DAILY", "2026-03-06", []string{"2026-03-07", "2026-03-08", "2026-03-09"}},
+		{"daily, fall back", "FREQ=DAILY", "2026-10-30", []string{"2026-10-31", "2026-11-01", "2026-11-02"}},
+		{"weekly, spring forward", "FREQ=WEEKLY", "2026-03-01", []string{"2026-03-08", "2026-03-15", "2026-03-22"}},
+		{"weekly, fall back", "FREQ=WEEKLY;BYDAY=SA,SU", "2026-10-24", []string{"2026-10-25", "2026-10-31", "2026-11-01"}},
+		{"monthly, spring forward", "FREQ=MONTHLY;BYDAY=2SU", "2026-02-08", []string{"2026-03-08", "2026-04-12", "2026-05-10"}},
+		{"monthly, fall back", "FREQ=MONTHLY;BYDAY=1SU", "2026-10-04", []string{"2026-11-01", "2026-12-06", "2027-01-03"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrences(t, tt.rrule, tt.start, tt.start, nil, 3)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("occurrences = %v, want %v", got, tt.want)
+			}
+
+			// Occurrences are due at the same time of day on both sides
+			// of the change, so their instants are not a multiple of a
+			// day apart.
+			previous := dueAt(t, tt.start, loc)
+			for _, date := range got {
+				due := dueAt(t, date, loc)
+				if due.Hour() != 9 || due.Minute() != 0 || due.Format(dateLayout) != date {
+					t.Errorf("%s is due at %v", date, due)
+				}
+				if !due.After(previous) {
+					t.Errorf("%s is due at %v, before %v", date, due, previous)
+				}
+				previous = due
+			}
+		})
+	}
+
+	// The offset changes within the occurrences of the daily rules
+	spring := occurrences(t, "FREQ=DAILY", "2026-03-07", "2026-03-07", nil, 1)
+	if d := dueAt(t, spring[0], loc).Sub(dueAt(t, "2026-03-07", loc)); d != 23*time.Hour {
+		t.Errorf("spring forward: occurrences %v apart, want 23h", d)
+	}
+	fall := occurrences(t, "FREQ=DAILY", "2026-10-31", "2026-10-31", nil, 1)
+	if d := dueAt(t, fall[0], loc).Sub(dueAt(t, "2026-10-31", loc)); d != 25*time.Hour {
+		t.Errorf("fall back: occurrences %v apart, want 25h", d)
+	}
+}
+
+// dueAt returns the instant of an occurrence at 09:00 in loc, as the
+// reminders apply it.
+func dueAt(t *testing.T, date string, loc *time.Location) time.Time {
+	t.Helper()
+	d, err := time.ParseInLocation(dateLayout, date, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), 9, 0, 0, 0, loc)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, rrule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20260301",
+		"FREQ=DAILY;UNTIL=2026",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=DAILY;BYHOUR=9",
+	} {
+		if _, err := Parse(rrule); err == nil {
+			t.Errorf("Parse(%q) succeeded", rrule)
+		}
+	}
+
+	r, err := Parse("RRULE:freq=weekly;byday=mo,-1fr;wkst=su")
+	if err == nil {
+		t.Errorf("Parse() = %+v, want an error for the numbered BYDAY", r)
+	}
+	r, err = Parse("RRULE:freq=weekly;byday=mo,fr;wkst=su")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rule{Freq: Weekly, Interval: 1, ByDay: []WeekdayNum{{Day: time.Monday}, {Day: time.Friday}}, WeekStart: time.Sunday}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Parse() = %+v, want %+v", r, want)
+	}
+}
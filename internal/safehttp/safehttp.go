@@ -0,0 +1,98 @@
+// Package safehttp provides the HTTP client used to reach URLs supplied by
+// users (calendar feeds, notification channels, AI providers), so that they
+// can't be used to reach the server's own network.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is the number of redirects followed by the clients.
+const maxRedirects = 5
+
+// ErrForbiddenAddress is returned when a URL resolves to an address of the
+// local network.
+var ErrForbiddenAddress = errors.New("address not allowed")
+
+// Ranges not reachable through the public internet that IsPrivate and the
+// other netip predicates don't cover.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+}
+
+// NewClient returns a client that refuses to connect to loopback, private,
+// link-local and other non-public addresses. Addresses are checked once
+// host names are resolved, so that DNS can't point to them, and redirects
+// are checked the same way. Proxies aren't used, the check would apply to
+// the proxy rather than to the target.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: Control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: checkRedirect}
+}
+
+// ValidateURL checks that a URL is an absolute http or https URL, and that
+// its host isn't a forbidden IP address. Host names are checked when
+// connecting.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", raw)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !Allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+// Allowed reports whether an address is public.
+func Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Control refuses connections to addresses that aren't Allowed. It is run
+// with the resolved address when set as the Control of a net.Dialer, for
+// connections made outside of NewClient such as SMTP.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !Allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+	return ValidateURL(req.URL.String())
+}
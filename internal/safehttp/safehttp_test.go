@@ -0,0 +1,103 @@
+package safehttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // Cloud metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := Allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		forbidden bool
+		invalid   bool
+	}{
+		{"https://calendar.example.com/feed.ics", false, false},
+		{"http://93.184.216.34:8080/x", false, false},
+		{"http://localhost/x", false, false}, // Checked when connecting
+		{"http://127.0.0.1/x", true, false},
+		{"http://[::1]:8080/x", true, false},
+		{"http://169.254.169.254/latest/meta-data", true, false},
+		{"ftp://example.com/x", false, true},
+		{"/relative", false, true},
+		{"https://", false, true},
+	}
+	for _, tt := range tests {
+		err := ValidateURL(tt.url)
+		switch {
+		case tt.forbidden && !errors.Is(err, ErrForbiddenAddress):
+			t.Errorf("ValidateURL(%q) = %v, want %v", tt.url, err, ErrForbiddenAddress)
+		case tt.invalid && (err == nil || errors.Is(err, ErrForbiddenAddress)):
+			t.Errorf("ValidateURL(%q) = %v, want an invalid URL", tt.url, err)
+		case !tt.forbidden && !tt.invalid && err != nil:
+			t.Errorf("ValidateURL(%q) = %v", tt.url, err)
+		}
+	}
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+
+	client := NewClient(5 * time.Second)
+	// Resolved by name, so that only the dialer can refuse it
+	u, _ := url.Parse(srv.URL)
+	for _, target := range []string{srv.URL, "http://localhost:" + u.Port()} {
+		resp, err := client.Get(target)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("GET %s succeeded", target)
+		} else if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("GET %s = %v, want %v", target, err, ErrForbiddenAddress)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	public, _ := http.NewRequest(http.MethodGet, "https://example.com/next", nil)
+	local, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/admin", nil)
+	if err := checkRedirect(public, make([]*http.Request, 1)); err != nil {
+		t.Errorf("redirect to a public URL: %v", err)
+	}
+	if err := checkRedirect(local, make([]*http.Request, 1)); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("redirect to a local URL: %v", err)
+	}
+	if err := checkRedirect(public, make([]*http.Request, maxRedirects)); err == nil {
+		t.Error("too many redirects followed")
+	}
+}
@@ -0,0 +1,85 @@
+// Package tags parses and normalizes the tags of widget items.
+//
+// Items are tagged explicitly, or inline with #tag in their text. Tags are
+// case-insensitive: they are stored lowercase, without the '#'. They are
+// made of letters, digits, '_', '-' and '/' (for hierarchies such as
+// #house/garden), and must contain a letter, so that "#1" or "#42" stay
+// plain references.
+package tags
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the maximum length of a tag, in characters.
+const MaxLength = 64
+
+// inline matches #tag at the start of the text or after a space or an
+// opening punctuation, so that URL fragments and Markdown headings ("# Title")
+// aren't tags.
+var inline = regexp.MustCompile(`(?:^|[\s(\[{,;])#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// Normalize returns the canonical form of a tag, or "" if it isn't valid.
+// Spaces become '-', so that labels such as "In review" are tags too.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	tag = strings.Join(strings.Fields(tag), "-")
+	tag = strings.TrimRight(tag, "/-")
+	if tag == "" || len([]rune(tag)) > MaxLength {
+		return ""
+	}
+	hasLetter := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r), r == '_', r == '-', r == '/':
+		default:
+			return ""
+		}
+	}
+	if !hasLetter {
+		return ""
+	}
+	return tag
+}
+
+// Parse returns the inline tags of a text, normalized, in order of first
+// appearance.
+func Parse(text string) []string {
+	var tags []string
+	for _, m := range inline.FindAllStringSubmatch(text, -1) {
+		tags = appendTag(tags, m[1])
+	}
+	return tags
+}
+
+// Merge returns the explicit tags followed by the inline tags of texts,
+// normalized and without duplicates. Invalid explicit tags are dropped.
+func Merge(explicit []string, texts ...string) []string {
+	var tags []string
+	for _, tag := range explicit {
+		tags = appendTag(tags, tag)
+	}
+	for _, text := range texts {
+		for _, tag := range Parse(text) {
+			tags = appendTag(tags, tag)
+		}
+	}
+	return tags
+}
+
+func appendTag(tags []string, tag string) []string {
+	tag = Normalize(tag)
+	if tag == "" {
+		return tags
+	}
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
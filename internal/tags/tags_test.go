@@ -0,0 +1,76 @@
+package tags
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{"work", "work"},
+		{"#Work", "work"},
+		{"  In review ", "in-review"},
+		{"house/garden", "house/garden"},
+		{"house/", "house"},
+		{"Café", "café"},
+		{"v2", "v2"},
+		{"snake_case", "snake_case"},
+		{"#42", ""},
+		{"1/2", ""},
+		{"", ""},
+		{"#", ""},
+		{"c++", ""},
+		{"a.b", ""},
+		{strings.Repeat("a", MaxLength), strings.Repeat("a", MaxLength)},
+		{strings.Repeat("a", MaxLength+1), ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.tag); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"#work call Ana about #Taxes", []string{"work", "taxes"}},
+		{"plant (#house/garden) and #HOUSE/garden", []string{"house/garden"}},
+		{"list: a,#b;#c [#d] {#e}", []string{"b", "c", "d", "e"}},
+		{"# Title\n## Section", nil},
+		{"see https://example.com/page#section", nil},
+		{"issue #42 and word#tag", nil},
+		{"#todo-", []string{"todo"}},
+		{"line\n#next", []string{"next"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		explicit []string
+		texts    []string
+		want     []string
+	}{
+		{"explicit first", []string{"Work"}, []string{"#home and #work"}, []string{"work", "home"}},
+		{"several texts", nil, []string{"#a", "#b #a"}, []string{"a", "b"}},
+		{"invalid explicit tags", []string{"#1", "", "In progress"}, nil, []string{"in-progress"}},
+		{"nothing", nil, []string{"no tags"}, nil},
+	}
+	for _, tt := range tests {
+		if got := Merge(tt.explicit, tt.texts...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Merge() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
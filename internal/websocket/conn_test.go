@@ -0,0 +1,289 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// client is the test side of a connection: it masks the frames it sends,
+// as browsers do.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// serve starts a server upgrading every request, and running handle on
+// the connection. The result of handle is sent on the returned channel.
+func serve(t *testing.T, maxSize int64, handle func(*Conn) error) (*httptest.Server, <-chan error) {
+	t.Helper()
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, maxSize)
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, done
+}
+
+func dial(t *testing.T, srv *httptest.Server) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	// Example of RFC 6455, section 1.3
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return &client{t: t, conn: conn, br: br}
+}
+
+// frame writes a frame with the given first byte (FIN, RSV and opcode),
+// masked unless unmasked is set.
+func (c *client) frame(first byte, payload []byte, unmasked bool) {
+	c.t.Helper()
+	header := []byte{first}
+	maskBit := byte(0x80)
+	if unmasked {
+		maskBit = 0
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	data := append([]byte(nil), payload...)
+	if !unmasked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		header = append(header, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads a frame sent by the server, which must not be masked.
+func (c *client) read() (first byte, payload []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0], payload
+}
+
+// expectClose reads a close frame and returns its code.
+func (c *client) expectClose() int {
+	c.t.Helper()
+	first, payload := c.read()
+	if first != 0x80|opClose || len(payload) < 2 {
+		c.t.Fatalf("got frame %#x %q, want a close frame", first, payload)
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler didn't return")
+		return nil
+	}
+}
+
+func echo(conn *Conn) error {
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteMessage(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	srv, done := serve(t, 1024, echo)
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUpgradeRequired)
+	}
+	if err := wait(t, done); err == nil {
+		t.Error("Upgrade succeeded")
+	}
+}
+
+func TestEchoSizes(t *testing.T) {
+	srv, _ := serve(t, 1<<20, echo)
+	c := dial(t, srv)
+	// Payload lengths of 7 bits, 16 bits and 64 bits
+	for _, n := range []int{0, 5, 125, 126, 1000, 70000} {
+		msg := bytes.Repeat([]byte("x"), n)
+		c.frame(0x80|opText, msg, false)
+		first, payload := c.read()
+		if first != 0x80|opText || !bytes.Equal(payload, msg) {
+			t.Errorf("echo of %d bytes = %#x, %d bytes", n, first, len(payload))
+		}
+	}
+}
+
+func TestFragmentsWithInterleavedPing(t *testing.T) {
+	srv, _ := serve(t, 1024, echo)
+	c := dial(t, srv)
+	c.frame(opText, []byte("Hel"), false)
+	c.frame(0x80|opPing, []byte("are you there"), false)
+	c.frame(opContinuation, []byte("lo, "), false)
+	c.frame(0x80|opContinuation, []byte("world"), false)
+
+	first, payload := c.read()
+	if first != 0x80|opPong || string(payload) != "are you there" {
+		t.Fatalf("got %#x %q, want the pong", first, payload)
+	}
+	first, payload = c.read()
+	if first != 0x80|opText || string(payload) != "Hello, world" {
+		t.Fatalf("got %#x %q, want the joined message", first, payload)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv, done := serve(t, 1024, echo)
+	c := dial(t, srv)
+	c.frame(0x80|opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway), false)
+	if code := c.expectClose(); code != CloseGoingAway {
+		t.Errorf("echoed close code = %d, want %d", code, CloseGoingAway)
+	}
+	if err := wait(t, done); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadMessage() = %v, want ErrClosed", err)
+	}
+}
+
+func TestServerPingAndClose(t *testing.T) {
+	srv, done := serve(t, 1024, func(conn *Conn) error {
+		if err := conn.Ping(); err != nil {
+			return err
+		}
+		if err := conn.Close(CloseNormal, "bye"); err != nil {
+			return err
+		}
+		if err := conn.WriteMessage([]byte("late")); !errors.Is(err, ErrClosed) {
+			return errors.New("write after close succeeded")
+		}
+		return nil
+	})
+	c := dial(t, srv)
+	if first, payload := c.read(); first != 0x80|opPing || len(payload) != 0 {
+		t.Errorf("got %#x %q, want a ping", first, payload)
+	}
+	if code := c.expectClose(); code != CloseNormal {
+		t.Errorf("close code = %d, want %d", code, CloseNormal)
+	}
+	if err := wait(t, done); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(c *client)
+		code int
+	}{
+		{"unmasked frame", func(c *client) { c.frame(0x80|opText, []byte("hi"), true) }, CloseProtocolError},
+		{"RSV bit", func(c *client) { c.frame(0x80|0x40|opText, []byte("hi"), false) }, CloseProtocolError},
+		{"fragmented ping", func(c *client) { c.frame(opPing, []byte("hi"), false) }, CloseProtocolError},
+		{"oversized ping", func(c *client) { c.frame(0x80|opPing, bytes.Repeat([]byte("x"), 126), false) }, CloseProtocolError},
+		{"unknown opcode", func(c *client) { c.frame(0x80|0x3, []byte("hi"), false) }, CloseProtocolError},
+		{"continuation first", func(c *client) { c.frame(0x80|opContinuation, []byte("hi"), false) }, CloseProtocolError},
+		{"new message within fragments", func(c *client) {
+			c.frame(opText, []byte("a"), false)
+			c.frame(0x80|opText, []byte("b"), false)
+		}, CloseProtocolError},
+		{"frame too large", func(c *client) { c.frame(0x80|opText, bytes.Repeat([]byte("x"), 200), false) }, CloseTooLarge},
+		{"message too large", func(c *client) {
+			c.frame(opText, bytes.Repeat([]byte("x"), 60), false)
+			c.frame(0x80|opContinuation, bytes.Repeat([]byte("x"), 60), false)
+		}, CloseTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, done := serve(t, 100, echo)
+			c := dial(t, srv)
+			tt.send(c)
+			if code := c.expectClose(); code != tt.code {
+				t.Errorf("close code = %d, want %d", code, tt.code)
+			}
+			if err := wait(t, done); err == nil || errors.Is(err, ErrClosed) {
+				t.Errorf("ReadMessage() = %v, want a protocol error", err)
+			}
+		})
+	}
+}
+
+func TestHeaderContains(t *testing.T) {
+	h := http.Header{"Connection": {"keep-alive, Upgrade"}}
+	if !headerContains(h, "Connection", "upgrade") || headerContains(h, "Connection", "close") {
+		t.Error("headerContains doesn't match tokens case-insensitively")
+	}
+}
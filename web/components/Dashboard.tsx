@@ -31,6 +31,7 @@ import WikiWidget from "./widgets/WikiWidget";
 interface DashboardProps {
   widgets: WidgetData[];
   onUpdateWidget: (widget: WidgetData) => void;
+  onWidgetRefreshed: (widget: WidgetData) => void;
   onDeleteWidget: (id: string) => void;
   onReorderWidgets: (widgets: WidgetData[]) => void;
   isEditMode: boolean;
@@ -40,6 +41,7 @@ interface DashboardProps {
 const Dashboard: React.FC<DashboardProps> = ({
   widgets,
   onUpdateWidget,
+  onWidgetRefreshed,
   onDeleteWidget,
   onReorderWidgets,
   isEditMode,
@@ -221,6 +223,7 @@ const Dashboard: React.FC<DashboardProps> = ({
         return (
           <div
             key={widget.id}
+            id={`widget-${widget.id}`}
             draggable={isEditMode}
             onDragStart={(e) => handleDragStart(e, index)}
             onDragOver={(e) => handleDragOver(e, index)}
@@ -348,6 +351,7 @@ const Dashboard: React.FC<DashboardProps> = ({
                 <TodoWidget
                   data={widget}
                   onUpdate={(d) => updateWidgetData(widget.id, d)}
+                  onWidgetChanged={onWidgetRefreshed}
                 />
               )}
               {widget.type === WidgetType.NOTE && (
@@ -367,6 +371,7 @@ const Dashboard: React.FC<DashboardProps> = ({
                   allWidgets={widgets}
                   data={widget}
                   onUpdate={(d) => updateWidgetData(widget.id, d)}
+                  onWidgetChanged={onWidgetRefreshed}
                 />
               )}
               {widget.type === WidgetType.KANBAN && (
@@ -379,6 +384,7 @@ const Dashboard: React.FC<DashboardProps> = ({
                 <ReminderWidget
                   data={widget}
                   onUpdate={(d) => updateWidgetData(widget.id, d)}
+                  onWidgetChanged={onWidgetRefreshed}
                 />
               )}
               {widget.type === WidgetType.GYM && (
@@ -1,5 +1,13 @@
 import React, { useState, useRef, useEffect } from "react";
-import { WidgetData, AIConfig, AIProvider, AILanguage } from "../../types";
+import {
+  WidgetData,
+  AIConfig,
+  AIProvider,
+  AILanguage,
+  AIAction,
+  ChatMessage,
+} from "../../types";
+import { api } from "../../services/api";
 import {
   Send,
   Sparkles,
@@ -8,6 +16,9 @@ import {
   X,
   Save,
   Globe,
+  RefreshCw,
+  Trash2,
+  Check,
 } from "lucide-react";
 import { getGeminiInsight } from "../../services/geminiService";
 
@@ -15,12 +26,13 @@ interface AICoachWidgetProps {
   allWidgets: WidgetData[];
   data: WidgetData;
   onUpdate: (updatedData: WidgetData) => void;
+  // Called with widgets changed on the server by a confirmed action
+  onWidgetChanged?: (widget: WidgetData) => void;
 }
 
 const DEFAULT_CONFIG: AIConfig = {
   provider: "gemini",
   model: "gemini-2.5-flash",
-  apiKey: "",
   language: "pt-br",
 };
 
@@ -28,33 +40,71 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
   allWidgets,
   data,
   onUpdate,
+  onWidgetChanged,
 }) => {
   const [input, setInput] = useState("");
   const [loading, setLoading] = useState(false);
+  const [streamingText, setStreamingText] = useState("");
   const [showSettings, setShowSettings] = useState(false);
 
   // Load config from local storage or default
   const [config, setConfig] = useState<AIConfig>(() => {
     const saved = localStorage.getItem("lifehub_ai_config");
     if (saved) {
-      const parsed = JSON.parse(saved);
+      // Keys saved by older versions are moved to the server on next save
+      const { apiKey, ...parsed } = JSON.parse(saved);
       return { ...DEFAULT_CONFIG, ...parsed };
     }
     return DEFAULT_CONFIG;
   });
 
   const [tempConfig, setTempConfig] = useState<AIConfig>(config);
+  const [availableModels, setAvailableModels] = useState<string[]>([]);
+  const [modelsError, setModelsError] = useState("");
   const chatContainerRef = useRef<HTMLDivElement>(null);
 
-  const messages = data.content?.chatHistory || [
-    {
-      role: "model",
-      text:
-        config.language === "pt-br"
-          ? "Olá! Sou seu coach LifeHub. Posso ver suas tarefas e dados de bem-estar. Como posso ajudar hoje?"
-          : "Hi! I'm your LifeHub coach. I can see your tasks and wellness data. How can I help you today?",
-    },
-  ];
+  // History is stored server-side; the widget only keeps the conversation id
+  const conversationId = data.content?.conversationId;
+  const [history, setHistory] = useState<ChatMessage[]>([]);
+  const [hasOlder, setHasOlder] = useState(false);
+
+  useEffect(() => {
+    if (!conversationId) {
+      setHistory([]);
+      setHasOlder(false);
+      return;
+    }
+    api
+      .getAIMessages(conversationId)
+      .then((page) => {
+        setHistory(page.messages);
+        setHasOlder(page.hasMore);
+      })
+      .catch((error) => console.error(error));
+  }, [conversationId]);
+
+  const loadOlder = async () => {
+    if (!conversationId || !history[0]?.id) return;
+    const page = await api.getAIMessages(conversationId, history[0].id);
+    setHistory((current) => [...page.messages, ...current]);
+    setHasOlder(page.hasMore);
+  };
+
+  const clearHistory = async () => {
+    if (!conversationId) return;
+    await api.clearAIConversation(conversationId);
+    setHistory([]);
+    setHasOlder(false);
+  };
+
+  const greeting: ChatMessage = {
+    role: "model",
+    text:
+      config.language === "pt-br"
+        ? "Olá! Sou seu coach LifeHub. Posso ver suas tarefas e dados de bem-estar. Como posso ajudar hoje?"
+        : "Hi! I'm your LifeHub coach. I can see your tasks and wellness data. How can I help you today?",
+  };
+  const messages = history.length > 0 ? history : [greeting];
 
   const scrollToBottom = () => {
     if (chatContainerRef.current) {
@@ -77,12 +127,7 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
 
     if (!textToSend.trim()) return;
 
-    const newHistory = [...messages, { role: "user", text: textToSend }];
-
-    onUpdate({
-      ...data,
-      content: { ...data.content, chatHistory: newHistory as any },
-    });
+    setHistory((current) => [...current, { role: "user", text: textToSend }]);
 
     // Only clear input if we used the input field
     if (!overrideText) {
@@ -91,23 +136,85 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
 
     setLoading(true);
 
-    const responseText = await getGeminiInsight(allWidgets, textToSend, config);
-    const finalHistory = [...newHistory, { role: "model", text: responseText }];
-
-    onUpdate({
-      ...data,
-      content: { ...data.content, chatHistory: finalHistory as any },
-    });
+    const response = await getGeminiInsight(
+      textToSend,
+      config,
+      { conversationId, widgetId: data.id },
+      setStreamingText,
+      (id) => {
+        if (id !== conversationId) {
+          onUpdate({ ...data, content: { ...data.content, conversationId: id } });
+        }
+      }
+    );
+    setStreamingText("");
+    setHistory((current) => [...current, response]);
     setLoading(false);
   };
 
-  const saveSettings = () => {
-    setConfig(tempConfig);
-    localStorage.setItem("lifehub_ai_config", JSON.stringify(tempConfig));
+  const resolveAction = async (
+    action: AIAction,
+    decision: "apply" | "reject"
+  ) => {
+    let updated: AIAction;
+    try {
+      updated = await api.resolveAIAction(action.id, decision);
+    } catch (error) {
+      alert((error as Error).message);
+      return;
+    }
+    setHistory((current) =>
+      current.map((msg) => ({
+        ...msg,
+        actions: msg.actions?.map((a) => (a.id === updated.id ? updated : a)),
+      }))
+    );
+    if (updated.status === "applied") {
+      const widget = await api.getWidgetById(updated.widgetId);
+      if (widget) onWidgetChanged?.(widget);
+    }
+  };
+
+  const saveSettings = async () => {
+    const { apiKey, ...publicConfig } = tempConfig;
+    const isLocal = publicConfig.provider === "openai-compatible";
+    if (apiKey?.trim() || isLocal) {
+      try {
+        await api.saveAIKey(
+          publicConfig.provider,
+          apiKey?.trim() || "",
+          isLocal ? publicConfig.baseUrl?.trim() : undefined
+        );
+      } catch (error) {
+        alert((error as Error).message || "Failed to save the API key.");
+        return;
+      }
+    }
+    setConfig(publicConfig);
+    localStorage.setItem("lifehub_ai_config", JSON.stringify(publicConfig));
     setShowSettings(false);
   };
 
+  // Lists the models of the saved server configuration
+  const loadModels = async () => {
+    setModelsError("");
+    try {
+      if (tempConfig.provider === "openai-compatible") {
+        await api.saveAIKey(
+          tempConfig.provider,
+          tempConfig.apiKey?.trim() || "",
+          tempConfig.baseUrl?.trim()
+        );
+      }
+      setAvailableModels(await api.getAIModels(tempConfig.provider));
+    } catch (error) {
+      setAvailableModels([]);
+      setModelsError((error as Error).message);
+    }
+  };
+
   const getProviderName = (p: AIProvider) => {
+    if (p === "openai-compatible") return "Local AI";
     if (p === "openai") return "GPT";
     if (p === "anthropic") return "Claude";
     return "Gemini";
@@ -117,7 +224,16 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
     <div className="h-full flex flex-col relative">
       {/* Settings Toggle Button - Positioned absolute inside the container */}
       {!showSettings && (
-        <div className="absolute top-0 right-0 z-10">
+        <div className="absolute top-0 right-0 z-10 flex gap-1">
+          {history.length > 0 && (
+            <button
+              onClick={clearHistory}
+              className="p-1.5 text-slate-400 hover:text-red-500 dark:text-slate-500 dark:hover:text-red-400 bg-white/80 dark:bg-slate-900/80 backdrop-blur-sm rounded-lg transition-all hover:bg-slate-100 dark:hover:bg-slate-800 border border-transparent hover:border-slate-200 dark:hover:border-slate-700"
+              title="Clear conversation"
+            >
+              <Trash2 size={16} />
+            </button>
+          )}
           <button
             onClick={() => {
               setTempConfig(config);
@@ -184,7 +300,7 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
               <label className="block text-xs font-medium text-slate-500 dark:text-slate-400 mb-1">
                 Provider
               </label>
-              <div className="grid grid-cols-3 gap-2">
+              <div className="grid grid-cols-2 gap-2">
                 <button
                   onClick={() =>
                     setTempConfig({
@@ -233,6 +349,43 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
                 >
                   Anthropic
                 </button>
+                <button
+                  onClick={() =>
+                    setTempConfig({
+                      ...tempConfig,
+                      provider: "openai-compatible",
+                      model: "",
+                      baseUrl:
+                        tempConfig.baseUrl || "http://localhost:11434/v1",
+                    })
+                  }
+                  className={`py-2 text-xs rounded-md border transition-all ${
+                    tempConfig.provider === "openai-compatible"
+                      ? "bg-slate-100 dark:bg-slate-700/60 border-slate-500 text-slate-800 dark:text-slate-200 font-semibold"
+                      : "border-slate-200 dark:border-slate-700 hover:bg-white dark:hover:bg-slate-700"
+                  }`}
+                  title="Ollama, llama.cpp, LM Studio..."
+                >
+                  Local (OpenAI API)
+                </button>
+              </div>
+            </div>
+
+            {/* Base URL Input (OpenAI-compatible servers) */}
+            {tempConfig.provider === "openai-compatible" && (
+              <div>
+                <label className="block text-xs font-medium text-slate-500 dark:text-slate-400 mb-1">
+                  Server URL
+                </label>
+                <input
+                  type="url"
+                  value={tempConfig.baseUrl || ""}
+                  onChange={(e) =>
+                    setTempConfig({ ...tempConfig, baseUrl: e.target.value })
+                  }
+                  placeholder="http://localhost:11434/v1"
+                  className="w-full text-xs p-2 rounded-md border border-slate-300 dark:border-slate-600 bg-white dark:bg-slate-800 text-slate-800 dark:text-slate-200 focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 outline-none"
+                />
               </div>
             </div>
 
@@ -241,42 +394,73 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
               <label className="block text-xs font-medium text-slate-500 dark:text-slate-400 mb-1">
                 Model
               </label>
-              <select
-                value={tempConfig.model}
-                onChange={(e) =>
-                  setTempConfig({ ...tempConfig, model: e.target.value })
-                }
-                className="w-full text-xs p-2 rounded-md border border-slate-300 dark:border-slate-600 bg-white dark:bg-slate-800 text-slate-800 dark:text-slate-200 focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 outline-none"
-              >
-                {tempConfig.provider === "gemini" && (
-                  <>
-                    <option value="gemini-2.5-flash">Gemini 2.5 Flash</option>
-                    <option value="gemini-2.0-flash-lite-preview-02-05">
-                      Gemini 2.0 Flash Lite
-                    </option>
-                    <option value="gemini-2.0-pro-exp-02-05">
-                      Gemini 2.0 Pro
-                    </option>
-                  </>
-                )}
-                {tempConfig.provider === "openai" && (
-                  <>
-                    <option value="gpt-4o-mini">GPT-4o Mini</option>
-                    <option value="gpt-4o">GPT-4o</option>
-                    <option value="gpt-3.5-turbo">GPT-3.5 Turbo</option>
-                  </>
-                )}
-                {tempConfig.provider === "anthropic" && (
-                  <>
-                    <option value="claude-3-haiku-20240307">
-                      Claude 3 Haiku
-                    </option>
-                    <option value="claude-3-5-sonnet-latest">
-                      Claude 3.5 Sonnet
-                    </option>
-                  </>
-                )}
-              </select>
+              {tempConfig.provider === "openai-compatible" ? (
+                <div className="flex gap-2">
+                  <input
+                    type="text"
+                    list="ai-local-models"
+                    value={tempConfig.model}
+                    onChange={(e) =>
+                      setTempConfig({ ...tempConfig, model: e.target.value })
+                    }
+                    placeholder="llama3.2"
+                    className="flex-1 text-xs p-2 rounded-md border border-slate-300 dark:border-slate-600 bg-white dark:bg-slate-800 text-slate-800 dark:text-slate-200 focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 outline-none"
+                  />
+                  <datalist id="ai-local-models">
+                    {availableModels.map((m) => (
+                      <option key={m} value={m} />
+                    ))}
+                  </datalist>
+                  <button
+                    type="button"
+                    onClick={loadModels}
+                    className="p-2 rounded-md border border-slate-300 dark:border-slate-600 text-slate-500 hover:text-indigo-600 dark:hover:text-indigo-400"
+                    title="Load models from server"
+                  >
+                    <RefreshCw size={14} />
+                  </button>
+                </div>
+              ) : (
+                <select
+                  value={tempConfig.model}
+                  onChange={(e) =>
+                    setTempConfig({ ...tempConfig, model: e.target.value })
+                  }
+                  className="w-full text-xs p-2 rounded-md border border-slate-300 dark:border-slate-600 bg-white dark:bg-slate-800 text-slate-800 dark:text-slate-200 focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 outline-none"
+                >
+                  {tempConfig.provider === "gemini" && (
+                    <>
+                      <option value="gemini-2.5-flash">Gemini 2.5 Flash</option>
+                      <option value="gemini-2.0-flash-lite-preview-02-05">
+                        Gemini 2.0 Flash Lite
+                      </option>
+                      <option value="gemini-2.0-pro-exp-02-05">
+                        Gemini 2.0 Pro
+                      </option>
+                    </>
+                  )}
+                  {tempConfig.provider === "openai" && (
+                    <>
+                      <option value="gpt-4o-mini">GPT-4o Mini</option>
+                      <option value="gpt-4o">GPT-4o</option>
+                      <option value="gpt-3.5-turbo">GPT-3.5 Turbo</option>
+                    </>
+                  )}
+                  {tempConfig.provider === "anthropic" && (
+                    <>
+                      <option value="claude-3-haiku-20240307">
+                        Claude 3 Haiku
+                      </option>
+                      <option value="claude-3-5-sonnet-latest">
+                        Claude 3.5 Sonnet
+                      </option>
+                    </>
+                  )}
+                </select>
+              )}
+              {modelsError && (
+                <p className="mt-1 text-[10px] text-red-500">{modelsError}</p>
+              )}
             </div>
 
             {/* API Key Input */}
@@ -286,14 +470,14 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
               </label>
               <input
                 type="password"
-                value={tempConfig.apiKey}
+                value={tempConfig.apiKey || ""}
                 onChange={(e) =>
                   setTempConfig({ ...tempConfig, apiKey: e.target.value })
                 }
                 placeholder={
-                  tempConfig.provider === "gemini"
-                    ? "Optional (Uses default env key)"
-                    : "sk-..."
+                  tempConfig.provider === "openai-compatible"
+                    ? "Optional for local servers"
+                    : "Stored encrypted on the server"
                 }
                 className="w-full text-xs p-2 rounded-md border border-slate-300 dark:border-slate-600 bg-white dark:bg-slate-800 text-slate-800 dark:text-slate-200 focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 outline-none"
               />
@@ -314,6 +498,16 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
             ref={chatContainerRef}
             className="flex-1 overflow-y-auto custom-scrollbar space-y-3 pr-2 mb-3 pt-6"
           >
+            {hasOlder && (
+              <button
+                onClick={loadOlder}
+                className="w-full text-xs text-slate-400 hover:text-indigo-600 dark:hover:text-indigo-400 py-1"
+              >
+                {config.language === "pt-br"
+                  ? "Carregar mensagens anteriores"
+                  : "Load older messages"}
+              </button>
+            )}
             {messages.map((msg, idx) => (
               <div
                 key={idx}
@@ -329,10 +523,62 @@ const AICoachWidget: React.FC<AICoachWidgetProps> = ({
                   }`}
                 >
                   {msg.text}
+                  {msg.actions?.map((action) => (
+                    <div
+                      key={action.id}
+                      className="mt-2 flex items-center gap-2 text-xs border-t border-slate-200 dark:border-slate-700 pt-2"
+                    >
+                      <span className="flex-1">{action.summary}</span>
+                      {action.status === "proposed" ? (
+                        <>
+                          <button
+                            onClick={() => resolveAction(action, "apply")}
+                            className="p-1 rounded-md text-green-600 hover:bg-green-50 dark:hover:bg-green-900/30"
+                            title={
+                              config.language === "pt-br"
+                                ? "Confirmar"
+                                : "Confirm"
+                            }
+                          >
+                            <Check size={14} />
+                          </button>
+                          <button
+                            onClick={() => resolveAction(action, "reject")}
+                            className="p-1 rounded-md text-red-500 hover:bg-red-50 dark:hover:bg-red-900/30"
+                            title={
+                              config.language === "pt-br"
+                                ? "Recusar"
+                                : "Reject"
+                            }
+                          >
+                            <X size={14} />
+                          </button>
+                        </>
+                      ) : (
+                        <span
+                          className={`italic ${
+                            action.status === "applied"
+                              ? "text-green-600 dark:text-green-400"
+                              : "text-slate-400"
+                          }`}
+                          title={action.error}
+                        >
+                          {action.status}
+                        </span>
+                      )}
+                    </div>
+                  ))}
                 </div>
               </div>
             ))}
-            {loading && (
+            {loading && streamingText && (
+              <div className="flex justify-start">
+                <div className="max-w-[85%] rounded-lg px-3 py-2 text-sm bg-slate-100 dark:bg-slate-800 text-slate-800 dark:text-slate-200 rounded-bl-none">
+                  {streamingText}
+                </div>
+              </div>
+            )}
+            {loading && !streamingText && (
               <div className="flex justify-start">
                 <div className="bg-slate-100 dark:bg-slate-800 rounded-lg px-3 py-2 rounded-bl-none flex items-center gap-2 text-slate-500 dark:text-slate-400 text-sm">
                   <Loader2 size={14} className="animate-spin" />
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { WidgetData, NoteTab } from '../../types';
 import { Plus, X } from 'lucide-react';
+import { useCollabText } from './useCollabText';
 
 interface NoteWidgetProps {
   data: WidgetData;
@@ -26,6 +27,8 @@ const NoteWidget: React.FC<NoteWidgetProps> = ({ data, onUpdate }) => {
   }, [notes, activeTabId]);
 
   const activeNote = notes.find(n => n.id === activeTabId) || notes[0];
+  // Legacy text isn't a tab on the server yet, it's saved with the widget
+  const collab = useCollabText(data.id, data.content?.notes ? activeNote?.id : undefined);
 
   const updateNotes = (newNotes: NoteTab[]) => {
     onUpdate({
@@ -35,6 +38,7 @@ const NoteWidget: React.FC<NoteWidgetProps> = ({ data, onUpdate }) => {
   };
 
   const handleContentChange = (e: React.ChangeEvent<HTMLTextAreaElement>) => {
+    if (collab.edit(e.target.value)) return;
     const newNotes = notes.map(n => 
       n.id === activeTabId ? { ...n, content: e.target.value } : n
     );
@@ -116,10 +120,12 @@ const NoteWidget: React.FC<NoteWidgetProps> = ({ data, onUpdate }) => {
 
       {/* Note Content */}
       <textarea
+        ref={collab.textareaRef}
         className="flex-1 w-full h-full resize-none bg-yellow-50/30 dark:bg-yellow-900/5 p-3 rounded-b-lg text-sm text-slate-700 dark:text-slate-200 placeholder-slate-400 dark:placeholder-slate-500 focus:outline-none focus:ring-0 transition-all custom-scrollbar leading-relaxed"
         placeholder="Type your thoughts here..."
-        value={activeNote?.content || ''}
+        value={(collab.live ? collab.text : activeNote?.content) || ''}
         onChange={handleContentChange}
+        readOnly={data.role === 'viewer' || collab.readOnly}
       />
     </div>
   );
@@ -1,15 +1,24 @@
 import React, { useState } from "react";
 import { WidgetData, ReminderItem } from "../../types";
-import { Plus, Trash2, Calendar, Bell } from "lucide-react";
+import { Plus, Trash2, Calendar, Bell, Repeat, SkipForward } from "lucide-react";
+import { api } from "../../services/api";
+import RepeatSelect, { repeatLabel } from "./RepeatSelect";
 
 interface ReminderWidgetProps {
   data: WidgetData;
   onUpdate: (updatedData: WidgetData) => void;
+  // Called with the widget changed on the server, e.g. by skipping an occurrence
+  onWidgetChanged?: (widget: WidgetData) => void;
 }
 
-const ReminderWidget: React.FC<ReminderWidgetProps> = ({ data, onUpdate }) => {
+const ReminderWidget: React.FC<ReminderWidgetProps> = ({
+  data,
+  onUpdate,
+  onWidgetChanged,
+}) => {
   const [newText, setNewText] = useState("");
   const [newDate, setNewDate] = useState("");
+  const [newRRule, setNewRRule] = useState("");
 
   const reminders = data.content?.reminders || [];
 
@@ -27,6 +36,7 @@ const ReminderWidget: React.FC<ReminderWidgetProps> = ({ data, onUpdate }) => {
       text: newText,
       date: newDate,
       completed: false,
+      ...(newRRule && { rrule: newRRule }),
     };
 
     onUpdate({
@@ -35,6 +45,18 @@ const ReminderWidget: React.FC<ReminderWidgetProps> = ({ data, onUpdate }) => {
     });
     setNewText("");
     setNewDate("");
+    setNewRRule("");
+  };
+
+  // The server moves the reminder to its next occurrence
+  const skipReminder = async (id: string) => {
+    try {
+      await api.skipOccurrence(data.id, "reminders", id);
+      const widget = await api.getWidgetById(data.id);
+      if (widget) onWidgetChanged?.(widget);
+    } catch (error) {
+      console.error("Error skipping reminder:", error);
+    }
   };
 
   const deleteReminder = (id: string) => {
@@ -95,6 +117,8 @@ const ReminderWidget: React.FC<ReminderWidgetProps> = ({ data, onUpdate }) => {
           </div>
         </div>
 
+        <RepeatSelect value={newRRule} onChange={setNewRRule} />
+
         <button
           type="submit"
           className="p-2 bg-indigo-600 text-white rounded-xl hover:bg-indigo-700 transition-colors shadow-sm flex-shrink-0"
@@ -159,15 +183,35 @@ const ReminderWidget: React.FC<ReminderWidgetProps> = ({ data, onUpdate }) => {
                     {item.date}{" "}
                     {isOverdue(item.date) && !item.completed ? "(Overdue)" : ""}
                   </span>
+                  {item.rrule && (
+                    <span
+                      className="flex items-center gap-0.5 text-slate-400"
+                      title={item.rrule}
+                    >
+                      <Repeat size={10} />
+                      {repeatLabel(item.rrule)}
+                    </span>
+                  )}
                 </div>
               </div>
             </div>
-            <button
-              onClick={() => deleteReminder(item.id)}
-              className="text-slate-300 hover:text-red-500 opacity-0 group-hover:opacity-100 transition-all"
-            >
-              <Trash2 size={14} />
-            </button>
+            <div className="flex items-center gap-1 opacity-0 group-hover:opacity-100 transition-all">
+              {item.rrule && !item.completed && (
+                <button
+                  onClick={() => skipReminder(item.id)}
+                  className="text-slate-300 hover:text-indigo-500"
+                  title="Skip this one"
+                >
+                  <SkipForward size={14} />
+                </button>
+              )}
+              <button
+                onClick={() => deleteReminder(item.id)}
+                className="text-slate-300 hover:text-red-500"
+              >
+                <Trash2 size={14} />
+              </button>
+            </div>
           </div>
         ))}
       </div>
@@ -0,0 +1,36 @@
+import React from "react";
+
+// Common RFC 5545 rules; the server supports more through the API
+export const REPEAT_OPTIONS: { label: string; rrule: string }[] = [
+  { label: "No repeat", rrule: "" },
+  { label: "Daily", rrule: "FREQ=DAILY" },
+  { label: "Weekdays", rrule: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR" },
+  { label: "Weekly", rrule: "FREQ=WEEKLY" },
+  { label: "Every 2 weeks", rrule: "FREQ=WEEKLY;INTERVAL=2" },
+  { label: "Monthly", rrule: "FREQ=MONTHLY" },
+];
+
+export const repeatLabel = (rrule?: string) =>
+  REPEAT_OPTIONS.find((o) => o.rrule === rrule)?.label || "Custom";
+
+interface RepeatSelectProps {
+  value: string;
+  onChange: (rrule: string) => void;
+}
+
+const RepeatSelect: React.FC<RepeatSelectProps> = ({ value, onChange }) => (
+  <select
+    value={value}
+    onChange={(e) => onChange(e.target.value)}
+    title="Repeat"
+    className="px-1 py-1 text-xs bg-transparent border border-slate-300 dark:border-slate-600 rounded-lg text-slate-600 dark:text-slate-300 outline-none focus:border-indigo-500"
+  >
+    {REPEAT_OPTIONS.map((o) => (
+      <option key={o.rrule} value={o.rrule}>
+        {o.label}
+      </option>
+    ))}
+  </select>
+);
+
+export default RepeatSelect;
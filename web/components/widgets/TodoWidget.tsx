@@ -1,16 +1,30 @@
 import React, { useState } from 'react';
 import { TodoItem, WidgetData } from '../../types';
-import { Plus, Check, Trash2, Archive, ArchiveRestore } from 'lucide-react';
+import { Plus, Check, Trash2, Archive, ArchiveRestore, Repeat, SkipForward } from 'lucide-react';
+import { api } from '../../services/api';
+import RepeatSelect, { repeatLabel } from './RepeatSelect';
 
 interface TodoWidgetProps {
   data: WidgetData;
   onUpdate: (updatedData: WidgetData) => void;
+  // Called with the widget changed on the server, e.g. by skipping an occurrence
+  onWidgetChanged?: (widget: WidgetData) => void;
 }
 
 type TabType = 'current' | 'archived';
 
-const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate }) => {
+const priorityColors: Record<string, string> = {
+  low: 'text-slate-400',
+  medium: 'text-amber-500',
+  high: 'text-red-500',
+};
+
+// Local date, YYYY-MM-DD
+const today = () => new Date().toLocaleDateString('en-CA');
+
+const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate, onWidgetChanged }) => {
   const [newTodo, setNewTodo] = useState('');
+  const [newRRule, setNewRRule] = useState('');
   const [activeTab, setActiveTab] = useState<TabType>('current');
 
   const todos = data.content?.todos || [];
@@ -23,19 +37,24 @@ const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate }) => {
       id: Date.now().toString(),
       text: newTodo,
       completed: false,
-      archived: false
+      archived: false,
+      // Recurring tasks start today
+      ...(newRRule && { rrule: newRRule, dueDate: today() })
     };
     onUpdate({
       ...data,
       content: { ...data.content, todos: [...todos, newItem] }
     });
     setNewTodo('');
+    setNewRRule('');
     setActiveTab('current'); // Ensure we are looking at where the task goes
   };
 
   const toggleTodo = (id: string) => {
     const newTodos = todos.map(t => 
-      t.id === id ? { ...t, completed: !t.completed } : t
+      t.id === id
+        ? { ...t, completed: !t.completed, completedAt: t.completed ? undefined : new Date().toISOString() }
+        : t
     );
     onUpdate({
       ...data,
@@ -61,6 +80,17 @@ const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate }) => {
     });
   };
 
+  // The server moves the task to its next occurrence
+  const skipTodo = async (id: string) => {
+    try {
+      await api.skipOccurrence(data.id, 'todos', id);
+      const widget = await api.getWidgetById(data.id);
+      if (widget) onWidgetChanged?.(widget);
+    } catch (error) {
+      console.error('Error skipping task:', error);
+    }
+  };
+
   // Filter todos for active view
   const displayTodos = todos.filter(t => {
       if (activeTab === 'archived') return t.archived;
@@ -109,6 +139,7 @@ const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate }) => {
             placeholder="Add new task..."
             className="flex-1 px-3 py-1.5 text-sm bg-transparent border border-slate-300 dark:border-slate-600 rounded-lg text-slate-900 dark:text-white placeholder-slate-400 dark:placeholder-slate-500 focus:outline-none focus:ring-2 focus:ring-indigo-500/20 focus:border-indigo-500 transition-all outline-none"
           />
+          <RepeatSelect value={newRRule} onChange={setNewRRule} />
           <button type="submit" className="p-1.5 bg-indigo-600 text-white rounded-lg hover:bg-indigo-700 transition-colors">
             <Plus size={18} />
           </button>
@@ -134,11 +165,34 @@ const TodoWidget: React.FC<TodoWidgetProps> = ({ data, onUpdate }) => {
                 <span className={`text-sm truncate ${todo.completed ? 'text-slate-400 dark:text-slate-500 line-through' : 'text-slate-700 dark:text-slate-200'}`}>
                   {todo.text}
                 </span>
+                {(todo.dueDate || todo.priority) && (
+                  <span className="text-[10px] text-slate-400 dark:text-slate-500 truncate flex items-center gap-1">
+                    {todo.priority && <span className={priorityColors[todo.priority]}>{todo.priority}</span>}
+                    {todo.priority && todo.dueDate && ' · '}
+                    {todo.dueDate}
+                    {!!todo.rolledOver && ` (+${todo.rolledOver}d)`}
+                    {todo.rrule && (
+                      <span className="flex items-center gap-0.5" title={todo.rrule}>
+                        <Repeat size={10} />
+                        {repeatLabel(todo.rrule)}
+                      </span>
+                    )}
+                  </span>
+                )}
               </div>
             </div>
             
             {/* Actions */}
             <div className="flex items-center gap-1 opacity-0 group-hover:opacity-100 transition-all">
+                {todo.rrule && !todo.completed && (
+                  <button
+                  onClick={() => skipTodo(todo.id)}
+                  className="p-1 text-slate-300 dark:text-slate-600 hover:text-indigo-500 dark:hover:text-indigo-400 hover:bg-slate-100 dark:hover:bg-slate-700 rounded"
+                  title="Skip this one"
+                  >
+                  <SkipForward size={14} />
+                  </button>
+                )}
                 <button 
                 onClick={() => toggleArchive(todo.id)}
                 className="p-1 text-slate-300 dark:text-slate-600 hover:text-indigo-500 dark:hover:text-indigo-400 hover:bg-slate-100 dark:hover:bg-slate-700 rounded"
@@ -11,6 +11,7 @@ import {
   Sparkles,
 } from "lucide-react";
 import Toast, { ToastType } from "../Toast";
+import { useCollabText } from "./useCollabText";
 
 interface WikiWidgetProps {
   data: WidgetData;
@@ -73,6 +74,8 @@ const WikiWidget: React.FC<WikiWidgetProps> = ({
     wikiData.pages.find((p) => p.id === wikiData.activePageId) ||
     wikiData.pages[0];
   const [isPreviewMode, setIsPreviewMode] = useState(false);
+  const collab = useCollabText(data.id, activePage?.id);
+  const content = collab.live ? collab.text : activePage?.content ?? "";
   const [toast, setToast] = useState<{
     message: string;
     type: ToastType;
@@ -265,7 +268,7 @@ const WikiWidget: React.FC<WikiWidgetProps> = ({
           {isPreviewMode ? (
             <div className="absolute inset-0 p-4 overflow-y-auto prose dark:prose-invert max-w-none">
               {/* Simple Markdown Rendering (Placeholder for real markdown lib) */}
-              {activePage.content.split("\n").map((line, i) => {
+              {content.split("\n").map((line, i) => {
                 if (line.startsWith("# "))
                   return (
                     <h1 key={i} className="text-2xl font-bold mb-4">
@@ -294,10 +297,13 @@ const WikiWidget: React.FC<WikiWidgetProps> = ({
             </div>
           ) : (
             <textarea
-              value={activePage.content}
-              onChange={(e) =>
-                handleUpdatePage(activePage.id, { content: e.target.value })
-              }
+              ref={collab.textareaRef}
+              value={content}
+              onChange={(e) => {
+                if (collab.edit(e.target.value)) return;
+                handleUpdatePage(activePage.id, { content: e.target.value });
+              }}
+              readOnly={data.role === "viewer" || collab.readOnly}
               className="w-full h-full p-4 resize-none focus:outline-none bg-transparent text-slate-700 dark:text-slate-300 font-mono text-sm leading-relaxed"
               placeholder="Write your markdown here..."
             />
@@ -0,0 +1,78 @@
+import { RefObject, useEffect, useLayoutEffect, useRef, useState } from "react";
+import { CollabSession } from "../../services/collab";
+
+export interface CollabText {
+  live: boolean; // Edits go to the collaborative session
+  readOnly: boolean;
+  text: string; // Text of the session, while live
+  // Sends an edit, false when it must be saved with the widget instead
+  edit: (text: string) => boolean;
+  textareaRef: RefObject<HTMLTextAreaElement | null>;
+}
+
+// Textarea offsets count UTF-16 units, the session counts code points
+const toCodePoints = (text: string, offset: number) =>
+  Array.from(text.slice(0, offset)).length;
+const toUnits = (text: string, position: number) =>
+  Array.from(text).slice(0, position).join("").length;
+
+// Edits the text of a wiki page or note tab together with the other users
+// of the widget. The cursor of textareaRef stays in place when others edit.
+export const useCollabText = (
+  widgetId: string,
+  itemId: string | undefined,
+): CollabText => {
+  // Item of the live session, which lags behind itemId when it changes
+  const [liveItem, setLiveItem] = useState<string>();
+  const [readOnly, setReadOnly] = useState(false);
+  const [text, setText] = useState("");
+  const session = useRef<CollabSession | undefined>(undefined);
+  const textareaRef = useRef<HTMLTextAreaElement>(null);
+  const selection = useRef<[number, number] | undefined>(undefined);
+
+  useEffect(() => {
+    if (!itemId) return;
+    const s = new CollabSession(widgetId, itemId, {
+      onText: (newText, moved) => {
+        selection.current = moved;
+        setText(newText);
+      },
+      onStatus: (isLive, isReadOnly) => {
+        setLiveItem(isLive ? itemId : undefined);
+        setReadOnly(isReadOnly);
+      },
+      getSelection: () => {
+        const el = textareaRef.current;
+        if (!el || document.activeElement !== el) return undefined;
+        return [
+          toCodePoints(el.value, el.selectionStart),
+          toCodePoints(el.value, el.selectionEnd),
+        ];
+      },
+    });
+    session.current = s;
+    return () => {
+      s.close();
+      session.current = undefined;
+      setLiveItem(undefined);
+    };
+  }, [widgetId, itemId]);
+
+  // Put the cursor back after React replaced the value of the textarea
+  useLayoutEffect(() => {
+    const el = textareaRef.current;
+    const moved = selection.current;
+    selection.current = undefined;
+    if (!el || !moved) return;
+    el.setSelectionRange(toUnits(text, moved[0]), toUnits(text, moved[1]));
+  }, [text]);
+
+  const live = liveItem !== undefined && liveItem === itemId;
+  const edit = (newText: string) => {
+    if (!live || !session.current?.edit(newText)) return false;
+    setText(newText);
+    return true;
+  };
+
+  return { live, readOnly: live && readOnly, text, edit, textareaRef };
+};
@@ -61,6 +61,14 @@ const DashboardPage: React.FC = () => {
       try {
         const data = await api.getWidgets();
         setWidgets(data);
+        // Links to a widget (e.g. from tagged items) open at /#widget-{id}
+        if (window.location.hash.startsWith("#widget-")) {
+          requestAnimationFrame(() =>
+            document
+              .getElementById(window.location.hash.slice(1))
+              ?.scrollIntoView({ behavior: "smooth" }),
+          );
+        }
       } catch (error) {
         if ((error as Error).message === "Unauthorized") {
           handleLogout();
@@ -77,6 +85,35 @@ const DashboardPage: React.FC = () => {
     }
   }, [isAuthenticated]);
 
+  // Apply the changes made on other devices and by collaborators
+  useEffect(() => {
+    if (!isAuthenticated) return;
+
+    return api.subscribeWidgetEvents(async (event) => {
+      if (event.type === "reset") {
+        try {
+          setWidgets(await api.getWidgets());
+        } catch {
+          // Handled by the next load
+        }
+        return;
+      }
+      if (event.type === "widget-deleted") {
+        setWidgets((prev) => prev.filter((w) => w.id !== event.widgetId));
+        return;
+      }
+
+      const widget = await api.getWidgetById(event.widgetId!);
+      if (!widget) return;
+      setWidgets((prev) => {
+        const current = prev.find((w) => w.id === widget.id);
+        if (!current) return [...prev, widget];
+        if ((current.version ?? 0) >= (widget.version ?? 0)) return prev;
+        return prev.map((w) => (w.id === widget.id ? widget : w));
+      });
+    });
+  }, [isAuthenticated]);
+
   // --- Push Notifications ---
   const handleEnableNotifications = async () => {
     if (!("serviceWorker" in navigator) || !("PushManager" in window)) {
@@ -251,13 +288,36 @@ const DashboardPage: React.FC = () => {
   };
 
   const handleUpdateWidget = async (updatedWidget: WidgetData) => {
+    const previous = widgets.find((w) => w.id === updatedWidget.id);
+
     // Optimistic update
     setWidgets((prev) =>
       prev.map((w) => (w.id === updatedWidget.id ? updatedWidget : w))
     );
 
-    // Save to API
-    await api.saveWidget(updatedWidget);
+    // Save to API, reverting the change if it is rejected
+    let content;
+    try {
+      content = await api.saveWidget(updatedWidget);
+    } catch (error) {
+      if (previous) {
+        setWidgets((prev) =>
+          prev.map((w) => (w.id === updatedWidget.id ? previous : w))
+        );
+      }
+      alert((error as Error).message);
+      return;
+    }
+    if (content) {
+      setWidgets((prev) =>
+        prev.map((w) => (w.id === updatedWidget.id ? { ...w, content } : w))
+      );
+    }
+  };
+
+  // Replaces a widget changed on the server, e.g. by an AI Coach action
+  const handleWidgetRefreshed = (widget: WidgetData) => {
+    setWidgets((prev) => prev.map((w) => (w.id === widget.id ? widget : w)));
   };
 
   const handleDeleteWidget = async (id: string) => {
@@ -523,6 +583,7 @@ const DashboardPage: React.FC = () => {
         <Dashboard
           widgets={widgets}
           onUpdateWidget={handleUpdateWidget}
+          onWidgetRefreshed={handleWidgetRefreshed}
           onDeleteWidget={handleDeleteWidget}
           onReorderWidgets={handleReorderWidgets}
           isEditMode={isEditMode}
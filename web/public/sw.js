@@ -1,21 +1,74 @@
+// Push payloads are JSON (see PushPayload in internal/api/push_payload.go).
+// Plain text payloads from older servers are still shown as the body.
+function parsePayload(data) {
+  try {
+    const payload = data.json();
+    if (payload && typeof payload === "object") {
+      return payload;
+    }
+  } catch (e) {
+    // Not JSON, fall through
+  }
+  return { title: "LifeHub", body: data.text() };
+}
+
 self.addEventListener("push", function (event) {
   if (event.data) {
-    const message = event.data.text();
+    const payload = parsePayload(event.data);
     const options = {
-      body: message,
-      icon: "/favicon.svg", // Use our favicon
+      body: payload.body,
+      icon: payload.icon || "/favicon.svg", // Use our favicon
       badge: "/favicon.svg",
       vibrate: [100, 50, 100],
+      tag: payload.tag,
+      renotify: !!payload.tag,
+      actions: (payload.actions || []).map(function (a) {
+        return { action: a.action, title: a.title };
+      }),
       data: {
         dateOfArrival: Date.now(),
         primaryKey: 1,
+        url: payload.url || "/",
+        widgetId: payload.widgetId,
+        actions: payload.actions || [],
       },
     };
-    event.waitUntil(self.registration.showNotification("LifeHub", options));
+    event.waitUntil(
+      self.registration.showNotification(payload.title || "LifeHub", options)
+    );
   }
 });
 
 self.addEventListener("notificationclick", function (event) {
   event.notification.close();
-  event.waitUntil(clients.openWindow("/"));
+
+  const data = event.notification.data || {};
+  let url = data.url || "/";
+  const action = (data.actions || []).find(function (a) {
+    return a.action === event.action;
+  });
+  if (action && action.url) {
+    url = action.url;
+  }
+
+  event.waitUntil(
+    clients
+      .matchAll({ type: "window", includeUncontrolled: true })
+      .then(function (windowClients) {
+        // Reuse an open dashboard tab when possible
+        for (const client of windowClients) {
+          if ("focus" in client) {
+            return client
+              .navigate(url)
+              .then(function (c) {
+                return (c || client).focus();
+              })
+              .catch(function () {
+                return clients.openWindow(url);
+              });
+          }
+        }
+        return clients.openWindow(url);
+      })
+  );
 });
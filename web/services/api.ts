@@ -1,4 +1,18 @@
-import { WidgetData } from "../types";
+import {
+  WidgetData,
+  WidgetEvent,
+  SyncResponse,
+  SyncMutation,
+  SyncResult,
+  SearchResult,
+  TagCount,
+  TaggedItem,
+  WidgetType,
+  AIProvider,
+  AILanguage,
+  AIAction,
+  ChatMessage,
+} from "../types";
 
 const API_BASE_URL = "/api";
 
@@ -24,7 +38,9 @@ export const api = {
     }
   },
 
-  async saveWidget(widget: WidgetData): Promise<void> {
+  // Resolves with the content when the server changed it, e.g. to add the
+  // next occurrence of a recurring todo
+  async saveWidget(widget: WidgetData): Promise<WidgetData["content"] | undefined> {
     try {
       const response = await fetch(`${API_BASE_URL}/widgets/save`, {
         method: "POST",
@@ -35,14 +51,108 @@ export const api = {
         credentials: "include",
       });
       if (!response.ok) {
-        throw new Error("Failed to save widget");
+        // e.g. a card moved to a column at its strict WIP limit
+        throw new Error((await response.text()).trim() || "Failed to save widget");
       }
+      const result = await response.json();
+      return result.content;
     } catch (error) {
       console.error("Error saving widget:", error);
       throw error;
     }
   },
 
+  // Calls onEvent for the widget changes pushed by the server. EventSource
+  // reconnects by itself, resuming after the last event received. Returns
+  // the function closing the stream.
+  subscribeWidgetEvents(onEvent: (event: WidgetEvent) => void): () => void {
+    const source = new EventSource(`${API_BASE_URL}/events`, {
+      withCredentials: true,
+    });
+    const listener = (e: Event) =>
+      onEvent(JSON.parse((e as MessageEvent).data));
+    for (const type of ["widget-changed", "widget-deleted", "reset"]) {
+      source.addEventListener(type, listener);
+    }
+    return () => source.close();
+  },
+
+  async search(
+    q: string,
+    filters: { types?: WidgetType[]; from?: string; to?: string } = {},
+  ): Promise<SearchResult[]> {
+    const params = new URLSearchParams({ q });
+    if (filters.types?.length) params.set("type", filters.types.join(","));
+    if (filters.from) params.set("from", filters.from);
+    if (filters.to) params.set("to", filters.to);
+    const response = await fetch(`${API_BASE_URL}/search?${params}`, {
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error("Failed to search");
+    }
+    return await response.json();
+  },
+
+  async getTags(): Promise<TagCount[]> {
+    const response = await fetch(`${API_BASE_URL}/tags`, {
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error("Failed to fetch tags");
+    }
+    return await response.json();
+  },
+
+  // Items with a tag across widgets; tags may contain "/"
+  async getTaggedItems(tag: string): Promise<TaggedItem[]> {
+    const path = tag.split("/").map(encodeURIComponent).join("/");
+    const response = await fetch(`${API_BASE_URL}/tags/${path}/items`, {
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error("Failed to fetch tagged items");
+    }
+    return await response.json();
+  },
+
+  // Collaborative editing session of a wiki page or note tab
+  openCollab(widgetId: string, itemId: string): WebSocket {
+    const protocol = window.location.protocol === "https:" ? "wss:" : "ws:";
+    return new WebSocket(
+      `${protocol}//${window.location.host}${API_BASE_URL}/collab/${widgetId}/${itemId}`,
+    );
+  },
+
+  // Widgets changed after the cursor of a previous sync, 0 for all
+  async getSyncChanges(since: number): Promise<SyncResponse> {
+    const response = await fetch(`${API_BASE_URL}/sync?since=${since}`, {
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error("Failed to sync");
+    }
+    return await response.json();
+  },
+
+  // Sends the changes queued offline, applied only where the widget is
+  // still at their base version
+  async pushSyncMutations(mutations: SyncMutation[]): Promise<SyncResult[]> {
+    const response = await fetch(`${API_BASE_URL}/sync`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ mutations }),
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error("Failed to sync");
+    }
+    const result = await response.json();
+    return result.results;
+  },
+
   async deleteWidget(id: string): Promise<void> {
     try {
       const response = await fetch(`${API_BASE_URL}/widgets/delete/${id}`, {
@@ -177,4 +287,175 @@ export const api = {
       console.error("Error sending test notification:", error);
     }
   },
+
+  // --- AI ---
+  async saveAIKey(
+    provider: AIProvider,
+    apiKey: string,
+    baseUrl?: string
+  ): Promise<void> {
+    const response = await fetch(`${API_BASE_URL}/ai/keys/${provider}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ apiKey, baseUrl }),
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error((await response.text()).trim() || "Failed to save API key");
+    }
+  },
+
+  async getAIModels(provider: AIProvider): Promise<string[]> {
+    const response = await fetch(
+      `${API_BASE_URL}/ai/models?provider=${provider}`,
+      { credentials: "include" }
+    );
+    if (!response.ok) {
+      throw new Error((await response.text()).trim() || "Failed to list models");
+    }
+    return await response.json();
+  },
+
+  async getAIKeys(): Promise<
+    {
+      provider: AIProvider;
+      baseUrl?: string;
+      hasKey: boolean;
+      updated_at: string;
+    }[]
+  > {
+    try {
+      const response = await fetch(`${API_BASE_URL}/ai/keys`, {
+        credentials: "include",
+      });
+      if (!response.ok) return [];
+      return (await response.json()) || [];
+    } catch (error) {
+      console.error("Error fetching AI keys:", error);
+      return [];
+    }
+  },
+
+  async getAIMessages(
+    conversationId: string,
+    before?: number
+  ): Promise<{ messages: ChatMessage[]; hasMore: boolean }> {
+    const params = before ? `?before=${before}` : "";
+    const response = await fetch(
+      `${API_BASE_URL}/ai/conversations/${conversationId}/messages${params}`,
+      { credentials: "include" }
+    );
+    if (!response.ok) {
+      throw new Error("Failed to fetch messages");
+    }
+    return await response.json();
+  },
+
+  async clearAIConversation(conversationId: string): Promise<void> {
+    const response = await fetch(
+      `${API_BASE_URL}/ai/conversations/${conversationId}/messages`,
+      { method: "DELETE", credentials: "include" }
+    );
+    if (!response.ok) {
+      throw new Error("Failed to clear conversation");
+    }
+  },
+
+  // Confirms (apply) or rejects an action proposed by the AI Coach.
+  async skipOccurrence(
+    widgetId: string,
+    kind: "todos" | "reminders",
+    itemId: string
+  ): Promise<void> {
+    const response = await fetch(
+      `${API_BASE_URL}/widgets/${widgetId}/${kind}/${itemId}/skip`,
+      { method: "POST", credentials: "include" }
+    );
+    if (!response.ok) {
+      throw new Error((await response.text()).trim() || response.statusText);
+    }
+  },
+
+  async resolveAIAction(
+    id: string,
+    decision: "apply" | "reject"
+  ): Promise<AIAction> {
+    const response = await fetch(`${API_BASE_URL}/ai/actions/${id}/${decision}`, {
+      method: "POST",
+      credentials: "include",
+    });
+    if (!response.ok) {
+      throw new Error((await response.text()).trim() || response.statusText);
+    }
+    return await response.json();
+  },
+
+  // Streams the answer (Server-Sent Events) and resolves with the stored
+  // message, including the actions proposed by the model.
+  async streamAIChat(
+    request: {
+      provider: AIProvider;
+      model?: string;
+      language: AILanguage;
+      message: string;
+      conversationId?: string;
+      widgetId?: string;
+    },
+    onDelta?: (text: string) => void,
+    onStart?: (conversationId: string) => void
+  ): Promise<ChatMessage> {
+    const response = await fetch(`${API_BASE_URL}/ai/chat`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(request),
+      credentials: "include",
+    });
+    if (!response.ok || !response.body) {
+      throw new Error((await response.text()).trim() || response.statusText);
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = "";
+    let text = "";
+    let message: ChatMessage | null = null;
+
+    while (true) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let end;
+      while ((end = buffer.indexOf("\n\n")) !== -1) {
+        const frame = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+
+        let event = "message";
+        let data = "";
+        for (const line of frame.split("\n")) {
+          if (line.startsWith("event:")) event = line.slice(6).trim();
+          else if (line.startsWith("data:")) data += line.slice(5).trim();
+        }
+        if (!data) continue;
+
+        const parsed = JSON.parse(data);
+        if (event === "start") {
+          onStart?.(parsed.conversationId);
+        } else if (event === "delta") {
+          text += parsed.text;
+          onDelta?.(text);
+        } else if (event === "done") {
+          message = {
+            id: parsed.messageId,
+            role: "model",
+            text: parsed.text,
+            actions: parsed.actions,
+          };
+        } else if (event === "error") {
+          throw new Error(parsed.error);
+        }
+      }
+    }
+    return message || { role: "model", text };
+  },
 };
@@ -0,0 +1,246 @@
+import { CollabMessage, CollabOp, CollabRun } from "../types";
+import { api } from "./api";
+
+// Replica of a collaborative document (see internal/crdt): every character
+// has an ID "site:counter", deleted characters stay as tombstones. Text is
+// handled in code points, as the server counts characters.
+
+interface CollabID {
+  site: string;
+  counter: number;
+}
+
+interface CollabChar extends CollabID {
+  char: string;
+  deleted: boolean;
+}
+
+// Longest insert the server accepts, in characters
+const MAX_INSERT_LENGTH = 64 * 1024;
+
+const formatID = (id: CollabID) => `${id.site}:${id.counter}`;
+
+const parseID = (s: string): CollabID => {
+  const i = s.lastIndexOf(":");
+  return { site: s.slice(0, i), counter: Number(s.slice(i + 1)) };
+};
+
+// Orders IDs as the server does: higher counters first, then by site
+const newer = (a: CollabID, b: CollabID) =>
+  a.counter !== b.counter ? a.counter > b.counter : a.site > b.site;
+
+export class CollabDoc {
+  private chars: CollabChar[] = [];
+  private clock: number;
+
+  constructor(
+    private site: string,
+    state: CollabRun[],
+    clock: number,
+  ) {
+    for (const run of state) {
+      let { site, counter } = parseID(run.id);
+      for (const char of run.text) {
+        this.chars.push({ site, counter, char, deleted: !!run.deleted });
+        counter++;
+      }
+    }
+    this.clock = clock;
+  }
+
+  text(): string {
+    return this.chars
+      .filter((c) => !c.deleted)
+      .map((c) => c.char)
+      .join("");
+  }
+
+  // Applies an operation of another site. Operations already applied are
+  // ignored.
+  apply(op: CollabOp) {
+    if (op.op === "delete") {
+      const ids = new Set(op.ids);
+      for (const c of this.chars) {
+        if (ids.has(formatID(c))) c.deleted = true;
+      }
+      return;
+    }
+    const id = parseID(op.id!);
+    if (this.indexOf(op.id!) >= 0) return;
+    this.insert(id, op.after ?? "", Array.from(op.text ?? ""));
+  }
+
+  // Returns the operations turning the text into text, applied: the range
+  // between the common prefix and suffix is deleted and inserted again.
+  edit(text: string): CollabOp[] {
+    const visible = this.chars.filter((c) => !c.deleted);
+    const to = Array.from(text);
+    let prefix = 0;
+    while (
+      prefix < visible.length &&
+      prefix < to.length &&
+      visible[prefix].char === to[prefix]
+    ) {
+      prefix++;
+    }
+    let suffix = 0;
+    while (
+      suffix < visible.length - prefix &&
+      suffix < to.length - prefix &&
+      visible[visible.length - 1 - suffix].char === to[to.length - 1 - suffix]
+    ) {
+      suffix++;
+    }
+
+    const ops: CollabOp[] = [];
+    const deleted = visible.slice(prefix, visible.length - suffix);
+    if (deleted.length > 0) {
+      deleted.forEach((c) => (c.deleted = true));
+      ops.push({ op: "delete", ids: deleted.map(formatID) });
+    }
+    let after = prefix > 0 ? formatID(visible[prefix - 1]) : "";
+    let inserted = to.slice(prefix, to.length - suffix);
+    while (inserted.length > 0) {
+      const chunk = inserted.slice(0, MAX_INSERT_LENGTH);
+      const id = { site: this.site, counter: this.clock + 1 };
+      this.insert(id, after, chunk);
+      ops.push({ op: "insert", id: formatID(id), after, text: chunk.join("") });
+      after = formatID({ site: id.site, counter: id.counter + chunk.length - 1 });
+      inserted = inserted.slice(chunk.length);
+    }
+    return ops;
+  }
+
+  // Visible position right after the character id, or of the start for "",
+  // following it when the text around it changes
+  positionAfter(id: string): number {
+    const end = this.indexOf(id);
+    let position = 0;
+    for (let i = 0; i <= end; i++) {
+      if (!this.chars[i].deleted) position++;
+    }
+    return position;
+  }
+
+  // ID of the visible character before a position, "" for the start
+  idBefore(position: number): string {
+    let seen = 0;
+    for (const c of this.chars) {
+      if (c.deleted) continue;
+      if (++seen === position) return formatID(c);
+    }
+    return "";
+  }
+
+  private indexOf(id: string): number {
+    if (id === "") return -1;
+    return this.chars.findIndex((c) => formatID(c) === id);
+  }
+
+  private insert(id: CollabID, after: string, text: string[]) {
+    // Skip the characters inserted concurrently at the same place with
+    // newer IDs, as the server does
+    let i = this.indexOf(after) + 1;
+    while (i < this.chars.length && newer(this.chars[i], id)) i++;
+    const block = text.map((char, j) => ({
+      site: id.site,
+      counter: id.counter + j,
+      char,
+      deleted: false,
+    }));
+    this.chars.splice(i, 0, ...block);
+    this.clock = Math.max(this.clock, id.counter + text.length - 1);
+  }
+}
+
+export interface CollabListener {
+  // The text changed, by the server or another client. selection is the
+  // one returned by getSelection, moved along with the text around it.
+  onText: (text: string, selection?: [number, number]) => void;
+  onStatus: (live: boolean, readOnly: boolean) => void;
+  getSelection?: () => [number, number] | undefined;
+}
+
+// Connection to the collaborative session of a wiki page or note tab. It
+// reconnects on its own, starting over from the server's document; while
+// it isn't live, edits must be saved with the widget instead, the server
+// merges them.
+export class CollabSession {
+  private socket?: WebSocket;
+  private doc?: CollabDoc;
+  private readOnly = false;
+  private retryDelay = 1000;
+  private retryTimer?: ReturnType<typeof setTimeout>;
+  private closed = false;
+
+  constructor(
+    private widgetId: string,
+    private itemId: string,
+    private listener: CollabListener,
+  ) {
+    this.connect();
+  }
+
+  get live(): boolean {
+    return this.doc !== undefined;
+  }
+
+  // Sends an edit of the text. Returns false when the session isn't live or
+  // is read-only, the edit wasn't sent.
+  edit(text: string): boolean {
+    if (!this.doc || this.readOnly) return false;
+    const ops = this.doc.edit(text);
+    if (ops.length > 0) {
+      this.socket!.send(JSON.stringify({ type: "update", ops }));
+    }
+    return true;
+  }
+
+  close() {
+    this.closed = true;
+    clearTimeout(this.retryTimer);
+    this.socket?.close();
+  }
+
+  private update(doc: CollabDoc, ops: CollabOp[]) {
+    const selection = this.listener.getSelection?.();
+    const anchors = selection?.map((position) => doc.idBefore(position));
+    ops.forEach((op) => doc.apply(op));
+    const moved = anchors?.map((id) => doc.positionAfter(id));
+    this.listener.onText(doc.text(), moved as [number, number] | undefined);
+  }
+
+  private connect() {
+    const socket = api.openCollab(this.widgetId, this.itemId);
+    this.socket = socket;
+    socket.onmessage = (e) => {
+      const msg: CollabMessage = JSON.parse(e.data);
+      switch (msg.type) {
+        case "init":
+          this.doc = new CollabDoc(msg.site!, msg.state ?? [], msg.clock ?? 0);
+          this.readOnly = !!msg.readOnly;
+          this.retryDelay = 1000;
+          this.listener.onStatus(true, this.readOnly);
+          this.listener.onText(this.doc.text());
+          break;
+        case "update":
+          if (!this.doc) return;
+          this.update(this.doc, msg.ops ?? []);
+          break;
+        case "error":
+          // The server rejected an edit: start over from its document
+          console.error("Collaboration error:", msg.error);
+          socket.close();
+          break;
+      }
+    };
+    socket.onclose = () => {
+      if (this.socket !== socket) return;
+      this.doc = undefined;
+      this.listener.onStatus(false, false);
+      if (this.closed) return;
+      this.retryTimer = setTimeout(() => this.connect(), this.retryDelay);
+      this.retryDelay = Math.min(this.retryDelay * 2, 30000);
+    };
+  }
+}
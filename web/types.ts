@@ -12,28 +12,65 @@ export enum WidgetType {
   WIKI = "WIKI",
 }
 
-export type AIProvider = "gemini" | "openai" | "anthropic";
+export type AIProvider =
+  | "gemini"
+  | "openai"
+  | "anthropic"
+  | "openai-compatible"; // Ollama, llama.cpp, LM Studio...
 export type AILanguage = "pt-br" | "en-us";
 
 export interface AIConfig {
   provider: AIProvider;
-  apiKey: string;
+  apiKey?: string; // Only typed in settings; stored encrypted on the server
+  baseUrl?: string; // OpenAI-compatible servers, e.g. http://localhost:11434/v1
   model: string;
   language: AILanguage;
 }
 
-export interface TodoItem {
+export interface ChatMessage {
+  id?: number; // Set once stored on the server
+  role: "user" | "model";
+  text: string;
+  actions?: AIAction[];
+}
+
+// A widget change proposed by the AI Coach, applied once confirmed
+export interface AIAction {
+  id: string;
+  widgetId: string;
+  tool: string;
+  summary: string;
+  status: "proposed" | "applying" | "applied" | "rejected" | "failed";
+  error?: string;
+}
+
+// RFC 5545 recurrence of a todo or reminder. Completing the current
+// occurrence makes the server add the next one.
+export interface Recurrence {
+  rrule?: string; // e.g. FREQ=WEEKLY;BYDAY=MO,WE
+  seriesId?: string;
+  seriesStart?: string; // YYYY-MM-DD
+  exdates?: string[]; // Skipped occurrences
+}
+
+export interface TodoItem extends Recurrence {
   id: string;
   text: string;
   completed: boolean;
   archived?: boolean; // Replaces date logic
+  priority?: 'low' | 'medium' | 'high';
+  dueDate?: string; // YYYY-MM-DD, moved to today by the daily rollover when overdue
+  completedAt?: string; // ISO timestamp
+  rolledOver?: number; // Days carried over past the due date
+  tags?: string[]; // Explicit tags, besides the #tags of the text
 }
 
-export interface ReminderItem {
+export interface ReminderItem extends Recurrence {
   id: string;
   text: string;
   date: string; // ISO date string YYYY-MM-DD
   completed: boolean;
+  tags?: string[]; // Explicit tags, besides the #tags of the text
 }
 
 export interface LinkItem {
@@ -42,21 +79,35 @@ export interface LinkItem {
   url: string;
 }
 
+export interface KanbanChecklistItem {
+  id: string;
+  text: string;
+  done: boolean;
+}
+
 export interface KanbanItem {
   id: string;
   content: string;
+  description?: string;
+  labels?: string[]; // Also the tags of the card
+  dueDate?: string; // YYYY-MM-DD
+  checklist?: KanbanChecklistItem[];
+  assignee?: string;
 }
 
 export interface KanbanColumn {
   id: string;
   title: string;
   items: KanbanItem[];
+  wipLimit?: number;
+  wipStrict?: boolean;
 }
 
 export interface NoteTab {
   id: string;
   title: string;
   content: string;
+  tags?: string[]; // Explicit tags, besides the #tags of the content
 }
 
 export interface WellnessRecord {
@@ -149,6 +200,7 @@ export interface WikiPage {
   publicId?: string; // UUID for public access
   author?: string;
   date?: string;
+  tags?: string[]; // Explicit tags, besides the #tags of the content
 }
 
 export interface WikiData {
@@ -156,20 +208,123 @@ export interface WikiData {
   activePageId?: string;
 }
 
+export interface WidgetShare {
+  userId: number;
+  username: string;
+  role: 'viewer' | 'editor';
+  created_at: string;
+}
+
+// Pushed by GET /api/events when a widget changes on another device or is
+// changed by a collaborator. On reset, events were missed: reload all widgets.
+export interface WidgetEvent {
+  id: number;
+  type: "widget-changed" | "widget-deleted" | "reset";
+  widgetId?: string;
+  version?: number;
+}
+
+// Delta sync (GET/POST /api/sync)
+export interface SyncChange {
+  id: string;
+  deleted: boolean;
+  widget?: WidgetData;
+}
+
+export interface SyncResponse {
+  cursor: number;
+  changes: SyncChange[];
+  more: boolean;
+}
+
+export interface SyncMutation {
+  id: string;
+  op: "save" | "delete";
+  baseVersion: number; // 0 for widgets created offline
+  widget?: WidgetData;
+}
+
+export interface SyncResult {
+  id: string;
+  status: "accepted" | "conflict" | "rejected";
+  version?: number;
+  widget?: WidgetData; // Server copy on conflict
+  error?: string;
+}
+
+// Collaborative editing (WebSocket /api/collab/{widgetId}/{itemId})
+export interface CollabOp {
+  op: "insert" | "delete";
+  id?: string; // "site:counter" of the first inserted character
+  after?: string; // Empty for the start of the document
+  text?: string;
+  ids?: string[];
+}
+
+export interface CollabRun {
+  id: string;
+  text: string;
+  deleted?: boolean;
+}
+
+export interface CollabMessage {
+  type: "init" | "update" | "error";
+  site?: string;
+  clock?: number;
+  state?: CollabRun[];
+  readOnly?: boolean;
+  ops?: CollabOp[];
+  error?: string;
+}
+
+// Full-text search (GET /api/search). title and snippet are HTML with
+// the matches in <mark> tags.
+export interface SearchResult {
+  widgetId: string;
+  widgetType: WidgetType;
+  widgetTitle: string;
+  itemId?: string;
+  title?: string;
+  snippet: string;
+  rank: number;
+  updated_at: string;
+}
+
+// Tags (GET /api/tags, GET /api/tags/{tag}/items)
+export interface TagCount {
+  tag: string;
+  count: number;
+}
+
+export interface TaggedItem {
+  widgetId: string;
+  widgetType: WidgetType;
+  widgetTitle: string;
+  itemId?: string;
+  title: string;
+  url: string; // Dashboard anchor of the widget
+}
+
 export interface WidgetData {
   id: string;
   type: WidgetType;
   title: string;
   cols?: number; // Number of grid columns to span (default 1)
   isActive?: boolean;
+  version?: number; // Incremented by the server on every write
+  role?: 'viewer' | 'editor'; // Set on widgets shared with the user
+  owner?: string; // Username of the owner of a shared widget
   // Dynamic content based on type
   content?: {
     todos?: TodoItem[];
+    rolloverDate?: string; // Deprecated: the server keeps the rollover date
     // Deprecated single text string, kept for migration
     text?: string;
     notes?: NoteTab[];
     wellness?: WellnessData;
-    chatHistory?: { role: "user" | "model"; text: string }[];
+    // Deprecated: history is stored server-side, see conversationId
+    chatHistory?: ChatMessage[];
+    conversationId?: string;
     kanban?: KanbanColumn[];
     reminders?: ReminderItem[];
     gym?: GymData;
@@ -13,6 +13,7 @@ export default defineConfig(({ mode }) => {
           target: "http://localhost:8080",
           changeOrigin: true,
           secure: false,
+          ws: true,
         },
       },
     },